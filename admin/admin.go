@@ -1,62 +1,151 @@
 package admin
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
+	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"thaimaster2d/appconfig"
+	"thaimaster2d/appuser"
+	"thaimaster2d/events"
+	"thaimaster2d/live"
+	"thaimaster2d/media"
+	"thaimaster2d/points"
+	"thaimaster2d/push"
+	"thaimaster2d/storage"
+	"thaimaster2d/threed"
+	"thaimaster2d/webhook"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-var db *sql.DB
+// Handler serves the admin pages, image uploads and image serving
+type Handler struct {
+	threeds     threed.ThreeDRepository
+	appConfig   appconfig.AppConfigRepository
+	flags       appconfig.FlagRepository
+	maintenance *appconfig.MaintenanceScheduler
+	library     *media.Library
+	store       storage.Backend
+	location    *time.Location
+	webhooks    *webhook.Dispatcher
+	push        *push.Dispatcher
+	users       *appuser.Service
+	points      *points.Service
+}
 
-// InitDB initializes the database connection for admin
-func InitDB(database *sql.DB) {
-	db = database
+// NewHandler creates an admin handler. location is the timezone used for
+// default dates in admin forms.
+func NewHandler(threeds threed.ThreeDRepository, appConfig appconfig.AppConfigRepository,
+	flags appconfig.FlagRepository, maintenance *appconfig.MaintenanceScheduler, library *media.Library,
+	store storage.Backend, location *time.Location, webhooks *webhook.Dispatcher, push *push.Dispatcher,
+	users *appuser.Service, points *points.Service) *Handler {
+	if location == nil {
+		location = time.Local
+	}
+	return &Handler{
+		threeds:     threeds,
+		appConfig:   appConfig,
+		flags:       flags,
+		maintenance: maintenance,
+		library:     library,
+		store:       store,
+		location:    location,
+		webhooks:    webhooks,
+		push:        push,
+		users:       users,
+		points:      points,
+	}
+}
+
+// today returns the current date in the configured timezone
+func (h *Handler) today() string {
+	return time.Now().In(h.location).Format("2006-01-02")
 }
 
 // AdminDashboardHandler renders the admin dashboard home
-func AdminDashboardHandler(c *gin.Context) {
+func (h *Handler) AdminDashboardHandler(c *gin.Context) {
+	feed := live.Feed()
+	var staleSince string
+	if feed.Stale {
+		staleSince = feed.StaleSince.In(h.location).Format("15:04:05 02/01/2006")
+	}
 	c.HTML(http.StatusOK, "dashboard.html", gin.H{
-		"title": "Admin Dashboard - ThaiMaster2D",
+		"title":          "Admin Dashboard - ThaiMaster2D",
+		"FeedStale":      feed.Stale,
+		"FeedStaleSince": staleSince,
+		"FeedLastUpdate": feed.LastUpdate.In(h.location).Format("15:04:05 02/01/2006"),
 	})
 }
 
+// FeedersPageHandler renders the feeder status and draw result consensus
+func (h *Handler) FeedersPageHandler(c *gin.Context) {
+	c.HTML(http.StatusOK, "feeders.html", gin.H{
+		"title":     "Feeders - Admin",
+		"Consensus": live.FeederConsensus(),
+		"Location":  h.location,
+		"Message":   c.Query("message"),
+	})
+}
+
+// ResolveDrawHandler finalizes a draw with the result picked by the admin
+func (h *Handler) ResolveDrawHandler(c *gin.Context) {
+	draw := c.PostForm("draw")
+	feeder := c.PostForm("feeder")
+
+	if err := live.ResolveDraw(c.Request.Context(), draw, feeder); err != nil {
+		c.Error(err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, live.ErrNoProposal) {
+			status = http.StatusBadRequest
+		}
+		c.HTML(status, "feeders.html", gin.H{
+			"title":     "Feeders - Admin",
+			"Consensus": live.FeederConsensus(),
+			"Location":  h.location,
+			"Error":     err.Error(),
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/feeders?message="+url.QueryEscape("The "+draw+" result from "+feeder+" is now final"))
+}
+
 // ManageGiftsPageHandler renders the gifts management page
-func ManageGiftsPageHandler(c *gin.Context) {
+func (h *Handler) ManageGiftsPageHandler(c *gin.Context) {
 	c.HTML(http.StatusOK, "manage_gifts.html", gin.H{
 		"title": "Manage Gifts - Admin",
 	})
 }
 
 // ManageSlidersPageHandler renders the sliders management page
-func ManageSlidersPageHandler(c *gin.Context) {
+func (h *Handler) ManageSlidersPageHandler(c *gin.Context) {
 	c.HTML(http.StatusOK, "manage_sliders.html", gin.H{
 		"title": "Manage Sliders - Admin",
 	})
 }
 
 // CreateGiftPageHandler renders the create gift form
-func CreateGiftPageHandler(c *gin.Context) {
+func (h *Handler) CreateGiftPageHandler(c *gin.Context) {
 	c.HTML(http.StatusOK, "create_gift.html", gin.H{
 		"title": "Create Gift - Admin",
 	})
 }
 
 // CreateSliderPageHandler renders the create slider form
-func CreateSliderPageHandler(c *gin.Context) {
+func (h *Handler) CreateSliderPageHandler(c *gin.Context) {
 	c.HTML(http.StatusOK, "create_slider.html", gin.H{
 		"title": "Create Slider - Admin",
 	})
 }
 
 // EditGiftPageHandler renders the edit gift form
-func EditGiftPageHandler(c *gin.Context) {
+func (h *Handler) EditGiftPageHandler(c *gin.Context) {
 	id := c.Param("id")
 	c.HTML(http.StatusOK, "edit_gift.html", gin.H{
 		"title": "Edit Gift - Admin",
@@ -65,7 +154,7 @@ func EditGiftPageHandler(c *gin.Context) {
 }
 
 // EditSliderPageHandler renders the edit slider form
-func EditSliderPageHandler(c *gin.Context) {
+func (h *Handler) EditSliderPageHandler(c *gin.Context) {
 	id := c.Param("id")
 	c.HTML(http.StatusOK, "edit_slider.html", gin.H{
 		"title": "Edit Slider - Admin",
@@ -73,74 +162,8 @@ func EditSliderPageHandler(c *gin.Context) {
 	})
 }
 
-// GetGiftByIDHandler returns a single gift by ID
-func GetGiftByIDHandler(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
-		return
-	}
-
-	query := `
-		SELECT id, name, image_link, type, description, points, stock, is_active, created_at
-		FROM gifts WHERE id = $1
-	`
-	var gift struct {
-		ID          int    `json:"id"`
-		Name        string `json:"name"`
-		ImageLink   string `json:"image_link"`
-		Type        string `json:"type"`
-		Description string `json:"description"`
-		Points      int    `json:"points"`
-		Stock       int    `json:"stock"`
-		IsActive    bool   `json:"is_active"`
-		CreatedAt   string `json:"created_at"`
-	}
-
-	err = db.QueryRow(query, id).Scan(&gift.ID, &gift.Name, &gift.ImageLink,
-		&gift.Type, &gift.Description, &gift.Points, &gift.Stock, &gift.IsActive, &gift.CreatedAt)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Gift not found"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gift)
-}
-
-// GetSliderByIDHandler returns a single slider by ID
-func GetSliderByIDHandler(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
-		return
-	}
-
-	query := `
-		SELECT id, image_link, forward_link, title, order_num, is_active, created_at
-		FROM sliders WHERE id = $1
-	`
-	var slider struct {
-		ID          int    `json:"id"`
-		ImageLink   string `json:"image_link"`
-		ForwardLink string `json:"forward_link"`
-		Title       string `json:"title"`
-		Order       int    `json:"order"`
-		IsActive    bool   `json:"is_active"`
-		CreatedAt   string `json:"created_at"`
-	}
-
-	err = db.QueryRow(query, id).Scan(&slider.ID, &slider.ImageLink, &slider.ForwardLink,
-		&slider.Title, &slider.Order, &slider.IsActive, &slider.CreatedAt)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Slider not found"})
-		return
-	}
-
-	c.JSON(http.StatusOK, slider)
-}
-
 // UploadImageHandler handles image uploads and returns the file path
-func UploadImageHandler(c *gin.Context) {
+func (h *Handler) UploadImageHandler(c *gin.Context) {
 	// Get the file from form data
 	file, err := c.FormFile("image")
 	if err != nil {
@@ -149,68 +172,65 @@ func UploadImageHandler(c *gin.Context) {
 	}
 
 	// Validate file type
-	ext := filepath.Ext(file.Filename)
+	ext := strings.ToLower(filepath.Ext(file.Filename))
 	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".gif" && ext != ".webp" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Only jpg, png, gif, webp allowed"})
 		return
 	}
 
-	// Create uploads directory if not exists
-	uploadsDir := "uploads"
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create uploads directory"})
-		return
-	}
-
-	// Generate unique filename using timestamp
-	timestamp := time.Now().Unix()
-	filename := fmt.Sprintf("%d_%s", timestamp, filepath.Base(file.Filename))
-	filepath := filepath.Join(uploadsDir, filename)
-
-	// Save the file
-	if err := c.SaveUploadedFile(file, filepath); err != nil {
+	// Save the file, reusing an identical upload if one exists
+	stored, reused, err := h.library.SaveUpload(c.Request.Context(), file)
+	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
 		return
 	}
 
-	// Get the host from the request to build full URL
-	// Always use HTTPS since we're behind Cloudflare
-	scheme := "https"
-	host := c.Request.Host
-	
-	// If host has port number, remove it (Cloudflare handles the port)
-	if strings.Contains(host, ":") {
-		host = strings.Split(host, ":")[0]
-	}
-
-	// Return the full image URL via API endpoint (not static /uploads)
-	imageURL := fmt.Sprintf("%s://%s/api/images/%s", scheme, host, filename)
+	// The database stores the media key, clients get the resolved URL
 	c.JSON(http.StatusOK, gin.H{
 		"success":   true,
-		"image_url": imageURL,
-		"filename":  filename,
+		"image_url": media.ResolveURL(stored.Filename),
+		"key":       stored.Filename,
+		"filename":  stored.Filename,
+		"reused":    reused,
 	})
 }
 
 // DeleteImageHandler deletes an uploaded image file
-func DeleteImageHandler(c *gin.Context) {
+func (h *Handler) DeleteImageHandler(c *gin.Context) {
 	filename := c.Param("filename")
 	if filename == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Filename required"})
 		return
 	}
 
-	// Construct file path
-	filepath := filepath.Join("uploads", filename)
-
 	// Check if file exists
-	if _, err := os.Stat(filepath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	filename = filepath.Base(filename)
+	if _, err := h.store.Stat(c.Request.Context(), filename); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		} else {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check image"})
+		}
+		return
+	}
+
+	// Uploads are shared between records, so refuse to delete one still in use
+	counts, err := h.library.ReferenceCounts()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check image references"})
+		return
+	}
+	if n := counts[filename]; n > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Image is still used by %d item(s)", n)})
 		return
 	}
 
 	// Delete the file
-	if err := os.Remove(filepath); err != nil {
+	if err := h.library.DeleteMedia(c.Request.Context(), filename); err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete image"})
 		return
 	}
@@ -218,39 +238,24 @@ func DeleteImageHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Image deleted"})
 }
 
+// MediaLibraryPageHandler renders the media library page
+func (h *Handler) MediaLibraryPageHandler(c *gin.Context) {
+	c.HTML(http.StatusOK, "media_library.html", gin.H{
+		"title": "Media Library - Admin",
+		"Pick":  c.Query("pick") != "",
+	})
+}
+
 // ManageThreeDPageHandler renders the 3D results management page
-func ManageThreeDPageHandler(c *gin.Context) {
-	rows, err := db.Query(`
-		SELECT id, date, result, created_at, updated_at 
-		FROM threed 
-		ORDER BY date DESC
-	`)
+func (h *Handler) ManageThreeDPageHandler(c *gin.Context) {
+	results, err := h.threeds.List()
 	if err != nil {
+		c.Error(err)
 		c.HTML(http.StatusInternalServerError, "manage_threed.html", gin.H{
 			"Error": "Failed to fetch 3D results",
 		})
 		return
 	}
-	defer rows.Close()
-
-	var results []map[string]interface{}
-	for rows.Next() {
-		var id int
-		var date, result string
-		var createdAt, updatedAt time.Time
-
-		if err := rows.Scan(&id, &date, &result, &createdAt, &updatedAt); err != nil {
-			continue
-		}
-
-		results = append(results, map[string]interface{}{
-			"ID":        id,
-			"Date":      date,
-			"Result":    result,
-			"CreatedAt": createdAt,
-			"UpdatedAt": updatedAt,
-		})
-	}
 
 	c.HTML(http.StatusOK, "manage_threed.html", gin.H{
 		"title":   "Manage 3D Results - Admin",
@@ -259,22 +264,22 @@ func ManageThreeDPageHandler(c *gin.Context) {
 }
 
 // ManagePaperPageHandler renders the paper management page
-func ManagePaperPageHandler(c *gin.Context) {
+func (h *Handler) ManagePaperPageHandler(c *gin.Context) {
 	c.HTML(http.StatusOK, "manage_paper.html", gin.H{
 		"title": "Manage Paper - Admin",
 	})
 }
 
 // CreateThreeDPageHandler renders the create 3D result form
-func CreateThreeDPageHandler(c *gin.Context) {
+func (h *Handler) CreateThreeDPageHandler(c *gin.Context) {
 	c.HTML(http.StatusOK, "create_threed.html", gin.H{
 		"title": "Create 3D Result - Admin",
-		"Today": time.Now().Format("2006-01-02"),
+		"Today": h.today(),
 	})
 }
 
 // CreateThreeDHandler handles creating a new 3D result
-func CreateThreeDHandler(c *gin.Context) {
+func (h *Handler) CreateThreeDHandler(c *gin.Context) {
 	date := c.PostForm("date")
 	result := c.PostForm("result")
 
@@ -282,7 +287,7 @@ func CreateThreeDHandler(c *gin.Context) {
 	if date == "" || result == "" {
 		c.HTML(http.StatusBadRequest, "create_threed.html", gin.H{
 			"Error": "All fields are required",
-			"Today": time.Now().Format("2006-01-02"),
+			"Today": h.today(),
 		})
 		return
 	}
@@ -290,30 +295,28 @@ func CreateThreeDHandler(c *gin.Context) {
 	if len(result) != 3 {
 		c.HTML(http.StatusBadRequest, "create_threed.html", gin.H{
 			"Error": "Result must be exactly 3 digits",
-			"Today": time.Now().Format("2006-01-02"),
+			"Today": h.today(),
 		})
 		return
 	}
 
 	// Insert into database
-	query := `
-		INSERT INTO threed (date, result, created_at, updated_at) 
-		VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-	`
-	_, err := db.Exec(query, date, result)
+	created, err := h.threeds.Create(date, result)
 	if err != nil {
+		c.Error(err)
 		c.HTML(http.StatusInternalServerError, "create_threed.html", gin.H{
 			"Error": "Failed to create result. Date might already exist.",
-			"Today": time.Now().Format("2006-01-02"),
+			"Today": h.today(),
 		})
 		return
 	}
 
+	events.Publish(c.Request.Context(), events.ThreeDCreated, created)
 	c.Redirect(http.StatusFound, "/admin/threed?message=Result created successfully")
 }
 
 // EditThreeDPageHandler renders the edit 3D result form
-func EditThreeDPageHandler(c *gin.Context) {
+func (h *Handler) EditThreeDPageHandler(c *gin.Context) {
 	idStr := c.Query("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -321,24 +324,12 @@ func EditThreeDPageHandler(c *gin.Context) {
 		return
 	}
 
-	var result struct {
-		ID        int
-		Date      string
-		Result    string
-		CreatedAt time.Time
-		UpdatedAt time.Time
-	}
-	var date time.Time
-
-	err = db.QueryRow("SELECT id, date, result, created_at, updated_at FROM threed WHERE id = $1", id).
-		Scan(&result.ID, &date, &result.Result, &result.CreatedAt, &result.UpdatedAt)
+	result, err := h.threeds.Get(id)
 	if err != nil {
 		c.Redirect(http.StatusFound, "/admin/threed")
 		return
 	}
 
-	result.Date = date.Format("2006-01-02")
-
 	c.HTML(http.StatusOK, "edit_threed.html", gin.H{
 		"title":  "Edit 3D Result - Admin",
 		"Result": result,
@@ -346,7 +337,7 @@ func EditThreeDPageHandler(c *gin.Context) {
 }
 
 // EditThreeDHandler handles updating a 3D result
-func EditThreeDHandler(c *gin.Context) {
+func (h *Handler) EditThreeDHandler(c *gin.Context) {
 	idStr := c.PostForm("id")
 	result := c.PostForm("result")
 
@@ -363,20 +354,21 @@ func EditThreeDHandler(c *gin.Context) {
 		return
 	}
 
-	query := `UPDATE threed SET result = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
-	_, err = db.Exec(query, result, id)
+	updated, err := h.threeds.Update(id, result)
 	if err != nil {
+		c.Error(err)
 		c.HTML(http.StatusInternalServerError, "edit_threed.html", gin.H{
 			"Error": "Failed to update result",
 		})
 		return
 	}
 
+	events.Publish(c.Request.Context(), events.ThreeDUpdated, updated)
 	c.Redirect(http.StatusFound, "/admin/threed?message=Result updated successfully")
 }
 
 // DeleteThreeDHandler handles deleting a 3D result
-func DeleteThreeDHandler(c *gin.Context) {
+func (h *Handler) DeleteThreeDHandler(c *gin.Context) {
 	idStr := c.PostForm("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -384,7 +376,7 @@ func DeleteThreeDHandler(c *gin.Context) {
 		return
 	}
 
-	_, err = db.Exec("DELETE FROM threed WHERE id = $1", id)
+	err = h.threeds.Delete(id)
 	if err != nil {
 		c.Redirect(http.StatusFound, "/admin/threed?message=Failed to delete result")
 		return
@@ -393,62 +385,67 @@ func DeleteThreeDHandler(c *gin.Context) {
 	c.Redirect(http.StatusFound, "/admin/threed?message=Result deleted successfully")
 }
 
-// AppConfigPageHandler renders the app config page
-func AppConfigPageHandler(c *gin.Context) {
-	var config struct {
-		ID                 int
-		LatestVersion      string
-		MinimumVersion     string
-		UpdateRequired     bool
-		UpdateURL          string
-		UpdateMessage      string
-		MaintenanceMode    bool
-		MaintenanceMessage string
-		ForceUpdate        bool
-		AppEnabled         bool
-		CreatedAt          time.Time
-		UpdatedAt          time.Time
-	}
-
-	query := `
-	SELECT 
-		id, latest_version, minimum_version, update_required, 
-		update_url, update_message, maintenance_mode, maintenance_message,
-		force_update, app_enabled, created_at, updated_at
-	FROM app_config 
-	ORDER BY id DESC 
-	LIMIT 1
-	`
-	err := db.QueryRow(query).Scan(
-		&config.ID,
-		&config.LatestVersion,
-		&config.MinimumVersion,
-		&config.UpdateRequired,
-		&config.UpdateURL,
-		&config.UpdateMessage,
-		&config.MaintenanceMode,
-		&config.MaintenanceMessage,
-		&config.ForceUpdate,
-		&config.AppEnabled,
-		&config.CreatedAt,
-		&config.UpdatedAt,
-	)
-
-	if err != nil && err != sql.ErrNoRows {
+// configHistorySize is how many config versions the app config page shows
+const configHistorySize = 20
+
+// configVersion is a saved config with what it changed from the version
+// before it
+type configVersion struct {
+	appconfig.AppConfig
+	Changes []string
+	// First is set for the oldest version, which has no changes
+	First bool
+}
+
+// AppConfigPageHandler renders the app config page with the latest
+// versions
+func (h *Handler) AppConfigPageHandler(c *gin.Context) {
+	config, err := h.appConfig.Get()
+	if err != nil {
+		c.Error(err)
 		c.HTML(http.StatusInternalServerError, "app_config.html", gin.H{
 			"error": "Failed to load config",
 		})
 		return
 	}
+	history, err := h.appConfig.History(configHistorySize + 1)
+	if err != nil {
+		c.Error(err)
+		c.HTML(http.StatusInternalServerError, "app_config.html", gin.H{
+			"error": "Failed to load config history",
+		})
+		return
+	}
+	active, err := h.maintenance.ActiveWindow()
+	if err != nil {
+		c.Error(err)
+		c.HTML(http.StatusInternalServerError, "app_config.html", gin.H{
+			"error": "Failed to load maintenance windows",
+		})
+		return
+	}
+	versions := make([]configVersion, 0, configHistorySize)
+	for i := 0; i < len(history) && i < configHistorySize; i++ {
+		v := configVersion{AppConfig: history[i], First: i+1 == len(history)}
+		if !v.First {
+			v.Changes = appconfig.Diff(&history[i+1], &history[i])
+		}
+		versions = append(versions, v)
+	}
 
 	c.HTML(http.StatusOK, "app_config.html", gin.H{
-		"title":  "App Configuration - Admin",
-		"Config": config,
+		"title":     "App Configuration - Admin",
+		"Config":    config,
+		"Platforms": appconfig.Platforms,
+		"History":   versions,
+		"Active":    active,
+		"Location":  h.location,
+		"Message":   c.Query("message"),
 	})
 }
 
 // UpdateAppConfigHandler handles updating the app config
-func UpdateAppConfigHandler(c *gin.Context) {
+func (h *Handler) UpdateAppConfigHandler(c *gin.Context) {
 	latestVersion := c.PostForm("latest_version")
 	minimumVersion := c.PostForm("minimum_version")
 	updateURL := c.PostForm("update_url")
@@ -460,62 +457,177 @@ func UpdateAppConfigHandler(c *gin.Context) {
 	maintenanceMode := c.PostForm("maintenance_mode") == "true"
 	appEnabled := c.PostForm("app_enabled") == "true"
 
-	query := `
-	UPDATE app_config SET
-		latest_version = $1,
-		minimum_version = $2,
-		update_required = $3,
-		update_url = $4,
-		update_message = $5,
-		maintenance_mode = $6,
-		maintenance_message = $7,
-		force_update = $8,
-		app_enabled = $9,
-		updated_at = CURRENT_TIMESTAMP
-	WHERE id = (SELECT id FROM app_config ORDER BY id DESC LIMIT 1)
-	`
-
-	_, err := db.Exec(
-		query,
-		latestVersion,
-		minimumVersion,
-		updateRequired,
-		updateURL,
-		updateMessage,
-		maintenanceMode,
-		maintenanceMessage,
-		forceUpdate,
-		appEnabled,
-	)
+	// Each platform's fields are prefixed with its name, e.g. ios_update_url
+	platforms := make(map[string]appconfig.PlatformConfig)
+	for _, platform := range appconfig.Platforms {
+		platforms[platform] = appconfig.PlatformConfig{
+			LatestVersion:  strings.TrimSpace(c.PostForm(platform + "_latest_version")),
+			MinimumVersion: strings.TrimSpace(c.PostForm(platform + "_minimum_version")),
+			UpdateURL:      strings.TrimSpace(c.PostForm(platform + "_update_url")),
+		}
+	}
+
+	config := appconfig.AppConfig{
+		LatestVersion:      latestVersion,
+		MinimumVersion:     minimumVersion,
+		UpdateRequired:     updateRequired,
+		UpdateURL:          updateURL,
+		UpdateMessage:      updateMessage,
+		MaintenanceMode:    maintenanceMode,
+		MaintenanceMessage: maintenanceMessage,
+		ForceUpdate:        forceUpdate,
+		AppEnabled:         appEnabled,
+		Platforms:          platforms,
+	}
+	if err := config.Validate(); err != nil {
+		c.Redirect(http.StatusFound, "/admin/appconfig?message="+url.QueryEscape("Not saved: "+err.Error()))
+		return
+	}
+	// A maintenance window in progress owns maintenance mode until it ends
+	// or is ended on the maintenance page
+	active, err := h.maintenance.ActiveWindow()
+	if err == nil && active != nil {
+		var current *appconfig.AppConfig
+		if current, err = h.appConfig.Get(); err == nil {
+			config.MaintenanceMode = current.MaintenanceMode
+		}
+	}
+	if err == nil {
+		_, err = h.appConfig.Update(config)
+	}
 
 	if err != nil {
+		c.Error(err)
 		c.HTML(http.StatusInternalServerError, "app_config.html", gin.H{
 			"error": "Failed to update config: " + err.Error(),
 		})
 		return
 	}
 
+	h.publishAppConfig(c)
+	if active != nil {
+		message := fmt.Sprintf("Configuration updated successfully. Maintenance mode stays as scheduled until %s.",
+			active.EndsAt.In(h.location).Format("15:04 02/01/2006"))
+		c.Redirect(http.StatusFound, "/admin/appconfig?message="+url.QueryEscape(message))
+		return
+	}
 	c.Redirect(http.StatusFound, "/admin/appconfig?message=Configuration updated successfully")
 }
 
-// ServeImageHandler serves images from the uploads directory via API endpoint
-// ServeImageHandler serves images via API endpoint to bypass static file restrictions
-func ServeImageHandler(c *gin.Context) {
+// RollbackAppConfigHandler restores an earlier config version by saving a
+// copy of it as the newest version. Maintenance mode is kept as it is:
+// scheduled maintenance windows switch it, and rolling back shouldn't end
+// or start maintenance.
+func (h *Handler) RollbackAppConfigHandler(c *gin.Context) {
+	version, err := strconv.Atoi(c.PostForm("version"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/appconfig?message=Choose a version to roll back to")
+		return
+	}
+	config, err := h.appConfig.GetVersion(version)
+	var current *appconfig.AppConfig
+	if err == nil {
+		current, err = h.appConfig.Get()
+	}
+	if err == nil {
+		config.MaintenanceMode = current.MaintenanceMode
+		config.RestoredFrom = version
+		_, err = h.appConfig.Update(*config)
+	}
+	switch {
+	case errors.Is(err, appconfig.ErrVersionNotFound):
+		c.Redirect(http.StatusFound, "/admin/appconfig?message="+url.QueryEscape(fmt.Sprintf("Version %d doesn't exist", version)))
+		return
+	case err != nil:
+		c.Error(err)
+		c.Redirect(http.StatusFound, "/admin/appconfig?message=Failed to roll back")
+		return
+	}
+
+	h.publishAppConfig(c)
+	c.Redirect(http.StatusFound, "/admin/appconfig?message="+url.QueryEscape(fmt.Sprintf("Rolled back to version %d", version)))
+}
+
+// publishAppConfig announces the newly saved config
+func (h *Handler) publishAppConfig(c *gin.Context) {
+	if updated, err := h.appConfig.Get(); err != nil {
+		c.Error(err)
+	} else {
+		events.Publish(c.Request.Context(), events.AppConfigUpdated, updated)
+	}
+}
+
+// ServeImageHandler serves images from the storage backend via API endpoint
+func (h *Handler) ServeImageHandler(c *gin.Context) {
 	filename := c.Param("filename")
 	if filename == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Filename required"})
 		return
 	}
+	filename = filepath.Base(filename)
 
-	// Construct file path
-	filePath := filepath.Join("uploads", filename)
+	// Reject tampered or expired signed URLs
+	if signature := c.Query("signature"); signature != "" {
+		verifier, ok := h.store.(interface {
+			VerifySignature(key, expires, signature string) bool
+		})
+		if !ok || !verifier.VerifySignature(filename, c.Query("expires"), signature) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired signature"})
+			return
+		}
+	}
 
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	reader, obj, err := h.store.Get(c.Request.Context(), filename)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		} else {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to load image"})
+		}
+		return
+	}
+	defer reader.Close()
+
+	// Local files support range and conditional requests
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, filename, obj.ModTime, seeker)
+		return
+	}
+
+	contentType := obj.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.DataFromReader(http.StatusOK, obj.Size, contentType, reader, nil)
+}
+
+// SignedImageURLHandler returns a temporary signed URL for an image
+func (h *Handler) SignedImageURLHandler(c *gin.Context) {
+	ttl := time.Hour
+	if raw := c.Query("ttl"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ttl"})
+			return
+		}
+		ttl = d
+	}
+
+	filename := filepath.Base(c.Param("filename"))
+	if _, err := h.store.Stat(c.Request.Context(), filename); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
 		return
 	}
 
-	// Serve the file with appropriate content type (Gin handles this automatically)
-	c.File(filePath)
+	signedURL, err := h.store.SignedURL(filename, ttl)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"url":        signedURL,
+		"expires_at": time.Now().Add(ttl),
+	})
 }
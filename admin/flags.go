@@ -0,0 +1,175 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"thaimaster2d/appconfig"
+
+	"github.com/gin-gonic/gin"
+)
+
+// flagHistorySize is how many flag changes the flags page shows
+const flagHistorySize = 50
+
+// FlagsPageHandler renders the feature flags and their change history
+func (h *Handler) FlagsPageHandler(c *gin.Context) {
+	flags, err := h.flags.ListFlags()
+	if err != nil {
+		c.Error(err)
+		c.HTML(http.StatusInternalServerError, "manage_flags.html", gin.H{
+			"Error": "Failed to fetch feature flags",
+		})
+		return
+	}
+	changes, err := h.flags.ListFlagChanges(flagHistorySize)
+	if err != nil {
+		c.Error(err)
+		c.HTML(http.StatusInternalServerError, "manage_flags.html", gin.H{
+			"Error": "Failed to fetch flag history",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "manage_flags.html", gin.H{
+		"title":    "Feature Flags - Admin",
+		"Flags":    flags,
+		"Changes":  changes,
+		"Location": h.location,
+		"Message":  c.Query("message"),
+	})
+}
+
+// CreateFlagPageHandler renders the create flag form
+func (h *Handler) CreateFlagPageHandler(c *gin.Context) {
+	c.HTML(http.StatusOK, "edit_flag.html", gin.H{
+		"title":     "Add Feature Flag - Admin",
+		"Flag":      appconfig.Flag{Percentage: 100},
+		"Platforms": appconfig.Platforms,
+	})
+}
+
+// CreateFlagHandler handles creating a flag
+func (h *Handler) CreateFlagHandler(c *gin.Context) {
+	flag, err := flagForm(c, c.PostForm("key"))
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "edit_flag.html", gin.H{
+			"Error":     err.Error(),
+			"Flag":      flag,
+			"Platforms": appconfig.Platforms,
+		})
+		return
+	}
+
+	if _, err := h.flags.CreateFlag(flag); err != nil {
+		status, message := http.StatusBadRequest, "A flag with this key already exists"
+		if !errors.Is(err, appconfig.ErrFlagExists) {
+			c.Error(err)
+			status, message = http.StatusInternalServerError, "Failed to create flag"
+		}
+		c.HTML(status, "edit_flag.html", gin.H{
+			"Error":     message,
+			"Flag":      flag,
+			"Platforms": appconfig.Platforms,
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/flags?message="+url.QueryEscape("Flag "+flag.Key+" created"))
+}
+
+// EditFlagPageHandler renders the edit flag form
+func (h *Handler) EditFlagPageHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/flags")
+		return
+	}
+	flag, err := h.flags.GetFlag(id)
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/flags")
+		return
+	}
+
+	c.HTML(http.StatusOK, "edit_flag.html", gin.H{
+		"title":     "Edit Feature Flag - Admin",
+		"Flag":      flag,
+		"Platforms": appconfig.Platforms,
+	})
+}
+
+// EditFlagHandler handles updating the rules of a flag
+func (h *Handler) EditFlagHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/flags")
+		return
+	}
+	current, err := h.flags.GetFlag(id)
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/flags")
+		return
+	}
+
+	flag, err := flagForm(c, current.Key)
+	flag.ID = id
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "edit_flag.html", gin.H{
+			"Error":     err.Error(),
+			"Flag":      flag,
+			"Platforms": appconfig.Platforms,
+		})
+		return
+	}
+	if _, err := h.flags.UpdateFlag(flag); err != nil {
+		c.Error(err)
+		c.HTML(http.StatusInternalServerError, "edit_flag.html", gin.H{
+			"Error":     "Failed to update flag",
+			"Flag":      flag,
+			"Platforms": appconfig.Platforms,
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/flags?message="+url.QueryEscape("Flag "+flag.Key+" updated"))
+}
+
+// DeleteFlagHandler handles deleting a flag. Its history is kept.
+func (h *Handler) DeleteFlagHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/flags")
+		return
+	}
+
+	if err := h.flags.DeleteFlag(id); err != nil {
+		if !errors.Is(err, appconfig.ErrFlagNotFound) {
+			c.Error(err)
+		}
+		c.Redirect(http.StatusFound, "/admin/flags?message=Failed to delete flag")
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/flags?message=Flag deleted successfully")
+}
+
+// flagForm reads and validates the flag form. Segments are comma-separated.
+func flagForm(c *gin.Context, key string) (appconfig.Flag, error) {
+	flag := appconfig.Flag{
+		Key:         key,
+		Description: strings.TrimSpace(c.PostForm("description")),
+		Enabled:     c.PostForm("enabled") == "true",
+		Platforms:   c.PostFormArray("platforms"),
+		MinVersion:  c.PostForm("min_version"),
+		MaxVersion:  c.PostForm("max_version"),
+		Segments:    strings.Split(c.PostForm("segments"), ","),
+	}
+	percentage, err := strconv.Atoi(strings.TrimSpace(c.PostForm("percentage")))
+	if err != nil {
+		return flag, errors.New("Percentage must be a whole number")
+	}
+	flag.Percentage = percentage
+	return flag, flag.Validate()
+}
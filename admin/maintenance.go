@@ -0,0 +1,162 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"thaimaster2d/appconfig"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maintenanceHistorySize is how many windows the maintenance page shows
+const maintenanceHistorySize = 50
+
+// datetimeLocal is the format of datetime-local form inputs
+const datetimeLocal = "2006-01-02T15:04"
+
+// MaintenancePageHandler renders the scheduled and past maintenance windows
+// with the form to schedule one
+func (h *Handler) MaintenancePageHandler(c *gin.Context) {
+	start := time.Now().In(h.location).Add(time.Hour).Truncate(time.Hour)
+	h.maintenancePage(c, http.StatusOK, "", gin.H{
+		"starts_at": start.Format(datetimeLocal),
+		"ends_at":   start.Add(time.Hour).Format(datetimeLocal),
+	})
+}
+
+// maintenancePage renders the maintenance page with an error and the
+// values of the schedule form
+func (h *Handler) maintenancePage(c *gin.Context, status int, message string, form gin.H) {
+	windows, err := h.maintenance.Repository().ListWindows(maintenanceHistorySize)
+	if err != nil {
+		c.Error(err)
+		status, message = http.StatusInternalServerError, "Failed to fetch maintenance windows"
+	}
+
+	c.HTML(status, "manage_maintenance.html", gin.H{
+		"title":    "Maintenance - Admin",
+		"Windows":  windows,
+		"Form":     form,
+		"Location": h.location,
+		"Message":  c.Query("message"),
+		"Error":    message,
+	})
+}
+
+// CreateMaintenanceHandler schedules a maintenance window. A window that
+// has already started switches maintenance mode on right away.
+func (h *Handler) CreateMaintenanceHandler(c *gin.Context) {
+	form := gin.H{
+		"starts_at": c.PostForm("starts_at"),
+		"ends_at":   c.PostForm("ends_at"),
+		"message":   c.PostForm("message"),
+		"messages":  c.PostForm("messages"),
+	}
+	w, err := h.maintenanceForm(c)
+	if err != nil {
+		h.maintenancePage(c, http.StatusBadRequest, err.Error(), form)
+		return
+	}
+	windows := h.maintenance.Repository()
+	scheduled, err := windows.ScheduledWindows()
+	if err != nil {
+		c.Error(err)
+		h.maintenancePage(c, http.StatusInternalServerError, "Failed to schedule maintenance", form)
+		return
+	}
+	if err := w.Validate(time.Now(), scheduled); err != nil {
+		h.maintenancePage(c, http.StatusBadRequest, "Invalid window: "+err.Error(), form)
+		return
+	}
+
+	created, err := windows.CreateWindow(w)
+	if err != nil {
+		c.Error(err)
+		h.maintenancePage(c, http.StatusInternalServerError, "Failed to schedule maintenance", form)
+		return
+	}
+	if err := h.maintenance.Sync(c.Request.Context(), time.Now()); err != nil {
+		c.Error(err)
+	}
+
+	message := fmt.Sprintf("Maintenance scheduled from %s to %s",
+		created.StartsAt.In(h.location).Format("15:04 02/01/2006"), created.EndsAt.In(h.location).Format("15:04 02/01/2006"))
+	c.Redirect(http.StatusFound, "/admin/maintenance?message="+url.QueryEscape(message))
+}
+
+// CancelMaintenanceHandler cancels a window that hasn't started
+func (h *Handler) CancelMaintenanceHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/maintenance")
+		return
+	}
+
+	if err := h.maintenance.Repository().CancelWindow(id); err != nil {
+		if !errors.Is(err, appconfig.ErrWindowNotFound) {
+			c.Error(err)
+		}
+		c.Redirect(http.StatusFound, "/admin/maintenance?message=Only upcoming maintenance can be cancelled")
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/maintenance?message=Maintenance cancelled")
+}
+
+// EndMaintenanceHandler ends the maintenance in progress early, switching
+// maintenance mode off
+func (h *Handler) EndMaintenanceHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/maintenance")
+		return
+	}
+
+	now := time.Now()
+	if err := h.maintenance.Repository().EndWindow(id, now); err != nil {
+		if !errors.Is(err, appconfig.ErrWindowNotFound) {
+			c.Error(err)
+		}
+		c.Redirect(http.StatusFound, "/admin/maintenance?message=Only maintenance in progress can be ended")
+		return
+	}
+	if err := h.maintenance.Sync(c.Request.Context(), now); err != nil {
+		c.Error(err)
+		c.Redirect(http.StatusFound, "/admin/maintenance?message=Failed to switch maintenance mode off")
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/maintenance?message=Maintenance ended")
+}
+
+// maintenanceForm reads the schedule form. Times are in the admin timezone
+// and translations are one "locale: message" per line.
+func (h *Handler) maintenanceForm(c *gin.Context) (appconfig.MaintenanceWindow, error) {
+	w := appconfig.MaintenanceWindow{
+		Message:  c.PostForm("message"),
+		Messages: map[string]string{},
+	}
+	var err error
+	if w.StartsAt, err = time.ParseInLocation(datetimeLocal, c.PostForm("starts_at"), h.location); err != nil {
+		return w, errors.New("Enter when the maintenance starts")
+	}
+	if w.EndsAt, err = time.ParseInLocation(datetimeLocal, c.PostForm("ends_at"), h.location); err != nil {
+		return w, errors.New("Enter when the maintenance ends")
+	}
+	for _, line := range strings.Split(c.PostForm("messages"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		locale, message, ok := strings.Cut(line, ":")
+		if !ok {
+			return w, fmt.Errorf("Write each translation as locale: message, not %q", strings.TrimSpace(line))
+		}
+		w.Messages[locale] = message
+	}
+	return w, nil
+}
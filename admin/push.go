@@ -0,0 +1,78 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"thaimaster2d/push"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PushPageHandler renders the broadcast form and the subscribers per topic
+func (h *Handler) PushPageHandler(c *gin.Context) {
+	h.renderPush(c, http.StatusOK, gin.H{"Message": c.Query("message")})
+}
+
+func (h *Handler) renderPush(c *gin.Context, status int, data gin.H) {
+	counts, err := h.push.Repository().CountByTopic()
+	if err != nil {
+		c.Error(err)
+		status = http.StatusInternalServerError
+		data["Error"] = "Failed to count devices"
+	}
+	data["title"] = "Push Notifications - Admin"
+	data["Topics"] = push.Topics
+	data["Counts"] = counts
+	data["Enabled"] = h.push.Enabled()
+	c.HTML(status, "push.html", data)
+}
+
+// SendPushHandler broadcasts a notification to a topic, or to every device
+// when the topic is "all"
+func (h *Handler) SendPushHandler(c *gin.Context) {
+	title := c.PostForm("title")
+	body := c.PostForm("body")
+	topic := c.PostForm("topic")
+	form := gin.H{"Title": title, "Body": body, "Topic": topic}
+
+	if title == "" || body == "" {
+		form["Error"] = "Title and message are required"
+		h.renderPush(c, http.StatusBadRequest, form)
+		return
+	}
+	if topic == "all" {
+		topic = ""
+	} else if !slices.Contains(push.Topics, topic) {
+		form["Error"] = "Unknown topic"
+		h.renderPush(c, http.StatusBadRequest, form)
+		return
+	}
+	if !h.push.Enabled() {
+		form["Error"] = "Push notifications are not configured, set push.sender"
+		h.renderPush(c, http.StatusBadRequest, form)
+		return
+	}
+
+	result, err := h.push.Broadcast(c.Request.Context(), topic, push.Message{
+		Title: title,
+		Body:  body,
+		Data:  map[string]string{"event": "broadcast"},
+	})
+	if err != nil {
+		c.Error(err)
+		form["Error"] = "Failed to send notification"
+		h.renderPush(c, http.StatusInternalServerError, form)
+		return
+	}
+
+	message := fmt.Sprintf("Sent to %d devices", result.Sent)
+	if result.Failed > 0 {
+		message += fmt.Sprintf(", %d failed", result.Failed)
+	}
+	if result.Removed > 0 {
+		message += fmt.Sprintf(", %d unregistered devices removed", result.Removed)
+	}
+	c.Redirect(http.StatusFound, "/admin/push?message="+url.QueryEscape(message))
+}
@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"thaimaster2d/points"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redemptionPageLimit is how many redemptions the queue lists
+const redemptionPageLimit = 100
+
+// RedemptionsPageHandler renders gift redemptions with the ?status= given,
+// pending by default, oldest first so claims are handled in order
+func (h *Handler) RedemptionsPageHandler(c *gin.Context) {
+	status := c.DefaultQuery("status", points.StatusPending)
+	if status != "all" && !slices.Contains(points.Statuses, status) {
+		status = points.StatusPending
+	}
+	filter := status
+	if filter == "all" {
+		filter = ""
+	}
+
+	redemptions, total, err := h.points.Repository().ListRedemptions(0, filter, redemptionPageLimit, 0)
+	if err != nil {
+		c.Error(err)
+		c.HTML(http.StatusInternalServerError, "redemptions.html", gin.H{
+			"Error":    "Failed to load redemptions",
+			"Status":   status,
+			"Statuses": points.Statuses,
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "redemptions.html", gin.H{
+		"title":       "Gift Redemptions - Admin",
+		"Redemptions": redemptions,
+		"Total":       total,
+		"Limit":       redemptionPageLimit,
+		"Status":      status,
+		"Statuses":    points.Statuses,
+		"Location":    h.location,
+		"Message":     c.Query("message"),
+	})
+}
+
+// redemptionsRedirect returns to the redemptions page, keeping the filter
+func redemptionsRedirect(c *gin.Context, message string) {
+	target := "/admin/redemptions?message=" + url.QueryEscape(message)
+	if status := c.PostForm("status"); status != "" {
+		target += "&status=" + url.QueryEscape(status)
+	}
+	c.Redirect(http.StatusFound, target)
+}
+
+// redemptionError returns the message shown when a redemption couldn't be
+// updated
+func redemptionError(c *gin.Context, err error, action string) string {
+	switch {
+	case errors.Is(err, points.ErrNotFound):
+		return "Redemption not found"
+	case errors.Is(err, points.ErrNotPending):
+		return "Redemption was already handled"
+	default:
+		c.Error(err)
+		return "Failed to " + action + " redemption"
+	}
+}
+
+// FulfillRedemptionHandler marks a redemption delivered
+func (h *Handler) FulfillRedemptionHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/redemptions")
+		return
+	}
+
+	note := strings.TrimSpace(c.PostForm("note"))
+	if _, err := h.points.Fulfill(c.Request.Context(), id, note); err != nil {
+		redemptionsRedirect(c, redemptionError(c, err, "fulfill"))
+		return
+	}
+	redemptionsRedirect(c, "Redemption fulfilled")
+}
+
+// RejectRedemptionHandler cancels a redemption, refunding the points and
+// returning the gift to stock
+func (h *Handler) RejectRedemptionHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/redemptions")
+		return
+	}
+
+	note := strings.TrimSpace(c.PostForm("note"))
+	if _, err := h.points.Reject(c.Request.Context(), id, note); err != nil {
+		redemptionsRedirect(c, redemptionError(c, err, "reject"))
+		return
+	}
+	redemptionsRedirect(c, "Redemption rejected and points refunded")
+}
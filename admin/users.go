@@ -0,0 +1,103 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"thaimaster2d/appuser"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userSearchLimit is how many users the users page lists
+const userSearchLimit = 100
+
+// UsersPageHandler renders the app users matching ?q= by phone, name or ID,
+// or the newest users
+func (h *Handler) UsersPageHandler(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	users, err := h.users.Repository().Search(query, userSearchLimit)
+	if err != nil {
+		c.Error(err)
+		c.HTML(http.StatusInternalServerError, "users.html", gin.H{
+			"Error": "Failed to search users",
+			"Query": query,
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "users.html", gin.H{
+		"title":      "App Users - Admin",
+		"Users":      users,
+		"Query":      query,
+		"Limit":      userSearchLimit,
+		"SMSEnabled": h.users.SMSEnabled(),
+		"Location":   h.location,
+		"Message":    c.Query("message"),
+	})
+}
+
+// usersRedirect returns to the users page, keeping the search
+func usersRedirect(c *gin.Context, message string) {
+	target := "/admin/users?message=" + url.QueryEscape(message)
+	if q := c.PostForm("q"); q != "" {
+		target += "&q=" + url.QueryEscape(q)
+	}
+	c.Redirect(http.StatusFound, target)
+}
+
+// BanUserHandler bans a user and signs them out
+func (h *Handler) BanUserHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/users")
+		return
+	}
+
+	if _, err := h.users.Ban(c.Request.Context(), id, strings.TrimSpace(c.PostForm("reason"))); err != nil {
+		if !errors.Is(err, appuser.ErrNotFound) {
+			c.Error(err)
+		}
+		usersRedirect(c, "Failed to ban user")
+		return
+	}
+	usersRedirect(c, "User banned")
+}
+
+// SetUserSegmentsHandler replaces the comma-separated segments of a user
+func (h *Handler) SetUserSegmentsHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/users")
+		return
+	}
+
+	if _, err := h.users.SetSegments(c.Request.Context(), id, strings.Split(c.PostForm("segments"), ",")); err != nil {
+		if !errors.Is(err, appuser.ErrNotFound) {
+			c.Error(err)
+		}
+		usersRedirect(c, "Failed to set user segments")
+		return
+	}
+	usersRedirect(c, "User segments saved")
+}
+
+// UnbanUserHandler lets a banned user sign in again
+func (h *Handler) UnbanUserHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/users")
+		return
+	}
+
+	if _, err := h.users.Unban(c.Request.Context(), id); err != nil {
+		if !errors.Is(err, appuser.ErrNotFound) {
+			c.Error(err)
+		}
+		usersRedirect(c, "Failed to unban user")
+		return
+	}
+	usersRedirect(c, "User unbanned")
+}
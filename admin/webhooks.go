@@ -0,0 +1,206 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"thaimaster2d/events"
+	"thaimaster2d/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deliveryLogSize is how many deliveries the webhooks page shows
+const deliveryLogSize = 50
+
+// WebhooksPageHandler renders the webhook endpoints and the delivery log,
+// filtered to one endpoint with ?endpoint_id=
+func (h *Handler) WebhooksPageHandler(c *gin.Context) {
+	repo := h.webhooks.Repository()
+	endpoints, err := repo.ListEndpoints()
+	if err != nil {
+		c.Error(err)
+		c.HTML(http.StatusInternalServerError, "manage_webhooks.html", gin.H{
+			"Error": "Failed to fetch webhook endpoints",
+		})
+		return
+	}
+	endpointID, _ := strconv.Atoi(c.Query("endpoint_id"))
+	deliveries, err := repo.ListDeliveries(endpointID, deliveryLogSize)
+	if err != nil {
+		c.Error(err)
+		c.HTML(http.StatusInternalServerError, "manage_webhooks.html", gin.H{
+			"Error": "Failed to fetch webhook deliveries",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "manage_webhooks.html", gin.H{
+		"title":      "Webhooks - Admin",
+		"Endpoints":  endpoints,
+		"Deliveries": deliveries,
+		"EndpointID": endpointID,
+		"Location":   h.location,
+		"Message":    c.Query("message"),
+	})
+}
+
+// CreateWebhookPageHandler renders the create endpoint form
+func (h *Handler) CreateWebhookPageHandler(c *gin.Context) {
+	c.HTML(http.StatusOK, "edit_webhook.html", gin.H{
+		"title":    "Add Webhook - Admin",
+		"Endpoint": webhook.Endpoint{Active: true, Events: events.Types},
+		"Types":    events.Types,
+	})
+}
+
+// CreateWebhookHandler handles creating an endpoint. A signing secret is
+// generated unless one is given.
+func (h *Handler) CreateWebhookHandler(c *gin.Context) {
+	endpoint, err := webhookForm(c)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "edit_webhook.html", gin.H{
+			"Error":    err.Error(),
+			"Endpoint": endpoint,
+			"Types":    events.Types,
+		})
+		return
+	}
+	if endpoint.Secret == "" {
+		endpoint.Secret = webhook.NewSecret()
+	}
+
+	if _, err := h.webhooks.Repository().CreateEndpoint(&endpoint); err != nil {
+		c.Error(err)
+		c.HTML(http.StatusInternalServerError, "edit_webhook.html", gin.H{
+			"Error":    "Failed to create webhook",
+			"Endpoint": endpoint,
+			"Types":    events.Types,
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/webhooks?message=Webhook created successfully")
+}
+
+// EditWebhookPageHandler renders the edit endpoint form
+func (h *Handler) EditWebhookPageHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/webhooks")
+		return
+	}
+	endpoint, err := h.webhooks.Repository().GetEndpoint(id)
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/webhooks")
+		return
+	}
+
+	c.HTML(http.StatusOK, "edit_webhook.html", gin.H{
+		"title":    "Edit Webhook - Admin",
+		"Endpoint": endpoint,
+		"Types":    events.Types,
+	})
+}
+
+// EditWebhookHandler handles updating an endpoint. An empty secret keeps
+// the current one.
+func (h *Handler) EditWebhookHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/webhooks")
+		return
+	}
+	repo := h.webhooks.Repository()
+	current, err := repo.GetEndpoint(id)
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/webhooks")
+		return
+	}
+
+	endpoint, err := webhookForm(c)
+	endpoint.ID = id
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "edit_webhook.html", gin.H{
+			"Error":    err.Error(),
+			"Endpoint": endpoint,
+			"Types":    events.Types,
+		})
+		return
+	}
+	if endpoint.Secret == "" {
+		endpoint.Secret = current.Secret
+	}
+
+	if _, err := repo.UpdateEndpoint(&endpoint); err != nil {
+		c.Error(err)
+		c.HTML(http.StatusInternalServerError, "edit_webhook.html", gin.H{
+			"Error":    "Failed to update webhook",
+			"Endpoint": endpoint,
+			"Types":    events.Types,
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/webhooks?message=Webhook updated successfully")
+}
+
+// DeleteWebhookHandler handles deleting an endpoint and its delivery log
+func (h *Handler) DeleteWebhookHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/webhooks")
+		return
+	}
+
+	if err := h.webhooks.Repository().DeleteEndpoint(id); err != nil {
+		c.Redirect(http.StatusFound, "/admin/webhooks?message=Failed to delete webhook")
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/webhooks?message=Webhook deleted successfully")
+}
+
+// TestWebhookHandler queues a test event for an endpoint
+func (h *Handler) TestWebhookHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil {
+		c.Redirect(http.StatusFound, "/admin/webhooks")
+		return
+	}
+
+	if _, err := h.webhooks.SendTest(c.Request.Context(), id); err != nil {
+		if !errors.Is(err, webhook.ErrNotFound) {
+			c.Error(err)
+		}
+		c.Redirect(http.StatusFound, "/admin/webhooks?message=Failed to send test event")
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/webhooks?endpoint_id="+strconv.Itoa(id)+"&message=Test event sent")
+}
+
+// webhookForm reads and validates the endpoint form
+func webhookForm(c *gin.Context) (webhook.Endpoint, error) {
+	endpoint := webhook.Endpoint{
+		URL:         c.PostForm("url"),
+		Description: c.PostForm("description"),
+		Secret:      c.PostForm("secret"),
+		Events:      c.PostFormArray("events"),
+		Active:      c.PostForm("active") == "true",
+	}
+	if u, err := url.Parse(endpoint.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return endpoint, errors.New("URL must be an absolute http(s) URL")
+	}
+	if len(endpoint.Events) == 0 {
+		return endpoint, errors.New("Select at least one event")
+	}
+	for _, typ := range endpoint.Events {
+		if !slices.Contains(events.Types, typ) {
+			return endpoint, errors.New("Unknown event " + typ)
+		}
+	}
+	return endpoint, nil
+}
@@ -0,0 +1,185 @@
+// Package alert notifies admins about operational problems, such as the
+// lottery feeder going quiet or a gift running out, through pluggable sinks:
+// a JSON webhook, email via SMTP and the Telegram bot API (or anything
+// compatible with it).
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"thaimaster2d/metrics"
+	"time"
+)
+
+// Alert kinds
+const (
+	KindFeedDown       = "feed_down"
+	KindFeedRecovered  = "feed_recovered"
+	KindResultConflict = "result_conflict"
+	KindLowStock       = "gift_low_stock"
+)
+
+var sent = metrics.NewCounter("alerts_sent_total",
+	"Alerts delivered to each sink, by result (ok or error)", "sink", "result")
+
+// Alert is one notification
+type Alert struct {
+	Kind    string    `json:"kind"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Text is the alert as a plain text message
+func (a Alert) Text() string {
+	return fmt.Sprintf("%s\n\n%s\n\n%s", a.Title, a.Message, a.Time.Format(time.RFC3339))
+}
+
+// Sink delivers alerts
+type Sink interface {
+	// Name identifies the sink in logs and metrics
+	Name() string
+	Send(ctx context.Context, a Alert) error
+}
+
+// Multi sends every alert to all of its sinks
+type Multi []Sink
+
+// Name implements Sink
+func (m Multi) Name() string {
+	names := make([]string, len(m))
+	for i, sink := range m {
+		names[i] = sink.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Send delivers the alert to every sink, even if some fail, and returns
+// the combined errors
+func (m Multi) Send(ctx context.Context, a Alert) error {
+	var errs []error
+	for _, sink := range m {
+		if err := sink.Send(ctx, a); err != nil {
+			sent.Inc(sink.Name(), "error")
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+			continue
+		}
+		sent.Inc(sink.Name(), "ok")
+	}
+	return errors.Join(errs...)
+}
+
+// Notify sends the alert in the background, logging failures. Nothing is
+// sent if sink is nil.
+func Notify(sink Sink, a Alert) {
+	if sink == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := sink.Send(ctx, a); err != nil {
+			slog.Error("failed to send alert", "kind", a.Kind, "error", err)
+		} else {
+			slog.Info("alert sent", "kind", a.Kind, "sinks", sink.Name())
+		}
+	}()
+}
+
+// Webhook POSTs the alert as JSON
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// Name implements Sink
+func (w *Webhook) Name() string { return "webhook" }
+
+// Send implements Sink
+func (w *Webhook) Send(ctx context.Context, a Alert) error {
+	return postJSON(ctx, w.Client, w.URL, a)
+}
+
+// Telegram sends the alert through the Telegram bot API. APIURL can point at
+// any server implementing sendMessage.
+type Telegram struct {
+	APIURL string
+	Token  string
+	ChatID string
+	Client *http.Client
+}
+
+// Name implements Sink
+func (t *Telegram) Name() string { return "telegram" }
+
+// Send implements Sink
+func (t *Telegram) Send(ctx context.Context, a Alert) error {
+	url := strings.TrimSuffix(t.APIURL, "/") + "/bot" + t.Token + "/sendMessage"
+	err := postJSON(ctx, t.Client, url, map[string]string{
+		"chat_id": t.ChatID,
+		"text":    a.Text(),
+	})
+	if err != nil && t.Token != "" {
+		// Transport errors quote the URL, which contains the bot token
+		return errors.New(strings.ReplaceAll(err.Error(), t.Token, "<token>"))
+	}
+	return err
+}
+
+// Email sends the alert through an SMTP server without authentication, such
+// as a local relay or a development mail catcher
+type Email struct {
+	Addr string
+	From string
+	To   []string
+}
+
+// Name implements Sink
+func (e *Email) Name() string { return "email" }
+
+// Send implements Sink
+func (e *Email) Send(ctx context.Context, a Alert) error {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		e.From, strings.Join(e.To, ", "), a.Title, strings.ReplaceAll(a.Text(), "\n", "\r\n"))
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(e.Addr, nil, e.From, e.To, []byte(msg))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body any) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
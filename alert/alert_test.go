@@ -0,0 +1,122 @@
+package alert
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAlert = Alert{
+	Kind:    KindFeedDown,
+	Title:   "Lottery feed down",
+	Message: "No update from the feeder for 3m0s (expected every 2m0s).",
+	Time:    time.Date(2025, 10, 1, 10, 0, 0, 0, time.UTC),
+}
+
+func TestTelegram(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botsecret/sendMessage" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	sink := &Telegram{APIURL: srv.URL + "/", Token: "secret", ChatID: "-100"}
+	if err := sink.Send(context.Background(), testAlert); err != nil {
+		t.Fatal(err)
+	}
+	if got["chat_id"] != "-100" || !strings.HasPrefix(got["text"], "Lottery feed down\n\nNo update") {
+		t.Errorf("sendMessage body = %v", got)
+	}
+
+	// The token never shows up in errors
+	srv.Close()
+	err := sink.Send(context.Background(), testAlert)
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("error = %v, want a failure without the token", err)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// A minimal SMTP server that accepts one message
+	msg := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost")
+		var data strings.Builder
+		for inData := false; ; {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case inData && line == ".\r\n":
+				inData = false
+				msg <- data.String()
+				reply("250 OK")
+			case inData:
+				data.WriteString(line)
+			case strings.HasPrefix(line, "DATA"):
+				inData = true
+				reply("354 go ahead")
+			case strings.HasPrefix(line, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	sink := &Email{Addr: ln.Addr().String(), From: "server@example.com", To: []string{"ops@example.com"}}
+	if err := sink.Send(context.Background(), testAlert); err != nil {
+		t.Fatal(err)
+	}
+	got := <-msg
+	for _, want := range []string{"To: ops@example.com\r\n", "Subject: Lottery feed down\r\n", "expected every 2m0s"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestMulti(t *testing.T) {
+	var received int
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	sink := Multi{&Webhook{URL: failing.URL}, &Webhook{URL: ok.URL}}
+	err := sink.Send(context.Background(), testAlert)
+	if err == nil || !strings.Contains(err.Error(), "webhook: unexpected status 502") {
+		t.Errorf("error = %v, want the failing webhook's status", err)
+	}
+	if received != 1 {
+		t.Errorf("working webhook received %d alerts, want 1 despite the other failing", received)
+	}
+}
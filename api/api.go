@@ -0,0 +1,137 @@
+// Package api holds the response envelope, error codes and pagination
+// shared by the /api/v2 handlers.
+//
+// Successful responses are {"data": ...}, with a "meta" object added for
+// paginated lists. Errors are {"error": {"code": ..., "message": ...}}.
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes returned in v2 error envelopes
+const (
+	CodeInvalidRequest = "invalid_request"
+	CodeValidation     = "validation_failed"
+	CodeNotFound       = "not_found"
+	CodeUnauthorized   = "unauthorized"
+	CodeForbidden      = "forbidden"
+	CodeConflict       = "conflict"
+	CodeRateLimited    = "rate_limited"
+	CodeInternal       = "internal_error"
+)
+
+// Pagination defaults and limits for list endpoints
+const (
+	DefaultPerPage = 50
+	MaxPerPage     = 200
+)
+
+// ErrorBody describes a failed request
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Meta is the pagination metadata of a list response
+type Meta struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+// Page is the requested slice of a list
+type Page struct {
+	Number  int
+	PerPage int
+}
+
+// Offset is the number of items before the page
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.PerPage
+}
+
+// OK writes a single resource
+func OK(c *gin.Context, status int, data any) {
+	c.JSON(status, gin.H{"data": data})
+}
+
+// List writes one page of items with its metadata. total is the number of
+// items across all pages.
+func List[T any](c *gin.Context, items []T, page Page, total int) {
+	if items == nil {
+		items = []T{}
+	}
+	totalPages := 0
+	if total > 0 {
+		totalPages = (total + page.PerPage - 1) / page.PerPage
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": items,
+		"meta": Meta{
+			Page:       page.Number,
+			PerPage:    page.PerPage,
+			Total:      total,
+			TotalPages: totalPages,
+		},
+	})
+}
+
+// Paginate writes the requested page of an in-memory list
+func Paginate[T any](c *gin.Context, items []T, page Page) {
+	start := min(page.Offset(), len(items))
+	end := min(start+page.PerPage, len(items))
+	List(c, items[start:end], page, len(items))
+}
+
+// Error writes an error envelope and aborts the request
+func Error(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": ErrorBody{Code: code, Message: message}})
+}
+
+// ParsePage reads the page and per_page query parameters, replying 400 if
+// they are invalid
+func ParsePage(c *gin.Context) (Page, bool) {
+	page := Page{Number: 1, PerPage: DefaultPerPage}
+	if raw := c.Query("page"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			Error(c, http.StatusBadRequest, CodeInvalidRequest, "page must be a positive integer")
+			return page, false
+		}
+		page.Number = n
+	}
+	if raw := c.Query("per_page"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > MaxPerPage {
+			Error(c, http.StatusBadRequest, CodeInvalidRequest, "per_page must be between 1 and "+strconv.Itoa(MaxPerPage))
+			return page, false
+		}
+		page.PerPage = n
+	}
+	return page, true
+}
+
+// ParamID parses a numeric path parameter, replying 400 if it isn't one
+func ParamID(c *gin.Context, name string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil {
+		Error(c, http.StatusBadRequest, CodeInvalidRequest, name+" must be an integer")
+		return 0, false
+	}
+	return id, true
+}
+
+// Deprecated marks a v1 route as deprecated and points clients at the v2
+// route that replaces it
+func Deprecated(successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", "<"+successor+`>; rel="successor-version"`)
+		c.Next()
+	}
+}
@@ -0,0 +1,31 @@
+// Package apidocs serves the OpenAPI specification of the HTTP API and a
+// self-contained page that renders it.
+package apidocs
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+//go:embed docs.html
+var docsPage []byte
+
+// Spec returns the OpenAPI 3 document
+func Spec() []byte {
+	return spec
+}
+
+// SpecHandler serves the OpenAPI document at /api/openapi.json
+func SpecHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", spec)
+}
+
+// DocsHandler serves the API docs page at /api/docs
+func DocsHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", docsPage)
+}
@@ -1,19 +1,31 @@
 package appconfig
 
 import (
-	"database/sql"
-	"log"
+	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-var db *sql.DB
+// Platforms lists the app platforms with their own version settings
+var Platforms = []string{"android", "ios", "web"}
 
-// AppConfig represents the app configuration
+// PlatformConfig overrides the version settings for one platform. Empty
+// fields use the shared value.
+type PlatformConfig struct {
+	LatestVersion  string `json:"latest_version"`
+	MinimumVersion string `json:"minimum_version"`
+	// UpdateURL is the platform's store listing
+	UpdateURL string `json:"update_url"`
+}
+
+// AppConfig represents the app configuration. Every save adds a version
+// with the next Version number.
 type AppConfig struct {
 	ID                 int       `json:"id"`
+	Version            int       `json:"version"`
 	LatestVersion      string    `json:"latest_version"`
 	MinimumVersion     string    `json:"minimum_version"`
 	UpdateRequired     bool      `json:"update_required"`
@@ -25,112 +37,156 @@ type AppConfig struct {
 	AppEnabled         bool      `json:"app_enabled"`
 	CreatedAt          time.Time `json:"created_at"`
 	UpdatedAt          time.Time `json:"updated_at"`
+	// Platforms holds the overrides of each platform that has any
+	Platforms map[string]PlatformConfig `json:"platforms"`
+	// RestoredFrom is the version this one rolled back to, if any
+	RestoredFrom int `json:"restored_from,omitempty"`
 }
 
-// InitDB initializes the database connection for app config
-func InitDB(database *sql.DB) {
-	db = database
-	createTable()
-	insertDefaultConfig()
+// ForPlatform returns the config a platform's apps see: a copy with the
+// platform's overrides applied. An empty platform gets the shared config.
+func (config AppConfig) ForPlatform(platform string) AppConfig {
+	p := config.Platforms[platform]
+	if p.LatestVersion != "" {
+		config.LatestVersion = p.LatestVersion
+	}
+	if p.MinimumVersion != "" {
+		config.MinimumVersion = p.MinimumVersion
+	}
+	if p.UpdateURL != "" {
+		config.UpdateURL = p.UpdateURL
+	}
+	return config
 }
 
-// Create app_config table if it doesn't exist
-func createTable() {
-	query := `
-	CREATE TABLE IF NOT EXISTS app_config (
-		id SERIAL PRIMARY KEY,
-		latest_version VARCHAR(20) NOT NULL DEFAULT '1.0.0',
-		minimum_version VARCHAR(20) NOT NULL DEFAULT '1.0.0',
-		update_required BOOLEAN DEFAULT FALSE,
-		update_url TEXT DEFAULT '',
-		update_message TEXT DEFAULT 'A new version is available!',
-		maintenance_mode BOOLEAN DEFAULT FALSE,
-		maintenance_message TEXT DEFAULT 'App is under maintenance. Please try again later.',
-		force_update BOOLEAN DEFAULT FALSE,
-		app_enabled BOOLEAN DEFAULT TRUE,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-	`
-	_, err := db.Exec(query)
-	if err != nil {
-		log.Fatalf("Failed to create app_config table: %v", err)
+// Validate checks the versions of a config before it is saved, dropping
+// platforms without overrides
+func (config *AppConfig) Validate() error {
+	check := func(name, latest, minimum string) error {
+		for _, v := range []string{latest, minimum} {
+			if _, err := ParseVersion(v); v != "" && err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		if latest != "" && minimum != "" && CompareVersions(minimum, latest) > 0 {
+			return fmt.Errorf("%s: minimum version %s is above latest version %s", name, minimum, latest)
+		}
+		return nil
 	}
-	log.Println("✅ app_config table ready")
+	if err := check("shared", config.LatestVersion, config.MinimumVersion); err != nil {
+		return err
+	}
+	for platform, p := range config.Platforms {
+		if !slices.Contains(Platforms, platform) {
+			return fmt.Errorf("unknown platform %q", platform)
+		}
+		if p == (PlatformConfig{}) {
+			delete(config.Platforms, platform)
+			continue
+		}
+		effective := config.ForPlatform(platform)
+		if err := check(platform, effective.LatestVersion, effective.MinimumVersion); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// Insert default config if table is empty
-func insertDefaultConfig() {
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM app_config").Scan(&count)
-	if err != nil {
-		log.Printf("Error checking app_config: %v", err)
-		return
+// DefaultConfig returns the configuration a new installation starts with
+func DefaultConfig() AppConfig {
+	return AppConfig{
+		LatestVersion:      "1.0.0",
+		MinimumVersion:     "1.0.0",
+		UpdateRequired:     false,
+		UpdateURL:          "https://play.google.com/store/apps/details?id=com.thaimaster2d",
+		UpdateMessage:      "🎉 New version available! Update now for better experience.",
+		MaintenanceMode:    false,
+		MaintenanceMessage: "🔧 App is under maintenance. Please check back soon!",
+		ForceUpdate:        false,
+		AppEnabled:         true,
+		Platforms:          map[string]PlatformConfig{},
 	}
+}
 
-	if count == 0 {
-		query := `
-		INSERT INTO app_config (
-			latest_version, 
-			minimum_version, 
-			update_required, 
-			update_url,
-			update_message,
-			maintenance_mode,
-			maintenance_message,
-			force_update,
-			app_enabled
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		`
-		_, err = db.Exec(
-			query,
-			"1.0.0",                                                  // latest_version
-			"1.0.0",                                                  // minimum_version
-			false,                                                    // update_required
-			"https://play.google.com/store/apps/details?id=com.thaimaster2d", // update_url
-			"🎉 New version available! Update now for better experience.",    // update_message
-			false, // maintenance_mode
-			"🔧 App is under maintenance. Please check back soon!",    // maintenance_message
-			false, // force_update
-			true,  // app_enabled
-		)
-		if err != nil {
-			log.Printf("Failed to insert default app_config: %v", err)
-		} else {
-			log.Println("✅ Default app config inserted")
-		}
+// VersionCheck tells a client whether its version may be used
+type VersionCheck struct {
+	// Platform is the platform the check was made for, empty for the
+	// shared settings
+	Platform        string `json:"platform,omitempty"`
+	CanUse          bool   `json:"can_use"`
+	Message         string `json:"message"`
+	MaintenanceMode bool   `json:"maintenance_mode"`
+	CurrentVersion  string `json:"current_version"`
+	LatestVersion   string `json:"latest_version"`
+	MinimumVersion  string `json:"minimum_version"`
+	NeedsUpdate     bool   `json:"needs_update"`
+	HasUpdate       bool   `json:"has_update"`
+	ForceUpdate     bool   `json:"force_update"`
+	UpdateURL       string `json:"update_url"`
+	UpdateMessage   string `json:"update_message"`
+	// MaintenanceEndsAt is when the scheduled maintenance in progress ends
+	MaintenanceEndsAt *time.Time `json:"maintenance_ends_at,omitempty"`
+	// UpcomingMaintenance is the next scheduled maintenance, if any
+	UpcomingMaintenance *MaintenanceNotice `json:"upcoming_maintenance,omitempty"`
+}
+
+// Check compares a client version against the configuration of its
+// platform, or the shared settings if platform is empty
+func Check(config *AppConfig, platform, clientVersion string) VersionCheck {
+	forPlatform := config.ForPlatform(platform)
+	config = &forPlatform
+	check := VersionCheck{
+		Platform:       platform,
+		CurrentVersion: clientVersion,
+		LatestVersion:  config.LatestVersion,
+		MinimumVersion: config.MinimumVersion,
+		UpdateURL:      config.UpdateURL,
+		UpdateMessage:  config.UpdateMessage,
+	}
+
+	// Check if app is enabled
+	if !config.AppEnabled {
+		check.Message = "App is temporarily disabled"
+		check.MaintenanceMode = true
+		return check
 	}
+
+	// Check maintenance mode
+	if config.MaintenanceMode {
+		check.Message = config.MaintenanceMessage
+		check.MaintenanceMode = true
+		return check
+	}
+
+	// Compare versions
+	check.NeedsUpdate = CompareVersions(clientVersion, config.MinimumVersion) < 0
+	check.HasUpdate = CompareVersions(clientVersion, config.LatestVersion) < 0
+	check.ForceUpdate = config.ForceUpdate && check.NeedsUpdate
+	check.CanUse = !check.NeedsUpdate
+	if check.HasUpdate {
+		check.Message = config.UpdateMessage
+	}
+	return check
 }
 
-// GetAppConfig returns the current app configuration
-func GetAppConfig(c *gin.Context) {
-	var config AppConfig
-	query := `
-	SELECT 
-		id, latest_version, minimum_version, update_required, 
-		update_url, update_message, maintenance_mode, maintenance_message,
-		force_update, app_enabled, created_at, updated_at
-	FROM app_config 
-	ORDER BY id DESC 
-	LIMIT 1
-	`
-	err := db.QueryRow(query).Scan(
-		&config.ID,
-		&config.LatestVersion,
-		&config.MinimumVersion,
-		&config.UpdateRequired,
-		&config.UpdateURL,
-		&config.UpdateMessage,
-		&config.MaintenanceMode,
-		&config.MaintenanceMessage,
-		&config.ForceUpdate,
-		&config.AppEnabled,
-		&config.CreatedAt,
-		&config.UpdatedAt,
-	)
+// Handler serves the app config API
+type Handler struct {
+	repo    AppConfigRepository
+	flags   FlagRepository
+	windows MaintenanceRepository
+}
+
+// NewHandler creates an app config handler backed by repo, serving the
+// feature flags in flags and announcing the maintenance windows in windows
+func NewHandler(repo AppConfigRepository, flags FlagRepository, windows MaintenanceRepository) *Handler {
+	return &Handler{repo: repo, flags: flags, windows: windows}
+}
 
+// GetAppConfig returns the current app configuration
+func (h *Handler) GetAppConfig(c *gin.Context) {
+	config, err := h.repo.Get()
 	if err != nil {
-		log.Printf("Error fetching app config: %v", err)
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch app config"})
 		return
 	}
@@ -138,122 +194,87 @@ func GetAppConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, config)
 }
 
-// CheckVersion checks if the client version is compatible
-func CheckVersion(c *gin.Context) {
+// validPlatform reports whether the ?platform= of a version check is empty
+// or known
+func validPlatform(platform string) bool {
+	return platform == "" || slices.Contains(Platforms, platform)
+}
+
+// CheckVersion checks if the client version is compatible. ?platform=
+// selects the platform's versions and store URL, and ?locale= or
+// Accept-Language the language of scheduled maintenance messages.
+func (h *Handler) CheckVersion(c *gin.Context) {
 	clientVersion := c.Query("version")
 	if clientVersion == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "version parameter required"})
 		return
 	}
+	platform := c.Query("platform")
+	if !validPlatform(platform) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "platform must be android, ios or web"})
+		return
+	}
 
-	var config AppConfig
-	query := `
-	SELECT 
-		latest_version, minimum_version, update_required, 
-		update_url, update_message, maintenance_mode, maintenance_message,
-		force_update, app_enabled
-	FROM app_config 
-	ORDER BY id DESC 
-	LIMIT 1
-	`
-	err := db.QueryRow(query).Scan(
-		&config.LatestVersion,
-		&config.MinimumVersion,
-		&config.UpdateRequired,
-		&config.UpdateURL,
-		&config.UpdateMessage,
-		&config.MaintenanceMode,
-		&config.MaintenanceMessage,
-		&config.ForceUpdate,
-		&config.AppEnabled,
-	)
-
+	config, err := h.repo.Get()
 	if err != nil {
-		log.Printf("Error fetching app config: %v", err)
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check version"})
 		return
 	}
 
-	// Check if app is enabled
-	if !config.AppEnabled {
-		c.JSON(http.StatusOK, gin.H{
-			"can_use":          false,
-			"message":          "App is temporarily disabled",
-			"maintenance_mode": true,
-		})
+	check := Check(config, platform, clientVersion)
+	if err := h.addMaintenance(&check, config, requestLocale(c)); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check version"})
 		return
 	}
-
-	// Check maintenance mode
-	if config.MaintenanceMode {
-		c.JSON(http.StatusOK, gin.H{
+	if check.MaintenanceMode {
+		response := gin.H{
 			"can_use":          false,
-			"message":          config.MaintenanceMessage,
+			"message":          check.Message,
 			"maintenance_mode": true,
-		})
+		}
+		if check.MaintenanceEndsAt != nil {
+			response["maintenance_ends_at"] = check.MaintenanceEndsAt
+		}
+		c.JSON(http.StatusOK, response)
 		return
 	}
 
-	// Compare versions
-	needsUpdate := compareVersions(clientVersion, config.MinimumVersion) < 0
-	hasUpdate := compareVersions(clientVersion, config.LatestVersion) < 0
-
 	response := gin.H{
-		"can_use":          !needsUpdate,
-		"current_version":  clientVersion,
-		"latest_version":   config.LatestVersion,
-		"minimum_version":  config.MinimumVersion,
-		"needs_update":     needsUpdate,
-		"has_update":       hasUpdate,
-		"force_update":     config.ForceUpdate && needsUpdate,
-		"update_url":       config.UpdateURL,
-		"update_message":   config.UpdateMessage,
+		"can_use":          check.CanUse,
+		"current_version":  check.CurrentVersion,
+		"latest_version":   check.LatestVersion,
+		"minimum_version":  check.MinimumVersion,
+		"needs_update":     check.NeedsUpdate,
+		"has_update":       check.HasUpdate,
+		"force_update":     check.ForceUpdate,
+		"update_url":       check.UpdateURL,
+		"update_message":   check.UpdateMessage,
 		"maintenance_mode": false,
 	}
+	if check.UpcomingMaintenance != nil {
+		response["upcoming_maintenance"] = check.UpcomingMaintenance
+	}
 
 	c.JSON(http.StatusOK, response)
 }
 
 // UpdateAppConfig updates the app configuration (admin only)
-func UpdateAppConfig(c *gin.Context) {
+func (h *Handler) UpdateAppConfig(c *gin.Context) {
 	var input AppConfig
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	query := `
-	UPDATE app_config SET
-		latest_version = $1,
-		minimum_version = $2,
-		update_required = $3,
-		update_url = $4,
-		update_message = $5,
-		maintenance_mode = $6,
-		maintenance_message = $7,
-		force_update = $8,
-		app_enabled = $9,
-		updated_at = CURRENT_TIMESTAMP
-	WHERE id = (SELECT id FROM app_config ORDER BY id DESC LIMIT 1)
-	RETURNING id
-	`
-
-	var id int
-	err := db.QueryRow(
-		query,
-		input.LatestVersion,
-		input.MinimumVersion,
-		input.UpdateRequired,
-		input.UpdateURL,
-		input.UpdateMessage,
-		input.MaintenanceMode,
-		input.MaintenanceMessage,
-		input.ForceUpdate,
-		input.AppEnabled,
-	).Scan(&id)
-
+	id, err := h.repo.Update(input)
 	if err != nil {
-		log.Printf("Error updating app config: %v", err)
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update config"})
 		return
 	}
@@ -263,16 +284,3 @@ func UpdateAppConfig(c *gin.Context) {
 		"id":      id,
 	})
 }
-
-// Simple version comparison (major.minor.patch)
-// Returns: -1 if v1 < v2, 0 if v1 == v2, 1 if v1 > v2
-func compareVersions(v1, v2 string) int {
-	// Simple string comparison for now
-	// For production, use proper semantic versioning library
-	if v1 < v2 {
-		return -1
-	} else if v1 > v2 {
-		return 1
-	}
-	return 0
-}
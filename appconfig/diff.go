@@ -0,0 +1,44 @@
+package appconfig
+
+import "fmt"
+
+// changeList describes the fields that differ between two versions of
+// something, one "name: before → after" line per field
+type changeList []string
+
+// add records a field if its value changed
+func (l *changeList) add(name string, before, after any) {
+	b, a := display(before), display(after)
+	if b != a {
+		*l = append(*l, fmt.Sprintf("%s: %s → %s", name, b, a))
+	}
+}
+
+// display formats a value for a change line, showing empty strings as ""
+func display(v any) string {
+	if s, ok := v.(string); ok && s == "" {
+		return `""`
+	}
+	return fmt.Sprint(v)
+}
+
+// Diff describes what changed from one config version to another
+func Diff(from, to *AppConfig) []string {
+	var changes changeList
+	changes.add("latest version", from.LatestVersion, to.LatestVersion)
+	changes.add("minimum version", from.MinimumVersion, to.MinimumVersion)
+	changes.add("update required", from.UpdateRequired, to.UpdateRequired)
+	changes.add("force update", from.ForceUpdate, to.ForceUpdate)
+	changes.add("update URL", from.UpdateURL, to.UpdateURL)
+	changes.add("update message", from.UpdateMessage, to.UpdateMessage)
+	changes.add("maintenance mode", from.MaintenanceMode, to.MaintenanceMode)
+	changes.add("maintenance message", from.MaintenanceMessage, to.MaintenanceMessage)
+	changes.add("app enabled", from.AppEnabled, to.AppEnabled)
+	for _, platform := range Platforms {
+		before, after := from.Platforms[platform], to.Platforms[platform]
+		changes.add(platform+" latest version", before.LatestVersion, after.LatestVersion)
+		changes.add(platform+" minimum version", before.MinimumVersion, after.MinimumVersion)
+		changes.add(platform+" update URL", before.UpdateURL, after.UpdateURL)
+	}
+	return changes
+}
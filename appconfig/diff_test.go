@@ -0,0 +1,26 @@
+package appconfig
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	from := DefaultConfig()
+	to := DefaultConfig()
+	to.MaintenanceMode = true
+	to.UpdateMessage = ""
+	to.Platforms = map[string]PlatformConfig{"ios": {LatestVersion: "2.0.0"}}
+
+	want := []string{
+		`update message: 🎉 New version available! Update now for better experience. → ""`,
+		"maintenance mode: false → true",
+		`ios latest version: "" → 2.0.0`,
+	}
+	if got := Diff(&from, &to); !slices.Equal(got, want) {
+		t.Errorf("Diff = %q, want %q", got, want)
+	}
+	if got := Diff(&to, &to); len(got) != 0 {
+		t.Errorf("Diff of a version with itself = %q", got)
+	}
+}
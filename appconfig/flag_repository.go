@@ -0,0 +1,280 @@
+package appconfig
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+)
+
+var (
+	// ErrFlagNotFound is returned when a flag doesn't exist
+	ErrFlagNotFound = errors.New("flag not found")
+	// ErrFlagExists is returned when a flag key is taken
+	ErrFlagExists = errors.New("flag already exists")
+)
+
+// FlagRepository stores feature flags and the history of their changes.
+// Every write records a FlagChange.
+type FlagRepository interface {
+	// ListFlags returns every flag in key order
+	ListFlags() ([]Flag, error)
+	// GetFlag returns a flag or ErrFlagNotFound
+	GetFlag(id int) (*Flag, error)
+	// CreateFlag adds a flag or returns ErrFlagExists
+	CreateFlag(f Flag) (*Flag, error)
+	// UpdateFlag saves the rules of a flag; its key is kept
+	UpdateFlag(f Flag) (*Flag, error)
+	DeleteFlag(id int) error
+	// ListFlagChanges returns the latest changes, newest first
+	ListFlagChanges(limit int) ([]FlagChange, error)
+}
+
+// SQLFlagRepository is a FlagRepository backed by the feature_flags and
+// feature_flag_changes tables
+type SQLFlagRepository struct {
+	db *sql.DB
+}
+
+// NewSQLFlagRepository creates the feature flag tables if needed
+func NewSQLFlagRepository(db *sql.DB) *SQLFlagRepository {
+	r := &SQLFlagRepository{db: db}
+	r.createTables()
+	return r
+}
+
+func (r *SQLFlagRepository) createTables() {
+	query := `
+		CREATE TABLE IF NOT EXISTS feature_flags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			key TEXT NOT NULL UNIQUE,
+			description TEXT NOT NULL DEFAULT '',
+			enabled BOOLEAN NOT NULL DEFAULT 0,
+			platforms TEXT NOT NULL DEFAULT '',
+			min_version TEXT NOT NULL DEFAULT '',
+			max_version TEXT NOT NULL DEFAULT '',
+			segments TEXT NOT NULL DEFAULT '',
+			percentage INTEGER NOT NULL DEFAULT 100,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS feature_flag_changes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			flag_id INTEGER NOT NULL,
+			flag_key TEXT NOT NULL,
+			action TEXT NOT NULL,
+			old_value TEXT NOT NULL DEFAULT '',
+			new_value TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+	`
+	if _, err := r.db.Exec(query); err != nil {
+		slog.Error("failed to create feature flag tables", "error", err)
+	}
+}
+
+const selectFlag = `SELECT id, key, description, enabled, platforms, min_version, max_version,
+	segments, percentage, created_at, updated_at FROM feature_flags`
+
+func scanFlag(row interface{ Scan(...any) error }) (*Flag, error) {
+	var f Flag
+	var platforms, segments string
+	err := row.Scan(&f.ID, &f.Key, &f.Description, &f.Enabled, &platforms, &f.MinVersion, &f.MaxVersion,
+		&segments, &f.Percentage, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	f.Platforms, f.Segments = splitList(platforms), splitList(segments)
+	return &f, nil
+}
+
+// splitList splits a comma-separated column
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+// ListFlags returns every flag in key order
+func (r *SQLFlagRepository) ListFlags() ([]Flag, error) {
+	rows, err := r.db.Query(selectFlag + " ORDER BY key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flags []Flag
+	for rows.Next() {
+		f, err := scanFlag(rows)
+		if err != nil {
+			return nil, err
+		}
+		flags = append(flags, *f)
+	}
+	return flags, rows.Err()
+}
+
+// GetFlag fetches one flag
+func (r *SQLFlagRepository) GetFlag(id int) (*Flag, error) {
+	f, err := scanFlag(r.db.QueryRow(selectFlag+" WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrFlagNotFound
+	}
+	return f, err
+}
+
+// CreateFlag inserts a flag and records its creation
+func (r *SQLFlagRepository) CreateFlag(f Flag) (*Flag, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO feature_flags (key, description, enabled, platforms, min_version, max_version, segments, percentage)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (key) DO NOTHING
+		RETURNING id`,
+		f.Key, f.Description, f.Enabled, strings.Join(f.Platforms, ","), f.MinVersion, f.MaxVersion,
+		strings.Join(f.Segments, ","), f.Percentage,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrFlagExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	created, err := scanFlag(tx.QueryRow(selectFlag+" WHERE id = $1", id))
+	if err != nil {
+		return nil, err
+	}
+	if err := recordFlagChange(tx, FlagCreated, nil, created); err != nil {
+		return nil, err
+	}
+	return created, tx.Commit()
+}
+
+// UpdateFlag saves the rules of a flag and records the change
+func (r *SQLFlagRepository) UpdateFlag(f Flag) (*Flag, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := scanFlag(tx.QueryRow(selectFlag+" WHERE id = $1", f.ID))
+	if err == sql.ErrNoRows {
+		return nil, ErrFlagNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		UPDATE feature_flags SET description = $1, enabled = $2, platforms = $3, min_version = $4,
+			max_version = $5, segments = $6, percentage = $7, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $8`,
+		f.Description, f.Enabled, strings.Join(f.Platforms, ","), f.MinVersion,
+		f.MaxVersion, strings.Join(f.Segments, ","), f.Percentage, f.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	after, err := scanFlag(tx.QueryRow(selectFlag+" WHERE id = $1", f.ID))
+	if err != nil {
+		return nil, err
+	}
+	if err := recordFlagChange(tx, FlagUpdated, before, after); err != nil {
+		return nil, err
+	}
+	return after, tx.Commit()
+}
+
+// DeleteFlag removes a flag and records its last state. Its history is
+// kept.
+func (r *SQLFlagRepository) DeleteFlag(id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := scanFlag(tx.QueryRow(selectFlag+" WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return ErrFlagNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM feature_flags WHERE id = $1", id); err != nil {
+		return err
+	}
+	if err := recordFlagChange(tx, FlagDeleted, before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// recordFlagChange stores the flag states around a change as JSON
+func recordFlagChange(tx *sql.Tx, action string, before, after *Flag) error {
+	flag := after
+	if flag == nil {
+		flag = before
+	}
+	var values [2]string
+	for i, f := range []*Flag{before, after} {
+		if f == nil {
+			continue
+		}
+		b, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		values[i] = string(b)
+	}
+	_, err := tx.Exec(`
+		INSERT INTO feature_flag_changes (flag_id, flag_key, action, old_value, new_value)
+		VALUES ($1, $2, $3, $4, $5)`,
+		flag.ID, flag.Key, action, values[0], values[1],
+	)
+	if err == nil {
+		slog.Info("feature flag changed", "key", flag.Key, "action", action)
+	}
+	return err
+}
+
+// ListFlagChanges returns the latest changes, newest first
+func (r *SQLFlagRepository) ListFlagChanges(limit int) ([]FlagChange, error) {
+	rows, err := r.db.Query(`
+		SELECT id, flag_id, flag_key, action, old_value, new_value, created_at
+		FROM feature_flag_changes
+		ORDER BY id DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []FlagChange
+	for rows.Next() {
+		var fc FlagChange
+		var values [2]string
+		if err := rows.Scan(&fc.ID, &fc.FlagID, &fc.Key, &fc.Action, &values[0], &values[1], &fc.CreatedAt); err != nil {
+			return nil, err
+		}
+		for i, dst := range []**Flag{&fc.Before, &fc.After} {
+			if values[i] == "" {
+				continue
+			}
+			*dst = new(Flag)
+			if err := json.Unmarshal([]byte(values[i]), *dst); err != nil {
+				return nil, err
+			}
+		}
+		changes = append(changes, fc)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,193 @@
+package appconfig
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"thaimaster2d/appuser"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var flagKeyRe = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Flag is a remote feature flag. An enabled flag is on for the clients
+// matching all of its targeting rules; empty rules match every client.
+type Flag struct {
+	ID int `json:"id"`
+	// Key names the flag in the app, e.g. threed_ticket_checker. It can't
+	// be changed once created.
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	// Platforms limits the flag to some of Platforms
+	Platforms  []string `json:"platforms"`
+	MinVersion string   `json:"min_version"`
+	MaxVersion string   `json:"max_version"`
+	// Segments limits the flag to clients in one of these user segments,
+	// e.g. beta or staff
+	Segments []string `json:"segments"`
+	// Percentage rolls the flag out to a share of devices, from 0 to 100.
+	// Below 100 clients must send their device ID.
+	Percentage int       `json:"percentage"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// FlagClient describes the app asking for its flags
+type FlagClient struct {
+	Platform string
+	Version  string
+	DeviceID string
+	Segments []string
+}
+
+// Validate normalizes the targeting rules of a flag and checks them
+// before it is saved
+func (f *Flag) Validate() error {
+	f.Key = strings.TrimSpace(f.Key)
+	if !flagKeyRe.MatchString(f.Key) {
+		return errors.New("key must be up to 64 lowercase letters, digits and underscores, starting with a letter")
+	}
+	f.Platforms = normalizeList(f.Platforms)
+	for _, platform := range f.Platforms {
+		if !slices.Contains(Platforms, platform) {
+			return fmt.Errorf("unknown platform %q", platform)
+		}
+	}
+	f.MinVersion, f.MaxVersion = strings.TrimSpace(f.MinVersion), strings.TrimSpace(f.MaxVersion)
+	for _, v := range []string{f.MinVersion, f.MaxVersion} {
+		if _, err := ParseVersion(v); v != "" && err != nil {
+			return err
+		}
+	}
+	if f.MinVersion != "" && f.MaxVersion != "" && CompareVersions(f.MinVersion, f.MaxVersion) > 0 {
+		return fmt.Errorf("minimum version %s is above maximum version %s", f.MinVersion, f.MaxVersion)
+	}
+	f.Segments = normalizeList(f.Segments)
+	if f.Percentage < 0 || f.Percentage > 100 {
+		return errors.New("percentage must be from 0 to 100")
+	}
+	return nil
+}
+
+// normalizeList lowercases and trims the entries of a list, dropping empty
+// and repeated ones
+func normalizeList(list []string) []string {
+	normalized := []string{}
+	for _, s := range list {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s != "" && !slices.Contains(normalized, s) {
+			normalized = append(normalized, s)
+		}
+	}
+	return normalized
+}
+
+// Evaluate reports whether the flag is on for a client
+func (f *Flag) Evaluate(client FlagClient) bool {
+	if !f.Enabled {
+		return false
+	}
+	if len(f.Platforms) > 0 && !slices.Contains(f.Platforms, client.Platform) {
+		return false
+	}
+	if (f.MinVersion != "" || f.MaxVersion != "") && client.Version == "" {
+		return false
+	}
+	if f.MinVersion != "" && CompareVersions(client.Version, f.MinVersion) < 0 {
+		return false
+	}
+	if f.MaxVersion != "" && CompareVersions(client.Version, f.MaxVersion) > 0 {
+		return false
+	}
+	if len(f.Segments) > 0 && !slices.ContainsFunc(client.Segments, func(s string) bool {
+		return slices.Contains(f.Segments, s)
+	}) {
+		return false
+	}
+	if f.Percentage < 100 {
+		return client.DeviceID != "" && bucket(f.Key, client.DeviceID) < f.Percentage
+	}
+	return true
+}
+
+// bucket places a device in one of 100 buckets of a flag. A device keeps
+// its bucket as a rollout grows, and each flag spreads devices differently.
+func bucket(key, deviceID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key + ":" + deviceID))
+	return int(h.Sum32() % 100)
+}
+
+// Flag change actions
+const (
+	FlagCreated = "created"
+	FlagUpdated = "updated"
+	FlagDeleted = "deleted"
+)
+
+// FlagChange records one change to a flag with its state before and after.
+// Before is nil when the flag was created and After when it was deleted.
+type FlagChange struct {
+	ID        int       `json:"id"`
+	FlagID    int       `json:"flag_id"`
+	Key       string    `json:"key"`
+	Action    string    `json:"action"`
+	Before    *Flag     `json:"before"`
+	After     *Flag     `json:"after"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Changes describes what an update changed, one field per line
+func (fc FlagChange) Changes() []string {
+	if fc.Before == nil || fc.After == nil {
+		return nil
+	}
+	var changes changeList
+	b, a := fc.Before, fc.After
+	changes.add("description", b.Description, a.Description)
+	changes.add("enabled", b.Enabled, a.Enabled)
+	changes.add("platforms", strings.Join(b.Platforms, ","), strings.Join(a.Platforms, ","))
+	changes.add("min version", b.MinVersion, a.MinVersion)
+	changes.add("max version", b.MaxVersion, a.MaxVersion)
+	changes.add("segments", strings.Join(b.Segments, ","), strings.Join(a.Segments, ","))
+	changes.add("percentage", b.Percentage, a.Percentage)
+	return changes
+}
+
+// Flags evaluates every feature flag for the app asking. The app sends
+// ?platform=, ?version= and ?device_id=; flags whose rules need a missing
+// value are off. Segments come from the signed-in app user, never from
+// the request, so signed-out apps match no segment.
+func (h *Handler) Flags(c *gin.Context) {
+	client := FlagClient{
+		Platform: strings.ToLower(c.Query("platform")),
+		Version:  c.Query("version"),
+		DeviceID: c.Query("device_id"),
+	}
+	if u := appuser.Current(c); u != nil {
+		client.Segments = u.Segments
+	}
+	if !validPlatform(client.Platform) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "platform must be android, ios or web"})
+		return
+	}
+
+	flags, err := h.flags.ListFlags()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch flags"})
+		return
+	}
+	evaluated := make(map[string]bool, len(flags))
+	for _, f := range flags {
+		evaluated[f.Key] = f.Evaluate(client)
+	}
+	c.JSON(http.StatusOK, gin.H{"flags": evaluated})
+}
@@ -0,0 +1,75 @@
+package appconfig
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFlagEvaluate(t *testing.T) {
+	f := Flag{
+		Key: "threed_ticket_checker", Enabled: true, Platforms: []string{"android"},
+		MinVersion: "1.4.0", MaxVersion: "2.0.0", Segments: []string{"beta"}, Percentage: 100,
+	}
+	if err := f.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		client FlagClient
+		want   bool
+	}{
+		{FlagClient{Platform: "android", Version: "1.10.0", Segments: []string{"staff", "beta"}}, true},
+		{FlagClient{Platform: "android", Version: "2.0.0-rc.1", Segments: []string{"beta"}}, true},
+		{FlagClient{Platform: "ios", Version: "1.10.0", Segments: []string{"beta"}}, false},
+		{FlagClient{Platform: "android", Version: "1.3.9", Segments: []string{"beta"}}, false},
+		{FlagClient{Platform: "android", Version: "2.0.1", Segments: []string{"beta"}}, false},
+		{FlagClient{Platform: "android", Segments: []string{"beta"}}, false},
+		{FlagClient{Platform: "android", Version: "1.10.0"}, false},
+	} {
+		if got := f.Evaluate(tc.client); got != tc.want {
+			t.Errorf("Evaluate(%+v) = %v, want %v", tc.client, got, tc.want)
+		}
+	}
+	f.Enabled = false
+	if f.Evaluate(FlagClient{Platform: "android", Version: "1.10.0", Segments: []string{"beta"}}) {
+		t.Error("disabled flag is on")
+	}
+}
+
+func TestFlagRollout(t *testing.T) {
+	small := Flag{Key: "new_home", Enabled: true, Percentage: 10}
+	large := Flag{Key: "new_home", Enabled: true, Percentage: 30}
+	on := 0
+	for i := range 10000 {
+		client := FlagClient{DeviceID: fmt.Sprintf("device-%d", i)}
+		if small.Evaluate(client) {
+			on++
+			if !large.Evaluate(client) {
+				t.Fatalf("%s left the rollout as it grew", client.DeviceID)
+			}
+		}
+	}
+	if on < 900 || on > 1100 {
+		t.Errorf("10%% rollout reached %d of 10000 devices", on)
+	}
+	if small.Evaluate(FlagClient{}) {
+		t.Error("partial rollout is on without a device ID")
+	}
+}
+
+func TestFlagValidate(t *testing.T) {
+	f := Flag{Key: "dark_mode", Platforms: []string{" iOS ", "ios"}, Segments: []string{"Beta", " ", "beta"}}
+	if err := f.Validate(); err != nil || len(f.Platforms) != 1 || len(f.Segments) != 1 || f.Segments[0] != "beta" {
+		t.Errorf("Validate = %v, %+v", err, f)
+	}
+	for _, f := range []Flag{
+		{Key: "Dark Mode"},
+		{Key: "dark_mode", Platforms: []string{"windows"}},
+		{Key: "dark_mode", MinVersion: "1.x"},
+		{Key: "dark_mode", MinVersion: "2.0.0", MaxVersion: "1.0.0"},
+		{Key: "dark_mode", Percentage: 101},
+	} {
+		if err := f.Validate(); err == nil {
+			t.Errorf("Validate accepted %+v", f)
+		}
+	}
+}
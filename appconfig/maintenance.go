@@ -0,0 +1,246 @@
+package appconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaintenanceInterval is how often the scheduler checks the windows
+var MaintenanceInterval = 15 * time.Second
+
+// Maintenance window statuses
+const (
+	WindowPending = "pending"
+	WindowActive  = "active"
+	WindowDone    = "done"
+)
+
+var localeRe = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]+)*$`)
+
+// MaintenanceWindow is a scheduled maintenance. The scheduler switches
+// maintenance mode on when it starts and off when it ends.
+type MaintenanceWindow struct {
+	ID       int       `json:"id"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	// Message is shown in locales without a message of their own
+	Message string `json:"message"`
+	// Messages holds the message in other locales, e.g. "my" or "th". A
+	// locale such as "my" is also used for "my-MM".
+	Messages  map[string]string `json:"messages"`
+	Status    string            `json:"status"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// MaintenanceNotice tells clients about a maintenance window in their
+// locale
+type MaintenanceNotice struct {
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	Message  string    `json:"message"`
+}
+
+// Validate normalizes a window before it is scheduled and checks it
+// against now and the windows already scheduled, which it may not overlap
+func (w *MaintenanceWindow) Validate(now time.Time, scheduled []MaintenanceWindow) error {
+	if !w.EndsAt.After(w.StartsAt) {
+		return errors.New("the window must end after it starts")
+	}
+	if !w.EndsAt.After(now) {
+		return errors.New("the window has already ended")
+	}
+	w.Message = strings.TrimSpace(w.Message)
+	if w.Message == "" {
+		return errors.New("a default message is required")
+	}
+	messages := make(map[string]string, len(w.Messages))
+	for locale, message := range w.Messages {
+		locale = strings.ToLower(strings.TrimSpace(locale))
+		if !localeRe.MatchString(locale) {
+			return fmt.Errorf("invalid locale %q", locale)
+		}
+		if message = strings.TrimSpace(message); message != "" {
+			messages[locale] = message
+		}
+	}
+	w.Messages = messages
+	for _, other := range scheduled {
+		if w.StartsAt.Before(other.EndsAt) && other.StartsAt.Before(w.EndsAt) {
+			return fmt.Errorf("the window overlaps window %d", other.ID)
+		}
+	}
+	return nil
+}
+
+// MessageFor returns the message in a locale, or in its language, falling
+// back to the default message
+func (w MaintenanceWindow) MessageFor(locale string) string {
+	if message, ok := w.Messages[locale]; ok {
+		return message
+	}
+	language, _, _ := strings.Cut(locale, "-")
+	if message, ok := w.Messages[language]; ok {
+		return message
+	}
+	return w.Message
+}
+
+// Notice returns the window as clients in a locale see it
+func (w MaintenanceWindow) Notice(locale string) *MaintenanceNotice {
+	return &MaintenanceNotice{StartsAt: w.StartsAt, EndsAt: w.EndsAt, Message: w.MessageFor(locale)}
+}
+
+// requestLocale reads the ?locale= of a request, falling back to the first
+// Accept-Language tag
+func requestLocale(c *gin.Context) string {
+	locale := c.Query("locale")
+	if locale == "" {
+		locale, _, _ = strings.Cut(c.GetHeader("Accept-Language"), ",")
+		locale, _, _ = strings.Cut(locale, ";")
+	}
+	return strings.ToLower(strings.TrimSpace(locale))
+}
+
+// addMaintenance adds the scheduled maintenance to a version check: the
+// localized message and end of the window in progress, or the next window
+func (h *Handler) addMaintenance(check *VersionCheck, config *AppConfig, locale string) error {
+	windows, err := h.windows.ScheduledWindows()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, w := range windows {
+		switch {
+		case w.Status == WindowActive && config.AppEnabled && config.MaintenanceMode:
+			check.Message = w.MessageFor(locale)
+			check.MaintenanceEndsAt = &w.EndsAt
+		case w.Status == WindowPending && now.Before(w.StartsAt) && check.UpcomingMaintenance == nil:
+			check.UpcomingMaintenance = w.Notice(locale)
+		}
+	}
+	return nil
+}
+
+// MaintenanceScheduler switches maintenance mode on and off as scheduled
+// windows start and end
+type MaintenanceScheduler struct {
+	configs AppConfigRepository
+	windows MaintenanceRepository
+	notify  func(ctx context.Context, config *AppConfig, w MaintenanceWindow)
+}
+
+// NewMaintenanceScheduler creates a scheduler saving configs to configs.
+// notify is called with the saved config each time the scheduler switches
+// maintenance mode.
+func NewMaintenanceScheduler(configs AppConfigRepository, windows MaintenanceRepository,
+	notify func(ctx context.Context, config *AppConfig, w MaintenanceWindow)) *MaintenanceScheduler {
+	return &MaintenanceScheduler{configs: configs, windows: windows, notify: notify}
+}
+
+// Repository returns the window store
+func (s *MaintenanceScheduler) Repository() MaintenanceRepository {
+	return s.windows
+}
+
+// ActiveWindow returns the window in progress, nil if there is none
+func (s *MaintenanceScheduler) ActiveWindow() (*MaintenanceWindow, error) {
+	windows, err := s.windows.ScheduledWindows()
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range windows {
+		if w.Status == WindowActive {
+			return &w, nil
+		}
+	}
+	return nil, nil
+}
+
+// Start checks the windows every MaintenanceInterval until ctx is done.
+// The returned channel is closed once it has stopped.
+func (s *MaintenanceScheduler) Start(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(MaintenanceInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.Sync(ctx, time.Now()); err != nil {
+				slog.Error("failed to sync maintenance windows", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	slog.Info("maintenance scheduler started", "interval", MaintenanceInterval.String())
+	return done
+}
+
+// Sync starts and ends the windows due at now. Windows that ended before
+// they could start, e.g. while the server was down, are skipped.
+func (s *MaintenanceScheduler) Sync(ctx context.Context, now time.Time) error {
+	windows, err := s.windows.ScheduledWindows()
+	if err != nil {
+		return err
+	}
+	for _, w := range windows {
+		var status string
+		switch {
+		case w.Status == WindowPending && !now.Before(w.EndsAt):
+			slog.Warn("skipped missed maintenance window", "window", w.ID, "ends_at", w.EndsAt)
+			status = WindowDone
+		case w.Status == WindowPending && !now.Before(w.StartsAt):
+			status = WindowActive
+		case w.Status == WindowActive && !now.Before(w.EndsAt):
+			status = WindowDone
+		default:
+			continue
+		}
+		if status == WindowActive || w.Status == WindowActive {
+			if err := s.switchMaintenance(ctx, status == WindowActive, w); err != nil {
+				return err
+			}
+		}
+		if err := s.windows.SetWindowStatus(w.ID, status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// switchMaintenance saves a config version with maintenance mode on or off
+// unless an admin already switched it
+func (s *MaintenanceScheduler) switchMaintenance(ctx context.Context, on bool, w MaintenanceWindow) error {
+	config, err := s.configs.Get()
+	if err != nil {
+		return err
+	}
+	if config.MaintenanceMode == on {
+		return nil
+	}
+	config.MaintenanceMode = on
+	config.RestoredFrom = 0
+	if _, err := s.configs.Update(*config); err != nil {
+		return err
+	}
+	slog.Info("switched maintenance mode", "on", on, "window", w.ID)
+
+	saved, err := s.configs.Get()
+	if err != nil {
+		return err
+	}
+	if s.notify != nil {
+		s.notify(ctx, saved, w)
+	}
+	return nil
+}
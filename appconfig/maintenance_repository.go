@@ -0,0 +1,155 @@
+package appconfig
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// ErrWindowNotFound is returned when a maintenance window doesn't exist or
+// isn't in the state an operation needs
+var ErrWindowNotFound = errors.New("maintenance window not found")
+
+// MaintenanceRepository stores maintenance windows
+type MaintenanceRepository interface {
+	// ListWindows returns the latest windows, the last to start first
+	ListWindows(limit int) ([]MaintenanceWindow, error)
+	// ScheduledWindows returns the pending and active windows in start
+	// order
+	ScheduledWindows() ([]MaintenanceWindow, error)
+	CreateWindow(w MaintenanceWindow) (*MaintenanceWindow, error)
+	SetWindowStatus(id int, status string) error
+	// CancelWindow deletes a pending window
+	CancelWindow(id int) error
+	// EndWindow moves the end of an active window to at
+	EndWindow(id int, at time.Time) error
+}
+
+// SQLMaintenanceRepository is a MaintenanceRepository backed by the
+// maintenance_windows table
+type SQLMaintenanceRepository struct {
+	db *sql.DB
+}
+
+// NewSQLMaintenanceRepository creates the maintenance_windows table if
+// needed
+func NewSQLMaintenanceRepository(db *sql.DB) *SQLMaintenanceRepository {
+	r := &SQLMaintenanceRepository{db: db}
+	r.createTable()
+	return r
+}
+
+func (r *SQLMaintenanceRepository) createTable() {
+	query := `
+		CREATE TABLE IF NOT EXISTS maintenance_windows (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			starts_at DATETIME NOT NULL,
+			ends_at DATETIME NOT NULL,
+			message TEXT NOT NULL,
+			messages TEXT NOT NULL DEFAULT '{}',
+			status TEXT NOT NULL DEFAULT 'pending',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_maintenance_windows_status ON maintenance_windows(status, starts_at);
+	`
+	if _, err := r.db.Exec(query); err != nil {
+		slog.Error("failed to create maintenance_windows table", "error", err)
+	}
+}
+
+const selectWindow = `SELECT id, starts_at, ends_at, message, messages, status, created_at FROM maintenance_windows`
+
+func scanWindow(row interface{ Scan(...any) error }) (*MaintenanceWindow, error) {
+	var w MaintenanceWindow
+	var messages string
+	if err := row.Scan(&w.ID, &w.StartsAt, &w.EndsAt, &w.Message, &messages, &w.Status, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(messages), &w.Messages); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (r *SQLMaintenanceRepository) query(query string, args ...any) ([]MaintenanceWindow, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var windows []MaintenanceWindow
+	for rows.Next() {
+		w, err := scanWindow(rows)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, *w)
+	}
+	return windows, rows.Err()
+}
+
+// ListWindows returns the latest windows, the last to start first
+func (r *SQLMaintenanceRepository) ListWindows(limit int) ([]MaintenanceWindow, error) {
+	return r.query(selectWindow+" ORDER BY starts_at DESC, id DESC LIMIT $1", limit)
+}
+
+// ScheduledWindows returns the pending and active windows in start order
+func (r *SQLMaintenanceRepository) ScheduledWindows() ([]MaintenanceWindow, error) {
+	return r.query(selectWindow+" WHERE status IN ($1, $2) ORDER BY starts_at, id", WindowPending, WindowActive)
+}
+
+// CreateWindow schedules a window
+func (r *SQLMaintenanceRepository) CreateWindow(w MaintenanceWindow) (*MaintenanceWindow, error) {
+	messages, err := json.Marshal(w.Messages)
+	if err != nil {
+		return nil, err
+	}
+	if w.Messages == nil {
+		messages = []byte("{}")
+	}
+	w.StartsAt, w.EndsAt = w.StartsAt.UTC(), w.EndsAt.UTC()
+	w.Status = WindowPending
+	err = r.db.QueryRow(`
+		INSERT INTO maintenance_windows (starts_at, ends_at, message, messages, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		w.StartsAt, w.EndsAt, w.Message, string(messages), w.Status,
+	).Scan(&w.ID, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("maintenance window scheduled", "window", w.ID, "starts_at", w.StartsAt, "ends_at", w.EndsAt)
+	return &w, nil
+}
+
+// SetWindowStatus records that a window started or ended
+func (r *SQLMaintenanceRepository) SetWindowStatus(id int, status string) error {
+	return r.exec("UPDATE maintenance_windows SET status = $1 WHERE id = $2", status, id)
+}
+
+// CancelWindow deletes a pending window
+func (r *SQLMaintenanceRepository) CancelWindow(id int) error {
+	return r.exec("DELETE FROM maintenance_windows WHERE id = $1 AND status = $2", id, WindowPending)
+}
+
+// EndWindow moves the end of an active window
+func (r *SQLMaintenanceRepository) EndWindow(id int, at time.Time) error {
+	return r.exec("UPDATE maintenance_windows SET ends_at = $1 WHERE id = $2 AND status = $3", at.UTC(), id, WindowActive)
+}
+
+// exec runs a statement changing one window, or returns ErrWindowNotFound
+func (r *SQLMaintenanceRepository) exec(query string, args ...any) error {
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrWindowNotFound
+	}
+	return nil
+}
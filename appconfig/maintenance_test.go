@@ -0,0 +1,93 @@
+package appconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindowValidate(t *testing.T) {
+	now := time.Date(2025, 10, 16, 12, 0, 0, 0, time.UTC)
+	scheduled := []MaintenanceWindow{{ID: 1, StartsAt: now.Add(2 * time.Hour), EndsAt: now.Add(3 * time.Hour)}}
+
+	w := MaintenanceWindow{
+		StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour), Message: " Back soon ",
+		Messages: map[string]string{" TH ": " ปิดปรับปรุง ", "my": " "},
+	}
+	if err := w.Validate(now, scheduled); err != nil {
+		t.Fatal(err)
+	}
+	if w.Message != "Back soon" || len(w.Messages) != 1 || w.Messages["th"] != "ปิดปรับปรุง" {
+		t.Errorf("normalized window = %+v", w)
+	}
+
+	for name, w := range map[string]MaintenanceWindow{
+		"ends before it starts": {StartsAt: now.Add(time.Hour), EndsAt: now.Add(time.Hour), Message: "x"},
+		"already ended":         {StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour), Message: "x"},
+		"no message":            {StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour), Message: " "},
+		"invalid locale":        {StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour), Message: "x", Messages: map[string]string{"thai!": "x"}},
+		"overlapping":           {StartsAt: now.Add(150 * time.Minute), EndsAt: now.Add(4 * time.Hour), Message: "x"},
+	} {
+		if err := w.Validate(now, scheduled); err == nil {
+			t.Errorf("%s: window accepted", name)
+		}
+	}
+}
+
+func TestMaintenanceMessageFor(t *testing.T) {
+	w := MaintenanceWindow{Message: "default", Messages: map[string]string{"my": "my", "zh-hant": "zh-hant"}}
+	for locale, want := range map[string]string{
+		"my":      "my",
+		"my-mm":   "my",
+		"zh-hant": "zh-hant",
+		"zh-hans": "default",
+		"th":      "default",
+		"":        "default",
+	} {
+		if got := w.MessageFor(locale); got != want {
+			t.Errorf("MessageFor(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestMaintenanceSchedulerSync(t *testing.T) {
+	configs, windows := NewMemoryRepository(), NewMemoryMaintenanceRepository()
+	var notified []bool
+	s := NewMaintenanceScheduler(configs, windows, func(ctx context.Context, config *AppConfig, w MaintenanceWindow) {
+		notified = append(notified, config.MaintenanceMode)
+	})
+	start := time.Date(2025, 10, 16, 2, 0, 0, 0, time.UTC)
+	windows.CreateWindow(MaintenanceWindow{StartsAt: start, EndsAt: start.Add(time.Hour), Message: "x"})
+	windows.CreateWindow(MaintenanceWindow{StartsAt: start.Add(2 * time.Hour), EndsAt: start.Add(3 * time.Hour), Message: "x"})
+
+	maintenance := func(at time.Time) bool {
+		t.Helper()
+		if err := s.Sync(context.Background(), at); err != nil {
+			t.Fatal(err)
+		}
+		config, _ := configs.Get()
+		return config.MaintenanceMode
+	}
+	if maintenance(start.Add(-time.Minute)) {
+		t.Error("maintenance on before the window")
+	}
+	if !maintenance(start) {
+		t.Error("maintenance off during the window")
+	}
+	if !maintenance(start.Add(30 * time.Minute)) {
+		t.Error("maintenance off during the window")
+	}
+	// The second window is missed while the server is down
+	if maintenance(start.Add(4 * time.Hour)) {
+		t.Error("maintenance on after the windows")
+	}
+	if len(notified) != 2 || !notified[0] || notified[1] {
+		t.Errorf("notified %v, want [true false]", notified)
+	}
+	if scheduled, _ := windows.ScheduledWindows(); len(scheduled) != 0 {
+		t.Errorf("windows still scheduled: %+v", scheduled)
+	}
+	if history, _ := configs.History(10); len(history) != 3 {
+		t.Errorf("saved %d config versions, want 3", len(history))
+	}
+}
@@ -0,0 +1,279 @@
+package appconfig
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryRepository is an in-memory AppConfigRepository for tests
+type MemoryRepository struct {
+	mu       sync.Mutex
+	versions []AppConfig
+}
+
+// NewMemoryRepository returns a repository holding the default config
+func NewMemoryRepository() *MemoryRepository {
+	r := &MemoryRepository{}
+	r.Update(DefaultConfig())
+	return r
+}
+
+// Get returns a copy of the current config
+func (r *MemoryRepository) Get() (*AppConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.version(len(r.versions))
+}
+
+// version returns a copy of a version
+func (r *MemoryRepository) version(version int) (*AppConfig, error) {
+	if version < 1 || version > len(r.versions) {
+		return nil, ErrVersionNotFound
+	}
+	config := r.versions[version-1]
+	config.Platforms = maps.Clone(config.Platforms)
+	return &config, nil
+}
+
+// GetVersion returns a copy of a saved version
+func (r *MemoryRepository) GetVersion(version int) (*AppConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.version(version)
+}
+
+// History returns copies of the latest versions, newest first
+func (r *MemoryRepository) History(limit int) ([]AppConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var history []AppConfig
+	for v := len(r.versions); v > 0 && len(history) < limit; v-- {
+		config, _ := r.version(v)
+		history = append(history, *config)
+	}
+	return history, nil
+}
+
+// Update appends the config as the next version
+func (r *MemoryRepository) Update(input AppConfig) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	input.Version = len(r.versions) + 1
+	input.ID = input.Version
+	input.CreatedAt = time.Now()
+	input.UpdatedAt = input.CreatedAt
+	input.Platforms = maps.Clone(input.Platforms)
+	if input.Platforms == nil {
+		input.Platforms = map[string]PlatformConfig{}
+	}
+	r.versions = append(r.versions, input)
+	return input.Version, nil
+}
+
+// MemoryFlagRepository is an in-memory FlagRepository for tests
+type MemoryFlagRepository struct {
+	mu      sync.Mutex
+	flags   []Flag
+	changes []FlagChange
+	nextID  int
+}
+
+// NewMemoryFlagRepository returns a repository without flags
+func NewMemoryFlagRepository() *MemoryFlagRepository {
+	return &MemoryFlagRepository{nextID: 1}
+}
+
+// ListFlags returns copies of the flags in key order
+func (r *MemoryFlagRepository) ListFlags() ([]Flag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	flags := slices.Clone(r.flags)
+	slices.SortFunc(flags, func(a, b Flag) int { return strings.Compare(a.Key, b.Key) })
+	return flags, nil
+}
+
+// GetFlag returns a copy of a flag or ErrFlagNotFound
+func (r *MemoryFlagRepository) GetFlag(id int) (*Flag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, f := range r.flags {
+		if f.ID == id {
+			return &f, nil
+		}
+	}
+	return nil, ErrFlagNotFound
+}
+
+// CreateFlag adds a flag with the next ID
+func (r *MemoryFlagRepository) CreateFlag(f Flag) (*Flag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if slices.ContainsFunc(r.flags, func(existing Flag) bool { return existing.Key == f.Key }) {
+		return nil, ErrFlagExists
+	}
+	f.ID = r.nextID
+	r.nextID++
+	f.CreatedAt = time.Now()
+	f.UpdatedAt = f.CreatedAt
+	r.flags = append(r.flags, f)
+	r.record(FlagCreated, nil, &f)
+	return &f, nil
+}
+
+// UpdateFlag replaces the rules of a flag, keeping its key
+func (r *MemoryFlagRepository) UpdateFlag(f Flag) (*Flag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, before := range r.flags {
+		if before.ID == f.ID {
+			f.Key = before.Key
+			f.CreatedAt = before.CreatedAt
+			f.UpdatedAt = time.Now()
+			r.flags[i] = f
+			r.record(FlagUpdated, &before, &f)
+			return &f, nil
+		}
+	}
+	return nil, ErrFlagNotFound
+}
+
+// DeleteFlag removes a flag, keeping its history
+func (r *MemoryFlagRepository) DeleteFlag(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, before := range r.flags {
+		if before.ID == id {
+			r.flags = slices.Delete(r.flags, i, i+1)
+			r.record(FlagDeleted, &before, nil)
+			return nil
+		}
+	}
+	return ErrFlagNotFound
+}
+
+// record appends a change to the history
+func (r *MemoryFlagRepository) record(action string, before, after *Flag) {
+	flag := after
+	if flag == nil {
+		flag = before
+	}
+	r.changes = append(r.changes, FlagChange{
+		ID:        len(r.changes) + 1,
+		FlagID:    flag.ID,
+		Key:       flag.Key,
+		Action:    action,
+		Before:    before,
+		After:     after,
+		CreatedAt: time.Now(),
+	})
+}
+
+// ListFlagChanges returns the latest changes, newest first
+func (r *MemoryFlagRepository) ListFlagChanges(limit int) ([]FlagChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changes := slices.Clone(r.changes)
+	slices.Reverse(changes)
+	return changes[:min(limit, len(changes))], nil
+}
+
+// MemoryMaintenanceRepository is an in-memory MaintenanceRepository for
+// tests
+type MemoryMaintenanceRepository struct {
+	mu      sync.Mutex
+	windows []MaintenanceWindow
+	nextID  int
+}
+
+// NewMemoryMaintenanceRepository returns a repository without windows
+func NewMemoryMaintenanceRepository() *MemoryMaintenanceRepository {
+	return &MemoryMaintenanceRepository{nextID: 1}
+}
+
+// ListWindows returns copies of the latest windows, the last to start first
+func (r *MemoryMaintenanceRepository) ListWindows(limit int) ([]MaintenanceWindow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	windows := slices.Clone(r.windows)
+	slices.SortStableFunc(windows, func(a, b MaintenanceWindow) int { return b.StartsAt.Compare(a.StartsAt) })
+	return windows[:min(limit, len(windows))], nil
+}
+
+// ScheduledWindows returns copies of the pending and active windows in
+// start order
+func (r *MemoryMaintenanceRepository) ScheduledWindows() ([]MaintenanceWindow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var windows []MaintenanceWindow
+	for _, w := range r.windows {
+		if w.Status == WindowPending || w.Status == WindowActive {
+			windows = append(windows, w)
+		}
+	}
+	slices.SortStableFunc(windows, func(a, b MaintenanceWindow) int { return a.StartsAt.Compare(b.StartsAt) })
+	return windows, nil
+}
+
+// CreateWindow adds a pending window with the next ID
+func (r *MemoryMaintenanceRepository) CreateWindow(w MaintenanceWindow) (*MaintenanceWindow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w.ID = r.nextID
+	r.nextID++
+	w.Status = WindowPending
+	w.Messages = maps.Clone(w.Messages)
+	w.CreatedAt = time.Now()
+	r.windows = append(r.windows, w)
+	return &w, nil
+}
+
+// update changes the window with an ID and one of statuses
+func (r *MemoryMaintenanceRepository) update(id int, statuses []string, change func(w *MaintenanceWindow)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.windows {
+		if r.windows[i].ID == id && slices.Contains(statuses, r.windows[i].Status) {
+			change(&r.windows[i])
+			return nil
+		}
+	}
+	return ErrWindowNotFound
+}
+
+// SetWindowStatus records that a window started or ended
+func (r *MemoryMaintenanceRepository) SetWindowStatus(id int, status string) error {
+	return r.update(id, []string{WindowPending, WindowActive, WindowDone}, func(w *MaintenanceWindow) {
+		w.Status = status
+	})
+}
+
+// CancelWindow deletes a pending window
+func (r *MemoryMaintenanceRepository) CancelWindow(id int) error {
+	return r.update(id, []string{WindowPending}, func(w *MaintenanceWindow) {
+		r.windows = slices.DeleteFunc(r.windows, func(other MaintenanceWindow) bool { return other.ID == id })
+	})
+}
+
+// EndWindow moves the end of an active window
+func (r *MemoryMaintenanceRepository) EndWindow(id int, at time.Time) error {
+	return r.update(id, []string{WindowActive}, func(w *MaintenanceWindow) {
+		w.EndsAt = at
+	})
+}
@@ -0,0 +1,292 @@
+package appconfig
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+)
+
+// ErrVersionNotFound is returned when a config version doesn't exist
+var ErrVersionNotFound = errors.New("config version not found")
+
+// AppConfigRepository stores the app configuration. Saved configurations
+// are never changed: every update adds a version.
+type AppConfigRepository interface {
+	// Get returns the current configuration
+	Get() (*AppConfig, error)
+	// Update saves the configuration as a new version and returns its
+	// number
+	Update(config AppConfig) (int, error)
+	// GetVersion returns a saved version or ErrVersionNotFound
+	GetVersion(version int) (*AppConfig, error)
+	// History returns the latest versions, newest first
+	History(limit int) ([]AppConfig, error)
+}
+
+// SQLRepository is an AppConfigRepository backed by the app_config table
+type SQLRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository creates the app_config table and its default row if needed
+func NewSQLRepository(db *sql.DB) *SQLRepository {
+	r := &SQLRepository{db: db}
+	r.createTable()
+	r.insertDefaultConfig()
+	return r
+}
+
+// Create app_config table if it doesn't exist
+func (r *SQLRepository) createTable() {
+	query := `
+	CREATE TABLE IF NOT EXISTS app_config (
+		id SERIAL PRIMARY KEY,
+		latest_version VARCHAR(20) NOT NULL DEFAULT '1.0.0',
+		minimum_version VARCHAR(20) NOT NULL DEFAULT '1.0.0',
+		update_required BOOLEAN DEFAULT FALSE,
+		update_url TEXT DEFAULT '',
+		update_message TEXT DEFAULT 'A new version is available!',
+		maintenance_mode BOOLEAN DEFAULT FALSE,
+		maintenance_message TEXT DEFAULT 'App is under maintenance. Please try again later.',
+		force_update BOOLEAN DEFAULT FALSE,
+		app_enabled BOOLEAN DEFAULT TRUE,
+		platforms TEXT NOT NULL DEFAULT '{}',
+		restored_from INTEGER,
+		version INTEGER NOT NULL UNIQUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err := r.db.Exec(query)
+	if err == nil {
+		err = r.addColumns()
+	}
+	if err == nil {
+		err = r.numberVersions()
+	}
+	if err != nil {
+		slog.Error("failed to create app_config table", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("app_config table ready")
+}
+
+// addedColumns are the app_config columns added after its first release
+var addedColumns = []struct{ name, definition string }{
+	{"platforms", "TEXT NOT NULL DEFAULT '{}'"},
+	{"restored_from", "INTEGER"},
+	{"version", "INTEGER"},
+}
+
+// addColumns adds the columns missing from tables created before them
+func (r *SQLRepository) addColumns() error {
+	for _, column := range addedColumns {
+		var n int
+		err := r.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('app_config') WHERE name = $1", column.name).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := r.db.Exec("ALTER TABLE app_config ADD COLUMN " + column.name + " " + column.definition); err != nil {
+			return err
+		}
+		slog.Info("added app_config column", "column", column.name)
+	}
+	return nil
+}
+
+// numberVersions numbers the rows saved before the version column in the
+// order they were saved, and makes version numbers unique. Versions are
+// stored rather than derived from rowid, which VACUUM may renumber since
+// id isn't an INTEGER PRIMARY KEY.
+func (r *SQLRepository) numberVersions() error {
+	result, err := r.db.Exec("UPDATE app_config SET version = rowid WHERE version IS NULL")
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		slog.Info("numbered app_config versions", "rows", n)
+	}
+	_, err = r.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_app_config_version ON app_config(version)")
+	return err
+}
+
+// nextVersion is the version number of the next saved config
+const nextVersion = "(SELECT COALESCE(MAX(version), 0) + 1 FROM app_config)"
+
+// Insert default config if table is empty
+func (r *SQLRepository) insertDefaultConfig() {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM app_config").Scan(&count)
+	if err != nil {
+		slog.Error("failed to check app_config", "error", err)
+		return
+	}
+
+	if count == 0 {
+		query := `
+		INSERT INTO app_config (
+			latest_version, 
+			minimum_version, 
+			update_required, 
+			update_url,
+			update_message,
+			maintenance_mode,
+			maintenance_message,
+			force_update,
+			app_enabled,
+			version
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, ` + nextVersion + `)
+		`
+		d := DefaultConfig()
+		_, err = r.db.Exec(
+			query,
+			d.LatestVersion,
+			d.MinimumVersion,
+			d.UpdateRequired,
+			d.UpdateURL,
+			d.UpdateMessage,
+			d.MaintenanceMode,
+			d.MaintenanceMessage,
+			d.ForceUpdate,
+			d.AppEnabled,
+		)
+		if err != nil {
+			slog.Error("failed to insert default app_config", "error", err)
+		} else {
+			slog.Info("default app config inserted")
+		}
+	}
+}
+
+const selectConfig = `
+	SELECT
+		COALESCE(id, version), version, latest_version, minimum_version, update_required,
+		update_url, update_message, maintenance_mode, maintenance_message,
+		force_update, app_enabled, platforms, COALESCE(restored_from, 0), created_at, updated_at
+	FROM app_config
+`
+
+func scanConfig(row interface{ Scan(...any) error }) (*AppConfig, error) {
+	var config AppConfig
+	var platforms string
+	err := row.Scan(
+		&config.ID,
+		&config.Version,
+		&config.LatestVersion,
+		&config.MinimumVersion,
+		&config.UpdateRequired,
+		&config.UpdateURL,
+		&config.UpdateMessage,
+		&config.MaintenanceMode,
+		&config.MaintenanceMessage,
+		&config.ForceUpdate,
+		&config.AppEnabled,
+		&platforms,
+		&config.RestoredFrom,
+		&config.CreatedAt,
+		&config.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(platforms), &config.Platforms); err != nil {
+		return nil, err
+	}
+	if config.Platforms == nil {
+		config.Platforms = map[string]PlatformConfig{}
+	}
+	return &config, nil
+}
+
+// Get returns the latest app_config row. Rows are addressed by version
+// since SERIAL isn't an auto-increment type in SQLite and id may be NULL.
+func (r *SQLRepository) Get() (*AppConfig, error) {
+	return scanConfig(r.db.QueryRow(selectConfig + " ORDER BY version DESC LIMIT 1"))
+}
+
+// GetVersion returns one saved version
+func (r *SQLRepository) GetVersion(version int) (*AppConfig, error) {
+	config, err := scanConfig(r.db.QueryRow(selectConfig+" WHERE version = $1", version))
+	if err == sql.ErrNoRows {
+		return nil, ErrVersionNotFound
+	}
+	return config, err
+}
+
+// History returns the latest versions, newest first
+func (r *SQLRepository) History(limit int) ([]AppConfig, error) {
+	rows, err := r.db.Query(selectConfig+" ORDER BY version DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []AppConfig
+	for rows.Next() {
+		config, err := scanConfig(rows)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, *config)
+	}
+	return history, rows.Err()
+}
+
+// Update inserts the configuration as a new app_config row with the next
+// version number
+func (r *SQLRepository) Update(input AppConfig) (int, error) {
+	query := `
+	INSERT INTO app_config (
+		latest_version,
+		minimum_version,
+		update_required,
+		update_url,
+		update_message,
+		maintenance_mode,
+		maintenance_message,
+		force_update,
+		app_enabled,
+		platforms,
+		restored_from,
+		version
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, ` + nextVersion + `)
+	RETURNING version
+	`
+
+	platforms, err := json.Marshal(input.Platforms)
+	if err != nil {
+		return 0, err
+	}
+	if input.Platforms == nil {
+		platforms = []byte("{}")
+	}
+	var restoredFrom *int
+	if input.RestoredFrom != 0 {
+		restoredFrom = &input.RestoredFrom
+	}
+
+	var version int
+	err = r.db.QueryRow(
+		query,
+		input.LatestVersion,
+		input.MinimumVersion,
+		input.UpdateRequired,
+		input.UpdateURL,
+		input.UpdateMessage,
+		input.MaintenanceMode,
+		input.MaintenanceMessage,
+		input.ForceUpdate,
+		input.AppEnabled,
+		string(platforms),
+		restoredFrom,
+	).Scan(&version)
+	if err == nil {
+		slog.Info("app config saved", "version", version)
+	}
+	return version, err
+}
@@ -0,0 +1,67 @@
+package appconfig
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSQLRepositoryVersions(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// A table from before versions were stored, numbered by rowid
+	_, err = db.Exec(`
+		CREATE TABLE app_config (
+			id SERIAL PRIMARY KEY,
+			latest_version VARCHAR(20) NOT NULL DEFAULT '1.0.0',
+			minimum_version VARCHAR(20) NOT NULL DEFAULT '1.0.0',
+			update_required BOOLEAN DEFAULT FALSE,
+			update_url TEXT DEFAULT '',
+			update_message TEXT DEFAULT '',
+			maintenance_mode BOOLEAN DEFAULT FALSE,
+			maintenance_message TEXT DEFAULT '',
+			force_update BOOLEAN DEFAULT FALSE,
+			app_enabled BOOLEAN DEFAULT TRUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO app_config (latest_version) VALUES ('1.0.0'), ('1.1.0'), ('1.2.0');
+		DELETE FROM app_config WHERE latest_version = '1.0.0';`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewSQLRepository(db)
+	config := DefaultConfig()
+	config.LatestVersion = "1.3.0"
+	version, err := r.Update(config)
+	if err != nil || version != 4 {
+		t.Fatalf("Update = %d, %v, want version 4", version, err)
+	}
+
+	// VACUUM may renumber rowids without changing versions
+	if _, err := db.Exec("VACUUM"); err != nil {
+		t.Fatal(err)
+	}
+	for version, latest := range map[int]string{2: "1.1.0", 3: "1.2.0", 4: "1.3.0"} {
+		config, err := r.GetVersion(version)
+		if err != nil || config.LatestVersion != latest {
+			t.Errorf("GetVersion(%d) = %+v, %v, want latest version %s", version, config, err, latest)
+		}
+	}
+	if _, err := r.GetVersion(1); err != ErrVersionNotFound {
+		t.Errorf("GetVersion(1) error = %v, want ErrVersionNotFound", err)
+	}
+	if current, err := r.Get(); err != nil || current.Version != 4 {
+		t.Errorf("Get = %+v, %v, want version 4", current, err)
+	}
+	if history, err := r.History(10); err != nil || len(history) != 3 || history[2].Version != 2 {
+		t.Errorf("History = %+v, %v", history, err)
+	}
+}
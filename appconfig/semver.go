@@ -0,0 +1,144 @@
+package appconfig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed semantic version (https://semver.org)
+type Version struct {
+	Major, Minor, Patch int
+	// PreRelease holds the dot-separated identifiers after "-", e.g.
+	// ["beta", "2"] for 1.0.0-beta.2
+	PreRelease []string
+	// Build is the metadata after "+". It doesn't affect precedence.
+	Build string
+}
+
+// ParseVersion parses a version such as 1.10.0, 2.0.0-rc.1+build.5 or
+// v1.2. A leading "v" is ignored and missing minor and patch numbers are 0.
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	rest, build, hasBuild := strings.Cut(rest, "+")
+	core, pre, hasPre := strings.Cut(rest, "-")
+
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return v, fmt.Errorf("invalid version %q: at most major.minor.patch", s)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return v, fmt.Errorf("invalid version %q: %q is not a number", s, part)
+		}
+		*numbers[i] = n
+	}
+	if hasPre {
+		v.PreRelease = strings.Split(pre, ".")
+		for _, id := range v.PreRelease {
+			if !validIdentifier(id) {
+				return v, fmt.Errorf("invalid version %q: bad pre-release %q", s, pre)
+			}
+		}
+	}
+	if hasBuild {
+		for _, id := range strings.Split(build, ".") {
+			if !validIdentifier(id) {
+				return v, fmt.Errorf("invalid version %q: bad build metadata %q", s, build)
+			}
+		}
+		v.Build = build
+	}
+	return v, nil
+}
+
+// validIdentifier reports whether id is a non-empty run of [0-9A-Za-z-]
+func validIdentifier(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the version in its canonical form
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.PreRelease) > 0 {
+		s += "-" + strings.Join(v.PreRelease, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 as v has lower, equal or higher precedence
+// than o. A pre-release is lower than its release; build metadata is
+// ignored.
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case len(v.PreRelease) == 0 && len(o.PreRelease) == 0:
+		return 0
+	case len(v.PreRelease) == 0:
+		return 1
+	case len(o.PreRelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.PreRelease) && i < len(o.PreRelease); i++ {
+		if c := compareIdentifiers(v.PreRelease[i], o.PreRelease[i]); c != 0 {
+			return c
+		}
+	}
+	return sign(len(v.PreRelease) - len(o.PreRelease))
+}
+
+// compareIdentifiers orders pre-release identifiers: numeric ones by value
+// and below alphanumeric ones, which compare in ASCII order
+func compareIdentifiers(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return sign(na - nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// CompareVersions compares app versions by semantic version precedence.
+// Returns: -1 if v1 < v2, 0 if v1 == v2, 1 if v1 > v2. Versions that
+// don't parse fall back to comparing the strings.
+func CompareVersions(v1, v2 string) int {
+	p1, err1 := ParseVersion(v1)
+	p2, err2 := ParseVersion(v2)
+	if err1 != nil || err2 != nil {
+		return strings.Compare(v1, v2)
+	}
+	return p1.Compare(p2)
+}
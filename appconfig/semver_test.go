@@ -0,0 +1,44 @@
+package appconfig
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		v1, v2 string
+		want   int
+	}{
+		{"1.10.0", "1.9.0", 1},
+		{"1.9.0", "1.10.0", -1},
+		{"2.0.0", "2.0.0", 0},
+		{"v1.2", "1.2.0", 0},
+		{"1.0.0+build.5", "1.0.0+build.6", 0},
+		{"1.0.0-alpha", "1.0.0", -1},
+		// The precedence example from semver.org
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-alpha.beta", "1.0.0-beta", -1},
+		{"1.0.0-beta", "1.0.0-beta.2", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-beta.11", "1.0.0-rc.1", -1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+	} {
+		if got := CompareVersions(tc.v1, tc.v2); got != tc.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tc.v1, tc.v2, got, tc.want)
+		}
+		if got := CompareVersions(tc.v2, tc.v1); got != -tc.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tc.v2, tc.v1, got, -tc.want)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	v, err := ParseVersion("2.1.3-rc.1+sha.abc")
+	if err != nil || v.String() != "2.1.3-rc.1+sha.abc" {
+		t.Errorf("ParseVersion = %v, %v", v, err)
+	}
+	for _, s := range []string{"", "1.2.3.4", "1.x", "1.0.0-", "1.0.0-beta..1", "1.0.0+", "-1.0", "1.+2"} {
+		if _, err := ParseVersion(s); err == nil {
+			t.Errorf("ParseVersion(%q) accepted", s)
+		}
+	}
+}
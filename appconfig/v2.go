@@ -0,0 +1,51 @@
+package appconfig
+
+import (
+	"net/http"
+	"thaimaster2d/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetV2 handles GET /api/v2/appconfig
+func (h *Handler) GetV2(c *gin.Context) {
+	config, err := h.repo.Get()
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to fetch app config")
+		return
+	}
+
+	api.OK(c, http.StatusOK, config)
+}
+
+// CheckV2 handles GET /api/v2/appconfig/check. Every field of the check is
+// always present, unlike the v1 response, except platform, set when
+// ?platform= is, and the scheduled maintenance fields.
+func (h *Handler) CheckV2(c *gin.Context) {
+	clientVersion := c.Query("version")
+	if clientVersion == "" {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "version parameter required")
+		return
+	}
+	platform := c.Query("platform")
+	if !validPlatform(platform) {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "platform must be android, ios or web")
+		return
+	}
+
+	config, err := h.repo.Get()
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to check version")
+		return
+	}
+
+	check := Check(config, platform, clientVersion)
+	if err := h.addMaintenance(&check, config, requestLocale(c)); err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to check version")
+		return
+	}
+	api.OK(c, http.StatusOK, check)
+}
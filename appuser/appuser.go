@@ -0,0 +1,383 @@
+// Package appuser manages the accounts of mobile app users. Users sign in
+// with a one-time code sent to their phone by SMS, or anonymously with a
+// device ID and verify a phone number later. Signed-in apps get a short
+// lived JWT access token and a refresh token that is rotated on every use.
+package appuser
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"regexp"
+	"slices"
+	"strings"
+	"thaimaster2d/metrics"
+	"time"
+)
+
+// Errors returned by the Service
+var (
+	ErrInvalidPhone = errors.New("phone must be in international format, e.g. +959123456789")
+	ErrInvalidCode  = errors.New("wrong or expired code")
+	ErrTooSoon      = errors.New("a code was sent recently, try again later")
+	ErrBanned       = errors.New("account is banned")
+	ErrSMSDisabled  = errors.New("phone sign-in is not configured")
+	ErrPhoneTaken   = errors.New("phone number belongs to another account")
+)
+
+var logins = metrics.NewCounter("app_user_logins_total",
+	"App user sign-ins by method (otp, anonymous or refresh)", "method")
+
+var phoneRe = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// NormalizePhone strips spaces, dashes and brackets from an E.164 phone
+// number, returning ErrInvalidPhone if it isn't one
+func NormalizePhone(raw string) (string, error) {
+	phone := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" -()", r) {
+			return -1
+		}
+		return r
+	}, raw)
+	if !phoneRe.MatchString(phone) {
+		return "", ErrInvalidPhone
+	}
+	return phone, nil
+}
+
+// Options configures the Service
+type Options struct {
+	// Secret signs the tokens. A random one is generated if empty, which
+	// signs every user out on restart, so the config only allows that in
+	// development mode.
+	Secret string
+	// AccessTTL is how long an access token is valid
+	AccessTTL time.Duration
+	// RefreshTTL is how long a refresh token is valid
+	RefreshTTL time.Duration
+	// OTPTTL is how long a login code is valid
+	OTPTTL time.Duration
+	// OTPResend is the wait before another code can be sent to a number
+	OTPResend time.Duration
+	// OTPAttempts is how many wrong guesses void a code
+	OTPAttempts int
+	// SMS sends login codes. Without it only anonymous sign-in works.
+	SMS SMSSender
+}
+
+// Session is returned when a user signs in or refreshes their tokens
+type Session struct {
+	User         *User  `json:"user"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn int `json:"expires_in"`
+}
+
+// Service signs users in and issues their tokens
+type Service struct {
+	repo   Repository
+	opts   Options
+	secret []byte
+	now    func() time.Time
+}
+
+// NewService returns a service storing users in repo
+func NewService(repo Repository, opts Options) *Service {
+	if opts.AccessTTL <= 0 {
+		opts.AccessTTL = 15 * time.Minute
+	}
+	if opts.RefreshTTL <= 0 {
+		opts.RefreshTTL = 30 * 24 * time.Hour
+	}
+	if opts.OTPTTL <= 0 {
+		opts.OTPTTL = 5 * time.Minute
+	}
+	if opts.OTPResend <= 0 {
+		opts.OTPResend = time.Minute
+	}
+	if opts.OTPAttempts <= 0 {
+		opts.OTPAttempts = 5
+	}
+	secret := []byte(opts.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+		slog.Warn("users.jwt_secret is not set, app users are signed out on every restart")
+	}
+	return &Service{repo: repo, opts: opts, secret: secret, now: time.Now}
+}
+
+// Repository returns the user store
+func (s *Service) Repository() Repository {
+	return s.repo
+}
+
+// SMSEnabled reports whether phone sign-in is available
+func (s *Service) SMSEnabled() bool {
+	return s.opts.SMS != nil
+}
+
+// SendOTP texts a new login code to a phone number, replacing any pending
+// one
+func (s *Service) SendOTP(ctx context.Context, phone string) error {
+	if s.opts.SMS == nil {
+		return ErrSMSDisabled
+	}
+	now := s.now()
+	pending, err := s.repo.GetOTP(phone)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if pending != nil && now.Before(pending.CreatedAt.Add(s.opts.OTPResend)) {
+		return ErrTooSoon
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	err = s.repo.SaveOTP(&OTP{
+		Phone:     phone,
+		CodeHash:  s.hashCode(phone, code),
+		ExpiresAt: now.Add(s.opts.OTPTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("Your ThaiMaster2D code is %s. It expires in %d minutes.", code, int(s.opts.OTPTTL.Minutes()))
+	if err := s.opts.SMS.SendSMS(ctx, phone, text); err != nil {
+		return fmt.Errorf("failed to send code: %w", err)
+	}
+	slog.InfoContext(ctx, "login code sent", "phone", maskPhone(phone))
+	return nil
+}
+
+// hashCode keys the code hash with the token secret so a leaked database
+// doesn't reveal pending codes
+func (s *Service) hashCode(phone, code string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(phone + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyOTP signs in with a code sent by SendOTP. The phone's account is
+// created on first sign-in. If current is an anonymous user and the phone
+// has no account yet, current is upgraded instead.
+func (s *Service) VerifyOTP(ctx context.Context, phone, code string, current *User) (*Session, error) {
+	// Every guess uses up an attempt before the code is compared
+	pending, err := s.repo.AttemptOTP(phone, s.opts.OTPAttempts)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !s.now().Before(pending.ExpiresAt) || !hmac.Equal([]byte(pending.CodeHash), []byte(s.hashCode(phone, code))) {
+		return nil, ErrInvalidCode
+	}
+	// Only one of concurrent right guesses signs in
+	if err := s.repo.DeleteOTP(phone, pending.CodeHash); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrInvalidCode
+		}
+		return nil, err
+	}
+
+	u, err := s.repo.GetByPhone(phone)
+	switch {
+	case err == nil:
+		if current != nil && current.ID != u.ID && !current.Anonymous {
+			return nil, ErrPhoneTaken
+		}
+	case !errors.Is(err, ErrNotFound):
+		return nil, err
+	case current != nil && current.Anonymous:
+		if u, err = s.repo.Upgrade(current.ID, phone); err != nil {
+			return nil, err
+		}
+		slog.InfoContext(ctx, "anonymous user upgraded", "user_id", u.ID)
+	default:
+		if u, err = s.repo.CreatePhone(phone); err != nil {
+			return nil, err
+		}
+		slog.InfoContext(ctx, "user registered", "user_id", u.ID)
+	}
+	return s.signIn(ctx, u, "otp")
+}
+
+// SignInDevice signs in the anonymous user of a device, creating it on
+// first use
+func (s *Service) SignInDevice(ctx context.Context, deviceID string) (*Session, error) {
+	u, err := s.repo.GetByDevice(deviceID)
+	if errors.Is(err, ErrNotFound) {
+		if u, err = s.repo.CreateAnonymous(deviceID); err != nil {
+			return nil, err
+		}
+		slog.InfoContext(ctx, "anonymous user registered", "user_id", u.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.signIn(ctx, u, "anonymous")
+}
+
+func (s *Service) signIn(ctx context.Context, u *User, method string) (*Session, error) {
+	if u.Banned() {
+		return nil, ErrBanned
+	}
+	now := s.now().UTC()
+	if err := s.repo.Touch(u.ID, now); err != nil {
+		return nil, err
+	}
+	u.LastLoginAt = &now
+	session, err := s.issue(u)
+	if err != nil {
+		return nil, err
+	}
+	logins.Inc(method)
+	slog.InfoContext(ctx, "user signed in", "user_id", u.ID, "method", method)
+	return session, nil
+}
+
+// issue creates a new refresh token session and its access token
+func (s *Service) issue(u *User) (*Session, error) {
+	now := s.now()
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	if err := s.repo.CreateSession(id, u.ID, now.Add(s.opts.RefreshTTL)); err != nil {
+		return nil, err
+	}
+	return &Session{
+		User: u,
+		AccessToken: SignToken(s.secret, Claims{
+			Subject:  u.ID,
+			Type:     TokenAccess,
+			IssuedAt: now.Unix(),
+			Expires:  now.Add(s.opts.AccessTTL).Unix(),
+		}),
+		RefreshToken: SignToken(s.secret, Claims{
+			Subject:  u.ID,
+			Type:     TokenRefresh,
+			ID:       id,
+			IssuedAt: now.Unix(),
+			Expires:  now.Add(s.opts.RefreshTTL).Unix(),
+		}),
+		TokenType: "Bearer",
+		ExpiresIn: int(s.opts.AccessTTL.Seconds()),
+	}, nil
+}
+
+// Refresh exchanges a refresh token for new tokens. Each refresh token
+// works once.
+func (s *Service) Refresh(ctx context.Context, token string) (*Session, error) {
+	claims, err := ParseToken(s.secret, token, TokenRefresh, s.now())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.RevokeSession(claims.ID, s.now()); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	u, err := s.repo.Get(claims.Subject)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.signIn(ctx, u, "refresh")
+}
+
+// SignOut revokes a refresh token
+func (s *Service) SignOut(token string) error {
+	claims, err := ParseToken(s.secret, token, TokenRefresh, s.now())
+	if err != nil {
+		return err
+	}
+	err = s.repo.RevokeSession(claims.ID, s.now())
+	if errors.Is(err, ErrNotFound) {
+		return ErrInvalidToken
+	}
+	return err
+}
+
+// Authenticate returns the user of an access token
+func (s *Service) Authenticate(token string) (*User, error) {
+	claims, err := ParseToken(s.secret, token, TokenAccess, s.now())
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.repo.Get(claims.Subject)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.Banned() {
+		return nil, ErrBanned
+	}
+	return u, nil
+}
+
+// Ban blocks a user and signs them out of every device
+func (s *Service) Ban(ctx context.Context, id int, reason string) (*User, error) {
+	u, err := s.repo.SetStatus(id, StatusBanned, reason)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.RevokeSessions(id); err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "user banned", "user_id", id, "reason", reason)
+	return u, nil
+}
+
+// Unban lets a banned user sign in again
+func (s *Service) Unban(ctx context.Context, id int) (*User, error) {
+	u, err := s.repo.SetStatus(id, StatusActive, "")
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "user unbanned", "user_id", id)
+	return u, nil
+}
+
+// SetSegments replaces the segments of a user, which feature flags can
+// target. Segments are lowercased, and blank and repeated ones dropped.
+func (s *Service) SetSegments(ctx context.Context, id int, segments []string) (*User, error) {
+	normalized := []string{}
+	for _, segment := range segments {
+		segment = strings.ToLower(strings.TrimSpace(segment))
+		if segment != "" && !slices.Contains(normalized, segment) {
+			normalized = append(normalized, segment)
+		}
+	}
+	u, err := s.repo.SetSegments(id, normalized)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "user segments set", "user_id", id, "segments", normalized)
+	return u, nil
+}
+
+// maskPhone hides all but the last three digits of a phone number in logs
+func maskPhone(phone string) string {
+	if len(phone) <= 3 {
+		return phone
+	}
+	return strings.Repeat("*", len(phone)-3) + phone[len(phone)-3:]
+}
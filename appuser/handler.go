@@ -0,0 +1,253 @@
+package appuser
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"thaimaster2d/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contextKey is where RequireUser stores the signed-in user
+const contextKey = "appuser"
+
+// Handler serves the sign-in and profile API
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a handler for service
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(c *gin.Context) string {
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authError replies to a failed sign-in or token check
+func authError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidToken):
+		api.Error(c, http.StatusUnauthorized, api.CodeUnauthorized, "Invalid or expired token")
+	case errors.Is(err, ErrInvalidCode):
+		api.Error(c, http.StatusUnauthorized, api.CodeUnauthorized, "Wrong or expired code")
+	case errors.Is(err, ErrBanned):
+		api.Error(c, http.StatusForbidden, api.CodeForbidden, "Account is banned")
+	case errors.Is(err, ErrPhoneTaken):
+		api.Error(c, http.StatusConflict, api.CodeConflict, "Phone number belongs to another account")
+	default:
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to sign in")
+	}
+}
+
+// RequireUser rejects requests without a valid access token and makes the
+// user available to the next handlers through Current
+func (h *Handler) RequireUser(c *gin.Context) {
+	token := bearerToken(c)
+	if token == "" {
+		api.Error(c, http.StatusUnauthorized, api.CodeUnauthorized, "Sign in required")
+		return
+	}
+	u, err := h.service.Authenticate(token)
+	if err != nil {
+		authError(c, err)
+		return
+	}
+	c.Set(contextKey, u)
+	c.Next()
+}
+
+// OptionalUser makes the user of a valid access token available through
+// Current, and lets requests without one through as signed out
+func (h *Handler) OptionalUser(c *gin.Context) {
+	if token := bearerToken(c); token != "" {
+		if u, err := h.service.Authenticate(token); err == nil {
+			c.Set(contextKey, u)
+		}
+	}
+	c.Next()
+}
+
+// Current returns the user signed in by RequireUser or OptionalUser
+func Current(c *gin.Context) *User {
+	u, _ := c.Get(contextKey)
+	user, _ := u.(*User)
+	return user
+}
+
+// SendOTPV2 handles POST /api/v2/auth/otp
+func (h *Handler) SendOTPV2(c *gin.Context) {
+	var input struct {
+		Phone string `json:"phone"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+	phone, err := NormalizePhone(input.Phone)
+	if err != nil {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, err.Error())
+		return
+	}
+
+	err = h.service.SendOTP(c.Request.Context(), phone)
+	switch {
+	case errors.Is(err, ErrSMSDisabled):
+		api.Error(c, http.StatusServiceUnavailable, api.CodeInternal, "Phone sign-in is not available")
+		return
+	case errors.Is(err, ErrTooSoon):
+		api.Error(c, http.StatusTooManyRequests, api.CodeRateLimited, "A code was sent recently, try again later")
+		return
+	case err != nil:
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to send code")
+		return
+	}
+	api.OK(c, http.StatusAccepted, gin.H{
+		"phone":      phone,
+		"expires_in": int(h.service.opts.OTPTTL.Seconds()),
+	})
+}
+
+// VerifyOTPV2 handles POST /api/v2/auth/verify. Called with the access
+// token of an anonymous user, it upgrades that account.
+func (h *Handler) VerifyOTPV2(c *gin.Context) {
+	var input struct {
+		Phone string `json:"phone"`
+		Code  string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+	phone, err := NormalizePhone(input.Phone)
+	if err != nil {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, err.Error())
+		return
+	}
+	if input.Code == "" {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "code is required")
+		return
+	}
+
+	var current *User
+	if token := bearerToken(c); token != "" {
+		if current, err = h.service.Authenticate(token); err != nil {
+			authError(c, err)
+			return
+		}
+	}
+	session, err := h.service.VerifyOTP(c.Request.Context(), phone, input.Code, current)
+	if err != nil {
+		authError(c, err)
+		return
+	}
+	api.OK(c, http.StatusOK, session)
+}
+
+// AnonymousV2 handles POST /api/v2/auth/anonymous
+func (h *Handler) AnonymousV2(c *gin.Context) {
+	var input struct {
+		DeviceID string `json:"device_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+	if input.DeviceID == "" || len(input.DeviceID) > 200 {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "device_id is required")
+		return
+	}
+
+	session, err := h.service.SignInDevice(c.Request.Context(), input.DeviceID)
+	if err != nil {
+		authError(c, err)
+		return
+	}
+	api.OK(c, http.StatusOK, session)
+}
+
+// bindRefreshToken reads the refresh_token field of the request body
+func bindRefreshToken(c *gin.Context) (string, bool) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid JSON")
+		return "", false
+	}
+	if input.RefreshToken == "" {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "refresh_token is required")
+		return "", false
+	}
+	return input.RefreshToken, true
+}
+
+// RefreshV2 handles POST /api/v2/auth/refresh
+func (h *Handler) RefreshV2(c *gin.Context) {
+	token, ok := bindRefreshToken(c)
+	if !ok {
+		return
+	}
+	session, err := h.service.Refresh(c.Request.Context(), token)
+	if err != nil {
+		authError(c, err)
+		return
+	}
+	api.OK(c, http.StatusOK, session)
+}
+
+// LogoutV2 handles POST /api/v2/auth/logout
+func (h *Handler) LogoutV2(c *gin.Context) {
+	token, ok := bindRefreshToken(c)
+	if !ok {
+		return
+	}
+	if err := h.service.SignOut(token); err != nil {
+		authError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetProfileV2 handles GET /api/v2/me
+func (h *Handler) GetProfileV2(c *gin.Context) {
+	api.OK(c, http.StatusOK, Current(c))
+}
+
+// UpdateProfileV2 handles PUT /api/v2/me
+func (h *Handler) UpdateProfileV2(c *gin.Context) {
+	var input struct {
+		Name   string `json:"name"`
+		Locale string `json:"locale"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if len([]rune(input.Name)) > 50 {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "name must be at most 50 characters")
+		return
+	}
+	if len(input.Locale) > 10 {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "locale must be a language tag such as my or en-US")
+		return
+	}
+
+	u, err := h.service.Repository().UpdateProfile(Current(c).ID, input.Name, input.Locale)
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to update profile")
+		return
+	}
+	api.OK(c, http.StatusOK, u)
+}
@@ -0,0 +1,375 @@
+package appuser
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a user, code or session doesn't exist
+var ErrNotFound = errors.New("user not found")
+
+// User statuses
+const (
+	StatusActive = "active"
+	StatusBanned = "banned"
+)
+
+// User is an account of the mobile app. Anonymous accounts belong to a
+// device and have no phone number until they are upgraded.
+type User struct {
+	ID        int    `json:"id"`
+	Phone     string `json:"phone"`
+	Name      string `json:"name"`
+	Locale    string `json:"locale"`
+	Anonymous bool   `json:"anonymous"`
+	Status    string `json:"status"`
+	BanReason string `json:"ban_reason,omitempty"`
+	// Segments are set by admins and target feature flags, e.g. beta
+	// or staff
+	Segments    []string   `json:"segments"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Banned reports whether the user has been banned by an admin
+func (u *User) Banned() bool {
+	return u.Status == StatusBanned
+}
+
+// OTP is the login code last sent to a phone number. Only its hash is kept.
+type OTP struct {
+	Phone     string
+	CodeHash  string
+	Attempts  int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// Repository stores users, pending login codes and refresh token sessions
+type Repository interface {
+	// Get returns a user or ErrNotFound
+	Get(id int) (*User, error)
+	// GetByPhone returns the user with a phone number or ErrNotFound
+	GetByPhone(phone string) (*User, error)
+	// GetByDevice returns the anonymous user of a device or ErrNotFound
+	GetByDevice(deviceID string) (*User, error)
+	// CreatePhone creates a user with a verified phone number
+	CreatePhone(phone string) (*User, error)
+	// CreateAnonymous creates an anonymous user for a device
+	CreateAnonymous(deviceID string) (*User, error)
+	// Upgrade gives an anonymous user a verified phone number
+	Upgrade(id int, phone string) (*User, error)
+	UpdateProfile(id int, name, locale string) (*User, error)
+	// Touch records a login
+	Touch(id int, at time.Time) error
+	// SetStatus bans or unbans a user
+	SetStatus(id int, status, reason string) (*User, error)
+	// SetSegments replaces the segments of a user
+	SetSegments(id int, segments []string) (*User, error)
+	// Search returns up to limit users whose phone or name contains query,
+	// or the newest users if query is empty
+	Search(query string, limit int) ([]User, error)
+
+	// SaveOTP replaces the code pending for a phone number
+	SaveOTP(o *OTP) error
+	// GetOTP returns the code pending for a phone number or ErrNotFound
+	GetOTP(phone string) (*OTP, error)
+	// AttemptOTP counts a guess of the pending code and returns it, or
+	// ErrNotFound if there is none or maxAttempts guesses were made
+	AttemptOTP(phone string, maxAttempts int) (*OTP, error)
+	// DeleteOTP removes a code once used, or returns ErrNotFound if it was
+	// already used or replaced
+	DeleteOTP(phone, codeHash string) error
+
+	// CreateSession records an issued refresh token
+	CreateSession(id string, userID int, expiresAt time.Time) error
+	// RevokeSession ends a session that is still valid at now, or returns
+	// ErrNotFound if it was already used, revoked or has expired
+	RevokeSession(id string, now time.Time) error
+	// RevokeSessions ends every session of a user
+	RevokeSessions(userID int) error
+}
+
+// SQLRepository is a Repository backed by the app_users, app_user_otps and
+// app_user_sessions tables
+type SQLRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository creates the user tables if needed
+func NewSQLRepository(db *sql.DB) *SQLRepository {
+	r := &SQLRepository{db: db}
+	r.createTables()
+	return r
+}
+
+func (r *SQLRepository) createTables() {
+	query := `
+		CREATE TABLE IF NOT EXISTS app_users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			phone TEXT UNIQUE,
+			device_id TEXT UNIQUE,
+			name TEXT NOT NULL DEFAULT '',
+			locale TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'active',
+			ban_reason TEXT NOT NULL DEFAULT '',
+			segments TEXT NOT NULL DEFAULT '',
+			last_login_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS app_user_otps (
+			phone TEXT PRIMARY KEY,
+			code_hash TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			expires_at DATETIME NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS app_user_sessions (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES app_users(id) ON DELETE CASCADE,
+			expires_at DATETIME NOT NULL,
+			revoked_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_app_user_sessions_user ON app_user_sessions(user_id);
+	`
+	_, err := r.db.Exec(query)
+	if err == nil {
+		err = r.addSegments()
+	}
+	if err != nil {
+		slog.Error("failed to create app user tables", "error", err)
+	}
+}
+
+// addSegments adds the segments column to tables created before it
+func (r *SQLRepository) addSegments() error {
+	var n int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('app_users') WHERE name = 'segments'").Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+	if _, err := r.db.Exec("ALTER TABLE app_users ADD COLUMN segments TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	slog.Info("added app_users column", "column", "segments")
+	return nil
+}
+
+const (
+	userColumns = `id, phone, device_id, name, locale, status, ban_reason, segments, last_login_at, created_at, updated_at`
+	selectUser  = `SELECT ` + userColumns + ` FROM app_users`
+)
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (*User, error) {
+	var u User
+	var phone, deviceID sql.NullString
+	var segments string
+	var lastLogin sql.NullTime
+	if err := row.Scan(&u.ID, &phone, &deviceID, &u.Name, &u.Locale, &u.Status, &u.BanReason,
+		&segments, &lastLogin, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		return nil, err
+	}
+	u.Segments = []string{}
+	if segments != "" {
+		u.Segments = strings.Split(segments, ",")
+	}
+	u.Phone = phone.String
+	u.Anonymous = !phone.Valid
+	if lastLogin.Valid {
+		u.LastLoginAt = &lastLogin.Time
+	}
+	return &u, nil
+}
+
+func (r *SQLRepository) getUser(query string, args ...any) (*User, error) {
+	u, err := scanUser(r.db.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return u, err
+}
+
+// Get returns a user by ID
+func (r *SQLRepository) Get(id int) (*User, error) {
+	return r.getUser(selectUser+" WHERE id = $1", id)
+}
+
+// GetByPhone returns a user by phone number
+func (r *SQLRepository) GetByPhone(phone string) (*User, error) {
+	return r.getUser(selectUser+" WHERE phone = $1", phone)
+}
+
+// GetByDevice returns the anonymous user of a device
+func (r *SQLRepository) GetByDevice(deviceID string) (*User, error) {
+	return r.getUser(selectUser+" WHERE device_id = $1 AND phone IS NULL", deviceID)
+}
+
+// CreatePhone inserts a user with a phone number
+func (r *SQLRepository) CreatePhone(phone string) (*User, error) {
+	return r.getUser("INSERT INTO app_users (phone) VALUES ($1) RETURNING "+userColumns, phone)
+}
+
+// CreateAnonymous inserts a user for a device
+func (r *SQLRepository) CreateAnonymous(deviceID string) (*User, error) {
+	return r.getUser("INSERT INTO app_users (device_id) VALUES ($1) RETURNING "+userColumns, deviceID)
+}
+
+// Upgrade sets the phone number of an anonymous user. The device is
+// released so it can start a new anonymous account.
+func (r *SQLRepository) Upgrade(id int, phone string) (*User, error) {
+	query := `
+		UPDATE app_users SET phone = $1, device_id = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND phone IS NULL
+		RETURNING ` + userColumns
+	return r.getUser(query, phone, id)
+}
+
+// UpdateProfile changes the name and locale of a user
+func (r *SQLRepository) UpdateProfile(id int, name, locale string) (*User, error) {
+	query := `
+		UPDATE app_users SET name = $1, locale = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+		RETURNING ` + userColumns
+	return r.getUser(query, name, locale, id)
+}
+
+// Touch sets the last login time of a user
+func (r *SQLRepository) Touch(id int, at time.Time) error {
+	_, err := r.db.Exec("UPDATE app_users SET last_login_at = $1 WHERE id = $2", at.UTC(), id)
+	return err
+}
+
+// SetStatus changes the status of a user
+func (r *SQLRepository) SetStatus(id int, status, reason string) (*User, error) {
+	query := `
+		UPDATE app_users SET status = $1, ban_reason = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+		RETURNING ` + userColumns
+	return r.getUser(query, status, reason, id)
+}
+
+// SetSegments stores the segments of a user comma-separated
+func (r *SQLRepository) SetSegments(id int, segments []string) (*User, error) {
+	query := `
+		UPDATE app_users SET segments = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+		RETURNING ` + userColumns
+	return r.getUser(query, strings.Join(segments, ","), id)
+}
+
+// Search finds users by phone number, name or ID
+func (r *SQLRepository) Search(query string, limit int) ([]User, error) {
+	var rows *sql.Rows
+	var err error
+	if query == "" {
+		rows, err = r.db.Query(selectUser+" ORDER BY id DESC LIMIT $1", limit)
+	} else {
+		rows, err = r.db.Query(selectUser+`
+			WHERE phone LIKE '%' || $1 || '%' OR name LIKE '%' || $1 || '%' OR CAST(id AS TEXT) = $1
+			ORDER BY id DESC LIMIT $2`, query, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
+// SaveOTP upserts the code of a phone number
+func (r *SQLRepository) SaveOTP(o *OTP) error {
+	query := `
+		INSERT INTO app_user_otps (phone, code_hash, attempts, expires_at, created_at)
+		VALUES ($1, $2, 0, $3, $4)
+		ON CONFLICT (phone) DO UPDATE SET
+			code_hash = excluded.code_hash, attempts = 0,
+			expires_at = excluded.expires_at, created_at = excluded.created_at
+	`
+	_, err := r.db.Exec(query, o.Phone, o.CodeHash, o.ExpiresAt.UTC(), o.CreatedAt.UTC())
+	return err
+}
+
+const otpColumns = `phone, code_hash, attempts, expires_at, created_at`
+
+func (r *SQLRepository) getOTP(query string, args ...any) (*OTP, error) {
+	var o OTP
+	err := r.db.QueryRow(query, args...).Scan(&o.Phone, &o.CodeHash, &o.Attempts, &o.ExpiresAt, &o.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &o, err
+}
+
+// GetOTP returns the code of a phone number
+func (r *SQLRepository) GetOTP(phone string) (*OTP, error) {
+	return r.getOTP("SELECT "+otpColumns+" FROM app_user_otps WHERE phone = $1", phone)
+}
+
+// AttemptOTP checks and increments the guesses of a code in one statement,
+// so concurrent guesses can't go over the limit
+func (r *SQLRepository) AttemptOTP(phone string, maxAttempts int) (*OTP, error) {
+	query := `
+		UPDATE app_user_otps SET attempts = attempts + 1
+		WHERE phone = $1 AND attempts < $2
+		RETURNING ` + otpColumns
+	return r.getOTP(query, phone, maxAttempts)
+}
+
+// DeleteOTP removes the code of a phone number if it is still codeHash
+func (r *SQLRepository) DeleteOTP(phone, codeHash string) error {
+	result, err := r.db.Exec("DELETE FROM app_user_otps WHERE phone = $1 AND code_hash = $2", phone, codeHash)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// CreateSession inserts a refresh token session
+func (r *SQLRepository) CreateSession(id string, userID int, expiresAt time.Time) error {
+	_, err := r.db.Exec("INSERT INTO app_user_sessions (id, user_id, expires_at) VALUES ($1, $2, $3)", id, userID, expiresAt.UTC())
+	return err
+}
+
+// RevokeSession marks a valid session revoked
+func (r *SQLRepository) RevokeSession(id string, now time.Time) error {
+	result, err := r.db.Exec(`
+		UPDATE app_user_sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > $2`, id, now.UTC())
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeSessions marks every open session of a user revoked
+func (r *SQLRepository) RevokeSessions(userID int) error {
+	_, err := r.db.Exec("UPDATE app_user_sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	return err
+}
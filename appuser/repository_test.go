@@ -0,0 +1,64 @@
+package appuser
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestAttemptOTP(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	r := NewSQLRepository(db)
+
+	now := time.Now()
+	if err := r.SaveOTP(&OTP{Phone: "+959123", CodeHash: "hash", ExpiresAt: now.Add(time.Minute), CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent guesses can't go over the limit
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch _, err := r.AttemptOTP("+959123", 5); {
+			case err == nil:
+				allowed.Add(1)
+			case !errors.Is(err, ErrNotFound):
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := allowed.Load(); got != 5 {
+		t.Errorf("%d guesses allowed, want 5", got)
+	}
+	if o, err := r.GetOTP("+959123"); err != nil || o.Attempts != 5 {
+		t.Errorf("GetOTP = %+v, %v, want 5 attempts", o, err)
+	}
+	if _, err := r.AttemptOTP("+959000", 5); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AttemptOTP without a code = %v, want ErrNotFound", err)
+	}
+
+	// A code is used once, and not if it was replaced
+	if err := r.DeleteOTP("+959123", "other"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteOTP replaced code = %v, want ErrNotFound", err)
+	}
+	if err := r.DeleteOTP("+959123", "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteOTP("+959123", "hash"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteOTP used code = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,88 @@
+package appuser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SMSSender delivers a text message to a phone number
+type SMSSender interface {
+	SendSMS(ctx context.Context, phone, text string) error
+}
+
+// SMS is a message recorded by FakeSMS
+type SMS struct {
+	Phone string
+	Text  string
+}
+
+// FakeSMS is an SMSSender that logs and records messages instead of sending
+// them, for tests and local development
+type FakeSMS struct {
+	mu   sync.Mutex
+	sent []SMS
+}
+
+// NewFakeSMS returns an empty fake SMS sender
+func NewFakeSMS() *FakeSMS {
+	return &FakeSMS{}
+}
+
+// SendSMS implements SMSSender
+func (f *FakeSMS) SendSMS(ctx context.Context, phone, text string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, SMS{Phone: phone, Text: text})
+	slog.InfoContext(ctx, "sms (fake sender)", "phone", phone, "text", text)
+	return nil
+}
+
+// Sent returns the messages sent so far
+func (f *FakeSMS) Sent() []SMS {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]SMS(nil), f.sent...)
+}
+
+// SMSGateway is an SMSSender POSTing {"to": ..., "message": ...} as JSON to
+// an HTTP gateway, authenticated with a bearer token if one is set
+type SMSGateway struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+// SendSMS implements SMSSender
+func (g *SMSGateway) SendSMS(ctx context.Context, phone, text string) error {
+	body, _ := json.Marshal(map[string]string{"to": phone, "message": text})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+
+	client := g.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sms gateway returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
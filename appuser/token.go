@@ -0,0 +1,70 @@
+package appuser
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Token types, set in the typ claim so a refresh token can't be used as an
+// access token or the other way round
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
+
+// ErrInvalidToken is returned for a malformed, forged or expired token
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Claims are the JWT claims of access and refresh tokens
+type Claims struct {
+	// Subject is the user ID
+	Subject  int    `json:"sub"`
+	Type     string `json:"typ"`
+	ID       string `json:"jti,omitempty"`
+	IssuedAt int64  `json:"iat"`
+	Expires  int64  `json:"exp"`
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// SignToken returns claims as an HS256 JWT
+func SignToken(secret []byte, claims Claims) string {
+	payload, _ := json.Marshal(claims)
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature(secret, unsigned))
+}
+
+// ParseToken verifies an HS256 JWT of the given type and returns its claims
+func ParseToken(secret []byte, token, typ string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, signature(secret, parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Type != typ || claims.Subject <= 0 || now.Unix() >= claims.Expires {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+func signature(secret []byte, unsigned string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,55 @@
+package appuser
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToken(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1760600000, 0)
+	token := SignToken(secret, Claims{Subject: 7, Type: TokenAccess, IssuedAt: now.Unix(), Expires: now.Add(time.Minute).Unix()})
+
+	claims, err := ParseToken(secret, token, TokenAccess, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != 7 {
+		t.Errorf("subject = %d, want 7", claims.Subject)
+	}
+
+	parts := strings.Split(token, ".")
+	forged := parts[0] + "." + parts[1] + "x." + parts[2]
+	for name, tc := range map[string]struct {
+		secret []byte
+		token  string
+		typ    string
+		now    time.Time
+	}{
+		"wrong secret": {[]byte("other"), token, TokenAccess, now},
+		"wrong type":   {secret, token, TokenRefresh, now},
+		"expired":      {secret, token, TokenAccess, now.Add(time.Minute)},
+		"tampered":     {secret, forged, TokenAccess, now},
+		"malformed":    {secret, "abc", TokenAccess, now},
+	} {
+		if _, err := ParseToken(tc.secret, tc.token, tc.typ, tc.now); err != ErrInvalidToken {
+			t.Errorf("%s: error = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	for raw, want := range map[string]string{
+		"+959123456789":       "+959123456789",
+		"+95 9-123 (456) 789": "+959123456789",
+		"09123456789":         "",
+		"+0123456789":         "",
+		"+95abc":              "",
+	} {
+		got, err := NormalizePhone(raw)
+		if got != want || (want == "") != (err != nil) {
+			t.Errorf("NormalizePhone(%q) = %q, %v; want %q", raw, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Command migrate-uploads copies the local uploads directory to the storage
+// backend selected by the config (file, environment or flags, as for the
+// server) and rewrites legacy stored image URLs to media keys.
+//
+//	STORAGE_BACKEND=s3 S3_ENDPOINT=http://localhost:9000 S3_BUCKET=uploads \
+//	S3_ACCESS_KEY_ID=minioadmin S3_SECRET_ACCESS_KEY=minioadmin \
+//	go run ./cmd/migrate-uploads -source uploads
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"log"
+	"strings"
+	"thaimaster2d/config"
+	"thaimaster2d/media"
+	"thaimaster2d/storage"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	loader := config.NewLoader(flag.CommandLine)
+	source := flag.String("source", "uploads", "local uploads directory to migrate")
+	hostList := flag.String("hosts", "localhost", "comma separated hostnames whose /api/images/ and /uploads/ URLs are ours")
+	dryRun := flag.Bool("dry-run", false, "only report what would be copied and rewritten")
+	flag.Parse()
+
+	var hosts []string
+	for _, h := range strings.Split(*hostList, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	target, err := cfg.Storage.Open()
+	if err != nil {
+		log.Fatalf("❌ Storage configuration failed: %v", err)
+	}
+	if local, ok := target.(*storage.Local); ok && local.Dir() == *source {
+		log.Fatalf("❌ Target backend is the source directory, set storage.backend first")
+	}
+
+	ctx := context.Background()
+	src := storage.NewLocal(*source, "")
+	objects, err := src.List(ctx)
+	if err != nil {
+		log.Fatalf("❌ Failed to list %s: %v", *source, err)
+	}
+
+	log.Printf("📦 Migrating %d files from %s", len(objects), *source)
+	copied, skipped := 0, 0
+	for _, obj := range objects {
+		if existing, err := target.Stat(ctx, obj.Key); err == nil && existing.Size == obj.Size {
+			skipped++
+			continue
+		} else if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Fatalf("❌ Failed to check %s: %v", obj.Key, err)
+		}
+
+		if *dryRun {
+			log.Printf("Would copy %s (%d bytes)", obj.Key, obj.Size)
+			copied++
+			continue
+		}
+
+		r, info, err := src.Get(ctx, obj.Key)
+		if err != nil {
+			log.Fatalf("❌ Failed to read %s: %v", obj.Key, err)
+		}
+		err = target.Put(ctx, obj.Key, r, info.Size, info.ContentType)
+		r.Close()
+		if err != nil {
+			log.Fatalf("❌ Failed to copy %s: %v", obj.Key, err)
+		}
+		copied++
+	}
+	log.Printf("✅ Copied %d files, %d already present", copied, skipped)
+
+	db, err := sql.Open("sqlite3", cfg.Database.Path)
+	if err != nil {
+		log.Fatalf("❌ Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	storage.SetDefault(target)
+	library := media.NewLibrary(db, target)
+
+	// Stored links are media keys resolved against the active backend, so
+	// only legacy URLs pointing at the old uploads directory need rewriting
+	rewrite := func(link, key string) string {
+		if newLink, ok := media.LegacyKey(link, hosts); ok {
+			return newLink
+		}
+		return link
+	}
+
+	if *dryRun {
+		n := 0
+		preview := func(link, key string) string {
+			if newLink := rewrite(link, key); newLink != link {
+				log.Printf("Would rewrite %s -> %s", link, newLink)
+				n++
+			}
+			return link
+		}
+		if _, err := library.RewriteReferences(preview); err != nil {
+			log.Fatalf("❌ Failed to scan image URLs: %v", err)
+		}
+		log.Printf("✅ Dry run complete, %d URLs would be rewritten", n)
+		return
+	}
+
+	// Register the migrated files in the media library
+	if err := library.SyncUploads(ctx); err != nil {
+		log.Fatalf("❌ Failed to register migrated files: %v", err)
+	}
+
+	updated, err := library.RewriteReferences(rewrite)
+	if err != nil {
+		log.Fatalf("❌ Failed to rewrite image URLs: %v", err)
+	}
+	log.Printf("✅ Rewrote %d stored image URLs", updated)
+}
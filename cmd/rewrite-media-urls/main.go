@@ -0,0 +1,87 @@
+// Command rewrite-media-urls converts absolute image URLs stored in gifts,
+// sliders and paper images into media keys, which the API resolves against
+// media.public_base_url / media.cdn_url when serving responses. It reads the
+// same config file, environment and flags as the server.
+//
+//	go run ./cmd/rewrite-media-urls -config config.yaml -hosts api.example.com,localhost -dry-run
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"log"
+	"net/url"
+	"strings"
+	"thaimaster2d/config"
+	"thaimaster2d/media"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	loader := config.NewLoader(flag.CommandLine)
+	hostList := flag.String("hosts", "localhost", "comma separated hostnames whose /api/images/ and /uploads/ URLs are ours")
+	dryRun := flag.Bool("dry-run", false, "only report what would be rewritten")
+	flag.Parse()
+
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	var hosts []string
+	for _, h := range strings.Split(*hostList, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	media.Configure(cfg.Media.PublicBaseURL, cfg.Media.CDNURL)
+	if u, err := url.Parse(cfg.Media.PublicBaseURL); err == nil && u.Hostname() != "" {
+		hosts = append(hosts, u.Hostname())
+	}
+
+	db, err := sql.Open("sqlite3", cfg.Database.Path)
+	if err != nil {
+		log.Fatalf("❌ Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	store, err := cfg.Storage.Open()
+	if err != nil {
+		log.Fatalf("❌ Storage configuration failed: %v", err)
+	}
+	library := media.NewLibrary(db, store)
+
+	rewritten, err := rewriteURLs(library, hosts, *dryRun)
+	if err != nil {
+		log.Fatalf("❌ Failed to rewrite image URLs: %v", err)
+	}
+	if *dryRun {
+		log.Printf("✅ Dry run complete, %d URLs would be rewritten", rewritten)
+		return
+	}
+	log.Printf("✅ Rewrote %d stored image URLs to media keys", rewritten)
+}
+
+// rewriteURLs converts the legacy image URLs of hosts to media keys and
+// returns how many were found. A dry run only logs them.
+func rewriteURLs(library *media.Library, hosts []string, dryRun bool) (int, error) {
+	found := 0
+	updated, err := library.RewriteReferences(func(link, key string) string {
+		newLink, ok := media.LegacyKey(link, hosts)
+		if !ok || newLink == link {
+			return link
+		}
+		found++
+		if dryRun {
+			log.Printf("Would rewrite %s -> %s", link, newLink)
+			return link
+		}
+		log.Printf("%s -> %s", link, newLink)
+		return newLink
+	})
+	if dryRun {
+		return found, err
+	}
+	return updated, err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"thaimaster2d/media"
+	"thaimaster2d/storage"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// links returns every stored image link, in table and ID order
+func links(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	var all []string
+	for _, q := range []string{
+		"SELECT COALESCE(image_link, '') FROM gifts ORDER BY id",
+		"SELECT COALESCE(image_link, '') FROM sliders ORDER BY id",
+		"SELECT image_url FROM paper_images ORDER BY id",
+	} {
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var link string
+			if err := rows.Scan(&link); err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, link)
+		}
+		rows.Close()
+	}
+	return all
+}
+
+func TestRewriteURLs(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/legacy.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "legacy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(string(fixture)); err != nil {
+		t.Fatal(err)
+	}
+	library := media.NewLibrary(db, storage.NewLocal(t.TempDir(), ""))
+	hosts := []string{"localhost", "api.example.com"}
+	before := links(t, db)
+
+	// A dry run counts the URLs without changing them
+	if n, err := rewriteURLs(library, hosts, true); err != nil || n != 4 {
+		t.Errorf("dry run = %d, %v; want 4", n, err)
+	}
+	if got := links(t, db); !slices.Equal(got, before) {
+		t.Errorf("dry run changed links to %q", got)
+	}
+
+	if n, err := rewriteURLs(library, hosts, false); err != nil || n != 4 {
+		t.Errorf("rewrite = %d, %v; want 4", n, err)
+	}
+	want := []string{
+		"1700000000_gift.png",
+		"1700000001_gift.jpg",
+		"1700000002_gift.png",
+		"1700000003_banner.png",
+		// Other hosts and empty links are left alone
+		"https://cdn.partner.com/api/images/banner.png",
+		"",
+		"1700000004_paper.jpg",
+		"https://example.org/paper.jpg",
+	}
+	if got := links(t, db); !slices.Equal(got, want) {
+		t.Errorf("links after rewrite = %q, want %q", got, want)
+	}
+
+	if n, err := rewriteURLs(library, hosts, false); err != nil || n != 0 {
+		t.Errorf("second rewrite = %d, %v; want 0", n, err)
+	}
+}
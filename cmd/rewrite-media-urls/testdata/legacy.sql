@@ -0,0 +1,16 @@
+-- Image links as stored before they were saved as media keys
+CREATE TABLE gifts (id INTEGER PRIMARY KEY AUTOINCREMENT, image_link TEXT);
+CREATE TABLE sliders (id INTEGER PRIMARY KEY AUTOINCREMENT, image_link TEXT);
+CREATE TABLE paper_images (id INTEGER PRIMARY KEY AUTOINCREMENT, image_url TEXT);
+
+INSERT INTO gifts (image_link) VALUES
+	('http://localhost:4545/api/images/1700000000_gift.png'),
+	('https://API.example.com/uploads/1700000001_gift.jpg'),
+	('1700000002_gift.png');
+INSERT INTO sliders (image_link) VALUES
+	('/api/images/1700000003_banner.png'),
+	('https://cdn.partner.com/api/images/banner.png'),
+	(NULL);
+INSERT INTO paper_images (image_url) VALUES
+	('http://localhost:4545/uploads/1700000004_paper.jpg'),
+	('https://example.org/paper.jpg');
@@ -0,0 +1,888 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"thaimaster2d/alert"
+	"thaimaster2d/appuser"
+	"thaimaster2d/ingest"
+	"thaimaster2d/live"
+	"thaimaster2d/logging"
+	"thaimaster2d/points"
+	"thaimaster2d/push"
+	"thaimaster2d/storage"
+	"thaimaster2d/webhook"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Config holds every setting of the server. Values are resolved in order:
+// built-in defaults, config file, environment variables, command-line flags.
+type Config struct {
+	Server   ServerConfig   `yaml:"server" toml:"server"`
+	Database DatabaseConfig `yaml:"database" toml:"database"`
+	Storage  StorageConfig  `yaml:"storage" toml:"storage"`
+	Media    MediaConfig    `yaml:"media" toml:"media"`
+	Live     LiveConfig     `yaml:"live" toml:"live"`
+	CORS     CORSConfig     `yaml:"cors" toml:"cors"`
+	Log      LogConfig      `yaml:"log" toml:"log"`
+	Alerts   AlertsConfig   `yaml:"alerts" toml:"alerts"`
+	Ingest   IngestConfig   `yaml:"ingest" toml:"ingest"`
+	Webhooks WebhooksConfig `yaml:"webhooks" toml:"webhooks"`
+	Push     PushConfig     `yaml:"push" toml:"push"`
+	Users    UsersConfig    `yaml:"users" toml:"users"`
+	Points   PointsConfig   `yaml:"points" toml:"points"`
+
+	file    string
+	sources map[string]string
+}
+
+// ServerConfig configures the HTTP listener
+type ServerConfig struct {
+	Addr            string   `yaml:"addr" toml:"addr"`
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// Dev allows settings only fit for a development machine, such as an
+	// empty users.jwt_secret
+	Dev bool `yaml:"dev" toml:"dev"`
+}
+
+// DatabaseConfig configures the SQLite database
+type DatabaseConfig struct {
+	Path string `yaml:"path" toml:"path"`
+}
+
+// StorageConfig selects and configures the upload storage backend
+type StorageConfig struct {
+	Backend    string   `yaml:"backend" toml:"backend"`
+	UploadsDir string   `yaml:"uploads_dir" toml:"uploads_dir"`
+	SigningKey string   `yaml:"signing_key" toml:"signing_key"`
+	S3         S3Config `yaml:"s3" toml:"s3"`
+}
+
+// S3Config configures an S3-compatible bucket
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint" toml:"endpoint"`
+	Region          string `yaml:"region" toml:"region"`
+	Bucket          string `yaml:"bucket" toml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id" toml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key" toml:"secret_access_key"`
+	PathStyle       bool   `yaml:"path_style" toml:"path_style"`
+	PublicURL       string `yaml:"public_url" toml:"public_url"`
+}
+
+// MediaConfig configures how image links are resolved and cleaned up
+type MediaConfig struct {
+	PublicBaseURL   string   `yaml:"public_base_url" toml:"public_base_url"`
+	CDNURL          string   `yaml:"cdn_url" toml:"cdn_url"`
+	CleanupInterval Duration `yaml:"cleanup_interval" toml:"cleanup_interval"`
+}
+
+// LiveConfig configures the live lottery feed
+type LiveConfig struct {
+	Timezone          string   `yaml:"timezone" toml:"timezone"`
+	InsertWindowStart string   `yaml:"insert_window_start" toml:"insert_window_start"`
+	InsertWindowEnd   string   `yaml:"insert_window_end" toml:"insert_window_end"`
+	SSERetry          Duration `yaml:"sse_retry" toml:"sse_retry"`
+	// Sessions are "HH:MM-HH:MM/max_gap" entries, e.g. "09:30-12:01/2m"
+	Sessions   []string `yaml:"sessions" toml:"sessions"`
+	MarketDays []string `yaml:"market_days" toml:"market_days"`
+	// Feeders are the names feeders send in X-Feeder, in order of priority
+	Feeders []string `yaml:"feeders" toml:"feeders"`
+	// FeederSecrets are "name:secret" entries. A feeder posts over HTTP with
+	// its secret in X-Feeder-Secret.
+	FeederSecrets []string `yaml:"feeder_secrets" toml:"feeder_secrets"`
+	FeederTimeout Duration `yaml:"feeder_timeout" toml:"feeder_timeout"`
+	ResultTimeout Duration `yaml:"result_timeout" toml:"result_timeout"`
+}
+
+// CORSConfig configures the CORS headers sent on every response
+type CORSConfig struct {
+	AllowOrigins []string `yaml:"allow_origins" toml:"allow_origins"`
+	AllowMethods []string `yaml:"allow_methods" toml:"allow_methods"`
+	AllowHeaders []string `yaml:"allow_headers" toml:"allow_headers"`
+}
+
+// AlertsConfig configures where operational alerts are sent. Every sink
+// with its required settings filled in is used.
+type AlertsConfig struct {
+	WebhookURL     string   `yaml:"webhook_url" toml:"webhook_url"`
+	SMTPAddr       string   `yaml:"smtp_addr" toml:"smtp_addr"`
+	SMTPFrom       string   `yaml:"smtp_from" toml:"smtp_from"`
+	SMTPTo         []string `yaml:"smtp_to" toml:"smtp_to"`
+	TelegramURL    string   `yaml:"telegram_url" toml:"telegram_url"`
+	TelegramToken  string   `yaml:"telegram_token" toml:"telegram_token"`
+	TelegramChatID string   `yaml:"telegram_chat_id" toml:"telegram_chat_id"`
+}
+
+// IngestConfig configures the built-in upstream poller, which is off unless
+// sources are set
+type IngestConfig struct {
+	// Sources are "adapter:URL" entries in order of preference, e.g.
+	// "json:https://example.com/set.json" or "fixture:testdata/day.json"
+	Sources []string `yaml:"sources" toml:"sources"`
+	// Feeder is the name the poller posts under when live.feeders is set
+	Feeder   string   `yaml:"feeder" toml:"feeder"`
+	Interval Duration `yaml:"interval" toml:"interval"`
+	Timeout  Duration `yaml:"timeout" toml:"timeout"`
+	Failback Duration `yaml:"failback" toml:"failback"`
+}
+
+// WebhooksConfig configures delivery of events to the webhook endpoints
+// managed on /admin/webhooks
+type WebhooksConfig struct {
+	MaxAttempts int      `yaml:"max_attempts" toml:"max_attempts"`
+	Backoff     Duration `yaml:"backoff" toml:"backoff"`
+	Timeout     Duration `yaml:"timeout" toml:"timeout"`
+}
+
+// PushConfig configures mobile push notifications. Devices can register
+// either way, but nothing is sent unless a sender is set.
+type PushConfig struct {
+	// Sender is fcm, fake (log instead of sending) or empty to disable
+	Sender string `yaml:"sender" toml:"sender"`
+	// FCMCredentials is the service account key file from the Firebase console
+	FCMCredentials string `yaml:"fcm_credentials" toml:"fcm_credentials"`
+	FCMURL         string `yaml:"fcm_url" toml:"fcm_url"`
+}
+
+// UsersConfig configures sign-in for app users
+type UsersConfig struct {
+	// JWTSecret signs access and refresh tokens
+	JWTSecret  string   `yaml:"jwt_secret" toml:"jwt_secret"`
+	AccessTTL  Duration `yaml:"access_ttl" toml:"access_ttl"`
+	RefreshTTL Duration `yaml:"refresh_ttl" toml:"refresh_ttl"`
+	OTPTTL     Duration `yaml:"otp_ttl" toml:"otp_ttl"`
+	OTPResend  Duration `yaml:"otp_resend" toml:"otp_resend"`
+	// SMSSender is http, fake (log instead of sending) or empty to disable
+	// phone sign-in
+	SMSSender string `yaml:"sms_sender" toml:"sms_sender"`
+	SMSURL    string `yaml:"sms_url" toml:"sms_url"`
+	SMSToken  string `yaml:"sms_token" toml:"sms_token"`
+}
+
+// PointsConfig sets the points app users earn. 0 turns a reward off.
+type PointsConfig struct {
+	Checkin int `yaml:"checkin_points" toml:"checkin_points"`
+	Watch   int `yaml:"watch_points" toml:"watch_points"`
+	// Referral is given to both the referrer and the new user
+	Referral int `yaml:"referral_points" toml:"referral_points"`
+}
+
+// LogConfig configures the structured logger
+type LogConfig struct {
+	Level      string `yaml:"level" toml:"level"`
+	Format     string `yaml:"format" toml:"format"`
+	File       string `yaml:"file" toml:"file"`
+	MaxSizeMB  int    `yaml:"max_size_mb" toml:"max_size_mb"`
+	MaxBackups int    `yaml:"max_backups" toml:"max_backups"`
+}
+
+// Default returns the built-in defaults, matching the server's historical
+// hardcoded behaviour
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":4545",
+			ShutdownTimeout: Duration{15 * time.Second},
+		},
+		Database: DatabaseConfig{Path: "./thaimaster2d.db"},
+		Storage: StorageConfig{
+			Backend:    "local",
+			UploadsDir: "uploads",
+			S3:         S3Config{Region: "us-east-1", PathStyle: true},
+		},
+		Live: LiveConfig{
+			Timezone:          "Asia/Yangon",
+			InsertWindowStart: "16:30",
+			InsertWindowEnd:   "16:35",
+			SSERetry:          Duration{5 * time.Second},
+			Sessions:          []string{"09:30-12:01/2m", "14:00-16:30/2m"},
+			MarketDays:        []string{"Mon", "Tue", "Wed", "Thu", "Fri"},
+			FeederTimeout:     Duration{time.Minute},
+			ResultTimeout:     Duration{3 * time.Minute},
+		},
+		CORS: CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowHeaders: []string{"Content-Type", "Authorization"},
+		},
+		Log: LogConfig{
+			Level:      "info",
+			Format:     "json",
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+		},
+		Alerts: AlertsConfig{
+			SMTPFrom:    "thaimaster2d@localhost",
+			TelegramURL: "https://api.telegram.org",
+		},
+		Ingest: IngestConfig{
+			Feeder:   "ingest",
+			Interval: Duration{15 * time.Second},
+			Timeout:  Duration{5 * time.Second},
+			Failback: Duration{5 * time.Minute},
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts: 8,
+			Backoff:     Duration{30 * time.Second},
+			Timeout:     Duration{10 * time.Second},
+		},
+		Push: PushConfig{FCMURL: push.DefaultFCMURL},
+		Users: UsersConfig{
+			AccessTTL:  Duration{15 * time.Minute},
+			RefreshTTL: Duration{30 * 24 * time.Hour},
+			OTPTTL:     Duration{5 * time.Minute},
+			OTPResend:  Duration{time.Minute},
+		},
+		Points: PointsConfig{Checkin: 10, Watch: 5, Referral: 50},
+	}
+}
+
+// setting binds one config field to its file key, environment variable and flag
+type setting struct {
+	key    string
+	env    string
+	usage  string
+	secret bool
+	value  flag.Value
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"server.addr", "LISTEN_ADDR", "HTTP listen address", false, (*stringValue)(&c.Server.Addr)},
+		{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "time allowed to drain requests on shutdown", false, &c.Server.ShutdownTimeout},
+		{"server.dev", "DEV_MODE", "development mode, allowing an empty users.jwt_secret", false, (*boolValue)(&c.Server.Dev)},
+		{"database.path", "DATABASE_PATH", "SQLite database file", false, (*stringValue)(&c.Database.Path)},
+		{"storage.backend", "STORAGE_BACKEND", "upload storage backend (local or s3)", false, (*stringValue)(&c.Storage.Backend)},
+		{"storage.uploads_dir", "UPLOADS_DIR", "directory for the local storage backend", false, (*stringValue)(&c.Storage.UploadsDir)},
+		{"storage.signing_key", "STORAGE_SIGNING_KEY", "HMAC key for local signed URLs", true, (*stringValue)(&c.Storage.SigningKey)},
+		{"storage.s3.endpoint", "S3_ENDPOINT", "S3-compatible endpoint URL", false, (*stringValue)(&c.Storage.S3.Endpoint)},
+		{"storage.s3.region", "S3_REGION", "S3 region", false, (*stringValue)(&c.Storage.S3.Region)},
+		{"storage.s3.bucket", "S3_BUCKET", "S3 bucket", false, (*stringValue)(&c.Storage.S3.Bucket)},
+		{"storage.s3.access_key_id", "S3_ACCESS_KEY_ID", "S3 access key ID", false, (*stringValue)(&c.Storage.S3.AccessKeyID)},
+		{"storage.s3.secret_access_key", "S3_SECRET_ACCESS_KEY", "S3 secret access key", true, (*stringValue)(&c.Storage.S3.SecretAccessKey)},
+		{"storage.s3.path_style", "S3_PATH_STYLE", "use path-style S3 URLs (MinIO)", false, (*boolValue)(&c.Storage.S3.PathStyle)},
+		{"storage.s3.public_url", "S3_PUBLIC_URL", "public URL objects are served from", false, (*stringValue)(&c.Storage.S3.PublicURL)},
+		{"media.public_base_url", "PUBLIC_BASE_URL", "public base URL of this server", false, (*stringValue)(&c.Media.PublicBaseURL)},
+		{"media.cdn_url", "MEDIA_CDN_URL", "CDN prefix media keys are served from", false, (*stringValue)(&c.Media.CDNURL)},
+		{"media.cleanup_interval", "MEDIA_CLEANUP_INTERVAL", "orphaned upload cleanup interval (0 disables)", false, &c.Media.CleanupInterval},
+		{"live.timezone", "LIVE_TIMEZONE", "timezone of the lottery schedule", false, (*stringValue)(&c.Live.Timezone)},
+		{"live.insert_window_start", "HISTORY_INSERT_WINDOW_START", "start of the daily history insert window (HH:MM)", false, (*stringValue)(&c.Live.InsertWindowStart)},
+		{"live.insert_window_end", "HISTORY_INSERT_WINDOW_END", "end of the daily history insert window (HH:MM)", false, (*stringValue)(&c.Live.InsertWindowEnd)},
+		{"live.sse_retry", "SSE_RETRY", "reconnect delay suggested to SSE clients on restart", false, &c.Live.SSERetry},
+		{"live.sessions", "LIVE_SESSIONS", "comma separated market sessions with the maximum feeder gap (HH:MM-HH:MM/2m)", false, (*listValue)(&c.Live.Sessions)},
+		{"live.market_days", "LIVE_MARKET_DAYS", "comma separated weekdays with sessions (Mon,Tue,...)", false, (*listValue)(&c.Live.MarketDays)},
+		{"live.feeders", "LIVE_FEEDERS", "comma separated feeder names in order of priority, empty accepts any update", false, (*listValue)(&c.Live.Feeders)},
+		{"live.feeder_secrets", "LIVE_FEEDER_SECRETS", "comma separated name:secret pairs feeders send in X-Feeder-Secret", true, (*listValue)(&c.Live.FeederSecrets)},
+		{"live.feeder_timeout", "LIVE_FEEDER_TIMEOUT", "silence after which a feeder is considered down", false, &c.Live.FeederTimeout},
+		{"live.result_timeout", "LIVE_RESULT_TIMEOUT", "time feeders have to agree on a draw result", false, &c.Live.ResultTimeout},
+		{"cors.allow_origins", "CORS_ALLOW_ORIGINS", "comma separated allowed origins", false, (*listValue)(&c.CORS.AllowOrigins)},
+		{"cors.allow_methods", "CORS_ALLOW_METHODS", "comma separated allowed methods", false, (*listValue)(&c.CORS.AllowMethods)},
+		{"cors.allow_headers", "CORS_ALLOW_HEADERS", "comma separated allowed headers", false, (*listValue)(&c.CORS.AllowHeaders)},
+		{"alerts.webhook_url", "ALERT_WEBHOOK_URL", "URL alerts are POSTed to as JSON", false, (*stringValue)(&c.Alerts.WebhookURL)},
+		{"alerts.smtp_addr", "ALERT_SMTP_ADDR", "SMTP server (host:port) alert emails are sent through", false, (*stringValue)(&c.Alerts.SMTPAddr)},
+		{"alerts.smtp_from", "ALERT_SMTP_FROM", "sender of alert emails", false, (*stringValue)(&c.Alerts.SMTPFrom)},
+		{"alerts.smtp_to", "ALERT_SMTP_TO", "comma separated recipients of alert emails", false, (*listValue)(&c.Alerts.SMTPTo)},
+		{"alerts.telegram_url", "ALERT_TELEGRAM_URL", "Telegram bot API base URL", false, (*stringValue)(&c.Alerts.TelegramURL)},
+		{"alerts.telegram_token", "ALERT_TELEGRAM_TOKEN", "Telegram bot token", true, (*stringValue)(&c.Alerts.TelegramToken)},
+		{"alerts.telegram_chat_id", "ALERT_TELEGRAM_CHAT_ID", "Telegram chat alerts are sent to", false, (*stringValue)(&c.Alerts.TelegramChatID)},
+		{"ingest.sources", "INGEST_SOURCES", "comma separated upstream sources to poll (adapter:URL), empty disables the poller", false, (*listValue)(&c.Ingest.Sources)},
+		{"ingest.feeder", "INGEST_FEEDER", "feeder name the poller posts under", false, (*stringValue)(&c.Ingest.Feeder)},
+		{"ingest.interval", "INGEST_INTERVAL", "time between upstream polls", false, &c.Ingest.Interval},
+		{"ingest.timeout", "INGEST_TIMEOUT", "time allowed for each upstream fetch", false, &c.Ingest.Timeout},
+		{"ingest.failback", "INGEST_FAILBACK", "time on a fallback source before retrying the preferred one", false, &c.Ingest.Failback},
+		{"webhooks.max_attempts", "WEBHOOKS_MAX_ATTEMPTS", "attempts before a webhook delivery is marked failed", false, (*intValue)(&c.Webhooks.MaxAttempts)},
+		{"webhooks.backoff", "WEBHOOKS_BACKOFF", "wait before the first webhook retry, doubled for each one after", false, &c.Webhooks.Backoff},
+		{"webhooks.timeout", "WEBHOOKS_TIMEOUT", "time allowed for each webhook delivery", false, &c.Webhooks.Timeout},
+		{"push.sender", "PUSH_SENDER", "push notification sender (fcm or fake), empty disables sending", false, (*stringValue)(&c.Push.Sender)},
+		{"push.fcm_credentials", "PUSH_FCM_CREDENTIALS", "Firebase service account key file", false, (*stringValue)(&c.Push.FCMCredentials)},
+		{"push.fcm_url", "PUSH_FCM_URL", "FCM HTTP v1 API base URL", false, (*stringValue)(&c.Push.FCMURL)},
+		{"users.jwt_secret", "JWT_SECRET", "HMAC key for app user tokens, random per start if empty in development mode", true, (*stringValue)(&c.Users.JWTSecret)},
+		{"users.access_ttl", "USERS_ACCESS_TTL", "lifetime of app user access tokens", false, &c.Users.AccessTTL},
+		{"users.refresh_ttl", "USERS_REFRESH_TTL", "lifetime of app user refresh tokens", false, &c.Users.RefreshTTL},
+		{"users.otp_ttl", "USERS_OTP_TTL", "lifetime of SMS login codes", false, &c.Users.OTPTTL},
+		{"users.otp_resend", "USERS_OTP_RESEND", "wait before another login code can be sent to a number", false, &c.Users.OTPResend},
+		{"users.sms_sender", "SMS_SENDER", "SMS sender for login codes (http or fake), empty disables phone sign-in", false, (*stringValue)(&c.Users.SMSSender)},
+		{"users.sms_url", "SMS_URL", "SMS gateway URL login codes are POSTed to", false, (*stringValue)(&c.Users.SMSURL)},
+		{"users.sms_token", "SMS_TOKEN", "bearer token for the SMS gateway", true, (*stringValue)(&c.Users.SMSToken)},
+		{"points.checkin_points", "POINTS_CHECKIN", "points for the daily check-in (0 disables)", false, (*intValue)(&c.Points.Checkin)},
+		{"points.watch_points", "POINTS_WATCH", "points for watching a draw (0 disables)", false, (*intValue)(&c.Points.Watch)},
+		{"points.referral_points", "POINTS_REFERRAL", "points for the referrer and the referred user (0 disables)", false, (*intValue)(&c.Points.Referral)},
+		{"log.level", "LOG_LEVEL", "minimum log level (debug, info, warn or error)", false, (*stringValue)(&c.Log.Level)},
+		{"log.format", "LOG_FORMAT", "log output format (json or text)", false, (*stringValue)(&c.Log.Format)},
+		{"log.file", "LOG_FILE", "log file, rotated by the server (empty logs to stderr)", false, (*stringValue)(&c.Log.File)},
+		{"log.max_size_mb", "LOG_MAX_SIZE_MB", "log file size that triggers rotation", false, (*intValue)(&c.Log.MaxSizeMB)},
+		{"log.max_backups", "LOG_MAX_BACKUPS", "number of rotated log files kept", false, (*intValue)(&c.Log.MaxBackups)},
+	}
+}
+
+// Loader registers config flags on a FlagSet so commands can combine them
+// with their own flags
+type Loader struct {
+	fs    *flag.FlagSet
+	file  *string
+	flags map[string]*string
+}
+
+// NewLoader registers -config and one flag per setting on fs
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{
+		fs:    fs,
+		file:  fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file"),
+		flags: make(map[string]*string),
+	}
+	for _, s := range Default().settings() {
+		l.flags[s.key] = fs.String(s.key, "", fmt.Sprintf("%s (env %s, default %q)", s.usage, s.env, s.value.String()))
+	}
+	return l
+}
+
+// Load builds the config after the FlagSet has been parsed
+func (l *Loader) Load() (*Config, error) {
+	cfg := Default()
+	cfg.sources = make(map[string]string)
+	settings := cfg.settings()
+
+	if *l.file != "" {
+		before := snapshot(settings)
+		if err := cfg.loadFile(*l.file); err != nil {
+			return nil, err
+		}
+		cfg.file = *l.file
+		for i, s := range cfg.settings() {
+			if s.value.String() != before[i] {
+				cfg.sources[s.key] = "file"
+			}
+		}
+		settings = cfg.settings()
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err := s.value.Set(v); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+			cfg.sources[s.key] = "env"
+		}
+	}
+
+	set := make(map[string]bool)
+	l.fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, s := range settings {
+		if set[s.key] {
+			if err := s.value.Set(*l.flags[s.key]); err != nil {
+				return nil, fmt.Errorf("invalid -%s: %w", s.key, err)
+			}
+			cfg.sources[s.key] = "flag"
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Load parses command-line args and builds the server config
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("thaimasterserver", flag.ContinueOnError)
+	loader := NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return loader.Load()
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalWithOptions(data, c, yaml.Strict())
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(c)
+	default:
+		return fmt.Errorf("unsupported config file %q, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks that every setting is usable
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Server.Addr == "" {
+		add("server.addr is required")
+	}
+	if c.Database.Path == "" {
+		add("database.path is required")
+	}
+
+	switch c.Storage.Backend {
+	case "local":
+		if c.Storage.UploadsDir == "" {
+			add("storage.uploads_dir is required for the local backend")
+		}
+	case "s3":
+		if c.Storage.S3.Endpoint == "" || c.Storage.S3.Bucket == "" {
+			add("storage.s3.endpoint and storage.s3.bucket are required for the s3 backend")
+		}
+		if c.Storage.S3.AccessKeyID == "" || c.Storage.S3.SecretAccessKey == "" {
+			add("storage.s3.access_key_id and storage.s3.secret_access_key are required for the s3 backend")
+		}
+	default:
+		add("storage.backend must be local or s3, got %q", c.Storage.Backend)
+	}
+
+	for key, raw := range map[string]string{
+		"storage.s3.endpoint":   c.Storage.S3.Endpoint,
+		"storage.s3.public_url": c.Storage.S3.PublicURL,
+		"media.public_base_url": c.Media.PublicBaseURL,
+		"media.cdn_url":         c.Media.CDNURL,
+		"alerts.webhook_url":    c.Alerts.WebhookURL,
+		"alerts.telegram_url":   c.Alerts.TelegramURL,
+		"push.fcm_url":          c.Push.FCMURL,
+		"users.sms_url":         c.Users.SMSURL,
+	} {
+		if raw == "" {
+			continue
+		}
+		if u, err := url.Parse(raw); err != nil || u.Scheme == "" || u.Host == "" {
+			add("%s must be an absolute URL, got %q", key, raw)
+		}
+	}
+
+	if c.Server.ShutdownTimeout.Duration <= 0 {
+		add("server.shutdown_timeout must be positive")
+	}
+	if c.Live.SSERetry.Duration <= 0 {
+		add("live.sse_retry must be positive")
+	}
+	if c.Media.CleanupInterval.Duration < 0 {
+		add("media.cleanup_interval must not be negative")
+	}
+
+	if _, err := time.LoadLocation(c.Live.Timezone); err != nil {
+		add("live.timezone %q: %v", c.Live.Timezone, err)
+	}
+	start, errStart := ParseClock(c.Live.InsertWindowStart)
+	end, errEnd := ParseClock(c.Live.InsertWindowEnd)
+	if errStart != nil {
+		add("live.insert_window_start: %v", errStart)
+	}
+	if errEnd != nil {
+		add("live.insert_window_end: %v", errEnd)
+	}
+	if errStart == nil && errEnd == nil && end <= start {
+		add("live.insert_window_end must be after live.insert_window_start")
+	}
+	for _, raw := range c.Live.Sessions {
+		if _, err := ParseSession(raw); err != nil {
+			add("live.sessions: %v", err)
+		}
+	}
+	for _, raw := range c.Live.MarketDays {
+		if _, err := ParseWeekday(raw); err != nil {
+			add("live.market_days: %v", err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range c.Live.Feeders {
+		if seen[name] {
+			add("live.feeders: %q listed twice", name)
+		}
+		seen[name] = true
+	}
+	secrets := make(map[string]bool)
+	for _, entry := range c.Live.FeederSecrets {
+		name, _, err := ParseFeederSecret(entry)
+		switch {
+		case err != nil:
+			add("live.feeder_secrets: %v", err)
+		case !seen[name]:
+			add("live.feeder_secrets: %q is not in live.feeders", name)
+		case secrets[name]:
+			add("live.feeder_secrets: %q listed twice", name)
+		}
+		secrets[name] = true
+	}
+	for _, name := range c.Live.Feeders {
+		// The built-in poller submits directly and needs no secret
+		if !secrets[name] && (len(c.Ingest.Sources) == 0 || name != c.Ingest.Feeder) {
+			add("live.feeder_secrets: no secret for feeder %q", name)
+		}
+	}
+	if c.Live.FeederTimeout.Duration <= 0 || c.Live.ResultTimeout.Duration <= 0 {
+		add("live.feeder_timeout and live.result_timeout must be positive")
+	}
+
+	if (c.Alerts.SMTPAddr == "") != (len(c.Alerts.SMTPTo) == 0) {
+		add("alerts.smtp_addr and alerts.smtp_to must be set together")
+	}
+	if (c.Alerts.TelegramToken == "") != (c.Alerts.TelegramChatID == "") {
+		add("alerts.telegram_token and alerts.telegram_chat_id must be set together")
+	}
+
+	for _, spec := range c.Ingest.Sources {
+		if _, err := ingest.ParseSource(spec, nil); err != nil {
+			add("ingest.sources: %v", err)
+		}
+	}
+	if c.Ingest.Interval.Duration <= 0 {
+		add("ingest.interval must be positive")
+	}
+	if c.Ingest.Timeout.Duration < 0 || c.Ingest.Failback.Duration < 0 {
+		add("ingest.timeout and ingest.failback must not be negative")
+	}
+
+	if c.Webhooks.MaxAttempts <= 0 {
+		add("webhooks.max_attempts must be positive")
+	}
+	if c.Webhooks.Backoff.Duration <= 0 || c.Webhooks.Timeout.Duration <= 0 {
+		add("webhooks.backoff and webhooks.timeout must be positive")
+	}
+
+	switch c.Push.Sender {
+	case "", "fake":
+	case "fcm":
+		if c.Push.FCMCredentials == "" {
+			add("push.fcm_credentials is required for the fcm sender")
+		}
+	default:
+		add("push.sender must be fcm, fake or empty, got %q", c.Push.Sender)
+	}
+
+	// A random secret would sign every user out on restart and differ
+	// between instances
+	if c.Users.JWTSecret == "" && !c.Server.Dev {
+		add("users.jwt_secret is required unless server.dev is set")
+	}
+	if c.Users.AccessTTL.Duration <= 0 || c.Users.RefreshTTL.Duration <= 0 {
+		add("users.access_ttl and users.refresh_ttl must be positive")
+	}
+	if c.Users.OTPTTL.Duration <= 0 || c.Users.OTPResend.Duration <= 0 {
+		add("users.otp_ttl and users.otp_resend must be positive")
+	}
+	switch c.Users.SMSSender {
+	case "", "fake":
+	case "http":
+		if c.Users.SMSURL == "" {
+			add("users.sms_url is required for the http sms sender")
+		}
+	default:
+		add("users.sms_sender must be http, fake or empty, got %q", c.Users.SMSSender)
+	}
+
+	if c.Points.Checkin < 0 || c.Points.Watch < 0 || c.Points.Referral < 0 {
+		add("points rewards must not be negative")
+	}
+
+	if len(c.CORS.AllowOrigins) == 0 {
+		add("cors.allow_origins must not be empty")
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		add("log.level: %v", err)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		add("log.format must be json or text, got %q", c.Log.Format)
+	}
+	if c.Log.MaxSizeMB <= 0 {
+		add("log.max_size_mb must be positive")
+	}
+	if c.Log.MaxBackups < 0 {
+		add("log.max_backups must not be negative")
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// LogValue logs the effective configuration and where each value came
+// from. Secrets are redacted.
+func (c *Config) LogValue() slog.Value {
+	var attrs []slog.Attr
+	if c.file != "" {
+		attrs = append(attrs, slog.String("file", c.file))
+	}
+	for _, s := range c.settings() {
+		value := s.value.String()
+		if s.secret && value != "" {
+			value = "********"
+		}
+		attrs = append(attrs, slog.String(s.key, value))
+	}
+
+	// Record where each non-default value came from
+	var sources []slog.Attr
+	for _, s := range c.settings() {
+		if source := c.sources[s.key]; source != "" {
+			sources = append(sources, slog.String(s.key, source))
+		}
+	}
+	if len(sources) > 0 {
+		attrs = append(attrs, slog.Attr{Key: "sources", Value: slog.GroupValue(sources...)})
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// ParseClock parses an HH:MM time of day into an offset from midnight
+func ParseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, use HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ParseSession parses a "HH:MM-HH:MM/max_gap" market session
+func ParseSession(s string) (live.Session, error) {
+	hours, gap, ok := strings.Cut(s, "/")
+	from, to, ok2 := strings.Cut(hours, "-")
+	if !ok || !ok2 {
+		return live.Session{}, fmt.Errorf("invalid session %q, use HH:MM-HH:MM/max_gap", s)
+	}
+	start, err := ParseClock(from)
+	if err != nil {
+		return live.Session{}, err
+	}
+	end, err := ParseClock(to)
+	if err != nil {
+		return live.Session{}, err
+	}
+	if end <= start {
+		return live.Session{}, fmt.Errorf("session %q ends before it starts", s)
+	}
+	maxGap, err := time.ParseDuration(gap)
+	if err != nil || maxGap <= 0 {
+		return live.Session{}, fmt.Errorf("invalid maximum gap in session %q", s)
+	}
+	return live.Session{Start: start, End: end, MaxGap: maxGap}, nil
+}
+
+// ParseFeederSecret parses a "name:secret" feeder secret. Errors leave out
+// the secret.
+func ParseFeederSecret(s string) (name, secret string, err error) {
+	name, secret, ok := strings.Cut(s, ":")
+	if name, secret = strings.TrimSpace(name), strings.TrimSpace(secret); !ok || name == "" || secret == "" {
+		return "", "", errors.New("invalid feeder secret, use name:secret")
+	}
+	return name, secret, nil
+}
+
+// ParseWeekday parses a weekday name such as Mon or Monday
+func ParseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(s, d.String()) || strings.EqualFold(s, d.String()[:3]) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday %q", s)
+}
+
+func snapshot(settings []setting) []string {
+	values := make([]string, len(settings))
+	for i, s := range settings {
+		values[i] = s.value.String()
+	}
+	return values
+}
+
+// Open builds the configured storage backend
+func (s StorageConfig) Open() (storage.Backend, error) {
+	switch s.Backend {
+	case "local":
+		return storage.NewLocal(s.UploadsDir, s.SigningKey), nil
+	case "s3":
+		return storage.NewS3(storage.S3Config{
+			Endpoint:  s.S3.Endpoint,
+			Region:    s.S3.Region,
+			Bucket:    s.S3.Bucket,
+			AccessKey: s.S3.AccessKeyID,
+			SecretKey: s.S3.SecretAccessKey,
+			PathStyle: s.S3.PathStyle,
+			PublicURL: s.S3.PublicURL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", s.Backend)
+	}
+}
+
+// LiveOptions converts the live section into the live package settings
+func (l LiveConfig) LiveOptions() (live.Config, error) {
+	loc, err := time.LoadLocation(l.Timezone)
+	if err != nil {
+		return live.Config{}, err
+	}
+	start, err := ParseClock(l.InsertWindowStart)
+	if err != nil {
+		return live.Config{}, err
+	}
+	end, err := ParseClock(l.InsertWindowEnd)
+	if err != nil {
+		return live.Config{}, err
+	}
+	var sessions []live.Session
+	for _, raw := range l.Sessions {
+		session, err := ParseSession(raw)
+		if err != nil {
+			return live.Config{}, err
+		}
+		sessions = append(sessions, session)
+	}
+	secrets := make(map[string]string)
+	for _, entry := range l.FeederSecrets {
+		name, secret, err := ParseFeederSecret(entry)
+		if err != nil {
+			return live.Config{}, err
+		}
+		secrets[name] = secret
+	}
+	var days []time.Weekday
+	for _, raw := range l.MarketDays {
+		day, err := ParseWeekday(raw)
+		if err != nil {
+			return live.Config{}, err
+		}
+		days = append(days, day)
+	}
+	return live.Config{
+		Location:          loc,
+		InsertWindowStart: start,
+		InsertWindowEnd:   end,
+		SSERetry:          l.SSERetry.Duration,
+		Sessions:          sessions,
+		MarketDays:        days,
+		Feeders:           l.Feeders,
+		FeederSecrets:     secrets,
+		FeederTimeout:     l.FeederTimeout.Duration,
+		ResultTimeout:     l.ResultTimeout.Duration,
+	}, nil
+}
+
+// Sink builds the configured alert sinks, or returns nil if none is set up
+func (a AlertsConfig) Sink() alert.Sink {
+	var sinks alert.Multi
+	if a.WebhookURL != "" {
+		sinks = append(sinks, &alert.Webhook{URL: a.WebhookURL})
+	}
+	if a.SMTPAddr != "" {
+		sinks = append(sinks, &alert.Email{Addr: a.SMTPAddr, From: a.SMTPFrom, To: a.SMTPTo})
+	}
+	if a.TelegramToken != "" {
+		sinks = append(sinks, &alert.Telegram{APIURL: a.TelegramURL, Token: a.TelegramToken, ChatID: a.TelegramChatID})
+	}
+	if len(sinks) == 0 {
+		return nil
+	}
+	return sinks
+}
+
+// PollerOptions converts the ingest section into the poller settings
+func (i IngestConfig) PollerOptions() (ingest.Config, error) {
+	client := &http.Client{Timeout: i.Timeout.Duration}
+	var sources []ingest.Source
+	for _, spec := range i.Sources {
+		source, err := ingest.ParseSource(spec, client)
+		if err != nil {
+			return ingest.Config{}, err
+		}
+		sources = append(sources, source)
+	}
+	return ingest.Config{
+		Sources:  sources,
+		Feeder:   i.Feeder,
+		Interval: i.Interval.Duration,
+		Timeout:  i.Timeout.Duration,
+		Failback: i.Failback.Duration,
+	}, nil
+}
+
+// DispatcherOptions converts the webhooks section into the dispatcher
+// settings
+func (w WebhooksConfig) DispatcherOptions() webhook.Options {
+	return webhook.Options{
+		MaxAttempts: w.MaxAttempts,
+		Backoff:     w.Backoff.Duration,
+		Timeout:     w.Timeout.Duration,
+	}
+}
+
+// Open returns the configured push sender, or nil if sending is disabled
+func (p PushConfig) Open() (push.Sender, error) {
+	switch p.Sender {
+	case "fcm":
+		return push.LoadFCM(p.FCMCredentials, p.FCMURL)
+	case "fake":
+		return push.NewFake(), nil
+	}
+	return nil, nil
+}
+
+// ServiceOptions converts the users section into the sign-in settings
+func (u UsersConfig) ServiceOptions() appuser.Options {
+	opts := appuser.Options{
+		Secret:     u.JWTSecret,
+		AccessTTL:  u.AccessTTL.Duration,
+		RefreshTTL: u.RefreshTTL.Duration,
+		OTPTTL:     u.OTPTTL.Duration,
+		OTPResend:  u.OTPResend.Duration,
+	}
+	switch u.SMSSender {
+	case "http":
+		opts.SMS = &appuser.SMSGateway{URL: u.SMSURL, Token: u.SMSToken}
+	case "fake":
+		opts.SMS = appuser.NewFakeSMS()
+	}
+	return opts
+}
+
+// ServiceOptions converts the points section into the rewards settings
+func (p PointsConfig) ServiceOptions() points.Options {
+	return points.Options{
+		Checkin:  p.Checkin,
+		Watch:    p.Watch,
+		Referral: p.Referral,
+	}
+}
+
+// LogOptions converts the log section into the logging package settings
+func (l LogConfig) LogOptions() (logging.Config, error) {
+	level, err := logging.ParseLevel(l.Level)
+	if err != nil {
+		return logging.Config{}, err
+	}
+	return logging.Config{
+		Level:      level,
+		Format:     l.Format,
+		File:       l.File,
+		MaxSize:    int64(l.MaxSizeMB) << 20,
+		MaxBackups: l.MaxBackups,
+	}, nil
+}
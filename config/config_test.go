@@ -0,0 +1,199 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", "server:\n  addr: \":1000\"\ndatabase:\n  path: file.db\n")
+	tomlFile := writeFile(t, "config.toml", "[server]\naddr = \":1000\"\n[database]\npath = \"file.db\"\n")
+
+	for _, tc := range []struct {
+		name       string
+		env        map[string]string
+		args       []string
+		addr, path string
+		// source of server.addr, empty for the default
+		source string
+	}{
+		{"defaults", nil, nil, ":4545", "./thaimaster2d.db", ""},
+		{"yaml file", nil, []string{"-config", yamlFile}, ":1000", "file.db", "file"},
+		{"toml file", nil, []string{"-config", tomlFile}, ":1000", "file.db", "file"},
+		{"file from env", map[string]string{"CONFIG_FILE": yamlFile}, nil, ":1000", "file.db", "file"},
+		{"env over file", map[string]string{"LISTEN_ADDR": ":2000"}, []string{"-config", yamlFile}, ":2000", "file.db", "env"},
+		{"flag over env", map[string]string{"LISTEN_ADDR": ":2000"}, []string{"-config", yamlFile, "-server.addr", ":3000"}, ":3000", "file.db", "flag"},
+		{"flag over file", nil, []string{"-config", tomlFile, "-server.addr", ":3000"}, ":3000", "file.db", "flag"},
+		{"env without file", map[string]string{"LISTEN_ADDR": ":2000", "DATABASE_PATH": "env.db"}, nil, ":2000", "env.db", "env"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("JWT_SECRET", "test-secret")
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			cfg, err := Load(tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.Addr != tc.addr || cfg.Database.Path != tc.path {
+				t.Errorf("addr, path = %q, %q; want %q, %q", cfg.Server.Addr, cfg.Database.Path, tc.addr, tc.path)
+			}
+			if got := cfg.sources["server.addr"]; got != tc.source {
+				t.Errorf("server.addr source = %q, want %q", got, tc.source)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("JWT_SECRET", "test-secret")
+	for name, tc := range map[string]struct {
+		env  map[string]string
+		args []string
+		want string
+	}{
+		"missing file":  {nil, []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, "failed to read config file"},
+		"unknown key":   {nil, []string{"-config", writeFile(t, "unknown.yaml", "server:\n  port: 80\n")}, "failed to parse"},
+		"bad extension": {nil, []string{"-config", writeFile(t, "config.json", "{}")}, "unsupported config file"},
+		"bad env":       {map[string]string{"WEBHOOKS_MAX_ATTEMPTS": "many"}, nil, "invalid WEBHOOKS_MAX_ATTEMPTS"},
+		"bad flag":      {nil, []string{"-server.shutdown_timeout", "soon"}, "invalid -server.shutdown_timeout"},
+		"invalid value": {nil, []string{"-log.level", "loud"}, "log.level"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			if _, err := Load(tc.args); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Load error = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// validConfig returns the defaults with the settings they leave empty
+func validConfig() *Config {
+	c := Default()
+	c.Users.JWTSecret = "test-secret"
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("default config is invalid: %v", err)
+	}
+	// Development mode allows a random JWT secret
+	dev := Default()
+	dev.Server.Dev = true
+	if err := dev.Validate(); err != nil {
+		t.Errorf("development config is invalid: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		change func(c *Config)
+		want   string
+	}{
+		{"no addr", func(c *Config) { c.Server.Addr = "" }, "server.addr is required"},
+		{"no database", func(c *Config) { c.Database.Path = "" }, "database.path is required"},
+		{"unknown backend", func(c *Config) { c.Storage.Backend = "ftp" }, `storage.backend must be local or s3, got "ftp"`},
+		{"s3 without bucket", func(c *Config) { c.Storage.Backend = "s3" }, "storage.s3.endpoint and storage.s3.bucket are required"},
+		{"relative url", func(c *Config) { c.Media.CDNURL = "cdn.example.com" }, `media.cdn_url must be an absolute URL, got "cdn.example.com"`},
+		{"zero shutdown", func(c *Config) { c.Server.ShutdownTimeout.Duration = 0 }, "server.shutdown_timeout must be positive"},
+		{"bad timezone", func(c *Config) { c.Live.Timezone = "Mars/Olympus" }, `live.timezone "Mars/Olympus"`},
+		{"inverted window", func(c *Config) { c.Live.InsertWindowEnd = "16:00" }, "live.insert_window_end must be after live.insert_window_start"},
+		{"bad session", func(c *Config) { c.Live.Sessions = []string{"12:00-09:00/2m"} }, "ends before it starts"},
+		{"bad weekday", func(c *Config) { c.Live.MarketDays = []string{"Funday"} }, `invalid weekday "Funday"`},
+		{"repeated feeder", func(c *Config) { c.Live.Feeders = []string{"a", "a"} }, `live.feeders: "a" listed twice`},
+		{"feeder without secret", func(c *Config) { c.Live.Feeders = []string{"a"} }, `no secret for feeder "a"`},
+		{"bad feeder secret", func(c *Config) { c.Live.Feeders, c.Live.FeederSecrets = []string{"a"}, []string{"a"} }, "invalid feeder secret, use name:secret"},
+		{"secret for unknown feeder", func(c *Config) { c.Live.FeederSecrets = []string{"b:x"} }, `"b" is not in live.feeders`},
+		{"smtp without recipients", func(c *Config) { c.Alerts.SMTPAddr = "mail:25" }, "alerts.smtp_addr and alerts.smtp_to must be set together"},
+		{"bad source", func(c *Config) { c.Ingest.Sources = []string{"nope"} }, "ingest.sources"},
+		{"no webhook attempts", func(c *Config) { c.Webhooks.MaxAttempts = 0 }, "webhooks.max_attempts must be positive"},
+		{"fcm without credentials", func(c *Config) { c.Push.Sender = "fcm" }, "push.fcm_credentials is required"},
+		{"no jwt secret", func(c *Config) { c.Users.JWTSecret = "" }, "users.jwt_secret is required unless server.dev is set"},
+		{"http sms without url", func(c *Config) { c.Users.SMSSender = "http" }, "users.sms_url is required"},
+		{"negative points", func(c *Config) { c.Points.Watch = -1 }, "points rewards must not be negative"},
+		{"no cors origins", func(c *Config) { c.CORS.AllowOrigins = nil }, "cors.allow_origins must not be empty"},
+		{"bad log format", func(c *Config) { c.Log.Format = "xml" }, `log.format must be json or text, got "xml"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := validConfig()
+			tc.change(c)
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Validate = %v, want %q", err, tc.want)
+			}
+		})
+	}
+
+	// Every problem is reported at once
+	c := validConfig()
+	c.Server.Addr, c.Log.Format = "", "xml"
+	if err := c.Validate(); err == nil || strings.Count(err.Error(), "\n  - ") != 2 {
+		t.Errorf("Validate = %v, want 2 problems", err)
+	}
+}
+
+func TestLogValueRedactsSecrets(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("JWT_SECRET", "jwt-secret-value")
+	secrets := []string{"jwt-secret-value", "signing-secret-value", "s3-secret-value", "telegram-secret-value", "sms-secret-value", "feeder-secret-value"}
+	cfg, err := Load([]string{
+		"-storage.signing_key", "signing-secret-value",
+		"-storage.s3.secret_access_key", "s3-secret-value",
+		"-alerts.telegram_token", "telegram-secret-value",
+		"-alerts.telegram_chat_id", "42",
+		"-users.sms_token", "sms-secret-value",
+		"-live.feeders", "primary",
+		"-live.feeder_secrets", "primary:feeder-secret-value",
+		"-server.shutdown_timeout", "30s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("configuration loaded", "config", cfg)
+	out := buf.String()
+	for _, secret := range secrets {
+		if strings.Contains(out, secret) {
+			t.Errorf("log contains secret %q: %s", secret, out)
+		}
+	}
+	for _, want := range []string{
+		`"users.jwt_secret":"********"`,
+		`"users.sms_token":"********"`,
+		`"server.shutdown_timeout":"30s"`,
+		`"alerts.telegram_chat_id":"42"`,
+		`"sources":{`,
+		`"users.jwt_secret":"env"`,
+		`"server.shutdown_timeout":"flag"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log is missing %s: %s", want, out)
+		}
+	}
+
+	// Empty secrets show as empty rather than redacted
+	buf.Reset()
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("configuration loaded", "config", Default())
+	if strings.Contains(buf.String(), "********") {
+		t.Errorf("unset secrets redacted: %s", buf.String())
+	}
+}
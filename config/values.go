@@ -0,0 +1,104 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration written as a string such as "30s" or "24h" in
+// config files, environment variables and flags
+type Duration struct {
+	time.Duration
+}
+
+// Set implements flag.Value
+func (d *Duration) Set(s string) error {
+	if s == "" || s == "0" {
+		d.Duration = 0
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// String implements flag.Value
+func (d Duration) String() string {
+	if d.Duration == 0 {
+		return "0"
+	}
+	return d.Duration.String()
+}
+
+// UnmarshalText lets YAML and TOML decode durations from strings
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
+// MarshalText writes the duration in its string form
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+type stringValue string
+
+func (s *stringValue) Set(v string) error {
+	*s = stringValue(v)
+	return nil
+}
+
+func (s *stringValue) String() string {
+	return string(*s)
+}
+
+type boolValue bool
+
+func (b *boolValue) Set(v string) error {
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	*b = boolValue(parsed)
+	return nil
+}
+
+func (b *boolValue) String() string {
+	return strconv.FormatBool(bool(*b))
+}
+
+type intValue int
+
+func (i *intValue) Set(v string) error {
+	parsed, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	*i = intValue(parsed)
+	return nil
+}
+
+func (i *intValue) String() string {
+	return strconv.Itoa(int(*i))
+}
+
+// listValue is a comma separated list
+type listValue []string
+
+func (l *listValue) Set(v string) error {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*l = items
+	return nil
+}
+
+func (l *listValue) String() string {
+	return strings.Join(*l, ",")
+}
@@ -0,0 +1,88 @@
+// Package events is the in-process bus that domain events, such as a draw
+// result being finalized or a 3D result being edited, are published on.
+// Subscribers like the webhook and push dispatchers receive every event.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	ResultNoon       = "result.1200"
+	ResultEvening    = "result.430"
+	ThreeDCreated    = "threed.created"
+	ThreeDUpdated    = "threed.updated"
+	HistoryCorrected = "history.corrected"
+	AppConfigUpdated = "appconfig.updated"
+	PaperUpdated     = "paper.updated"
+	// Test is sent by the "send test event" button and never published
+	Test = "webhook.test"
+)
+
+// Types lists the event types subscribers can choose from
+var Types = []string{ResultNoon, ResultEvening, ThreeDCreated, ThreeDUpdated, HistoryCorrected, AppConfigUpdated, PaperUpdated}
+
+// Event is something that happened. Data is marshalled to JSON for
+// subscribers outside the process.
+type Event struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+// Handler receives events. It runs on the publisher's goroutine, so it
+// should hand slow work off.
+type Handler func(ctx context.Context, e Event)
+
+var (
+	mu       sync.RWMutex
+	handlers = make(map[string]Handler)
+)
+
+// Subscribe registers handler under name, replacing any handler already
+// registered under it. A nil handler unsubscribes.
+func Subscribe(name string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	if handler == nil {
+		delete(handlers, name)
+		return
+	}
+	handlers[name] = handler
+}
+
+// New returns an event with a fresh ID
+func New(typ string, data any) Event {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return Event{ID: "evt_" + hex.EncodeToString(b), Type: typ, Time: time.Now().UTC(), Data: data}
+}
+
+// Publish sends a new event to every subscriber
+func Publish(ctx context.Context, typ string, data any) {
+	e := New(typ, data)
+	mu.RLock()
+	names := make([]string, 0, len(handlers))
+	for name := range handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	subscribers := make([]Handler, len(names))
+	for i, name := range names {
+		subscribers[i] = handlers[name]
+	}
+	mu.RUnlock()
+
+	slog.DebugContext(ctx, "event published", "type", typ, "event_id", e.ID, "subscribers", len(subscribers))
+	for _, handle := range subscribers {
+		handle(ctx, e)
+	}
+}
@@ -0,0 +1,257 @@
+package gift
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"thaimaster2d/media"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize limits catalog uploads
+const maxImportSize = 5 << 20
+
+// csvHeader is the column order of CSV exports. Imports find columns by
+// name, so any order works and missing columns keep their zero value.
+var csvHeader = []string{
+	"id", "name", "image_link", "type", "description", "points", "stock", "is_active",
+	"starts_at", "ends_at", "per_user_limit", "low_stock_threshold",
+}
+
+// formatTime writes an optional time for CSV
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// WriteCSV writes gifts as CSV with a header row
+func WriteCSV(w io.Writer, gifts []Gift) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, g := range gifts {
+		cw.Write([]string{
+			strconv.Itoa(g.ID), g.Name, g.ImageLink.URL(), g.Type, g.Description,
+			strconv.Itoa(g.Points), strconv.Itoa(g.Stock), strconv.FormatBool(g.IsActive),
+			formatTime(g.StartsAt), formatTime(g.EndsAt),
+			strconv.Itoa(g.PerUserLimit), strconv.Itoa(g.LowStockThreshold),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvRow reads typed fields of one CSV record, keeping the first error
+type csvRow struct {
+	record  []string
+	columns map[string]int
+	err     error
+}
+
+func (r *csvRow) text(name string) string {
+	if i, ok := r.columns[name]; ok && i < len(r.record) {
+		return strings.TrimSpace(r.record[i])
+	}
+	return ""
+}
+
+func (r *csvRow) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *csvRow) number(name string) int {
+	raw := r.text(name)
+	if raw == "" {
+		return 0
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		r.fail(fmt.Errorf("%s must be a number", name))
+	}
+	return v
+}
+
+func (r *csvRow) boolean(name string, fallback bool) bool {
+	raw := r.text(name)
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		r.fail(fmt.Errorf("%s must be true or false", name))
+	}
+	return v
+}
+
+func (r *csvRow) time(name string) *time.Time {
+	raw := r.text(name)
+	if raw == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		r.fail(fmt.Errorf("%s must be an RFC 3339 time such as 2026-01-02T15:04:05Z", name))
+		return nil
+	}
+	return &t
+}
+
+// ReadCSV reads gifts written by WriteCSV
+func ReadCSV(r io.Reader) ([]Gift, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("missing header row")
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.New("missing name column")
+	}
+
+	var gifts []Gift
+	for n, record := range records[1:] {
+		row := &csvRow{record: record, columns: columns}
+		g := Gift{
+			ID:                row.number("id"),
+			Name:              row.text("name"),
+			ImageLink:         media.Link(media.NormalizeLink(row.text("image_link"))),
+			Type:              row.text("type"),
+			Description:       row.text("description"),
+			Points:            row.number("points"),
+			Stock:             row.number("stock"),
+			IsActive:          row.boolean("is_active", true),
+			StartsAt:          row.time("starts_at"),
+			EndsAt:            row.time("ends_at"),
+			PerUserLimit:      row.number("per_user_limit"),
+			LowStockThreshold: row.number("low_stock_threshold"),
+		}
+		if row.err != nil {
+			return nil, fmt.Errorf("row %d: %w", n+2, row.err)
+		}
+		gifts = append(gifts, g)
+	}
+	return gifts, nil
+}
+
+// Export downloads every gift as ?format=json (the default) or csv
+func (h *Handler) Export(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+	gifts, err := h.repo.List()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if gifts == nil {
+		gifts = []Gift{}
+	}
+
+	filename := "gifts-" + time.Now().Format("2006-01-02") + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == "json" {
+		c.JSON(http.StatusOK, gifts)
+		return
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, gifts); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// Import creates and updates gifts from an uploaded export. Rows whose ID
+// matches a gift update it, the rest are added. Nothing is saved unless
+// every row is valid.
+func (h *Handler) Import(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
+		return
+	}
+	if file.Size > maxImportSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is larger than 5 MB"})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	var gifts []Gift
+	switch strings.ToLower(filepath.Ext(file.Filename)) {
+	case ".csv":
+		gifts, err = ReadCSV(f)
+	case ".json":
+		err = json.NewDecoder(f).Decode(&gifts)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload a .csv or .json export"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file: " + err.Error()})
+		return
+	}
+
+	categories, err := h.repo.ListCategories()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i, g := range gifts {
+		if err := Validate(g, categories); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Gift %d (%s): %v", i+1, g.Name, err)})
+			return
+		}
+	}
+
+	existing, err := h.repo.List()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	created, updated, err := h.repo.Import(gifts)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, g := range gifts {
+		if i := slices.IndexFunc(existing, func(e Gift) bool { return e.ID == g.ID }); g.ID != 0 && i >= 0 {
+			h.checkStock(g, existing[i].Stock)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Imported %d new and %d updated gifts", created, updated),
+		"created": created,
+		"updated": updated,
+	})
+}
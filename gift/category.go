@@ -0,0 +1,99 @@
+package gift
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Claim periods: a gift can be redeemed once per day or once per ISO week
+const (
+	PeriodDaily  = "daily"
+	PeriodWeekly = "weekly"
+)
+
+// Periods lists the claim periods a category can have
+var Periods = []string{PeriodDaily, PeriodWeekly}
+
+// Category groups gifts. Gifts name their category in their type.
+type Category struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Period is how often each gift in the category can be claimed
+	Period    string    `json:"period"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListCategories returns every gift category
+func (h *Handler) ListCategories(c *gin.Context) {
+	categories, err := h.repo.ListCategories()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if categories == nil {
+		categories = []Category{}
+	}
+	c.JSON(http.StatusOK, categories)
+}
+
+// CreateCategory adds a gift category
+func (h *Handler) CreateCategory(c *gin.Context) {
+	var category Category
+	if err := c.BindJSON(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" || len([]rune(category.Name)) > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be 1 to 50 characters"})
+		return
+	}
+	if category.Period == "" {
+		category.Period = PeriodDaily
+	}
+	if !slices.Contains(Periods, category.Period) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be daily or weekly"})
+		return
+	}
+
+	created, err := h.repo.CreateCategory(category)
+	if errors.Is(err, ErrCategoryExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Category already exists"})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// DeleteCategory removes a gift category no gift belongs to
+func (h *Handler) DeleteCategory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	err = h.repo.DeleteCategory(id)
+	switch {
+	case errors.Is(err, ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+	case errors.Is(err, ErrCategoryInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": "Move or delete the gifts in this category first"})
+	case err != nil:
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Category deleted"})
+	}
+}
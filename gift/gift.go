@@ -1,169 +1,247 @@
 package gift
 
 import (
-	"database/sql"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"thaimaster2d/alert"
+	"thaimaster2d/media"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Gift struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	ImageLink   string    `json:"image_link"`
-	Type        string    `json:"type"`
-	Description string    `json:"description"`
-	Points      int       `json:"points"`
-	Stock       int       `json:"stock"`
-	IsActive    bool      `json:"is_active"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	ImageLink media.Link `json:"image_link"`
+	// Type is the name of the gift's category
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Points      int    `json:"points"`
+	Stock       int    `json:"stock"`
+	IsActive    bool   `json:"is_active"`
+	// StartsAt and EndsAt limit when an active gift is offered, nil for no
+	// limit
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+	// PerUserLimit caps how many times one user can redeem the gift, 0 for
+	// no cap
+	PerUserLimit int `json:"per_user_limit"`
+	// LowStockThreshold alerts admins when the stock drops to it, 0 for no
+	// alert
+	LowStockThreshold int       `json:"low_stock_threshold"`
+	CreatedAt         time.Time `json:"created_at"`
 }
 
-var db *sql.DB
+// Available reports whether the gift is offered at t
+func (g Gift) Available(t time.Time) bool {
+	if !g.IsActive {
+		return false
+	}
+	if g.StartsAt != nil && t.Before(*g.StartsAt) {
+		return false
+	}
+	return g.EndsAt == nil || t.Before(*g.EndsAt)
+}
+
+// LowStock reports whether the stock is at or below the alert threshold
+func (g Gift) LowStock() bool {
+	return g.LowStockThreshold > 0 && g.Stock <= g.LowStockThreshold
+}
 
-// InitDB initializes the database connection
-func InitDB(database *sql.DB) {
-	db = database
-	createTable()
+// StockAlert returns the alert for g's stock dropping from before to
+// g.Stock, if it ran out or crossed the low-stock threshold. Gifts without
+// a threshold don't alert.
+func StockAlert(g Gift, before int, now time.Time) *alert.Alert {
+	if g.LowStockThreshold <= 0 || g.Stock >= before {
+		return nil
+	}
+	switch {
+	case g.Stock == 0:
+		return &alert.Alert{
+			Kind:  alert.KindLowStock,
+			Title: "Gift out of stock: " + g.Name,
+			Message: fmt.Sprintf("The last %s (gift %d) is gone. Restock it or turn it off in the admin panel.",
+				g.Name, g.ID),
+			Time: now,
+		}
+	case before > g.LowStockThreshold && g.Stock <= g.LowStockThreshold:
+		return &alert.Alert{
+			Kind:    alert.KindLowStock,
+			Title:   "Gift stock low: " + g.Name,
+			Message: fmt.Sprintf("%d of %s (gift %d) left.", g.Stock, g.Name, g.ID),
+			Time:    now,
+		}
+	}
+	return nil
+}
+
+// Validate checks a gift before it is saved. categories are the categories
+// the gift's type can name.
+func Validate(g Gift, categories []Category) error {
+	if strings.TrimSpace(g.Name) == "" {
+		return errors.New("name is required")
+	}
+	if !slices.ContainsFunc(categories, func(c Category) bool { return c.Name == g.Type }) {
+		return fmt.Errorf("unknown category %q", g.Type)
+	}
+	if g.Points < 0 || g.Stock < 0 || g.PerUserLimit < 0 || g.LowStockThreshold < 0 {
+		return errors.New("points, stock, per_user_limit and low_stock_threshold must not be negative")
+	}
+	if g.StartsAt != nil && g.EndsAt != nil && !g.EndsAt.After(*g.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	return nil
 }
 
-// Create gifts table and uploads directory
-func createTable() {
-	query := `
-	CREATE TABLE IF NOT EXISTS gifts (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		image_link TEXT NOT NULL,
-		type TEXT NOT NULL CHECK (type IN ('Daily', 'Weekly')),
-		description TEXT,
-		points INTEGER DEFAULT 0,
-		stock INTEGER DEFAULT 0,
-		is_active INTEGER DEFAULT 1,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-	CREATE INDEX IF NOT EXISTS idx_gift_type ON gifts(type);
-	CREATE INDEX IF NOT EXISTS idx_gift_active ON gifts(is_active);
-	`
-	_, err := db.Exec(query)
+// validate replies 400 if the gift can't be saved
+func (h *Handler) validate(c *gin.Context, g Gift) bool {
+	categories, err := h.repo.ListCategories()
 	if err != nil {
-		log.Printf("❌ Error creating gifts table: %v", err)
-	} else {
-		log.Println("✅ Gifts table ready")
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := Validate(g, categories); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// Handler serves the gift API
+type Handler struct {
+	repo   GiftRepository
+	alerts alert.Sink
+}
+
+// NewHandler creates a gift handler backed by repo. alerts is told when an
+// edit brings a gift's stock low, nil to not alert.
+func NewHandler(repo GiftRepository, alerts alert.Sink) *Handler {
+	return &Handler{repo: repo, alerts: alerts}
+}
+
+// checkStock alerts admins if an edit took g's stock from before past its
+// low-stock threshold
+func (h *Handler) checkStock(g Gift, before int) {
+	if a := StockAlert(g, before, time.Now()); a != nil {
+		alert.Notify(h.alerts, *a)
 	}
 }
 
-// GetAllGifts retrieves all active gifts grouped by type
-func GetAllGifts() (map[string][]Gift, error) {
-	query := `
-		SELECT id, name, image_link, type, description, points, stock, is_active, created_at
-		FROM gifts
-		WHERE is_active = true
-		ORDER BY type, created_at DESC
-	`
-	rows, err := db.Query(query)
+// GetGifts returns the gifts on offer grouped by type
+func (h *Handler) GetGifts(c *gin.Context) {
+	gifts, err := h.repo.ListActive()
 	if err != nil {
-		return nil, err
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	defer rows.Close()
 
 	giftsMap := make(map[string][]Gift)
-	for rows.Next() {
-		var gift Gift
-		err := rows.Scan(&gift.ID, &gift.Name, &gift.ImageLink, &gift.Type,
-			&gift.Description, &gift.Points, &gift.Stock, &gift.IsActive, &gift.CreatedAt)
-		if err != nil {
-			log.Printf("Error scanning gift: %v", err)
-			continue
-		}
+	for _, gift := range gifts {
 		giftsMap[gift.Type] = append(giftsMap[gift.Type], gift)
 	}
 
-	return giftsMap, nil
+	c.JSON(http.StatusOK, giftsMap)
 }
 
-// GetAllGiftsForAdmin retrieves all gifts (including inactive)
-func GetAllGiftsForAdmin() ([]Gift, error) {
-	query := `
-		SELECT id, name, image_link, type, description, points, stock, is_active, created_at
-		FROM gifts
-		ORDER BY created_at DESC
-	`
-	rows, err := db.Query(query)
+// ListAdmin returns all gifts (including inactive)
+func (h *Handler) ListAdmin(c *gin.Context) {
+	gifts, err := h.repo.List()
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var gifts []Gift
-	for rows.Next() {
-		var gift Gift
-		err := rows.Scan(&gift.ID, &gift.Name, &gift.ImageLink, &gift.Type,
-			&gift.Description, &gift.Points, &gift.Stock, &gift.IsActive, &gift.CreatedAt)
-		if err != nil {
-			log.Printf("Error scanning gift: %v", err)
-			continue
-		}
-		gifts = append(gifts, gift)
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-
-	return gifts, nil
+	c.JSON(http.StatusOK, gifts)
 }
 
-// InsertGift adds a new gift
-func InsertGift(gift Gift) error {
-	query := `
-		INSERT INTO gifts (name, image_link, type, description, points, stock, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`
-	_, err := db.Exec(query, gift.Name, gift.ImageLink, gift.Type,
-		gift.Description, gift.Points, gift.Stock, gift.IsActive)
+// GetByID returns a single gift by ID
+func (h *Handler) GetByID(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		log.Printf("❌ Error inserting gift: %v", err)
-		return err
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
 	}
-	log.Printf("✅ Gift inserted: %s", gift.Name)
-	return nil
-}
 
-// UpdateGift updates an existing gift
-func UpdateGift(gift Gift) error {
-	query := `
-		UPDATE gifts
-		SET name = $1, image_link = $2, type = $3, description = $4,
-		    points = $5, stock = $6, is_active = $7
-		WHERE id = $8
-	`
-	_, err := db.Exec(query, gift.Name, gift.ImageLink, gift.Type,
-		gift.Description, gift.Points, gift.Stock, gift.IsActive, gift.ID)
+	gift, err := h.repo.Get(id)
 	if err != nil {
-		log.Printf("❌ Error updating gift: %v", err)
-		return err
+		if errors.Is(err, ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Gift not found"})
+		} else {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
 	}
-	log.Printf("✅ Gift updated: %s", gift.Name)
-	return nil
+
+	c.JSON(http.StatusOK, gift)
 }
 
-// DeleteGift deletes a gift
-func DeleteGift(id int) error {
-	query := `DELETE FROM gifts WHERE id = $1`
-	_, err := db.Exec(query, id)
-	if err != nil {
-		log.Printf("❌ Error deleting gift: %v", err)
-		return err
+// Create adds a new gift
+func (h *Handler) Create(c *gin.Context) {
+	var newGift Gift
+	if err := c.BindJSON(&newGift); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	log.Printf("✅ Gift deleted: ID %d", id)
-	return nil
+	if !h.validate(c, newGift) {
+		return
+	}
+	if err := h.repo.Create(newGift); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Gift created"})
 }
 
-// GetGiftsHandler returns gifts grouped by type
-func GetGiftsHandler(c *gin.Context) {
-	gifts, err := GetAllGifts()
-	if err != nil {
+// Update updates an existing gift
+func (h *Handler) Update(c *gin.Context) {
+	var updatedGift Gift
+	if err := c.BindJSON(&updatedGift); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if updatedGift.ID == 0 {
+		updatedGift.ID, _ = strconv.Atoi(c.Param("id"))
+	}
+	if !h.validate(c, updatedGift) {
+		return
+	}
+	old, err := h.repo.Get(updatedGift.ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if err := h.repo.Update(updatedGift); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if old != nil {
+		h.checkStock(updatedGift, old.Stock)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Gift updated"})
+}
 
-	c.JSON(http.StatusOK, gifts)
+// Delete deletes a gift
+func (h *Handler) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	if err := h.repo.Delete(id); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Gift deleted"})
 }
@@ -0,0 +1,34 @@
+package gift
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStockAlert(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		before, stock int
+		threshold     int
+		want          string
+	}{
+		{"reaches threshold", 4, 3, 3, "Gift stock low"},
+		{"skips past threshold", 10, 1, 3, "Gift stock low"},
+		{"runs out", 1, 0, 3, "Gift out of stock"},
+		{"runs out past threshold", 10, 0, 3, "Gift out of stock"},
+		{"stays above", 10, 5, 3, ""},
+		{"already low", 3, 2, 3, ""},
+		{"restocked", 0, 2, 3, ""},
+		{"no threshold", 1, 0, 0, ""},
+	} {
+		g := Gift{ID: 7, Name: "Phone Card", Stock: tc.stock, LowStockThreshold: tc.threshold}
+		a := StockAlert(g, tc.before, time.Now())
+		switch {
+		case tc.want == "" && a != nil:
+			t.Errorf("%s: alert %q, want none", tc.name, a.Title)
+		case tc.want != "" && (a == nil || !strings.HasPrefix(a.Title, tc.want)):
+			t.Errorf("%s: alert %v, want %q", tc.name, a, tc.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package gift
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryRepository is an in-memory GiftRepository for tests
+type MemoryRepository struct {
+	mu             sync.Mutex
+	gifts          map[int]Gift
+	nextID         int
+	categories     map[int]Category
+	nextCategoryID int
+}
+
+// NewMemoryRepository returns a repository with no gifts and the Daily and
+// Weekly categories
+func NewMemoryRepository() *MemoryRepository {
+	now := time.Now()
+	return &MemoryRepository{
+		gifts:  make(map[int]Gift),
+		nextID: 1,
+		categories: map[int]Category{
+			1: {ID: 1, Name: "Daily", Period: PeriodDaily, CreatedAt: now},
+			2: {ID: 2, Name: "Weekly", Period: PeriodWeekly, CreatedAt: now},
+		},
+		nextCategoryID: 3,
+	}
+}
+
+// ListActive returns the gifts on offer now ordered by type, newest first
+func (r *MemoryRepository) ListActive() ([]Gift, error) {
+	now := time.Now()
+	var gifts []Gift
+	for _, g := range r.sorted() {
+		if g.Available(now) {
+			gifts = append(gifts, g)
+		}
+	}
+	sort.SliceStable(gifts, func(i, j int) bool { return gifts[i].Type < gifts[j].Type })
+	return gifts, nil
+}
+
+// List returns every gift, newest first
+func (r *MemoryRepository) List() ([]Gift, error) {
+	return r.sorted(), nil
+}
+
+func (r *MemoryRepository) sorted() []Gift {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	gifts := make([]Gift, 0, len(r.gifts))
+	for _, g := range r.gifts {
+		gifts = append(gifts, g)
+	}
+	sort.Slice(gifts, func(i, j int) bool {
+		if !gifts[i].CreatedAt.Equal(gifts[j].CreatedAt) {
+			return gifts[i].CreatedAt.After(gifts[j].CreatedAt)
+		}
+		return gifts[i].ID > gifts[j].ID
+	})
+	return gifts
+}
+
+// Get returns a single gift or ErrNotFound
+func (r *MemoryRepository) Get(id int) (*Gift, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	g, ok := r.gifts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &g, nil
+}
+
+// Create adds a gift with the next ID
+func (r *MemoryRepository) Create(gift Gift) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.create(gift)
+	return nil
+}
+
+func (r *MemoryRepository) create(gift Gift) {
+	gift.ID = r.nextID
+	r.nextID++
+	if gift.CreatedAt.IsZero() {
+		gift.CreatedAt = time.Now()
+	}
+	r.gifts[gift.ID] = gift
+}
+
+// Update replaces a gift, keeping its creation time
+func (r *MemoryRepository) Update(gift Gift) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.update(gift)
+	return nil
+}
+
+func (r *MemoryRepository) update(gift Gift) bool {
+	existing, ok := r.gifts[gift.ID]
+	if !ok {
+		return false
+	}
+	gift.CreatedAt = existing.CreatedAt
+	r.gifts[gift.ID] = gift
+	return true
+}
+
+// Delete removes a gift
+func (r *MemoryRepository) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.gifts, id)
+	return nil
+}
+
+// Import updates the gifts whose ID exists and creates the rest
+func (r *MemoryRepository) Import(gifts []Gift) (created, updated int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, g := range gifts {
+		if g.ID > 0 && r.update(g) {
+			updated++
+			continue
+		}
+		r.create(g)
+		created++
+	}
+	return created, updated, nil
+}
+
+// ListCategories returns the categories in name order
+func (r *MemoryRepository) ListCategories() ([]Category, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	categories := make([]Category, 0, len(r.categories))
+	for _, c := range r.categories {
+		categories = append(categories, c)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+	return categories, nil
+}
+
+// CreateCategory adds a category or returns ErrCategoryExists
+func (r *MemoryRepository) CreateCategory(category Category) (*Category, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.categories {
+		if c.Name == category.Name {
+			return nil, ErrCategoryExists
+		}
+	}
+	category.ID = r.nextCategoryID
+	r.nextCategoryID++
+	category.CreatedAt = time.Now()
+	r.categories[category.ID] = category
+	return &category, nil
+}
+
+// DeleteCategory removes a category no gift belongs to
+func (r *MemoryRepository) DeleteCategory(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	category, ok := r.categories[id]
+	if !ok {
+		return ErrCategoryNotFound
+	}
+	for _, g := range r.gifts {
+		if g.Type == category.Name {
+			return ErrCategoryInUse
+		}
+	}
+	delete(r.categories, id)
+	return nil
+}
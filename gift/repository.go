@@ -0,0 +1,369 @@
+package gift
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a gift doesn't exist
+	ErrNotFound = errors.New("gift not found")
+	// ErrCategoryNotFound is returned when a category doesn't exist
+	ErrCategoryNotFound = errors.New("category not found")
+	// ErrCategoryExists is returned when a category name is taken
+	ErrCategoryExists = errors.New("category already exists")
+	// ErrCategoryInUse is returned when deleting a category gifts belong to
+	ErrCategoryInUse = errors.New("category has gifts")
+)
+
+// GiftRepository stores gifts and their categories
+type GiftRepository interface {
+	// ListActive returns the gifts on offer now: active and inside their
+	// availability window, ordered by type, newest first
+	ListActive() ([]Gift, error)
+	// List returns every gift, newest first
+	List() ([]Gift, error)
+	// Get returns a single gift or ErrNotFound
+	Get(id int) (*Gift, error)
+	Create(gift Gift) error
+	Update(gift Gift) error
+	Delete(id int) error
+	// Import updates the gifts whose ID exists and creates the rest, all
+	// in one transaction
+	Import(gifts []Gift) (created, updated int, err error)
+
+	// ListCategories returns the categories in name order
+	ListCategories() ([]Category, error)
+	// CreateCategory adds a category or returns ErrCategoryExists
+	CreateCategory(category Category) (*Category, error)
+	// DeleteCategory removes a category no gift belongs to
+	DeleteCategory(id int) error
+}
+
+// SQLRepository is a GiftRepository backed by the gifts and gift_categories
+// tables
+type SQLRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository creates the gift tables if needed
+func NewSQLRepository(db *sql.DB) *SQLRepository {
+	r := &SQLRepository{db: db}
+	r.createTable()
+	return r
+}
+
+const giftsTable = `
+	CREATE TABLE IF NOT EXISTS gifts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		image_link TEXT NOT NULL,
+		type TEXT NOT NULL,
+		description TEXT,
+		points INTEGER DEFAULT 0,
+		stock INTEGER DEFAULT 0,
+		is_active INTEGER DEFAULT 1,
+		starts_at DATETIME,
+		ends_at DATETIME,
+		per_user_limit INTEGER NOT NULL DEFAULT 0,
+		low_stock_threshold INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+`
+
+// Create gifts and categories tables. The categories start out as the
+// Daily and Weekly types gifts used to be limited to.
+func (r *SQLRepository) createTable() {
+	query := giftsTable + `
+	CREATE INDEX IF NOT EXISTS idx_gift_type ON gifts(type);
+	CREATE INDEX IF NOT EXISTS idx_gift_active ON gifts(is_active);
+	CREATE TABLE IF NOT EXISTS gift_categories (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		period TEXT NOT NULL DEFAULT 'daily',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO gift_categories (name, period)
+	SELECT 'Daily', 'daily' WHERE NOT EXISTS (SELECT 1 FROM gift_categories)
+	UNION ALL
+	SELECT 'Weekly', 'weekly' WHERE NOT EXISTS (SELECT 1 FROM gift_categories);
+	`
+	if err := r.migrate(); err != nil {
+		slog.Error("failed to migrate gifts table", "error", err)
+		return
+	}
+	_, err := r.db.Exec(query)
+	if err != nil {
+		slog.Error("failed to create gifts table", "error", err)
+	} else {
+		slog.Info("gifts table ready")
+	}
+}
+
+// migrate rebuilds a gifts table from before categories, whose type was
+// limited to Daily and Weekly by a CHECK constraint SQLite can't drop
+func (r *SQLRepository) migrate() error {
+	var schema string
+	err := r.db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'gifts'").Scan(&schema)
+	if err == sql.ErrNoRows || (err == nil && !strings.Contains(schema, "CHECK")) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		"ALTER TABLE gifts RENAME TO gifts_old",
+		giftsTable,
+		`INSERT INTO gifts (id, name, image_link, type, description, points, stock, is_active, created_at)
+		SELECT id, name, image_link, type, description, points, stock, is_active, created_at FROM gifts_old`,
+		"DROP TABLE gifts_old",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.Info("rebuilt gifts table for categories")
+	return nil
+}
+
+const selectGift = `
+	SELECT id, name, image_link, type, description, points, stock, is_active,
+	       starts_at, ends_at, per_user_limit, low_stock_threshold, created_at
+	FROM gifts
+`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanGift(row scanner) (Gift, error) {
+	var gift Gift
+	err := row.Scan(&gift.ID, &gift.Name, &gift.ImageLink, &gift.Type,
+		&gift.Description, &gift.Points, &gift.Stock, &gift.IsActive,
+		&gift.StartsAt, &gift.EndsAt, &gift.PerUserLimit, &gift.LowStockThreshold, &gift.CreatedAt)
+	return gift, err
+}
+
+// ListActive retrieves the gifts on offer ordered by type
+func (r *SQLRepository) ListActive() ([]Gift, error) {
+	gifts, err := r.query(selectGift + `WHERE is_active = true ORDER BY type, created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	available := gifts[:0]
+	for _, g := range gifts {
+		if g.Available(now) {
+			available = append(available, g)
+		}
+	}
+	return available, nil
+}
+
+// List retrieves all gifts (including inactive)
+func (r *SQLRepository) List() ([]Gift, error) {
+	return r.query(selectGift + `ORDER BY created_at DESC`)
+}
+
+func (r *SQLRepository) query(query string, args ...interface{}) ([]Gift, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gifts []Gift
+	for rows.Next() {
+		gift, err := scanGift(rows)
+		if err != nil {
+			slog.Warn("skipping unreadable gift row", "error", err)
+			continue
+		}
+		gifts = append(gifts, gift)
+	}
+
+	return gifts, rows.Err()
+}
+
+// Get retrieves a single gift
+func (r *SQLRepository) Get(id int) (*Gift, error) {
+	gift, err := scanGift(r.db.QueryRow(selectGift+`WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &gift, nil
+}
+
+// utc stores optional times in UTC so they compare as text
+func utc(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// execer is a *sql.DB or *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insertGift(db execer, gift Gift) error {
+	query := `
+		INSERT INTO gifts (name, image_link, type, description, points, stock, is_active,
+		                   starts_at, ends_at, per_user_limit, low_stock_threshold)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	_, err := db.Exec(query, gift.Name, gift.ImageLink, gift.Type,
+		gift.Description, gift.Points, gift.Stock, gift.IsActive,
+		utc(gift.StartsAt), utc(gift.EndsAt), gift.PerUserLimit, gift.LowStockThreshold)
+	return err
+}
+
+func updateGift(db execer, gift Gift) (bool, error) {
+	query := `
+		UPDATE gifts
+		SET name = $1, image_link = $2, type = $3, description = $4,
+		    points = $5, stock = $6, is_active = $7, starts_at = $8, ends_at = $9,
+		    per_user_limit = $10, low_stock_threshold = $11
+		WHERE id = $12
+	`
+	result, err := db.Exec(query, gift.Name, gift.ImageLink, gift.Type,
+		gift.Description, gift.Points, gift.Stock, gift.IsActive, utc(gift.StartsAt), utc(gift.EndsAt),
+		gift.PerUserLimit, gift.LowStockThreshold, gift.ID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// Create adds a new gift
+func (r *SQLRepository) Create(gift Gift) error {
+	if err := insertGift(r.db, gift); err != nil {
+		return err
+	}
+	slog.Debug("gift inserted", "name", gift.Name)
+	return nil
+}
+
+// Update updates an existing gift
+func (r *SQLRepository) Update(gift Gift) error {
+	if _, err := updateGift(r.db, gift); err != nil {
+		return err
+	}
+	slog.Debug("gift updated", "id", gift.ID, "name", gift.Name)
+	return nil
+}
+
+// Delete deletes a gift
+func (r *SQLRepository) Delete(id int) error {
+	query := `DELETE FROM gifts WHERE id = $1`
+	_, err := r.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+	slog.Debug("gift deleted", "id", id)
+	return nil
+}
+
+// Import creates and updates gifts in one transaction
+func (r *SQLRepository) Import(gifts []Gift) (created, updated int, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	for _, gift := range gifts {
+		if gift.ID > 0 {
+			found, err := updateGift(tx, gift)
+			if err != nil {
+				return 0, 0, err
+			}
+			if found {
+				updated++
+				continue
+			}
+		}
+		if err := insertGift(tx, gift); err != nil {
+			return 0, 0, err
+		}
+		created++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return created, updated, nil
+}
+
+// ListCategories retrieves every category
+func (r *SQLRepository) ListCategories() ([]Category, error) {
+	rows, err := r.db.Query(`SELECT id, name, period, created_at FROM gift_categories ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.Period, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+// CreateCategory adds a category
+func (r *SQLRepository) CreateCategory(category Category) (*Category, error) {
+	err := r.db.QueryRow(`
+		INSERT INTO gift_categories (name, period) VALUES ($1, $2)
+		ON CONFLICT (name) DO NOTHING
+		RETURNING id, created_at`, category.Name, category.Period).Scan(&category.ID, &category.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrCategoryExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("gift category created", "name", category.Name)
+	return &category, nil
+}
+
+// DeleteCategory removes an unused category
+func (r *SQLRepository) DeleteCategory(id int) error {
+	result, err := r.db.Exec(`
+		DELETE FROM gift_categories
+		WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM gifts WHERE gifts.type = gift_categories.name)`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		slog.Debug("gift category deleted", "id", id)
+		return nil
+	}
+	var exists bool
+	if err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM gift_categories WHERE id = $1)", id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrCategoryInUse
+	}
+	return ErrCategoryNotFound
+}
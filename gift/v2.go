@@ -0,0 +1,36 @@
+package gift
+
+import (
+	"net/http"
+	"thaimaster2d/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListV2 handles GET /api/v2/gifts. Gifts are returned as a flat list,
+// optionally filtered with ?type=Daily, instead of the v1 map keyed by type.
+func (h *Handler) ListV2(c *gin.Context) {
+	page, ok := api.ParsePage(c)
+	if !ok {
+		return
+	}
+
+	gifts, err := h.repo.ListActive()
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to fetch gifts")
+		return
+	}
+
+	if giftType := c.Query("type"); giftType != "" {
+		filtered := []Gift{}
+		for _, gift := range gifts {
+			if gift.Type == giftType {
+				filtered = append(filtered, gift)
+			}
+		}
+		gifts = filtered
+	}
+
+	api.Paginate(c, gifts, page)
+}
@@ -0,0 +1,122 @@
+// Package ingest polls upstream sources for the SET index and traded value
+// and publishes the live 2D number itself, as an alternative to an external
+// feeder posting to /api/lottery/update. Sources are tried in order and the
+// poller fails over to the next one when a source stops answering.
+package ingest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Quote is one reading of the SET index and the traded value in millions
+// of baht, formatted like the feed ("1,284.21", "18,520.04")
+type Quote struct {
+	Set   string `json:"set"`
+	Value string `json:"value"`
+}
+
+// ParseQuote normalizes an index and value as printed upstream, with or
+// without thousands separators
+func ParseQuote(set, value string) (Quote, error) {
+	s, err := parseAmount(set)
+	if err != nil {
+		return Quote{}, fmt.Errorf("invalid SET index %q", set)
+	}
+	v, err := parseAmount(value)
+	if err != nil {
+		return Quote{}, fmt.Errorf("invalid traded value %q", value)
+	}
+	return Quote{Set: s, Value: v}, nil
+}
+
+// Live is the 2D number: the last digit of the index followed by the last
+// digit before the decimal point of the value
+func (q Quote) Live() string {
+	integer, _, _ := strings.Cut(q.Value, ".")
+	return q.Set[len(q.Set)-1:] + integer[len(integer)-1:]
+}
+
+// parseAmount formats a positive decimal with two decimals and thousands
+// separators
+func parseAmount(s string) (string, error) {
+	f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), 64)
+	if err != nil || f <= 0 {
+		return "", errors.New("not a positive number")
+	}
+	plain := strconv.FormatFloat(f, 'f', 2, 64)
+	integer, fraction, _ := strings.Cut(plain, ".")
+	var b strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	return b.String() + "." + fraction, nil
+}
+
+// Adapter parses an upstream response body into a quote
+type Adapter func(body []byte) (Quote, error)
+
+var adapters = map[string]Adapter{
+	"json": parseJSON,
+	"csv":  parseCSV,
+}
+
+// RegisterAdapter makes an adapter available to sources as name:URL. It
+// panics if the name is taken.
+func RegisterAdapter(name string, adapter Adapter) {
+	if _, ok := adapters[name]; ok || name == "fixture" {
+		panic("ingest: adapter " + name + " registered twice")
+	}
+	adapters[name] = adapter
+}
+
+// parseJSON reads {"set": ..., "value": ...}, with numbers or strings
+func parseJSON(body []byte) (Quote, error) {
+	var doc struct {
+		Set   json.RawMessage `json:"set"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return Quote{}, err
+	}
+	if doc.Set == nil || doc.Value == nil {
+		return Quote{}, errors.New("set and value are required")
+	}
+	return ParseQuote(jsonText(doc.Set), jsonText(doc.Value))
+}
+
+func jsonText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// parseCSV reads the last row whose first two columns are the index and the
+// value, so a header row and earlier readings are skipped
+func parseCSV(body []byte) (Quote, error) {
+	r := csv.NewReader(bytes.NewReader(body))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return Quote{}, err
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if len(records[i]) < 2 {
+			continue
+		}
+		if q, err := ParseQuote(records[i][0], records[i][1]); err == nil {
+			return q, nil
+		}
+	}
+	return Quote{}, errors.New("no row with an index and a value")
+}
@@ -0,0 +1,123 @@
+package ingest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"thaimaster2d/live"
+	"time"
+)
+
+func TestAdapters(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/set.json":
+			w.Write([]byte(`{"set": 1284.21, "value": "18,520.04", "change": -2.1}`))
+		case "/set.csv":
+			w.Write([]byte("index,value\n1283.90,9874.12\n\"1,284.21\",\"18,520.04\"\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	for _, spec := range []string{"json:" + srv.URL + "/set.json", "csv:" + srv.URL + "/set.csv", "fixture:testdata/morning.json"} {
+		source, err := ParseSource(spec, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := source.Fetch(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", source.Name(), err)
+		}
+		if source.Name() == "fixture:morning.json" {
+			if q != (Quote{Set: "1,283.90", Value: "9,874.12"}) || q.Live() != "04" {
+				t.Errorf("%s: quote = %+v, live %s", source.Name(), q, q.Live())
+			}
+			continue
+		}
+		if q != (Quote{Set: "1,284.21", Value: "18,520.04"}) || q.Live() != "10" {
+			t.Errorf("%s: quote = %+v, live %s", source.Name(), q, q.Live())
+		}
+	}
+
+	if _, err := (&HTTPSource{Adapter: parseJSON, URL: srv.URL + "/missing"}).Fetch(context.Background()); err == nil {
+		t.Error("fetching a 404 succeeded")
+	}
+	for _, spec := range []string{"json", "xml:https://example.com", "json:/relative", "fixture:testdata/missing.json"} {
+		if _, err := ParseSource(spec, nil); err == nil {
+			t.Errorf("ParseSource(%q) succeeded", spec)
+		}
+	}
+}
+
+// at is a time on a Monday in UTC
+func at(clock string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04:05", "2025-10-20 "+clock)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestPoller(t *testing.T) {
+	live.Init(live.Config{
+		Location: time.UTC,
+		Sessions: []live.Session{{Start: 9*time.Hour + 30*time.Minute, End: 12*time.Hour + time.Minute, MaxGap: time.Minute}},
+	})
+	primary, err := LoadFixture("testdata/morning.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup := NewFixture("backup", Step{Quote: Quote{Set: "1284.10", Value: "16000.55"}})
+	p := New(Config{Sources: []Source{primary, backup}, Failback: time.Minute})
+	ctx := context.Background()
+
+	poll := func(clock string) live.LotteryData {
+		t.Helper()
+		if err := p.Poll(ctx, at(clock)); err != nil {
+			t.Fatalf("poll at %s: %v", clock, err)
+		}
+		return live.Current()
+	}
+
+	// Before the session nothing is fetched or published
+	if data := poll("09:00:00"); data.Live != "--" {
+		t.Errorf("live before the session = %q", data.Live)
+	}
+	if data := poll("11:58:00"); data.Live != "04" || data.Status != "On" || data.Date != "2025-10-20" || data.UpdateTime != "11:58:00 20/10/2025" {
+		t.Errorf("first poll published %+v", data)
+	}
+	poll("11:58:30")
+
+	// The primary times out, so the backup takes over until the failback
+	if data := poll("11:59:00"); data.Live != "00" {
+		t.Errorf("live after failover = %q, want the backup's 00", data.Live)
+	}
+	if p.current != 1 {
+		t.Errorf("source in use = %d, want the backup", p.current)
+	}
+	poll("11:59:30")
+	if p.current != 1 {
+		t.Error("returned to the primary before the failback interval")
+	}
+	if data := poll("12:00:00"); data.Live != "10" || p.current != 0 {
+		t.Errorf("live after failback = %q (source %d), want the primary's 10", data.Live, p.current)
+	}
+
+	// The last quote of the morning session is the 12:00 result
+	data := poll("12:01:15")
+	if data.Set1200 != "1,284.21" || data.Value1200 != "18,520.04" || data.Result1200 != "10" || data.Status != "Off" {
+		t.Errorf("12:00 result = %+v", data)
+	}
+	if data.Result430 != "---" {
+		t.Errorf("4:30 result = %q before the afternoon session", data.Result430)
+	}
+
+	// When every source fails the error says why
+	p = New(Config{Sources: []Source{NewFixture("down", Step{Error: "connection refused"})}})
+	if err := p.Poll(ctx, at("10:00:00")); err == nil || err.Error() != "down: connection refused" {
+		t.Errorf("error = %v", err)
+	}
+}
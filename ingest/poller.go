@@ -0,0 +1,177 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"thaimaster2d/live"
+	"thaimaster2d/metrics"
+	"time"
+)
+
+var (
+	fetches = metrics.NewCounter("ingest_fetches_total",
+		"Upstream fetches by source and result (ok or error)", "source", "result")
+	failovers = metrics.NewCounter("ingest_failovers_total",
+		"Times the poller moved to another upstream source")
+)
+
+// Config configures the poller
+type Config struct {
+	// Sources are tried in order, the first is preferred
+	Sources []Source
+	// Feeder is the name updates are submitted under
+	Feeder string
+	// Interval is the time between polls
+	Interval time.Duration
+	// Timeout bounds each fetch
+	Timeout time.Duration
+	// Failback is how long the poller stays on a fallback source before
+	// trying the preferred ones again
+	Failback time.Duration
+}
+
+// Poller fetches quotes during the live sessions and publishes them. The
+// last quote of the first session becomes the 12:00 result and that of the
+// second session the 4:30 result.
+type Poller struct {
+	cfg Config
+
+	current int       // index of the source in use
+	since   time.Time // when the poller moved to current
+	session int       // session of the last quote, -1 outside sessions
+	last    Quote
+}
+
+// New returns a poller for cfg
+func New(cfg Config) *Poller {
+	return &Poller{cfg: cfg, session: -1}
+}
+
+// Start polls every Interval until ctx is cancelled. The returned channel is
+// closed once it has stopped.
+func (p *Poller) Start(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(p.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := p.Poll(ctx, now); err != nil {
+					slog.Error("all upstream sources failed", "error", err)
+				}
+			}
+		}
+	}()
+	names := make([]string, len(p.cfg.Sources))
+	for i, source := range p.cfg.Sources {
+		names[i] = source.Name()
+	}
+	slog.Info("upstream poller started", "sources", names, "interval", p.cfg.Interval.String())
+	return done
+}
+
+// Poll fetches and publishes one quote if a session is in progress at now,
+// and publishes the result of a session that has just ended. Without
+// sessions it polls every time.
+func (p *Poller) Poll(ctx context.Context, now time.Time) error {
+	now = now.In(live.Location())
+	session, inSession := live.SessionAt(now)
+	if len(live.Sessions()) == 0 {
+		session, inSession = -1, true
+	}
+	if p.session >= 0 && (!inSession || session != p.session) {
+		p.publishResult(ctx, now)
+	}
+	if !inSession {
+		return nil
+	}
+
+	q, err := p.fetch(ctx, now)
+	if err != nil {
+		return err
+	}
+	p.session, p.last = session, q
+
+	data := today(now)
+	data.Live = q.Live()
+	data.Status = "On"
+	data.UpdateTime = now.Format("15:04:05 02/01/2006")
+	_, err = live.Submit(ctx, p.cfg.Feeder, &data)
+	return err
+}
+
+// publishResult records the last quote of the session that just ended
+func (p *Poller) publishResult(ctx context.Context, now time.Time) {
+	data := today(now)
+	switch p.session {
+	case 0:
+		data.Set1200, data.Value1200, data.Result1200 = p.last.Set, p.last.Value, p.last.Live()
+	case 1:
+		data.Set430, data.Value430, data.Result430 = p.last.Set, p.last.Value, p.last.Live()
+	}
+	data.Live = p.last.Live()
+	data.Status = "Off"
+	data.UpdateTime = now.Format("15:04:05 02/01/2006")
+	slog.InfoContext(ctx, "session closed", "session", p.session, "live", data.Live)
+	p.session = -1
+	if _, err := live.Submit(ctx, p.cfg.Feeder, &data); err != nil {
+		slog.ErrorContext(ctx, "failed to submit session result", "error", err)
+	}
+}
+
+// today returns the current data, or a blank day if it is from another day
+func today(now time.Time) live.LotteryData {
+	date := now.Format("2006-01-02")
+	data := live.Current()
+	if data.Date != date {
+		data = live.Placeholder()
+		data.Date = date
+	}
+	return data
+}
+
+// fetch tries the sources in order starting from the one in use and
+// switches to the first that answers
+func (p *Poller) fetch(ctx context.Context, now time.Time) (Quote, error) {
+	if p.current != 0 && now.Sub(p.since) >= p.cfg.Failback {
+		slog.InfoContext(ctx, "retrying preferred upstream source", "source", p.cfg.Sources[0].Name())
+		p.current, p.since = 0, now
+	}
+
+	var errs []error
+	for k := range p.cfg.Sources {
+		i := (p.current + k) % len(p.cfg.Sources)
+		source := p.cfg.Sources[i]
+		q, err := p.fetchFrom(ctx, source)
+		if err != nil {
+			fetches.Inc(source.Name(), "error")
+			slog.WarnContext(ctx, "upstream fetch failed", "source", source.Name(), "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+			continue
+		}
+		fetches.Inc(source.Name(), "ok")
+		if i != p.current {
+			failovers.Inc()
+			slog.WarnContext(ctx, "switched upstream source",
+				"from", p.cfg.Sources[p.current].Name(), "to", source.Name())
+			p.current, p.since = i, now
+		}
+		return q, nil
+	}
+	return Quote{}, errors.Join(errs...)
+}
+
+func (p *Poller) fetchFrom(ctx context.Context, source Source) (Quote, error) {
+	if p.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.cfg.Timeout)
+		defer cancel()
+	}
+	return source.Fetch(ctx)
+}
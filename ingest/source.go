@@ -0,0 +1,141 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Source fetches the latest quote from one upstream
+type Source interface {
+	// Name identifies the source in logs and metrics
+	Name() string
+	Fetch(ctx context.Context) (Quote, error)
+}
+
+// ParseSource builds a source from an "adapter:URL" spec, e.g.
+// "json:https://example.com/set.json", or "fixture:path/to/file.json" for a
+// recorded fixture
+func ParseSource(spec string, client *http.Client) (Source, error) {
+	kind, target, ok := strings.Cut(spec, ":")
+	if !ok || target == "" {
+		return nil, fmt.Errorf("invalid source %q, use adapter:URL", spec)
+	}
+	if kind == "fixture" {
+		return LoadFixture(target)
+	}
+	adapter, ok := adapters[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown adapter %q in source %q", kind, spec)
+	}
+	if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("source %q needs an http(s) URL", spec)
+	}
+	return &HTTPSource{Adapter: adapter, AdapterName: kind, URL: target, Client: client}, nil
+}
+
+// HTTPSource GETs a URL and parses the response with an adapter
+type HTTPSource struct {
+	Adapter     Adapter
+	AdapterName string
+	URL         string
+	Client      *http.Client
+}
+
+// Name implements Source
+func (s *HTTPSource) Name() string {
+	if u, err := url.Parse(s.URL); err == nil {
+		return s.AdapterName + ":" + u.Host
+	}
+	return s.AdapterName
+}
+
+// Fetch implements Source
+func (s *HTTPSource) Fetch(ctx context.Context) (Quote, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return Quote{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Quote{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Quote{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Quote{}, err
+	}
+	return s.Adapter(body)
+}
+
+// Step is one fixture response: a quote, or the error the upstream failed
+// with
+type Step struct {
+	Quote
+	Error string `json:"error,omitempty"`
+}
+
+// Fixture replays recorded responses, one per fetch, and keeps repeating
+// the last one. It stands in for an upstream in tests and development.
+type Fixture struct {
+	name  string
+	steps []Step
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewFixture returns a fixture replaying steps
+func NewFixture(name string, steps ...Step) *Fixture {
+	return &Fixture{name: name, steps: steps}
+}
+
+// LoadFixture reads a JSON array of steps, such as
+// [{"set": "1,284.21", "value": "18,520.04"}, {"error": "timeout"}]
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	var steps []Step
+	if err := json.Unmarshal(data, &steps); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("fixture %s has no steps", path)
+	}
+	return NewFixture("fixture:"+filepath.Base(path), steps...), nil
+}
+
+// Name implements Source
+func (f *Fixture) Name() string { return f.name }
+
+// Fetch implements Source
+func (f *Fixture) Fetch(ctx context.Context) (Quote, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.steps) == 0 {
+		return Quote{}, errors.New("empty fixture")
+	}
+	step := f.steps[min(f.next, len(f.steps)-1)]
+	f.next++
+	if step.Error != "" {
+		return Quote{}, errors.New(step.Error)
+	}
+	return ParseQuote(step.Set, step.Value)
+}
@@ -0,0 +1,442 @@
+package live
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"thaimaster2d/alert"
+	"thaimaster2d/metrics"
+	"time"
+)
+
+const (
+	// FeederHeader names the feeder posting an update
+	FeederHeader = "X-Feeder"
+	// FeederSecretHeader carries the posting feeder's secret
+	FeederSecretHeader = "X-Feeder-Secret"
+)
+
+// Draw names
+const (
+	DrawNoon    = "12:00"
+	DrawEvening = "4:30"
+)
+
+// Ways a draw result is finalized
+const (
+	FinalConsensus = "consensus"
+	FinalTimeout   = "timeout"
+	FinalAdmin     = "admin"
+)
+
+var (
+	// ErrUnknownFeeder is returned for updates from a feeder not in
+	// Config.Feeders
+	ErrUnknownFeeder = errors.New("unknown feeder")
+	// ErrFeederSecret is returned for updates without the feeder's secret
+	ErrFeederSecret = errors.New("wrong feeder secret")
+	// ErrNoProposal is returned when resolving a draw with a feeder that has
+	// not reported a result for it
+	ErrNoProposal = errors.New("no result from that feeder")
+)
+
+// Proposal is one feeder's result for a draw
+type Proposal struct {
+	Feeder string
+	Set    string
+	Value  string
+	Result string
+	Time   time.Time
+}
+
+func (p Proposal) agrees(o Proposal) bool {
+	return p.Set == o.Set && p.Value == o.Value && p.Result == o.Result
+}
+
+// DrawState tracks the feeders' results for one of the day's draws
+type DrawState struct {
+	Name      string
+	Date      string
+	Proposals []Proposal
+	// Final is the published result, nil until the draw is finalized
+	Final       *Proposal
+	FinalizedBy string
+	// Conflict is set when the feeders still disagreed at the result timeout
+	Conflict bool
+	first    time.Time
+}
+
+// FeederStatus reports one configured feeder
+type FeederStatus struct {
+	Name string
+	// Priority is 1 for the preferred feeder
+	Priority   int
+	Active     bool
+	Healthy    bool
+	LastUpdate time.Time
+	Updates    int
+}
+
+// Consensus is the state of the configured feeders and today's draws
+type Consensus struct {
+	Feeders []FeederStatus
+	Draws   []DrawState
+}
+
+type feederState struct {
+	name    string
+	last    time.Time
+	updates int
+}
+
+var (
+	consensusMutex sync.Mutex
+	feeders        []*feederState
+	activeFeeder   = -1
+	drawDate       string
+	draws          [2]*DrawState
+
+	feederSubmissions = metrics.NewCounter("lottery_feeder_submissions_total",
+		"Updates posted by named feeders, by result (published, standby or rejected)", "feeder", "result")
+	feederFailovers = metrics.NewCounter("lottery_feeder_failovers_total",
+		"Times another feeder became the active one")
+)
+
+func resetConsensus() {
+	consensusMutex.Lock()
+	defer consensusMutex.Unlock()
+	feeders = nil
+	for _, name := range cfg.Feeders {
+		feeders = append(feeders, &feederState{name: name})
+	}
+	activeFeeder = -1
+	drawDate = ""
+	draws = [2]*DrawState{}
+}
+
+// drawFields returns the set, value and result fields of each draw
+func drawFields(data *LotteryData) [2][3]*string {
+	return [2][3]*string{
+		{&data.Set1200, &data.Value1200, &data.Result1200},
+		{&data.Set430, &data.Value430, &data.Result430},
+	}
+}
+
+// isPlaceholder reports whether a field holds the "not yet known" dashes
+func isPlaceholder(s string) bool {
+	return s == "" || s == "--" || s == "---"
+}
+
+// Authenticate checks the secret a feeder posting over HTTP sent. Any
+// update is accepted when no feeders are configured.
+func Authenticate(name, secret string) error {
+	if len(cfg.Feeders) == 0 {
+		return nil
+	}
+	if !slices.Contains(cfg.Feeders, name) {
+		feederSubmissions.Inc("unknown", "rejected")
+		return fmt.Errorf("%w %q", ErrUnknownFeeder, name)
+	}
+	want, ok := cfg.FeederSecrets[name]
+	if !ok || subtle.ConstantTimeCompare([]byte(secret), []byte(want)) != 1 {
+		feederSubmissions.Inc(name, "rejected")
+		return fmt.Errorf("%w for %q", ErrFeederSecret, name)
+	}
+	return nil
+}
+
+// Submit handles an update from a named feeder. With no feeders configured
+// every update is published. Otherwise only the highest-priority healthy
+// feeder's updates are published, the others are recorded as standby, and
+// draw results are replaced by the agreed ones. It reports whether the
+// update was published.
+func Submit(ctx context.Context, name string, data *LotteryData) (bool, error) {
+	if len(cfg.Feeders) == 0 {
+		Publish(ctx, data)
+		return true, nil
+	}
+
+	now := time.Now()
+	consensusMutex.Lock()
+	var feeder *feederState
+	for _, f := range feeders {
+		if f.name == name {
+			feeder = f
+		}
+	}
+	if feeder == nil {
+		consensusMutex.Unlock()
+		feederSubmissions.Inc("unknown", "rejected")
+		return false, fmt.Errorf("%w %q", ErrUnknownFeeder, name)
+	}
+	feeder.last = now
+	feeder.updates++
+
+	if data.Date != "" {
+		if data.Date != drawDate {
+			drawDate = data.Date
+			draws = [2]*DrawState{
+				{Name: DrawNoon, Date: data.Date},
+				{Name: DrawEvening, Date: data.Date},
+			}
+		}
+		for i, fields := range drawFields(data) {
+			if !isPlaceholder(*fields[2]) {
+				propose(draws[i], Proposal{Feeder: name, Set: *fields[0], Value: *fields[1], Result: *fields[2], Time: now})
+			}
+		}
+	}
+	finalized, corrected := evaluateDraws(now)
+	date := drawDate
+	active := electFeeder(ctx, now)
+	published := active == feeder
+	if published {
+		applyFinals(data)
+	}
+	consensusMutex.Unlock()
+
+	if !published {
+		feederSubmissions.Inc(name, "standby")
+		slog.DebugContext(ctx, "standby feeder update recorded", "feeder", name, "active", active.name)
+		if finalized || corrected {
+			data := refreshFinals(ctx)
+			checkAndInsertHistory(ctx, &data)
+			if corrected {
+				correctHistory(ctx, &data, date)
+			}
+		}
+		return false, nil
+	}
+	feederSubmissions.Inc(name, "published")
+	Publish(ctx, data)
+	if corrected {
+		correctHistory(ctx, data, date)
+	}
+	return true, nil
+}
+
+// propose records a feeder's result, replacing its earlier one
+func propose(d *DrawState, p Proposal) {
+	if d.first.IsZero() {
+		d.first = p.Time
+	}
+	for i := range d.Proposals {
+		if d.Proposals[i].Feeder == p.Feeder {
+			d.Proposals[i] = p
+			return
+		}
+	}
+	d.Proposals = append(d.Proposals, p)
+}
+
+// evaluateDraws finalizes draws the feeders agree on. A draw is final once
+// two feeders (or the only one) report the same result, or at the result
+// timeout if those that reported agree. A final result is corrected when
+// the feeders later agree on another one, unless an admin picked it. It
+// reports whether any draw was finalized or corrected.
+func evaluateDraws(now time.Time) (finalized, corrected bool) {
+	for _, d := range draws {
+		if d == nil || len(d.Proposals) == 0 {
+			continue
+		}
+		first := d.Proposals[0]
+		agree := true
+		for _, p := range d.Proposals[1:] {
+			agree = agree && p.agrees(first)
+		}
+		quorum := agree && len(d.Proposals) >= min(2, len(feeders))
+		if d.Final != nil {
+			if quorum && d.FinalizedBy != FinalAdmin && !first.agrees(*d.Final) {
+				slog.Warn("draw result corrected", "draw", d.Name, "date", d.Date, "from", d.Final.Result, "to", first.Result)
+				finalize(d, first, FinalConsensus)
+				corrected = true
+			}
+			continue
+		}
+		switch {
+		case quorum:
+			finalize(d, first, FinalConsensus)
+			finalized = true
+		case now.Sub(d.first) < cfg.ResultTimeout:
+			// Wait for the other feeders
+		case agree:
+			finalize(d, first, FinalTimeout)
+			finalized = true
+		case !d.Conflict:
+			d.Conflict = true
+			slog.Warn("feeders disagree on the draw result", "draw", d.Name, "date", d.Date, "proposals", len(d.Proposals))
+			alert.Notify(currentAlertSink(), alert.Alert{
+				Kind:    alert.KindResultConflict,
+				Title:   "Feeders disagree on the " + d.Name + " result",
+				Message: fmt.Sprintf("%d feeders reported different %s results for %s. Pick the correct one on /admin/feeders.", len(d.Proposals), d.Name, d.Date),
+				Time:    now,
+			})
+		}
+	}
+	return finalized, corrected
+}
+
+func finalize(d *DrawState, p Proposal, by string) {
+	d.Final = &p
+	d.FinalizedBy = by
+	d.Conflict = false
+	slog.Info("draw result finalized", "draw", d.Name, "date", d.Date, "result", p.Result, "feeder", p.Feeder, "by", by)
+}
+
+// electFeeder makes the highest-priority healthy feeder the active one
+func electFeeder(ctx context.Context, now time.Time) *feederState {
+	elected := -1
+	for i, f := range feeders {
+		if !f.last.IsZero() && now.Sub(f.last) <= cfg.FeederTimeout {
+			elected = i
+			break
+		}
+	}
+	if elected != activeFeeder && elected >= 0 {
+		if activeFeeder >= 0 {
+			feederFailovers.Inc()
+			slog.WarnContext(ctx, "switched active feeder", "from", feeders[activeFeeder].name, "to", feeders[elected].name)
+		} else {
+			slog.InfoContext(ctx, "feeder active", "feeder", feeders[elected].name)
+		}
+		activeFeeder = elected
+	}
+	if activeFeeder < 0 {
+		return nil
+	}
+	return feeders[activeFeeder]
+}
+
+// applyFinals replaces the draw fields of data with the finalized results,
+// or placeholders for draws not final yet
+func applyFinals(data *LotteryData) {
+	for i, fields := range drawFields(data) {
+		d := draws[i]
+		if d != nil && d.Final != nil {
+			*fields[0], *fields[1], *fields[2] = d.Final.Set, d.Final.Value, d.Final.Result
+		} else {
+			*fields[0], *fields[1], *fields[2] = "--", "--", "---"
+		}
+	}
+}
+
+// refreshFinals puts newly finalized results into the current data, sends
+// it to SSE clients and returns it
+func refreshFinals(ctx context.Context) LotteryData {
+	consensusMutex.Lock()
+	dataMutex.Lock()
+	applyFinals(currentData)
+	data := *currentData
+	dataMutex.Unlock()
+	consensusMutex.Unlock()
+
+	broadcastUpdate()
+	announceResults(ctx, &data)
+	return data
+}
+
+// checkResults applies the result timeout when no feeder is posting
+func checkResults(now time.Time) {
+	if len(cfg.Feeders) == 0 {
+		return
+	}
+	consensusMutex.Lock()
+	finalized, corrected := evaluateDraws(now)
+	date := drawDate
+	consensusMutex.Unlock()
+	if finalized || corrected {
+		ctx := context.Background()
+		data := refreshFinals(ctx)
+		checkAndInsertHistory(ctx, &data)
+		if corrected {
+			correctHistory(ctx, &data, date)
+		}
+	}
+}
+
+// correctHistory updates the saved history of date with the corrected
+// results in data
+func correctHistory(ctx context.Context, data *LotteryData, date string) {
+	if historyCorrector == nil {
+		return
+	}
+	if data.Date != date {
+		slog.WarnContext(ctx, "corrected result not saved to history", "date", date, "current_date", data.Date)
+		return
+	}
+	pendingWrites.Add(1)
+	defer pendingWrites.Done()
+	if err := historyCorrector(ctx, data); err != nil {
+		slog.ErrorContext(ctx, "failed to correct history", "date", date, "error", err)
+	}
+}
+
+// ResolveDraw finalizes a draw with the result one feeder reported, for an
+// admin settling a conflict. The history is updated right away once the
+// 4:30 result is final, even outside the insert window.
+func ResolveDraw(ctx context.Context, drawName, feeder string) error {
+	consensusMutex.Lock()
+	var draw *DrawState
+	for _, d := range draws {
+		if d != nil && d.Name == drawName {
+			draw = d
+		}
+	}
+	var proposal *Proposal
+	if draw != nil {
+		for i := range draw.Proposals {
+			if draw.Proposals[i].Feeder == feeder {
+				proposal = &draw.Proposals[i]
+			}
+		}
+	}
+	if proposal == nil {
+		consensusMutex.Unlock()
+		return fmt.Errorf("%w: %s for the %s draw", ErrNoProposal, feeder, drawName)
+	}
+	finalize(draw, *proposal, FinalAdmin)
+	date, evening := draw.Date, draws[1].Final != nil
+	consensusMutex.Unlock()
+
+	data := refreshFinals(ctx)
+	if !evening {
+		return nil
+	}
+	if data.Date != date {
+		return fmt.Errorf("result resolved but not saved to history: the current data is for %q, not %s", data.Date, date)
+	}
+	if err := insertHistory(ctx, &data); err != nil {
+		return fmt.Errorf("result resolved but not saved to history: %w", err)
+	}
+	return nil
+}
+
+// FeederConsensus returns the state of the feeders and today's draws
+func FeederConsensus() Consensus {
+	consensusMutex.Lock()
+	defer consensusMutex.Unlock()
+	now := time.Now()
+	var c Consensus
+	for i, f := range feeders {
+		c.Feeders = append(c.Feeders, FeederStatus{
+			Name:       f.name,
+			Priority:   i + 1,
+			Active:     i == activeFeeder,
+			Healthy:    !f.last.IsZero() && now.Sub(f.last) <= cfg.FeederTimeout,
+			LastUpdate: f.last,
+			Updates:    f.updates,
+		})
+	}
+	for _, d := range draws {
+		if d != nil {
+			state := *d
+			state.Proposals = append([]Proposal(nil), d.Proposals...)
+			c.Draws = append(c.Draws, state)
+		}
+	}
+	return c
+}
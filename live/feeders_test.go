@@ -0,0 +1,184 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// initFeeders resets the live state with the named feeders and a history
+// insert window spanning the whole day
+func initFeeders(t *testing.T, names ...string) {
+	t.Helper()
+	Init(Config{
+		Location:        time.UTC,
+		InsertWindowEnd: 24 * time.Hour,
+		Feeders:         names,
+		FeederTimeout:   time.Minute,
+		ResultTimeout:   time.Hour,
+	})
+	lastCheckTime = time.Time{}
+	t.Cleanup(func() { SetHistoryInserter(nil) })
+}
+
+// update returns feeder data for date with the 4:30 result set
+func update(date, result430 string) *LotteryData {
+	data := Placeholder()
+	data.Date = date
+	if result430 != "" {
+		data.Set430, data.Value430, data.Result430 = "1,234.56", "12,345.67", result430
+	}
+	return &data
+}
+
+func TestResolveDrawWritesHistoryOnce(t *testing.T) {
+	initFeeders(t, "primary", "backup")
+	var saved []LotteryData
+	SetHistoryInserter(func(ctx context.Context, data *LotteryData) error {
+		saved = append(saved, *data)
+		return nil
+	})
+	ctx := context.Background()
+
+	Submit(ctx, "primary", update("2026-03-02", "67"))
+	Submit(ctx, "backup", update("2026-03-02", "68"))
+	if len(saved) != 0 {
+		t.Fatalf("history written before the draw was final: %v", saved)
+	}
+	if err := ResolveDraw(ctx, DrawEvening, "backup"); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].Date != "2026-03-02" || saved[0].Result430 != "68" {
+		t.Errorf("history writes = %+v, want one with the backup's result", saved)
+	}
+
+	// The current data must be for the resolved draw's date
+	saved = nil
+	currentData.Date = "2026-03-01"
+	if err := ResolveDraw(ctx, DrawEvening, "primary"); err == nil || len(saved) != 0 {
+		t.Errorf("ResolveDraw for another day = %v, wrote %v", err, saved)
+	}
+}
+
+func TestFeedersCorrectFinalResult(t *testing.T) {
+	initFeeders(t, "primary", "backup")
+	var inserted, corrected []string
+	SetHistoryInserter(func(ctx context.Context, data *LotteryData) error {
+		inserted = append(inserted, data.Result430)
+		return nil
+	})
+	SetHistoryCorrector(func(ctx context.Context, data *LotteryData) error {
+		corrected = append(corrected, data.Date+" "+data.Result430)
+		return nil
+	})
+	t.Cleanup(func() { SetHistoryCorrector(nil) })
+	ctx := context.Background()
+
+	Submit(ctx, "primary", update("2026-03-02", "67"))
+	Submit(ctx, "backup", update("2026-03-02", "67"))
+	if got := Current().Result430; got != "67" || len(inserted) != 1 {
+		t.Fatalf("result = %q, history writes %v; want 67 saved", got, inserted)
+	}
+
+	// One feeder changing its mind is not enough
+	Submit(ctx, "primary", update("2026-03-02", "76"))
+	if got := Current().Result430; got != "67" || len(corrected) != 0 {
+		t.Errorf("result after one feeder changed = %q, corrections %v", got, corrected)
+	}
+	Submit(ctx, "backup", update("2026-03-02", "76"))
+	if got := Current().Result430; got != "76" {
+		t.Errorf("result after both feeders changed = %q, want 76", got)
+	}
+	if len(corrected) != 1 || corrected[0] != "2026-03-02 76" {
+		t.Errorf("history corrections = %v", corrected)
+	}
+
+	// A result an admin picked stands
+	Submit(ctx, "primary", update("2026-03-02", "11"))
+	if err := ResolveDraw(ctx, DrawEvening, "primary"); err != nil {
+		t.Fatal(err)
+	}
+	Submit(ctx, "backup", update("2026-03-02", "11"))
+	Submit(ctx, "primary", update("2026-03-02", "22"))
+	Submit(ctx, "backup", update("2026-03-02", "22"))
+	if got := Current().Result430; got != "11" || len(corrected) != 1 {
+		t.Errorf("result after overriding an admin = %q, corrections %v", got, corrected)
+	}
+}
+
+func TestFeederConsensusAndFailover(t *testing.T) {
+	initFeeders(t, "primary", "backup")
+	ctx := context.Background()
+
+	// The preferred feeder is published and a result needs both feeders
+	if published, err := Submit(ctx, "primary", update("2026-03-02", "67")); !published || err != nil {
+		t.Fatalf("primary update = %v, %v; want published", published, err)
+	}
+	if got := Current().Result430; got != "---" {
+		t.Errorf("result = %q before the backup agreed", got)
+	}
+	if published, err := Submit(ctx, "backup", update("2026-03-02", "67")); published || err != nil {
+		t.Fatalf("backup update = %v, %v; want standby", published, err)
+	}
+	if got := Current().Result430; got != "67" {
+		t.Errorf("result = %q after both agreed, want 67", got)
+	}
+	if d := FeederConsensus().Draws[1]; d.Final == nil || d.FinalizedBy != FinalConsensus {
+		t.Errorf("4:30 draw = %+v, want final by consensus", d)
+	}
+
+	// Disagreement is only a conflict once the result timeout passes
+	Submit(ctx, "primary", update("2026-03-03", "11"))
+	Submit(ctx, "backup", update("2026-03-03", "12"))
+	if d := FeederConsensus().Draws[1]; d.Final != nil || d.Conflict {
+		t.Errorf("4:30 draw = %+v within the result timeout", d)
+	}
+	checkResults(time.Now().Add(2 * time.Hour))
+	if d := FeederConsensus().Draws[1]; d.Final != nil || !d.Conflict {
+		t.Errorf("4:30 draw = %+v after the result timeout, want a conflict", d)
+	}
+	if got := Current().Result430; got != "---" {
+		t.Errorf("result = %q while the feeders disagree", got)
+	}
+
+	// The backup takes over once the primary is quiet for FeederTimeout
+	consensusMutex.Lock()
+	feeders[0].last = time.Now().Add(-2 * time.Minute)
+	consensusMutex.Unlock()
+	if published, _ := Submit(ctx, "backup", update("2026-03-03", "")); !published {
+		t.Error("backup update not published while the primary is down")
+	}
+	if published, _ := Submit(ctx, "primary", update("2026-03-03", "")); !published {
+		t.Error("primary update not published after it came back")
+	}
+	if _, err := Submit(ctx, "intruder", update("2026-03-03", "")); !errors.Is(err, ErrUnknownFeeder) {
+		t.Errorf("unknown feeder = %v, want ErrUnknownFeeder", err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	initFeeders(t, "primary", "ingest")
+	cfg.FeederSecrets = map[string]string{"primary": "s3cret"}
+	for _, tc := range []struct {
+		name, secret string
+		want         error
+	}{
+		{"primary", "s3cret", nil},
+		{"primary", "wrong", ErrFeederSecret},
+		{"primary", "", ErrFeederSecret},
+		// A feeder without a secret can't post over HTTP
+		{"ingest", "", ErrFeederSecret},
+		{"intruder", "s3cret", ErrUnknownFeeder},
+	} {
+		if err := Authenticate(tc.name, tc.secret); !errors.Is(err, tc.want) {
+			t.Errorf("Authenticate(%q, %q) = %v, want %v", tc.name, tc.secret, err, tc.want)
+		}
+	}
+
+	// Without feeders any update is accepted
+	initFeeders(t)
+	if err := Authenticate("", ""); err != nil {
+		t.Errorf("Authenticate without feeders = %v", err)
+	}
+}
@@ -1,11 +1,13 @@
 package live
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"sync"
+	"thaimaster2d/events"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -28,30 +30,106 @@ type LotteryData struct {
 	Internet200 string `json:"200internet"`
 	UpdateTime  string `json:"updatetime"`
 	ViewCount   int    `json:"viewCount"`
+	// Stale is set by the watchdog when the feeder misses its cadence
+	Stale bool `json:"stale,omitempty"`
 }
 
-// HistoryInserter is a callback function type for inserting history
-type HistoryInserter func(data *LotteryData) error
+// Config holds the live feed settings
+type Config struct {
+	// Location is the timezone of the lottery schedule
+	Location *time.Location
+	// InsertWindowStart and InsertWindowEnd bound the daily history insert
+	// window as offsets from midnight in Location
+	InsertWindowStart time.Duration
+	InsertWindowEnd   time.Duration
+	// SSERetry is the reconnect delay suggested to SSE clients on shutdown
+	SSERetry time.Duration
+	// Sessions are the market hours during which the feeder must post
+	// updates. The watchdog is idle outside them.
+	Sessions []Session
+	// MarketDays are the weekdays with sessions, every day if empty
+	MarketDays []time.Weekday
+	// Feeders are the names of the feeders allowed to post, in order of
+	// priority. If empty, any update is published.
+	Feeders []string
+	// FeederSecrets are the secrets feeders send in X-Feeder-Secret to post
+	// over HTTP. A feeder without one can only post through Submit, as the
+	// built-in poller does.
+	FeederSecrets map[string]string
+	// FeederTimeout is how long a feeder may be silent and stay healthy
+	FeederTimeout time.Duration
+	// ResultTimeout is how long to wait for the feeders to agree on a draw
+	// result before settling for the one reported or asking an admin
+	ResultTimeout time.Duration
+}
+
+// HistoryInserter is a callback function type for inserting history. ctx
+// carries the request ID of the update that triggered the insert.
+type HistoryInserter func(ctx context.Context, data *LotteryData) error
+
+// HistoryCorrector updates the saved history of data.Date, if there is one,
+// after the feeders agree on a corrected draw result
+type HistoryCorrector func(ctx context.Context, data *LotteryData) error
 
 // Global state
 var (
-	currentData     *LotteryData
-	dataMutex       sync.RWMutex
-	clients         = make(map[chan string]bool)
-	clientsMutex    sync.RWMutex
-	historyInserter HistoryInserter
-	lastCheckTime   time.Time
+	currentData      *LotteryData
+	dataMutex        sync.RWMutex
+	clients          = make(map[chan string]bool)
+	clientsMutex     sync.RWMutex
+	historyInserter  HistoryInserter
+	historyCorrector HistoryCorrector
+	lastCheckTime    time.Time
+	cfg              Config
+	pendingWrites    sync.WaitGroup
+	shutdownCh       = make(chan struct{})
+	shutdownOnce     sync.Once
+
+	// announced is the date and result last announced for each draw
+	announced      [2]string
+	announcedMutex sync.Mutex
 )
 
+// ResultEvent is the payload of the result events
+type ResultEvent struct {
+	Date   string `json:"date"`
+	Draw   string `json:"draw"`
+	Set    string `json:"set"`
+	Value  string `json:"value"`
+	Result string `json:"result"`
+}
+
 // SetHistoryInserter sets the callback function for history insertion
 func SetHistoryInserter(inserter HistoryInserter) {
 	historyInserter = inserter
-	log.Println("✅ History inserter callback registered")
+	slog.Debug("history inserter registered")
+}
+
+// SetHistoryCorrector sets the callback for correcting saved history
+func SetHistoryCorrector(corrector HistoryCorrector) {
+	historyCorrector = corrector
 }
 
 // Init initializes the live package with default data
-func Init() {
-	currentData = &LotteryData{
+func Init(config Config) {
+	if config.Location == nil {
+		config.Location = time.Local
+	}
+	cfg = config
+	data := Placeholder()
+	currentData = &data
+	lastUpdate.Store(time.Now().UnixNano())
+	resetFeedState()
+	resetConsensus()
+	announcedMutex.Lock()
+	announced = [2]string{}
+	announcedMutex.Unlock()
+	slog.Info("live feed initialized with default data")
+}
+
+// Placeholder returns the data shown before the day's first update
+func Placeholder() LotteryData {
+	return LotteryData{
 		Live:        "--",
 		Status:      "Off",
 		Set1200:     "--",
@@ -66,7 +144,6 @@ func Init() {
 		Internet200: "---",
 		UpdateTime:  time.Now().Format("15:04:05 02/01/2006"),
 	}
-	log.Println("✅ Live package initialized with default data")
 }
 
 // UpdateLotteryData handles POST requests to update lottery data
@@ -85,48 +162,126 @@ func UpdateLotteryData(c *gin.Context) {
 		return
 	}
 
-	// Update current data
+	name := c.GetHeader(FeederHeader)
+	if err := Authenticate(name, c.GetHeader(FeederSecretHeader)); err != nil {
+		c.JSON(403, gin.H{"error": "Unknown feeder", "details": err.Error()})
+		return
+	}
+	published, err := Submit(c.Request.Context(), name, &newData)
+	if err != nil {
+		c.JSON(403, gin.H{"error": "Unknown feeder", "details": err.Error()})
+		return
+	}
+	if !published {
+		c.JSON(200, gin.H{
+			"status":  "success",
+			"message": "Update recorded, another feeder is active",
+			"data":    newData,
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":  "success",
+		"message": "Lottery data updated successfully",
+		"data":    newData,
+	})
+}
+
+// Publish replaces the current data, records it in the history during the
+// insert window and broadcasts it to every SSE client
+func Publish(ctx context.Context, data *LotteryData) {
+	data.Stale = false
 	dataMutex.Lock()
-	currentData = &newData
+	currentData = data
 	dataMutex.Unlock()
+	recordUpdate()
+	feedRecovered(ctx)
 
-	log.Printf("📊 Lottery data updated - Live: %s, Status: %s", newData.Live, newData.Status)
+	slog.InfoContext(ctx, "lottery data updated", "live", data.Live, "status", data.Status)
 
-	// Check if we should insert to history database (16:30-16:35 GMT+6:30)
-	checkAndInsertHistory(&newData)
+	// Check if we should insert to history database (within the insert window)
+	checkAndInsertHistory(ctx, data)
 
 	// Broadcast to all SSE clients
 	broadcastUpdate()
+	announceResults(ctx, data)
+}
 
-	c.JSON(200, gin.H{
-		"status":  "success",
-		"message": "Lottery data updated successfully",
-		"data":    newData,
-	})
+// announceResults publishes a result event the first time each draw result
+// of the day is published, and again whenever it is corrected
+func announceResults(ctx context.Context, data *LotteryData) {
+	if data.Date == "" {
+		return
+	}
+	var due []ResultEvent
+	announcedMutex.Lock()
+	for i, fields := range drawFields(data) {
+		if isPlaceholder(*fields[2]) {
+			continue
+		}
+		key := data.Date + "|" + *fields[0] + "|" + *fields[1] + "|" + *fields[2]
+		if announced[i] == key {
+			continue
+		}
+		announced[i] = key
+		due = append(due, ResultEvent{
+			Date:   data.Date,
+			Draw:   []string{DrawNoon, DrawEvening}[i],
+			Set:    *fields[0],
+			Value:  *fields[1],
+			Result: *fields[2],
+		})
+	}
+	announcedMutex.Unlock()
+
+	for _, e := range due {
+		typ := events.ResultNoon
+		if e.Draw == DrawEvening {
+			typ = events.ResultEvening
+		}
+		slog.InfoContext(ctx, "draw result published", "draw", e.Draw, "date", e.Date, "result", e.Result)
+		events.Publish(ctx, typ, e)
+	}
+}
+
+// Current returns a copy of the current data
+func Current() LotteryData {
+	dataMutex.RLock()
+	defer dataMutex.RUnlock()
+	return *currentData
+}
+
+// Location returns the timezone of the lottery schedule
+func Location() *time.Location {
+	return cfg.Location
 }
 
-// checkAndInsertHistory checks if current time is 16:30-16:35 GMT+6:30 and inserts to database
-func checkAndInsertHistory(data *LotteryData) {
+// InsertWindow returns the configured history insert window as HH:MM strings
+func InsertWindow() (string, string) {
+	return formatClock(cfg.InsertWindowStart), formatClock(cfg.InsertWindowEnd)
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// checkAndInsertHistory checks if current time is within the insert window and inserts to database
+func checkAndInsertHistory(ctx context.Context, data *LotteryData) {
 	if historyInserter == nil {
 		return // No history inserter registered
 	}
 
-	// Get Myanmar time (GMT+6:30)
-	loc, err := time.LoadLocation("Asia/Yangon")
-	if err != nil {
-		log.Printf("❌ Error loading timezone: %v", err)
-		return
-	}
-
-	now := time.Now().In(loc)
+	now := time.Now().In(cfg.Location)
 	hour := now.Hour()
 	minute := now.Minute()
+	sinceMidnight := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
 
-	// Check if time is between 16:30 and 16:35
-	if hour == 16 && minute >= 30 && minute < 35 {
+	// Check if time is within the insert window
+	if sinceMidnight >= cfg.InsertWindowStart && sinceMidnight < cfg.InsertWindowEnd {
 		// Check if 430 result has real data (not "--")
-		if data.Result430 == "--" || data.Result430 == "" {
-			log.Printf("⏭️  Skipping insert - 430 result is not ready yet: %s", data.Result430)
+		if isPlaceholder(data.Result430) {
+			slog.DebugContext(ctx, "skipping history insert, 430 result not ready", "result_430", data.Result430)
 			return
 		}
 
@@ -136,23 +291,30 @@ func checkAndInsertHistory(data *LotteryData) {
 		}
 		lastCheckTime = now
 
-		log.Printf("⏰ Time check: %02d:%02d - Within insert window (16:30-16:35)", hour, minute)
-		log.Printf("📊 430 result is ready: %s - Attempting to insert history for date: %s", data.Result430, data.Date)
+		start, end := InsertWindow()
+		slog.InfoContext(ctx, "inserting history within insert window",
+			"date", data.Date, "result_430", data.Result430, "window_start", start, "window_end", end)
 
-		// Call the history inserter callback
-		if err := historyInserter(data); err != nil {
-			log.Printf("❌ Error inserting history: %v", err)
-		} else {
-			log.Printf("✅ History checked/inserted for date: %s", data.Date)
+		if err := insertHistory(ctx, data); err != nil {
+			slog.ErrorContext(ctx, "failed to insert history", "date", data.Date, "error", err)
 		}
 	}
 }
 
+// insertHistory calls the history inserter, if any, as a write FlushWrites
+// waits for
+func insertHistory(ctx context.Context, data *LotteryData) error {
+	if historyInserter == nil {
+		return nil
+	}
+	pendingWrites.Add(1)
+	defer pendingWrites.Done()
+	return historyInserter(ctx, data)
+}
+
 // GetCurrentData returns the current lottery data
 func GetCurrentData(c *gin.Context) {
-	dataMutex.RLock()
-	data := currentData
-	dataMutex.RUnlock()
+	data := Current()
 
 	c.JSON(200, gin.H{
 		"status": "success",
@@ -162,11 +324,19 @@ func GetCurrentData(c *gin.Context) {
 
 // StreamLotteryData handles SSE streaming for real-time updates
 func StreamLotteryData(c *gin.Context) {
+	// Refuse new streams once shutdown has begun
+	select {
+	case <-shutdownCh:
+		c.Header("Retry-After", fmt.Sprintf("%d", int(cfg.SSERetry.Seconds())))
+		c.JSON(503, gin.H{"error": "Server is restarting"})
+		return
+	default:
+	}
+
 	// Set SSE headers
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
 
 	// Create a client channel
 	clientChan := make(chan string, 10)
@@ -176,14 +346,15 @@ func StreamLotteryData(c *gin.Context) {
 	clients[clientChan] = true
 	clientCount := len(clients)
 	clientsMutex.Unlock()
+	sseConnections.Inc()
 
-	log.Printf("📡 New SSE client connected (Total clients: %d)", clientCount)
+	slog.InfoContext(c.Request.Context(), "SSE client connected", "clients", clientCount)
 
 	// Send initial data immediately with current client count
-	dataMutex.RLock()
+	dataMutex.Lock()
 	currentData.ViewCount = clientCount
 	initialData, _ := json.Marshal(currentData)
-	dataMutex.RUnlock()
+	dataMutex.Unlock()
 
 	c.Writer.Write([]byte(fmt.Sprintf("data: %s\n\n", initialData)))
 	c.Writer.Flush()
@@ -197,13 +368,22 @@ func StreamLotteryData(c *gin.Context) {
 			// Client disconnected
 			clientsMutex.Lock()
 			delete(clients, clientChan)
+			remaining := len(clients)
 			clientsMutex.Unlock()
 			close(clientChan)
-			log.Printf("📴 SSE client disconnected (Remaining clients: %d)", len(clients))
+			slog.InfoContext(c.Request.Context(), "SSE client disconnected", "clients", remaining)
 			return
-		case message := <-clientChan:
+		case <-shutdownCh:
+			// Tell the client to reconnect once the server is back
+			clientsMutex.Lock()
+			delete(clients, clientChan)
+			clientsMutex.Unlock()
+			c.Writer.Write([]byte(fmt.Sprintf("event: restarting\nretry: %d\ndata: {\"status\":\"restarting\",\"message\":\"server restarting\"}\n\n", cfg.SSERetry.Milliseconds())))
+			c.Writer.Flush()
+			return
+		case frame := <-clientChan:
 			// Send update to client
-			c.Writer.Write([]byte(fmt.Sprintf("data: %s\n\n", message)))
+			c.Writer.Write([]byte(frame))
 			c.Writer.Flush()
 		}
 	}
@@ -211,30 +391,78 @@ func StreamLotteryData(c *gin.Context) {
 
 // broadcastUpdate sends updates to all connected SSE clients
 func broadcastUpdate() {
-	dataMutex.RLock()
+	clientsMutex.RLock()
+	clientCount := len(clients)
+	clientsMutex.RUnlock()
+
+	dataMutex.Lock()
 	// Add current client count to the data
-	currentData.ViewCount = len(clients)
+	currentData.ViewCount = clientCount
 	data, err := json.Marshal(currentData)
-	dataMutex.RUnlock()
+	dataMutex.Unlock()
 
 	if err != nil {
-		log.Printf("❌ Failed to marshal data: %v", err)
+		slog.Error("failed to marshal lottery data", "error", err)
 		return
 	}
 
+	n := send(fmt.Sprintf("data: %s\n\n", data))
+	slog.Debug("broadcast lottery data", "clients", n)
+}
+
+// Announce sends a named event, such as "maintenance", to every SSE client
+func Announce(event string, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("failed to marshal announcement", "event", event, "error", err)
+		return
+	}
+	n := send(fmt.Sprintf("event: %s\ndata: %s\n\n", event, payload))
+	slog.Info("announced to SSE clients", "event", event, "clients", n)
+}
+
+// send queues an SSE frame for every client and returns how many there are
+func send(frame string) int {
 	clientsMutex.RLock()
 	defer clientsMutex.RUnlock()
 
-	message := string(data)
 	for clientChan := range clients {
 		select {
-		case clientChan <- message:
+		case clientChan <- frame:
 			// Message sent successfully
 		default:
 			// Channel is full, skip this client
-			log.Println("⚠️  Client channel full, skipping...")
+			sseDroppedFrames.Inc()
+			slog.Warn("SSE client channel full, dropping update")
 		}
 	}
+	return len(clients)
+}
 
-	log.Printf("📤 Broadcast to %d clients", len(clients))
+// CloseStreams sends every SSE client a final "restarting" event with a
+// retry hint so their handlers return, and refuses new streams
+func CloseStreams() {
+	shutdownOnce.Do(func() {
+		clientsMutex.RLock()
+		slog.Info("closing SSE streams", "clients", len(clients))
+		clientsMutex.RUnlock()
+		close(shutdownCh)
+	})
+}
+
+// FlushWrites waits for pending history writes to finish or ctx to expire.
+// Call it once the HTTP server has stopped accepting updates.
+func FlushWrites(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		pendingWrites.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("pending history writes: %w", ctx.Err())
+	}
 }
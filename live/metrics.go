@@ -0,0 +1,40 @@
+package live
+
+import (
+	"sync/atomic"
+	"thaimaster2d/metrics"
+	"time"
+)
+
+var (
+	feederUpdates = metrics.NewCounter("lottery_feeder_updates_total",
+		"Lottery updates published by the feeder")
+	sseConnections = metrics.NewCounter("lottery_sse_connections_total",
+		"SSE streams opened")
+	sseDroppedFrames = metrics.NewCounter("lottery_sse_dropped_frames_total",
+		"Updates not delivered because an SSE client's buffer was full")
+
+	// lastUpdate is the Unix time in nanoseconds of the last feeder update,
+	// or of Init if none has arrived yet
+	lastUpdate atomic.Int64
+)
+
+func init() {
+	lastUpdate.Store(time.Now().UnixNano())
+
+	metrics.NewGaugeFunc("lottery_sse_clients", "Connected SSE clients", func() float64 {
+		clientsMutex.RLock()
+		defer clientsMutex.RUnlock()
+		return float64(len(clients))
+	})
+	metrics.NewGaugeFunc("lottery_feeder_seconds_since_update",
+		"Seconds since the last feeder update, or since startup if none has arrived", func() float64 {
+			return time.Since(time.Unix(0, lastUpdate.Load())).Seconds()
+		})
+}
+
+// recordUpdate marks a feeder update for the metrics
+func recordUpdate() {
+	feederUpdates.Inc()
+	lastUpdate.Store(time.Now().UnixNano())
+}
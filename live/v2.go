@@ -0,0 +1,40 @@
+package live
+
+import (
+	"encoding/json"
+	"net/http"
+	"thaimaster2d/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCurrentDataV2 handles GET /api/v2/lottery/current
+func GetCurrentDataV2(c *gin.Context) {
+	api.OK(c, http.StatusOK, Current())
+}
+
+// UpdateLotteryDataV2 handles POST /api/v2/lottery/update
+func UpdateLotteryDataV2(c *gin.Context) {
+	var newData LotteryData
+	if err := json.NewDecoder(c.Request.Body).Decode(&newData); err != nil {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	name := c.GetHeader(FeederHeader)
+	if err := Authenticate(name, c.GetHeader(FeederSecretHeader)); err != nil {
+		api.Error(c, http.StatusForbidden, api.CodeForbidden, err.Error())
+		return
+	}
+	published, err := Submit(c.Request.Context(), name, &newData)
+	if err != nil {
+		api.Error(c, http.StatusForbidden, api.CodeForbidden, err.Error())
+		return
+	}
+	if !published {
+		// Recorded for the result consensus, but another feeder is active
+		api.OK(c, http.StatusAccepted, Current())
+		return
+	}
+	api.OK(c, http.StatusOK, Current())
+}
@@ -0,0 +1,192 @@
+package live
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"thaimaster2d/alert"
+	"thaimaster2d/metrics"
+	"time"
+)
+
+// Session is a market session during which the feeder must post at least
+// every MaxGap. Start and End are offsets from midnight in Config.Location.
+type Session struct {
+	Start  time.Duration
+	End    time.Duration
+	MaxGap time.Duration
+}
+
+// FeedState reports whether the feeder is keeping up
+type FeedState struct {
+	Stale bool
+	// StaleSince is when the watchdog marked the feed stale
+	StaleSince time.Time
+	LastUpdate time.Time
+}
+
+// WatchdogInterval is how often the watchdog checks the feed
+var WatchdogInterval = 10 * time.Second
+
+var (
+	feedMutex  sync.Mutex
+	feedStale  bool
+	staleSince time.Time
+	alertSink  alert.Sink
+
+	feedStaleGauge = metrics.NewGauge("lottery_feed_stale",
+		"1 while the watchdog considers the feeder down")
+)
+
+// SetAlertSink sets where feed down and recovery alerts are sent
+func SetAlertSink(sink alert.Sink) {
+	feedMutex.Lock()
+	defer feedMutex.Unlock()
+	alertSink = sink
+}
+
+func currentAlertSink() alert.Sink {
+	feedMutex.Lock()
+	defer feedMutex.Unlock()
+	return alertSink
+}
+
+// Feed returns the current feed state
+func Feed() FeedState {
+	feedMutex.Lock()
+	defer feedMutex.Unlock()
+	return FeedState{
+		Stale:      feedStale,
+		StaleSince: staleSince,
+		LastUpdate: time.Unix(0, lastUpdate.Load()),
+	}
+}
+
+func resetFeedState() {
+	feedMutex.Lock()
+	defer feedMutex.Unlock()
+	feedStale = false
+	staleSince = time.Time{}
+	feedStaleGauge.Set(0)
+}
+
+// StartWatchdog checks the feed and the pending draw results every
+// WatchdogInterval until ctx is cancelled. The returned channel is closed once it has stopped.
+func StartWatchdog(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(WatchdogInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				checkFeed(now)
+				checkResults(now)
+			}
+		}
+	}()
+	slog.Info("feed watchdog started", "sessions", len(cfg.Sessions), "interval", WatchdogInterval.String())
+	return done
+}
+
+// Sessions returns the configured market sessions
+func Sessions() []Session {
+	return cfg.Sessions
+}
+
+// SessionAt returns the index in Config.Sessions of the session in progress
+// at now, if any
+func SessionAt(now time.Time) (int, bool) {
+	local := now.In(cfg.Location)
+	if len(cfg.MarketDays) > 0 && !slices.Contains(cfg.MarketDays, local.Weekday()) {
+		return 0, false
+	}
+	sinceMidnight := time.Duration(local.Hour())*time.Hour +
+		time.Duration(local.Minute())*time.Minute +
+		time.Duration(local.Second())*time.Second
+	for i, s := range cfg.Sessions {
+		if sinceMidnight >= s.Start && sinceMidnight < s.End {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// checkFeed marks the data stale, tells SSE clients and alerts admins when
+// the feeder has missed the cadence of the current session. The gap is
+// counted from the session start if the last update came before it.
+func checkFeed(now time.Time) {
+	i, ok := SessionAt(now)
+	if !ok {
+		return
+	}
+	session := cfg.Sessions[i]
+	last := time.Unix(0, lastUpdate.Load())
+	local := now.In(cfg.Location)
+	opened := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, cfg.Location).Add(session.Start)
+	gap := now.Sub(later(last, opened))
+	if gap <= session.MaxGap {
+		return
+	}
+
+	feedMutex.Lock()
+	if feedStale {
+		feedMutex.Unlock()
+		return
+	}
+	feedStale = true
+	staleSince = now
+	sink := alertSink
+	feedMutex.Unlock()
+	feedStaleGauge.Set(1)
+
+	dataMutex.Lock()
+	currentData.Stale = true
+	dataMutex.Unlock()
+
+	slog.Warn("lottery feed is stale", "last_update", last, "max_gap", session.MaxGap.String())
+	broadcastUpdate()
+	alert.Notify(sink, alert.Alert{
+		Kind:  alert.KindFeedDown,
+		Title: "Lottery feed down",
+		Message: fmt.Sprintf("No update from the feeder for %s (expected every %s). Clients are shown the data as stale.",
+			gap.Round(time.Second), session.MaxGap),
+		Time: now,
+	})
+}
+
+// later returns the later of a and b
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// feedRecovered clears the stale state once the feeder posts again
+func feedRecovered(ctx context.Context) {
+	feedMutex.Lock()
+	if !feedStale {
+		feedMutex.Unlock()
+		return
+	}
+	downFor := time.Since(staleSince)
+	feedStale = false
+	staleSince = time.Time{}
+	sink := alertSink
+	feedMutex.Unlock()
+	feedStaleGauge.Set(0)
+
+	slog.InfoContext(ctx, "lottery feed recovered", "down_for", downFor.Round(time.Second).String())
+	alert.Notify(sink, alert.Alert{
+		Kind:    alert.KindFeedRecovered,
+		Title:   "Lottery feed recovered",
+		Message: fmt.Sprintf("The feeder is posting again after %s.", downFor.Round(time.Second)),
+		Time:    time.Now(),
+	})
+}
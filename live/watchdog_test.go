@@ -0,0 +1,49 @@
+package live
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckFeedCountsFromSessionStart(t *testing.T) {
+	Init(Config{
+		Location: time.UTC,
+		Sessions: []Session{
+			{Start: 9*time.Hour + 30*time.Minute, End: 12*time.Hour + time.Minute, MaxGap: 2 * time.Minute},
+			{Start: 14 * time.Hour, End: 16*time.Hour + 30*time.Minute, MaxGap: 2 * time.Minute},
+		},
+	})
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	at := func(clock time.Duration) time.Time { return day.Add(clock) }
+
+	// The morning's last update is hours old when the afternoon opens
+	lastUpdate.Store(at(12 * time.Hour).UnixNano())
+	checkFeed(at(14*time.Hour + 10*time.Second))
+	checkFeed(at(14*time.Hour + 2*time.Minute))
+	if Feed().Stale {
+		t.Fatal("feed marked stale within MaxGap of the session start")
+	}
+	checkFeed(at(14*time.Hour + 2*time.Minute + time.Second))
+	if !Feed().Stale {
+		t.Fatal("feed not marked stale after MaxGap without an update")
+	}
+
+	// Within a session the gap counts from the last update
+	resetFeedState()
+	lastUpdate.Store(at(15 * time.Hour).UnixNano())
+	checkFeed(at(15*time.Hour + time.Minute))
+	if Feed().Stale {
+		t.Error("feed marked stale a minute after an update")
+	}
+	checkFeed(at(15*time.Hour + 3*time.Minute))
+	if !Feed().Stale {
+		t.Error("feed not marked stale three minutes after an update")
+	}
+
+	// Outside the sessions the watchdog is idle
+	resetFeedState()
+	checkFeed(at(13 * time.Hour))
+	if Feed().Stale {
+		t.Error("feed marked stale between sessions")
+	}
+}
@@ -0,0 +1,123 @@
+// Package logging configures the process-wide slog logger and provides the
+// Gin middleware that tags every log line of a request with its request ID.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config selects the log level, output format and destination
+type Config struct {
+	Level slog.Level
+	// Format is "json" or "text"
+	Format string
+	// File is the log file path. Logs go to stderr if it is empty.
+	File string
+	// MaxSize is the size in bytes at which the log file is rotated
+	MaxSize int64
+	// MaxBackups is the number of rotated files kept
+	MaxBackups int
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q, use debug, info, warn or error", s)
+	}
+	return level, nil
+}
+
+// Setup installs the configured logger as the slog and log package default.
+// The returned Closer closes the log file, if any.
+func Setup(cfg Config) (io.Closer, error) {
+	var out io.WriteCloser = nopCloser{os.Stderr}
+	if cfg.File != "" {
+		file, err := OpenRotatingFile(cfg.File, cfg.MaxSize, cfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		out = file
+	}
+
+	handler, err := NewHandler(out, cfg.Format, cfg.Level)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	slog.SetDefault(slog.New(handler))
+
+	// Route Gin's own output through slog. Route listings are only useful
+	// when debugging.
+	if cfg.Level > slog.LevelDebug {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	gin.DebugPrintRouteFunc = func(method, path, handler string, _ int) {
+		slog.Debug("route registered", "method", method, "path", path, "handler", handler)
+	}
+	gin.DebugPrintFunc = func(format string, values ...any) {
+		slog.Debug(strings.TrimSpace(fmt.Sprintf(format, values...)), "component", "gin")
+	}
+	return out, nil
+}
+
+// NewHandler returns a JSON or text handler writing to w that adds the
+// request ID of the context to every record
+func NewHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "json":
+		return contextHandler{slog.NewJSONHandler(w, opts)}, nil
+	case "text":
+		return contextHandler{slog.NewTextHandler(w, opts)}, nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, use json or text", format)
+	}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID of ctx, or "" if it has none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request_id attribute to records logged with a
+// request context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -1,284 +1,218 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
-	"thaimaster2d/admin"
-	"thaimaster2d/appconfig"
-	"thaimaster2d/gift"
+	"os/signal"
+	"syscall"
+	"thaimaster2d/config"
+	"thaimaster2d/ingest"
 	"thaimaster2d/live"
-	"thaimaster2d/paper"
-	"thaimaster2d/slider"
-	"thaimaster2d/threed"
+	"thaimaster2d/logging"
+	"thaimaster2d/media"
+	"thaimaster2d/server"
+	"thaimaster2d/storage"
 	"thaimaster2d/twodhistory"
-	"thaimaster2d/version"
-
-	"github.com/gin-gonic/gin"
 )
 
-func main() {
-	// Create Gin router
-	r := gin.Default()
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
 
-	// Enable CORS for all origins
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		c.Next()
-	})
+func main() {
+	// Load configuration (defaults < config file < env < flags)
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-	// Initialize database
-	dbPath := os.Getenv("DATABASE_PATH")
-	if dbPath == "" {
-		// Default SQLite database file
-		dbPath = "./thaimaster2d.db"
+	// Switch to the configured structured logger before anything else logs
+	logOptions, err := cfg.Log.LogOptions()
+	if err != nil {
+		fatal("invalid log configuration", "error", err)
+	}
+	logFile, err := logging.Setup(logOptions)
+	if err != nil {
+		fatal("failed to set up logging", "error", err)
 	}
+	defer logFile.Close()
+	slog.Info("configuration loaded", "config", cfg)
 
-	log.Printf("🔌 Attempting database connection...")
-	log.Printf("� Database file: %s", dbPath)
+	// Initialize upload storage
+	backend, err := cfg.Storage.Open()
+	if err != nil {
+		fatal("storage configuration failed", "error", err)
+	}
+	storage.SetDefault(backend)
+	slog.Info("upload storage ready", "backend", fmt.Sprintf("%T", backend))
 
-	dbEnabled := false
-	if err := twodhistory.InitDB(dbPath); err != nil {
-		log.Printf("❌ Database initialization failed: %v", err)
-		log.Println("⚠️  Continuing without database features...")
-		log.Println("⚠️  Admin routes and data APIs will not be available!")
-	} else {
-		defer twodhistory.CloseDB()
-		dbEnabled = true
-		log.Println("✅ Database connected successfully!")
+	// Image links are stored as media keys and resolved against this base URL
+	media.Configure(cfg.Media.PublicBaseURL, cfg.Media.CDNURL)
+	if cfg.Media.PublicBaseURL == "" && cfg.Media.CDNURL == "" {
+		slog.Warn("media.public_base_url not set, image URLs will be server-relative")
+	}
 
-		// Initialize gift and slider packages
-		db := twodhistory.GetDB()
-		gift.InitDB(db)
-		slider.InitDB(db)
-		admin.InitDB(db)
-		threed.InitDB(db)
-		appconfig.InitDB(db)
-		paper.InitDB(db)
-		log.Println("✅ All database modules initialized!")
+	liveConfig, err := cfg.Live.LiveOptions()
+	if err != nil {
+		fatal("live configuration failed", "error", err)
+	}
+	pollerConfig, err := cfg.Ingest.PollerOptions()
+	if err != nil {
+		fatal("ingest configuration failed", "error", err)
+	}
+	pushSender, err := cfg.Push.Open()
+	if err != nil {
+		fatal("push configuration failed", "error", err)
 	}
 
-	// Initialize live package
-	live.Init()
+	// Stop on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var cleanupDone, pollerDone, webhooksDone, pushDone, maintenanceDone <-chan struct{}
 
-	// Register history inserter callback if database is enabled
-	if dbEnabled {
-		live.SetHistoryInserter(func(data *live.LotteryData) error {
-			// Convert live.LotteryData to twodhistory.LotteryData
-			histData := &twodhistory.LotteryData{
-				Date:        data.Date,
-				Live:        data.Live,
-				Status:      data.Status,
-				Set1200:     data.Set1200,
-				Value1200:   data.Value1200,
-				Result1200:  data.Result1200,
-				Set430:      data.Set430,
-				Value430:    data.Value430,
-				Result430:   data.Result430,
-				Modern930:   data.Modern930,
-				Internet930: data.Internet930,
-				Modern200:   data.Modern200,
-				Internet200: data.Internet200,
-				UpdateTime:  data.UpdateTime,
-			}
-			return twodhistory.InsertFromLotteryData(histData)
-		})
-		log.Println("✅ History auto-insert enabled (16:30-16:35 GMT+6:30)")
+	// Initialize live package
+	live.Init(liveConfig)
+
+	// Mark the feed stale and alert admins when the feeder goes quiet, and
+	// settle draw results the feeders have not agreed on in time
+	alerts := cfg.Alerts.Sink()
+	live.SetAlertSink(alerts)
+	if len(liveConfig.Sessions) > 0 || len(liveConfig.Feeders) > 0 {
+		live.StartWatchdog(ctx)
 	}
 
-	// Routes
-	r.POST("/api/lottery/update", live.UpdateLotteryData)
-	r.GET("/api/lottery/stream", live.StreamLotteryData)
-	r.GET("/api/lottery/current", live.GetCurrentData)
+	// Initialize database
+	opts := server.Options{
+		Storage:  backend,
+		Location: liveConfig.Location,
+		CORS:     cfg.CORS,
+		Webhooks: cfg.Webhooks.DispatcherOptions(),
+		Push:     pushSender,
+		Users:    cfg.Users.ServiceOptions(),
+		Points:   cfg.Points.ServiceOptions(),
+		Alerts:   alerts,
+	}
+	// Draws are held on market days only
+	opts.Points.DrawDays = liveConfig.MarketDays
+	db, err := twodhistory.OpenDB(cfg.Database.Path)
+	if err != nil {
+		slog.Error("database initialization failed", "error", err)
+	} else {
+		opts.DB = db
+	}
 
-	// History routes
-	r.GET("/api/twodhistory", twodhistory.GetHistoryHandler)
-	r.POST("/api/twodhistory/check", twodhistory.CheckAndInsertHandler)
+	app, err := server.New(opts)
+	if err != nil {
+		slog.Error("database initialization failed", "error", err)
+		db.Close()
+		opts.DB = nil
+		app, err = server.New(opts)
+		if err != nil {
+			fatal("failed to create router", "error", err)
+		}
+	}
 
-	// Gift routes
-	r.GET("/api/gifts", gift.GetGiftsHandler)
+	dbEnabled := opts.DB != nil
+	if dbEnabled {
+		// Register existing uploads in the media library
+		if err := app.Library.SyncUploads(ctx); err != nil {
+			slog.Error("failed to sync uploads", "error", err)
+		}
 
-	// Slider routes
-	r.GET("/api/sliders", slider.GetSlidersHandler)
+		// Optionally sweep orphaned uploads on a schedule
+		if interval := cfg.Media.CleanupInterval.Duration; interval > 0 {
+			cleanupDone = app.Library.StartOrphanCleanup(ctx, interval)
+		}
 
-	// 3D routes
-	r.GET("/api/threed", threed.GetAllResults)
-	r.POST("/api/threed", threed.CreateResult)
-	r.PUT("/api/threed", threed.UpdateResult)
-	r.DELETE("/api/threed", threed.DeleteResult)
+		// Deliver events to the webhook endpoints
+		webhooksDone = app.Webhooks.Start(ctx)
 
-	// Paper routes (public)
-	r.GET("/api/paper/types", paper.GetAllTypes)
-	r.GET("/api/paper/types/:type_id/images", paper.GetImagesByType)
+		// Notify app users of new results
+		if app.Push.Enabled() {
+			pushDone = app.Push.Start(ctx)
+		}
 
-	// App Config routes (public)
-	r.GET("/api/appconfig", appconfig.GetAppConfig)
-	r.GET("/api/appconfig/check", appconfig.CheckVersion)
+		// Switch maintenance mode as scheduled windows start and end
+		maintenanceDone = app.Maintenance.Start(ctx)
 
-	// Admin routes
-	if dbEnabled {
-		// Serve uploaded files
-		r.Static("/uploads", "./uploads")
+		start, end := live.InsertWindow()
+		slog.Info("history auto-insert enabled", "start", start, "end", end, "timezone", cfg.Live.Timezone)
+	} else {
+		slog.Warn("continuing without database, admin routes and data APIs are unavailable")
+	}
 
-		// Load HTML templates
-		r.LoadHTMLGlob("admin/templates/*.html")
+	// Optionally poll upstream sources alongside the external feeder. Started
+	// once the router has registered the history inserter.
+	if len(pollerConfig.Sources) > 0 {
+		pollerDone = ingest.New(pollerConfig).Start(ctx)
+	}
 
-		// Admin dashboard pages
-		r.GET("/admin", admin.AdminDashboardHandler)
-		r.GET("/admin/gifts", admin.ManageGiftsPageHandler)
-		r.GET("/admin/sliders", admin.ManageSlidersPageHandler)
-		r.GET("/admin/threed", admin.ManageThreeDPageHandler)
-		r.GET("/admin/paper", admin.ManagePaperPageHandler)
-		r.GET("/admin/appconfig", admin.AppConfigPageHandler)
-		r.POST("/admin/appconfig/update", admin.UpdateAppConfigHandler)
-		r.GET("/admin/gifts/create", admin.CreateGiftPageHandler)
-		r.GET("/admin/sliders/create", admin.CreateSliderPageHandler)
-		r.GET("/admin/threed/create", admin.CreateThreeDPageHandler)
-		r.POST("/admin/threed/create", admin.CreateThreeDHandler)
-		r.GET("/admin/gifts/edit/:id", admin.EditGiftPageHandler)
-		r.GET("/admin/sliders/edit/:id", admin.EditSliderPageHandler)
-		r.GET("/admin/threed/edit", admin.EditThreeDPageHandler)
-		r.POST("/admin/threed/edit", admin.EditThreeDHandler)
-		r.POST("/admin/threed/delete", admin.DeleteThreeDHandler)
+	// Start server
+	slog.Info("server starting", "addr", cfg.Server.Addr)
+	srv := &http.Server{
+		Addr:     cfg.Server.Addr,
+		Handler:  app.Router,
+		ErrorLog: slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("failed to start server", "error", err)
+		}
+	}()
 
-		// Image upload routes
-		r.POST("/api/admin/upload-image", admin.UploadImageHandler)
-		r.DELETE("/api/admin/delete-image/:filename", admin.DeleteImageHandler)
-		
-		// Image serving route (API endpoint to serve images)
-		r.GET("/api/images/:filename", admin.ServeImageHandler)
-		
-		// Version/Health check endpoint
-		r.GET("/api/version", func(c *gin.Context) {
-			c.JSON(200, version.GetBuildInfo())
-		})
-		
-		// Admin API routes for gifts
-		r.GET("/api/admin/gifts", func(c *gin.Context) {
-			gifts, err := gift.GetAllGiftsForAdmin()
-			if err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return
-			}
-			c.JSON(200, gifts)
-		})
-		r.GET("/api/admin/gifts/:id", admin.GetGiftByIDHandler)
-		r.POST("/api/admin/gifts", func(c *gin.Context) {
-			var newGift gift.Gift
-			if err := c.BindJSON(&newGift); err != nil {
-				c.JSON(400, gin.H{"error": err.Error()})
-				return
-			}
-			if err := gift.InsertGift(newGift); err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return
-			}
-			c.JSON(200, gin.H{"message": "Gift created"})
-		})
-		r.PUT("/api/admin/gifts/:id", func(c *gin.Context) {
-			var updatedGift gift.Gift
-			if err := c.BindJSON(&updatedGift); err != nil {
-				c.JSON(400, gin.H{"error": err.Error()})
-				return
-			}
-			if err := gift.UpdateGift(updatedGift); err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return
-			}
-			c.JSON(200, gin.H{"message": "Gift updated"})
-		})
-		r.DELETE("/api/admin/gifts/:id", func(c *gin.Context) {
-			var id int
-			if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
-				c.JSON(400, gin.H{"error": "Invalid ID"})
-				return
-			}
-			if err := gift.DeleteGift(id); err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return
-			}
-			c.JSON(200, gin.H{"message": "Gift deleted"})
-		})
+	<-ctx.Done()
+	stop()
+	slog.Info("shutting down", "timeout", cfg.Server.ShutdownTimeout.String())
 
-		// Admin API routes for sliders
-		r.GET("/api/admin/sliders", func(c *gin.Context) {
-			sliders, err := slider.GetAllSlidersForAdmin()
-			if err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return
-			}
-			c.JSON(200, sliders)
-		})
-		r.GET("/api/admin/sliders/:id", admin.GetSliderByIDHandler)
-		r.POST("/api/admin/sliders", func(c *gin.Context) {
-			var newSlider slider.Slider
-			if err := c.BindJSON(&newSlider); err != nil {
-				c.JSON(400, gin.H{"error": err.Error()})
-				return
-			}
-			if err := slider.InsertSlider(newSlider); err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return
-			}
-			c.JSON(200, gin.H{"message": "Slider created"})
-		})
-		r.PUT("/api/admin/sliders/:id", func(c *gin.Context) {
-			var updatedSlider slider.Slider
-			if err := c.BindJSON(&updatedSlider); err != nil {
-				c.JSON(400, gin.H{"error": err.Error()})
-				return
-			}
-			if err := slider.UpdateSlider(updatedSlider); err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return
-			}
-			c.JSON(200, gin.H{"message": "Slider updated"})
-		})
-		r.DELETE("/api/admin/sliders/:id", func(c *gin.Context) {
-			var id int
-			if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
-				c.JSON(400, gin.H{"error": "Invalid ID"})
-				return
-			}
-			if err := slider.DeleteSlider(id); err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return
-			}
-			c.JSON(200, gin.H{"message": "Slider deleted"})
-		})
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Duration)
+	defer cancel()
 
-		// Admin API routes for paper
-		r.GET("/api/admin/paper/types", paper.GetAllTypesWithImages)
-		r.POST("/api/admin/paper/types", paper.CreateType)
-		r.PUT("/api/admin/paper/types/:id", paper.UpdateType)
-		r.DELETE("/api/admin/paper/types/:id", paper.DeleteType)
-		r.POST("/api/admin/paper/images", paper.CreateImage)
-		r.POST("/api/admin/paper/images/batch", paper.BatchCreateImages)
-		r.PUT("/api/admin/paper/images/:id", paper.UpdateImage)
-		r.DELETE("/api/admin/paper/images/:id", paper.DeleteImage)
+	// SSE streams never end on their own, so close them before draining
+	live.CloseStreams()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("timed out draining requests, closing remaining connections", "error", err)
+		srv.Close()
+	} else {
+		slog.Info("in-flight requests drained")
 	}
 
-	// Health check
-	r.GET("/", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status":  "ok",
-			"message": "ThaiMaster2D Lottery API Server",
-			"version": "1.0.0",
-		})
-	})
+	if pollerDone != nil {
+		<-pollerDone
+	}
+	if err := live.FlushWrites(shutdownCtx); err != nil {
+		slog.Warn("history writes still pending at shutdown", "error", err)
+	}
+	if webhooksDone != nil {
+		select {
+		case <-webhooksDone:
+		case <-shutdownCtx.Done():
+			slog.Warn("webhook deliveries still running at shutdown")
+		}
+	}
+	if pushDone != nil {
+		<-pushDone
+	}
+	if maintenanceDone != nil {
+		<-maintenanceDone
+	}
+	if cleanupDone != nil {
+		select {
+		case <-cleanupDone:
+		case <-shutdownCtx.Done():
+			slog.Warn("orphan cleanup still running at shutdown")
+		}
+	}
 
-	// Start server
-	log.Println("🚀 Server starting on :4545")
-	log.Println("📡 SSE Stream available at: http://localhost:4545/api/lottery/stream")
-	log.Println("📮 POST lottery data to: http://localhost:4545/api/lottery/update")
-	log.Println("📜 History data at: http://localhost:4545/api/twodhistory")
-	if err := r.Run(":4545"); err != nil {
-		log.Fatal("Failed to start server:", err)
+	if dbEnabled {
+		db.Close()
+		slog.Info("database connection closed")
 	}
+	slog.Info("server stopped")
 }
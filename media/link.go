@@ -0,0 +1,133 @@
+package media
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"thaimaster2d/storage"
+)
+
+// Link is an image link as stored in the database: the media key of a file
+// we host, or an absolute URL for images hosted elsewhere. It is resolved to
+// a full URL when serialized and normalized back to a key when decoded.
+type Link string
+
+var (
+	publicBaseURL string
+	cdnURL        string
+)
+
+// Configure sets the public base URL of this server (e.g.
+// https://api.example.com) and an optional CDN prefix media keys are served
+// from instead. Both may be empty, in which case links resolve to
+// server-relative paths.
+func Configure(publicBase, cdn string) {
+	publicBaseURL = strings.TrimSuffix(publicBase, "/")
+	cdnURL = strings.TrimSuffix(cdn, "/")
+}
+
+// PublicURL returns path on this server, absolute when the public base URL
+// is configured
+func PublicURL(path string) string {
+	return publicBaseURL + path
+}
+
+// ResolveURL turns a stored link into the URL clients should fetch
+func ResolveURL(link string) string {
+	if link == "" || strings.Contains(link, "://") {
+		return link
+	}
+	if cdnURL != "" {
+		return cdnURL + "/" + link
+	}
+	u := URLFor(link)
+	if strings.HasPrefix(u, "/") {
+		return publicBaseURL + u
+	}
+	return u
+}
+
+// NormalizeLink turns a URL pointing at one of our uploads back into its
+// media key. Links to other hosts are returned unchanged.
+func NormalizeLink(link string) string {
+	prefixes := []string{"/api/images/", "/uploads/"}
+	if publicBaseURL != "" {
+		prefixes = append(prefixes, publicBaseURL+"/api/images/", publicBaseURL+"/uploads/")
+	}
+	if cdnURL != "" {
+		prefixes = append(prefixes, cdnURL+"/")
+	}
+	if u := storage.Default().URL(""); !strings.HasPrefix(u, "/") {
+		prefixes = append(prefixes, u)
+	}
+
+	for _, prefix := range prefixes {
+		if rest, ok := strings.CutPrefix(link, prefix); ok && rest != "" {
+			if i := strings.IndexAny(rest, "?#"); i >= 0 {
+				rest = rest[:i]
+			}
+			if key, err := url.PathUnescape(rest); err == nil {
+				return key
+			}
+			return rest
+		}
+	}
+	return link
+}
+
+// String returns the stored form of the link
+func (l Link) String() string {
+	return string(l)
+}
+
+// URL returns the resolved URL of the link
+func (l Link) URL() string {
+	return ResolveURL(string(l))
+}
+
+// MarshalJSON writes the resolved URL
+func (l Link) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.URL())
+}
+
+// UnmarshalJSON accepts either a key or a URL and stores the key
+func (l *Link) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*l = Link(NormalizeLink(s))
+	return nil
+}
+
+// LegacyKey returns the media key of an absolute or server-relative URL
+// stored before links were saved as keys. Absolute URLs only match when
+// their hostname is in hosts (or is the configured public host).
+func LegacyKey(link string, hosts []string) (string, bool) {
+	if link == "" || !strings.Contains(link, "/") {
+		return "", false
+	}
+	if key := NormalizeLink(link); key != link {
+		return key, true
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", false
+	}
+	if u.Host != "" {
+		allowed := false
+		for _, host := range hosts {
+			if strings.EqualFold(u.Hostname(), host) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "", false
+		}
+	}
+
+	key := KeyFromURL(link)
+	return key, key != ""
+}
@@ -0,0 +1,589 @@
+package media
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"thaimaster2d/metrics"
+	"thaimaster2d/storage"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Media represents a single uploaded file in the storage backend
+type Media struct {
+	ID           int       `json:"id"`
+	Hash         string    `json:"hash"`
+	Filename     string    `json:"filename"`
+	OriginalName string    `json:"original_name"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	RefCount     int       `json:"ref_count"`
+	URL          string    `json:"url"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// errFilenameTaken is returned by insertMedia when a row already has the
+// filename
+var errFilenameTaken = errors.New("media filename already exists")
+
+// OrphanGracePeriod protects freshly uploaded files that have not been
+// attached to a gift, slider or paper image yet
+var OrphanGracePeriod = 24 * time.Hour
+
+var (
+	uploads = metrics.NewCounter("media_uploads_total",
+		"Image uploads, by result (stored or reused for duplicate content)", "result")
+	uploadBytes = metrics.NewCounter("media_upload_bytes_total",
+		"Bytes of newly stored uploads")
+)
+
+// Library tracks uploaded files in the media table and the storage backend
+type Library struct {
+	db    *sql.DB
+	store storage.Backend
+}
+
+// referenceColumns lists every table column that stores an uploaded image URL
+var referenceColumns = []struct {
+	Table  string
+	Column string
+}{
+	{"gifts", "image_link"},
+	{"sliders", "image_link"},
+	{"paper_images", "image_url"},
+}
+
+// NewLibrary creates the media table if needed
+func NewLibrary(db *sql.DB, store storage.Backend) *Library {
+	l := &Library{db: db, store: store}
+	l.createTable()
+	return l
+}
+
+// createTable creates the media table if it doesn't exist
+func (l *Library) createTable() {
+	query := `
+	CREATE TABLE IF NOT EXISTS media (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		hash TEXT NOT NULL,
+		filename TEXT NOT NULL UNIQUE,
+		original_name TEXT,
+		content_type TEXT,
+		size INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_media_hash ON media(hash);
+	`
+	_, err := l.db.Exec(query)
+	if err != nil {
+		slog.Error("failed to create media table", "error", err)
+	} else {
+		slog.Info("media table ready")
+	}
+}
+
+// URLFor returns the URL an uploaded file is served from
+func URLFor(filename string) string {
+	return storage.Default().URL(filename)
+}
+
+// KeyFromURL extracts the uploaded filename from a stored image link, which
+// may already be a bare media key. It returns "" for URLs that don't point
+// at our uploads.
+func KeyFromURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	if !strings.Contains(raw, "/") {
+		return raw
+	}
+	p := raw
+	if u, err := url.Parse(raw); err == nil {
+		p = u.Path
+	}
+	for _, prefix := range []string{"/api/images/", "/uploads/"} {
+		if i := strings.Index(p, prefix); i >= 0 {
+			return path.Base(p[i+len(prefix):])
+		}
+	}
+	return ""
+}
+
+// hashContent returns the hex encoded SHA-256, size and sniffed content type
+// of a reader's content
+func hashContent(r io.Reader) (string, int64, string, error) {
+	h := sha256.New()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", 0, "", err
+	}
+	head = head[:n]
+	h.Write(head)
+
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size + int64(n), http.DetectContentType(head), nil
+}
+
+// findByHash returns the oldest media row with the given content hash
+func (l *Library) findByHash(hash string) (*Media, error) {
+	var m Media
+	err := l.db.QueryRow(`
+		SELECT id, hash, filename, original_name, content_type, size, created_at
+		FROM media WHERE hash = $1
+		ORDER BY id ASC LIMIT 1
+	`, hash).Scan(&m.ID, &m.Hash, &m.Filename, &m.OriginalName, &m.ContentType, &m.Size, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	m.URL = ResolveURL(m.Filename)
+	return &m, nil
+}
+
+// insertMedia records a file in the media table, or returns
+// errFilenameTaken if another row has its filename
+func (l *Library) insertMedia(m *Media) error {
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	err := l.db.QueryRow(`
+		INSERT INTO media (hash, filename, original_name, content_type, size, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (filename) DO NOTHING
+		RETURNING id
+	`, m.Hash, m.Filename, m.OriginalName, m.ContentType, m.Size, m.CreatedAt.UTC()).Scan(&m.ID)
+	if err == sql.ErrNoRows {
+		return errFilenameTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert media: %w", err)
+	}
+	m.URL = ResolveURL(m.Filename)
+	return nil
+}
+
+// SaveUpload stores an uploaded file unless identical content already exists.
+// The returned bool reports whether an existing file was reused.
+func (l *Library) SaveUpload(ctx context.Context, file *multipart.FileHeader) (*Media, bool, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer src.Close()
+
+	hash, size, contentType, err := hashContent(src)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to hash upload: %w", err)
+	}
+
+	// Reuse the existing file if its content is already stored
+	if existing, err := l.findByHash(hash); err == nil {
+		if _, statErr := l.store.Stat(ctx, existing.Filename); statErr == nil {
+			uploads.Inc("reused")
+			slog.InfoContext(ctx, "duplicate upload reuses stored file", "upload", file.Filename, "filename", existing.Filename)
+			return existing, true, nil
+		}
+	} else if err != sql.ErrNoRows {
+		return nil, false, err
+	}
+
+	// The hash keeps uploads of different files with the same name in the
+	// same second apart
+	filename := fmt.Sprintf("%d_%s_%s", time.Now().Unix(), hash[:12], filepath.Base(file.Filename))
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, false, fmt.Errorf("failed to rewind upload: %w", err)
+	}
+	if err := l.store.Put(ctx, filename, src, size, contentType); err != nil {
+		return nil, false, fmt.Errorf("failed to save image: %w", err)
+	}
+
+	m := &Media{
+		Hash:         hash,
+		Filename:     filename,
+		OriginalName: file.Filename,
+		ContentType:  contentType,
+		Size:         size,
+	}
+	if err := l.insertMedia(m); err != nil {
+		// A taken filename belongs to a row with the same content, which
+		// still needs the stored file
+		if !errors.Is(err, errFilenameTaken) {
+			l.store.Delete(ctx, filename)
+		}
+		return nil, false, err
+	}
+
+	uploads.Inc("stored")
+	uploadBytes.Add(float64(size))
+	slog.InfoContext(ctx, "media stored", "filename", filename, "size", size)
+	return m, false, nil
+}
+
+// SyncUploads registers stored files that are missing from the media table
+// and points references at duplicate files to the oldest copy instead
+func (l *Library) SyncUploads(ctx context.Context) error {
+	objects, err := l.store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list uploads: %w", err)
+	}
+
+	known := make(map[string]bool)
+	rows, err := l.db.Query("SELECT filename FROM media")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		known[name] = true
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	added := 0
+	for _, obj := range objects {
+		if known[obj.Key] {
+			continue
+		}
+
+		r, _, err := l.store.Get(ctx, obj.Key)
+		if err != nil {
+			slog.WarnContext(ctx, "skipping unreadable upload", "key", obj.Key, "error", err)
+			continue
+		}
+		hash, size, contentType, err := hashContent(r)
+		r.Close()
+		if err != nil {
+			slog.WarnContext(ctx, "skipping unreadable upload", "key", obj.Key, "error", err)
+			continue
+		}
+
+		// Use the file's modification time so old orphans aren't protected
+		// by the grace period just because they were registered late
+		m := &Media{
+			Hash:         hash,
+			Filename:     obj.Key,
+			OriginalName: obj.Key,
+			ContentType:  contentType,
+			Size:         size,
+			CreatedAt:    obj.ModTime,
+		}
+		if err := l.insertMedia(m); err != nil {
+			slog.WarnContext(ctx, "skipping unregistrable upload", "key", obj.Key, "error", err)
+			continue
+		}
+		added++
+	}
+
+	if added > 0 {
+		slog.InfoContext(ctx, "registered existing uploads in media library", "count", added)
+	}
+
+	return l.dedupeReferences()
+}
+
+// dedupeReferences rewrites references to duplicate files so they point at
+// the oldest file with the same content. The duplicates become orphans.
+func (l *Library) dedupeReferences() error {
+	rows, err := l.db.Query(`
+		SELECT m.filename, c.filename
+		FROM media m
+		JOIN media c ON c.hash = m.hash AND c.id = (SELECT MIN(id) FROM media WHERE hash = m.hash)
+		WHERE m.id != c.id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to find duplicates: %w", err)
+	}
+	defer rows.Close()
+	duplicates := make(map[string]string)
+	for rows.Next() {
+		var dup, canonical string
+		if err := rows.Scan(&dup, &canonical); err != nil {
+			return fmt.Errorf("failed to read duplicates: %w", err)
+		}
+		duplicates[dup] = canonical
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to find duplicates: %w", err)
+	}
+	rows.Close()
+
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	updated, err := l.RewriteReferences(func(link, key string) string {
+		canonical, ok := duplicates[key]
+		if !ok {
+			return link
+		}
+		if link == key {
+			return canonical
+		}
+		return strings.Replace(link, "/"+key, "/"+canonical, 1)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rewrite duplicate references: %w", err)
+	}
+	if updated > 0 {
+		slog.Info("pointed duplicate image references at their original uploads", "count", updated)
+	}
+
+	return nil
+}
+
+// ReferenceCounts counts how many gifts, sliders and paper images use each file
+func (l *Library) ReferenceCounts() (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, ref := range referenceColumns {
+		rows, err := l.db.Query(fmt.Sprintf("SELECT %s FROM %s", ref.Column, ref.Table))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s.%s: %w", ref.Table, ref.Column, err)
+		}
+		for rows.Next() {
+			var link sql.NullString
+			if err := rows.Scan(&link); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to read %s.%s: %w", ref.Table, ref.Column, err)
+			}
+			if key := KeyFromURL(link.String); key != "" {
+				counts[key]++
+			}
+		}
+		// A missed reference would make its file look orphaned
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s.%s: %w", ref.Table, ref.Column, err)
+		}
+	}
+	return counts, nil
+}
+
+// GetAllMedia retrieves every media file with its reference count
+func (l *Library) GetAllMedia() ([]Media, error) {
+	counts, err := l.ReferenceCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := l.db.Query(`
+		SELECT id, hash, filename, original_name, content_type, size, created_at
+		FROM media
+		ORDER BY created_at DESC, id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []Media
+	for rows.Next() {
+		var m Media
+		if err := rows.Scan(&m.ID, &m.Hash, &m.Filename, &m.OriginalName, &m.ContentType, &m.Size, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.RefCount = counts[m.Filename]
+		m.URL = ResolveURL(m.Filename)
+		items = append(items, m)
+	}
+	return items, rows.Err()
+}
+
+// FindOrphans returns unreferenced files older than OrphanGracePeriod
+func (l *Library) FindOrphans() ([]Media, error) {
+	items, err := l.GetAllMedia()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-OrphanGracePeriod)
+	var orphans []Media
+	for _, m := range items {
+		if m.RefCount == 0 && m.CreatedAt.Before(cutoff) {
+			orphans = append(orphans, m)
+		}
+	}
+	return orphans, nil
+}
+
+// DeleteMedia removes a file from storage and from the media table
+func (l *Library) DeleteMedia(ctx context.Context, filename string) error {
+	filename = filepath.Base(filename)
+	if err := l.store.Delete(ctx, filename); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	if _, err := l.db.Exec("DELETE FROM media WHERE filename = $1", filename); err != nil {
+		return fmt.Errorf("failed to delete media row: %w", err)
+	}
+	return nil
+}
+
+// RewriteReferences passes every stored image URL that points at an upload
+// through rewrite and saves the ones it changes. It returns the number of
+// rows updated.
+func (l *Library) RewriteReferences(rewrite func(link, key string) string) (int, error) {
+	updated := 0
+	for _, ref := range referenceColumns {
+		rows, err := l.db.Query(fmt.Sprintf("SELECT id, %s FROM %s", ref.Column, ref.Table))
+		if err != nil {
+			return updated, fmt.Errorf("failed to read %s.%s: %w", ref.Table, ref.Column, err)
+		}
+		changes := make(map[int]string)
+		for rows.Next() {
+			var id int
+			var link sql.NullString
+			if err := rows.Scan(&id, &link); err != nil {
+				rows.Close()
+				return updated, fmt.Errorf("failed to read %s.%s: %w", ref.Table, ref.Column, err)
+			}
+			key := KeyFromURL(link.String)
+			if key == "" {
+				continue
+			}
+			if newLink := rewrite(link.String, key); newLink != link.String {
+				changes[id] = newLink
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return updated, fmt.Errorf("failed to read %s.%s: %w", ref.Table, ref.Column, err)
+		}
+
+		for id, link := range changes {
+			query := fmt.Sprintf("UPDATE %s SET %s = $1 WHERE id = $2", ref.Table, ref.Column)
+			if _, err := l.db.Exec(query, link, id); err != nil {
+				return updated, fmt.Errorf("failed to update %s %d: %w", ref.Table, id, err)
+			}
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+// DeleteOrphans deletes every orphaned file and returns what was removed
+func (l *Library) DeleteOrphans(ctx context.Context) ([]Media, error) {
+	orphans, err := l.FindOrphans()
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []Media
+	for _, m := range orphans {
+		if err := l.DeleteMedia(ctx, m.Filename); err != nil {
+			slog.ErrorContext(ctx, "failed to delete orphaned upload", "filename", m.Filename, "error", err)
+			continue
+		}
+		deleted = append(deleted, m)
+	}
+
+	if len(deleted) > 0 {
+		slog.InfoContext(ctx, "deleted orphaned uploads", "count", len(deleted))
+	}
+	return deleted, nil
+}
+
+// StartOrphanCleanup periodically deletes orphaned uploads in the background
+// until ctx is cancelled. The returned channel is closed once the current
+// sweep (if any) has finished.
+func (l *Library) StartOrphanCleanup(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			// Let a sweep in progress finish even if shutdown begins
+			sweepCtx := context.WithoutCancel(ctx)
+			if err := l.SyncUploads(sweepCtx); err != nil {
+				slog.Error("failed to sync uploads", "error", err)
+			}
+			if _, err := l.DeleteOrphans(sweepCtx); err != nil {
+				slog.Error("failed to delete orphaned uploads", "error", err)
+			}
+		}
+	}()
+	slog.Info("orphaned upload cleanup scheduled", "interval", interval.String())
+	return done
+}
+
+// GetMediaHandler returns every media file with its reference count
+func (l *Library) GetMediaHandler(c *gin.Context) {
+	items, err := l.GetAllMedia()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// GetOrphansHandler lists orphaned files without deleting them
+func (l *Library) GetOrphansHandler(c *gin.Context) {
+	if err := l.SyncUploads(c.Request.Context()); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	orphans, err := l.FindOrphans()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, orphans)
+}
+
+// CleanupOrphansHandler deletes orphaned files on demand
+func (l *Library) CleanupOrphansHandler(c *gin.Context) {
+	if err := l.SyncUploads(c.Request.Context()); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	deleted, err := l.DeleteOrphans(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"count":   len(deleted),
+		"deleted": deleted,
+	})
+}
@@ -0,0 +1,173 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"mime/multipart"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"thaimaster2d/storage"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestLibrary returns a library over an empty database with the tables
+// that reference uploads
+func newTestLibrary(t *testing.T) (*Library, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, ref := range referenceColumns {
+		if _, err := db.Exec("CREATE TABLE " + ref.Table + " (id INTEGER PRIMARY KEY AUTOINCREMENT, " + ref.Column + " TEXT)"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store := storage.NewLocal(filepath.Join(t.TempDir(), "uploads"), "test-key")
+	return NewLibrary(db, store), db
+}
+
+// fileHeader returns an uploaded file as the multipart reader parses it
+func fileHeader(t *testing.T, name, content string) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("image", name)
+	part.Write([]byte(content))
+	w.Close()
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["image"][0]
+}
+
+func TestSaveUploadReusesContent(t *testing.T) {
+	l, _ := newTestLibrary(t)
+	ctx := context.Background()
+
+	first, reused, err := l.SaveUpload(ctx, fileHeader(t, "banner.png", "same image"))
+	if err != nil || reused {
+		t.Fatalf("first upload = %+v, %v, %v", first, reused, err)
+	}
+	again, reused, err := l.SaveUpload(ctx, fileHeader(t, "copy.png", "same image"))
+	if err != nil || !reused || again.Filename != first.Filename {
+		t.Errorf("duplicate upload = %+v, %v, %v; want %s reused", again, reused, err, first.Filename)
+	}
+	other, reused, err := l.SaveUpload(ctx, fileHeader(t, "other.png", "other image"))
+	if err != nil || reused || other.Filename == first.Filename || other.Hash == first.Hash {
+		t.Errorf("different upload = %+v, %v, %v", other, reused, err)
+	}
+
+	// Another file with the same name in the same second gets its own key
+	renamed, _, err := l.SaveUpload(ctx, fileHeader(t, "banner.png", "new banner"))
+	if err != nil || renamed.Filename == first.Filename {
+		t.Fatalf("same-name upload = %+v, %v; want a new key", renamed, err)
+	}
+	if _, err := l.store.Stat(ctx, first.Filename); err != nil {
+		t.Errorf("first upload is gone after a same-name upload: %v", err)
+	}
+	if err := l.insertMedia(&Media{Hash: first.Hash, Filename: first.Filename}); !errors.Is(err, errFilenameTaken) {
+		t.Errorf("insert of a taken filename = %v, want errFilenameTaken", err)
+	}
+
+	// A row whose file went missing is stored again
+	if err := l.store.Delete(ctx, first.Filename); err != nil {
+		t.Fatal(err)
+	}
+	restored, reused, err := l.SaveUpload(ctx, fileHeader(t, "restored.png", "same image"))
+	if err != nil || reused {
+		t.Errorf("upload of a missing file = %+v, %v, %v", restored, reused, err)
+	}
+
+	items, err := l.GetAllMedia()
+	if err != nil || len(items) != 4 {
+		t.Errorf("GetAllMedia = %d items, %v; want 4", len(items), err)
+	}
+}
+
+func TestSyncUploadsDedupesAndFindsOrphans(t *testing.T) {
+	l, db := newTestLibrary(t)
+	ctx := context.Background()
+	defer func(grace time.Duration) { OrphanGracePeriod = grace }(OrphanGracePeriod)
+
+	// 2_copy.png duplicates 1_original.png and 3_unused.png is never used
+	for key, content := range map[string]string{
+		"1_original.png": "same image",
+		"2_copy.png":     "same image",
+		"3_unused.png":   "unused image",
+		"4_other.png":    "other image",
+	} {
+		if err := l.store.Put(ctx, key, strings.NewReader(content), int64(len(content)), "image/png"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, q := range []string{
+		"INSERT INTO gifts (image_link) VALUES ('https://api.example.com/api/images/2_copy.png')",
+		"INSERT INTO sliders (image_link) VALUES ('2_copy.png'), ('4_other.png'), (NULL)",
+		"INSERT INTO paper_images (image_url) VALUES ('https://elsewhere.example.com/2_copy.png')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := l.SyncUploads(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ query, want string }{
+		{"SELECT image_link FROM gifts", "https://api.example.com/api/images/1_original.png"},
+		{"SELECT image_link FROM sliders WHERE id = 1", "1_original.png"},
+		{"SELECT image_link FROM sliders WHERE id = 2", "4_other.png"},
+		// Images hosted elsewhere are left alone
+		{"SELECT image_url FROM paper_images", "https://elsewhere.example.com/2_copy.png"},
+	} {
+		var got string
+		if err := db.QueryRow(tc.query).Scan(&got); err != nil || got != tc.want {
+			t.Errorf("%s = %q, %v; want %q", tc.query, got, err, tc.want)
+		}
+	}
+
+	counts, err := l.ReferenceCounts()
+	if err != nil || counts["1_original.png"] != 2 || counts["2_copy.png"] != 0 || counts["4_other.png"] != 1 {
+		t.Errorf("ReferenceCounts = %v, %v", counts, err)
+	}
+
+	// Freshly registered files are protected by the grace period
+	if orphans, err := l.FindOrphans(); err != nil || len(orphans) != 0 {
+		t.Errorf("orphans within the grace period = %v, %v", orphans, err)
+	}
+	OrphanGracePeriod = -time.Minute
+	orphans, err := l.FindOrphans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, m := range orphans {
+		names = append(names, m.Filename)
+	}
+	slices.Sort(names)
+	if !slices.Equal(names, []string{"2_copy.png", "3_unused.png"}) {
+		t.Errorf("orphans = %v, want the duplicate and the unused file", names)
+	}
+
+	deleted, err := l.DeleteOrphans(ctx)
+	if err != nil || len(deleted) != 2 {
+		t.Fatalf("DeleteOrphans = %v, %v", deleted, err)
+	}
+	if _, err := l.store.Stat(ctx, "2_copy.png"); err == nil {
+		t.Error("orphaned file is still stored")
+	}
+	items, err := l.GetAllMedia()
+	if err != nil || len(items) != 2 {
+		t.Errorf("media after cleanup = %+v, %v", items, err)
+	}
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	dbQueryDuration = NewHistogram("db_query_duration_seconds",
+		"Time spent running SQL statements, by kind (exec or query)", DefaultBuckets, "op")
+	dbQueryErrors = NewCounter("db_query_errors_total",
+		"SQL statements that failed, by kind (exec or query)", "op")
+
+	// observedDB is the pool reported by the db_* gauges
+	observedDB atomic.Pointer[sql.DB]
+)
+
+func init() {
+	stat := func(fn func(sql.DBStats) float64) func() float64 {
+		return func() float64 {
+			db := observedDB.Load()
+			if db == nil {
+				return 0
+			}
+			return fn(db.Stats())
+		}
+	}
+	NewGaugeFunc("db_open_connections", "Open database connections",
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	NewGaugeFunc("db_in_use_connections", "Database connections currently in use",
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	NewGaugeFunc("db_idle_connections", "Idle database connections",
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	NewCounterFunc("db_wait_count_total", "Connections waited for because the pool was exhausted",
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	NewCounterFunc("db_wait_duration_seconds_total", "Time spent waiting for a free connection",
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+}
+
+// ObserveDB reports the pool statistics of db in the db_* gauges
+func ObserveDB(db *sql.DB) {
+	observedDB.Store(db)
+}
+
+// InstrumentDriver wraps a driver so every statement is timed in
+// db_query_duration_seconds. Connections that lack the context interfaces
+// go-sqlite3 implements are returned unwrapped.
+func InstrumentDriver(d driver.Driver) driver.Driver {
+	return instrumentedDriver{d}
+}
+
+type instrumentedDriver struct {
+	driver.Driver
+}
+
+func (d instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	inner, ok := conn.(innerConn)
+	if !ok {
+		return conn, nil
+	}
+	return &instrumentedConn{inner}, nil
+}
+
+// innerConn is what instrumented connections delegate to
+type innerConn interface {
+	driver.Conn
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.ConnPrepareContext
+	driver.ConnBeginTx
+	driver.Pinger
+}
+
+type instrumentedConn struct {
+	innerConn
+}
+
+func observeQuery(op string, start time.Time, err error) {
+	dbQueryDuration.Observe(time.Since(start).Seconds(), op)
+	if err != nil && err != driver.ErrSkip {
+		dbQueryErrors.Inc(op)
+	}
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := c.innerConn.ExecContext(ctx, query, args)
+	observeQuery("exec", start, err)
+	return result, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.innerConn.QueryContext(ctx, query, args)
+	observeQuery("query", start, err)
+	return rows, err
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	httpRequests = NewCounter("http_requests_total",
+		"HTTP requests served, by route pattern and status", "method", "route", "status")
+	httpDuration = NewHistogram("http_request_duration_seconds",
+		"Time spent serving HTTP requests, by route pattern", DefaultBuckets, "method", "route")
+)
+
+// Middleware counts and times every request. Requests that match no route
+// are grouped under route "unmatched" so scanners can't create new series.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequests.Inc(method, route, strconv.Itoa(c.Writer.Status()))
+		httpDuration.Observe(time.Since(start).Seconds(), method, route)
+	}
+}
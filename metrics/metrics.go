@@ -0,0 +1,329 @@
+// Package metrics is a small Prometheus client: counters, gauges and
+// histograms registered in a process-wide registry and served in the text
+// exposition format at /metrics.
+//
+// Metrics are declared as package variables next to the code they measure:
+//
+//	var updates = metrics.NewCounter("lottery_feeder_updates_total", "Lottery updates received from the feeder")
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultBuckets are latency buckets in seconds, from 1ms to 10s
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is anything the registry can write
+type metric interface {
+	name() string
+	write(b *strings.Builder)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]metric)
+)
+
+func register(m metric) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[m.name()]; exists {
+		panic("metrics: duplicate metric " + m.name())
+	}
+	registry[m.name()] = m
+}
+
+// Handler serves every registered metric in the Prometheus text format
+func Handler(c *gin.Context) {
+	registryMu.Lock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := make([]metric, len(names))
+	for i, name := range names {
+		metrics[i] = registry[name]
+	}
+	registryMu.Unlock()
+
+	var b strings.Builder
+	for _, m := range metrics {
+		m.write(&b)
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+// desc holds what every metric type shares
+type desc struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+}
+
+func (d *desc) name() string { return d.metricName }
+
+func (d *desc) header(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, d.help, d.metricName, d.kind)
+}
+
+// key joins label values into a map key
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", d.metricName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs formats {a="x",b="y"} for a series key, with extra pairs
+// such as le appended
+func (d *desc) labelPairs(key string, extra ...string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+`="`+escape(value)+`"`)
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+extra[i+1]+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// series is a set of labelled values
+type series struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newSeries(kind, name, help string, labels []string) *series {
+	s := &series{
+		desc:   desc{metricName: name, help: help, kind: kind, labels: labels},
+		values: make(map[string]float64),
+	}
+	// Unlabelled metrics are reported as 0 before their first update
+	if len(labels) == 0 {
+		s.values[""] = 0
+	}
+	register(s)
+	return s
+}
+
+func (s *series) add(delta float64, values []string) {
+	key := s.key(values)
+	s.mu.Lock()
+	s.values[key] += delta
+	s.mu.Unlock()
+}
+
+func (s *series) set(v float64, values []string) {
+	key := s.key(values)
+	s.mu.Lock()
+	s.values[key] = v
+	s.mu.Unlock()
+}
+
+func (s *series) get(values []string) float64 {
+	key := s.key(values)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key]
+}
+
+func (s *series) write(b *strings.Builder) {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	s.header(b)
+	for _, key := range keys {
+		fmt.Fprintf(b, "%s%s %s\n", s.metricName, s.labelPairs(key), formatFloat(s.values[key]))
+	}
+	s.mu.Unlock()
+}
+
+// Counter is a value that only goes up, optionally split by labels
+type Counter struct {
+	s *series
+}
+
+// NewCounter registers a counter. Increments must pass one value per label.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{newSeries("counter", name, help, labels)}
+}
+
+// Inc adds one
+func (c *Counter) Inc(labelValues ...string) {
+	c.s.add(1, labelValues)
+}
+
+// Add adds delta, which must not be negative
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter " + c.s.metricName + " cannot decrease")
+	}
+	c.s.add(delta, labelValues)
+}
+
+// Value returns the current count
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.s.get(labelValues)
+}
+
+// Gauge is a value that can go up and down, optionally split by labels
+type Gauge struct {
+	s *series
+}
+
+// NewGauge registers a gauge
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{newSeries("gauge", name, help, labels)}
+}
+
+// Set replaces the value
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.s.set(v, labelValues)
+}
+
+// Add changes the value by delta
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.s.add(delta, labelValues)
+}
+
+// Value returns the current value
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.s.get(labelValues)
+}
+
+// funcMetric is read from a callback at scrape time
+type funcMetric struct {
+	desc
+	fn func() float64
+}
+
+func (f *funcMetric) write(b *strings.Builder) {
+	f.header(b)
+	fmt.Fprintf(b, "%s %s\n", f.metricName, formatFloat(f.fn()))
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn on each scrape
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(&funcMetric{desc{metricName: name, help: help, kind: "gauge"}, fn})
+}
+
+// NewCounterFunc registers a counter whose value is read from fn on each
+// scrape, for totals kept elsewhere
+func NewCounterFunc(name, help string, fn func() float64) {
+	register(&funcMetric{desc{metricName: name, help: help, kind: "counter"}, fn})
+}
+
+// Histogram counts observations in cumulative buckets, optionally split by
+// labels
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the given upper bounds, which
+// must be sorted. DefaultBuckets suits latencies in seconds.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{metricName: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	register(h)
+	return h
+}
+
+// Observe records one value
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.series[key]
+	if s == nil {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s := h.series[key]; s != nil {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(b *strings.Builder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h.header(b)
+	for _, key := range keys {
+		s := h.series[key]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", h.metricName, h.labelPairs(key, "le", formatFloat(upper)), s.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", h.metricName, h.labelPairs(key, "le", "+Inf"), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", h.metricName, h.labelPairs(key), formatFloat(s.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", h.metricName, h.labelPairs(key), s.count)
+	}
+}
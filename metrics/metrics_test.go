@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExposition(t *testing.T) {
+	requests := NewCounter("test_requests_total", "Requests", "path")
+	requests.Inc(`/a"b`)
+	requests.Add(2, "/c")
+	NewGauge("test_temperature", "Temperature").Set(-1.5)
+	latency := NewHistogram("test_latency_seconds", "Latency", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(3)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	Handler(c)
+
+	for _, want := range []string{
+		"# TYPE test_requests_total counter\n" +
+			`test_requests_total{path="/a\"b"} 1` + "\n" +
+			`test_requests_total{path="/c"} 2` + "\n",
+		"# TYPE test_temperature gauge\ntest_temperature -1.5\n",
+		"# TYPE test_latency_seconds histogram\n" +
+			`test_latency_seconds_bucket{le="0.1"} 1` + "\n" +
+			`test_latency_seconds_bucket{le="1"} 2` + "\n" +
+			`test_latency_seconds_bucket{le="+Inf"} 3` + "\n" +
+			"test_latency_seconds_sum 3.55\n" +
+			"test_latency_seconds_count 3\n",
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("output missing:\n%s\ngot:\n%s", want, w.Body.String())
+		}
+	}
+}
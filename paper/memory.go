@@ -0,0 +1,255 @@
+package paper
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"thaimaster2d/media"
+	"time"
+)
+
+// MemoryRepository is an in-memory PaperRepository for tests
+type MemoryRepository struct {
+	mu          sync.Mutex
+	types       map[int]PaperType
+	images      map[int]PaperImage
+	nextTypeID  int
+	nextImageID int
+}
+
+// NewMemoryRepository returns an empty in-memory repository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		types:       make(map[int]PaperType),
+		images:      make(map[int]PaperImage),
+		nextTypeID:  1,
+		nextImageID: 1,
+	}
+}
+
+func (r *MemoryRepository) sortedTypes() []PaperType {
+	types := make([]PaperType, 0, len(r.types))
+	for _, t := range r.types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if types[i].DisplayOrder != types[j].DisplayOrder {
+			return types[i].DisplayOrder < types[j].DisplayOrder
+		}
+		return types[i].Name < types[j].Name
+	})
+	return types
+}
+
+func (r *MemoryRepository) imagesOf(typeID int, activeOnly bool) []PaperImage {
+	var images []PaperImage
+	for _, img := range r.images {
+		if img.TypeID == typeID && (img.IsActive || !activeOnly) {
+			images = append(images, img)
+		}
+	}
+	sort.Slice(images, func(i, j int) bool {
+		if images[i].DisplayOrder != images[j].DisplayOrder {
+			return images[i].DisplayOrder < images[j].DisplayOrder
+		}
+		return images[i].ID > images[j].ID
+	})
+	return images
+}
+
+// ListActiveTypes returns active types with their active image count
+func (r *MemoryRepository) ListActiveTypes() ([]PaperType, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var types []PaperType
+	for _, t := range r.sortedTypes() {
+		if t.IsActive {
+			t.ImageCount = len(r.imagesOf(t.ID, true))
+			types = append(types, t)
+		}
+	}
+	return types, nil
+}
+
+// ListTypesWithImages returns every type with all of its images
+func (r *MemoryRepository) ListTypesWithImages() ([]PaperTypeWithImages, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var results []PaperTypeWithImages
+	for _, t := range r.sortedTypes() {
+		results = append(results, PaperTypeWithImages{Type: t, Images: r.imagesOf(t.ID, false)})
+	}
+	return results, nil
+}
+
+// ListActiveImages returns the active images of an active type
+func (r *MemoryRepository) ListActiveImages(typeID int) ([]PaperImage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.types[typeID]
+	if !ok || !t.IsActive {
+		return nil, nil
+	}
+	images := r.imagesOf(typeID, true)
+	for i := range images {
+		images[i].TypeName = t.Name
+	}
+	return images, nil
+}
+
+// GetType returns a type with its active image count
+func (r *MemoryRepository) GetType(id int) (*PaperType, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.types[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	t.ImageCount = len(r.imagesOf(id, true))
+	return &t, nil
+}
+
+// GetImage returns an image with its type name
+func (r *MemoryRepository) GetImage(id int) (*PaperImage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	img, ok := r.images[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	img.TypeName = r.types[img.TypeID].Name
+	return &img, nil
+}
+
+// CreateType adds an active type, enforcing unique names
+func (r *MemoryRepository) CreateType(name string, displayOrder int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range r.types {
+		if t.Name == name {
+			return 0, fmt.Errorf("paper type %q already exists", name)
+		}
+	}
+
+	now := time.Now()
+	t := PaperType{ID: r.nextTypeID, Name: name, DisplayOrder: displayOrder, IsActive: true, CreatedAt: now, UpdatedAt: now}
+	r.types[t.ID] = t
+	r.nextTypeID++
+	return int64(t.ID), nil
+}
+
+// UpdateType updates a type's editable fields
+func (r *MemoryRepository) UpdateType(t PaperType) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.types[t.ID]
+	if !ok {
+		return nil
+	}
+	existing.Name = t.Name
+	existing.DisplayOrder = t.DisplayOrder
+	existing.IsActive = t.IsActive
+	existing.UpdatedAt = time.Now()
+	r.types[t.ID] = existing
+	return nil
+}
+
+// DeleteType removes a type and its images
+func (r *MemoryRepository) DeleteType(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.types, id)
+	for imageID, img := range r.images {
+		if img.TypeID == id {
+			delete(r.images, imageID)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) addImage(typeID int, url media.Link, displayOrder int) (int, error) {
+	if _, ok := r.types[typeID]; !ok {
+		return 0, fmt.Errorf("paper type %d does not exist", typeID)
+	}
+
+	now := time.Now()
+	img := PaperImage{ID: r.nextImageID, TypeID: typeID, ImageURL: url, DisplayOrder: displayOrder, IsActive: true, CreatedAt: now, UpdatedAt: now}
+	r.images[img.ID] = img
+	r.nextImageID++
+	return img.ID, nil
+}
+
+// CreateImage adds an active image
+func (r *MemoryRepository) CreateImage(img PaperImage) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, err := r.addImage(img.TypeID, img.ImageURL, img.DisplayOrder)
+	return int64(id), err
+}
+
+// CreateImages adds several images in order, all or nothing
+func (r *MemoryRepository) CreateImages(typeID int, urls []media.Link) ([]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.types[typeID]; !ok {
+		return nil, fmt.Errorf("paper type %d does not exist", typeID)
+	}
+
+	var ids []int
+	for i, url := range urls {
+		id, _ := r.addImage(typeID, url, i)
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// UpdateImage updates an image's editable fields
+func (r *MemoryRepository) UpdateImage(img PaperImage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.images[img.ID]
+	if !ok {
+		return nil
+	}
+	existing.TypeID = img.TypeID
+	existing.ImageURL = img.ImageURL
+	existing.DisplayOrder = img.DisplayOrder
+	existing.IsActive = img.IsActive
+	existing.UpdatedAt = time.Now()
+	r.images[img.ID] = existing
+	return nil
+}
+
+// DeleteImage removes an image
+func (r *MemoryRepository) DeleteImage(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.images, id)
+	return nil
+}
+
+// NextDisplayOrder returns the display order after the last image of a type
+func (r *MemoryRepository) NextDisplayOrder(typeID int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order := 0
+	for _, img := range r.images {
+		if img.TypeID == typeID && img.DisplayOrder > order {
+			order = img.DisplayOrder
+		}
+	}
+	return order + 1
+}
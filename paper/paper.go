@@ -1,15 +1,15 @@
 package paper
 
 import (
-	"database/sql"
 	"net/http"
+	"strconv"
+	"thaimaster2d/events"
+	"thaimaster2d/media"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-var db *sql.DB
-
 type PaperType struct {
 	ID           int       `json:"id"`
 	Name         string    `json:"name"`
@@ -21,14 +21,14 @@ type PaperType struct {
 }
 
 type PaperImage struct {
-	ID           int       `json:"id"`
-	TypeID       int       `json:"type_id"`
-	TypeName     string    `json:"type_name,omitempty"`
-	ImageURL     string    `json:"image_url"`
-	DisplayOrder int       `json:"display_order"`
-	IsActive     bool      `json:"is_active"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           int        `json:"id"`
+	TypeID       int        `json:"type_id"`
+	TypeName     string     `json:"type_name,omitempty"`
+	ImageURL     media.Link `json:"image_url"`
+	DisplayOrder int        `json:"display_order"`
+	IsActive     bool       `json:"is_active"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
 type PaperTypeWithImages struct {
@@ -36,184 +36,76 @@ type PaperTypeWithImages struct {
 	Images []PaperImage `json:"images"`
 }
 
-func InitDB(database *sql.DB) {
-	db = database
-	createTables()
+// ImagesAdded is the data of a paper.updated event
+type ImagesAdded struct {
+	TypeID   int    `json:"type_id"`
+	TypeName string `json:"type_name"`
+	Count    int    `json:"count"`
 }
 
-func createTables() {
-	// Enable foreign keys
-	_, err := db.Exec(`PRAGMA foreign_keys = ON`)
-	if err != nil {
-		panic("Failed to enable foreign keys: " + err.Error())
-	}
+// Handler serves the paper API
+type Handler struct {
+	repo PaperRepository
+}
 
-	// Create paper_types table
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS paper_types (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL UNIQUE,
-			display_order INTEGER NOT NULL DEFAULT 0,
-			is_active INTEGER NOT NULL DEFAULT 1,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
-		panic("Failed to create paper_types table: " + err.Error())
-	}
+// NewHandler creates a paper handler backed by repo
+func NewHandler(repo PaperRepository) *Handler {
+	return &Handler{repo: repo}
+}
 
-	// Create paper_images table
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS paper_images (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			type_id INTEGER NOT NULL REFERENCES paper_types(id) ON DELETE CASCADE,
-			image_url TEXT NOT NULL,
-			display_order INTEGER NOT NULL DEFAULT 0,
-			is_active INTEGER NOT NULL DEFAULT 1,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
+// paramID parses a numeric path parameter, replying 400 if it isn't one
+func paramID(c *gin.Context, name string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(name))
 	if err != nil {
-		panic("Failed to create paper_images table: " + err.Error())
-	}
-
-	// Create indexes
-	db.Exec(`CREATE INDEX IF NOT EXISTS idx_paper_images_type_id ON paper_images(type_id)`)
-	db.Exec(`CREATE INDEX IF NOT EXISTS idx_paper_images_display_order ON paper_images(display_order)`)
-	db.Exec(`CREATE INDEX IF NOT EXISTS idx_paper_types_display_order ON paper_types(display_order)`)
-
-	// Insert sample data if table is empty
-	var count int
-	db.QueryRow("SELECT COUNT(*) FROM paper_types").Scan(&count)
-	if count == 0 {
-		db.Exec(`
-			INSERT INTO paper_types (name, display_order) VALUES
-			('Myanmar News', 1),
-			('Thailand News', 2),
-			('International', 3)
-		`)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return 0, false
 	}
+	return id, true
 }
 
 // Get all paper types with image count
-func GetAllTypes(c *gin.Context) {
-	rows, err := db.Query(`
-		SELECT pt.id, pt.name, pt.display_order, pt.is_active, pt.created_at, pt.updated_at,
-		       COALESCE(COUNT(pi.id), 0) as image_count
-		FROM paper_types pt
-		LEFT JOIN paper_images pi ON pt.id = pi.type_id AND pi.is_active = 1
-		WHERE pt.is_active = 1
-		GROUP BY pt.id, pt.name, pt.display_order, pt.is_active, pt.created_at, pt.updated_at
-		ORDER BY pt.display_order ASC, pt.name ASC
-	`)
+func (h *Handler) GetAllTypes(c *gin.Context) {
+	types, err := h.repo.ListActiveTypes()
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
-
-	var types []PaperType
-	for rows.Next() {
-		var t PaperType
-		if err := rows.Scan(&t.ID, &t.Name, &t.DisplayOrder, &t.IsActive, &t.CreatedAt, &t.UpdatedAt, &t.ImageCount); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		types = append(types, t)
-	}
 
 	c.JSON(http.StatusOK, types)
 }
 
 // Get all paper types with their images (for admin)
-func GetAllTypesWithImages(c *gin.Context) {
-	// Get all types
-	typeRows, err := db.Query(`
-		SELECT id, name, display_order, is_active, created_at, updated_at
-		FROM paper_types
-		ORDER BY display_order ASC, name ASC
-	`)
+func (h *Handler) GetAllTypesWithImages(c *gin.Context) {
+	results, err := h.repo.ListTypesWithImages()
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer typeRows.Close()
-
-	var results []PaperTypeWithImages
-	for typeRows.Next() {
-		var t PaperType
-		if err := typeRows.Scan(&t.ID, &t.Name, &t.DisplayOrder, &t.IsActive, &t.CreatedAt, &t.UpdatedAt); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		// Get images for this type
-		imageRows, err := db.Query(`
-			SELECT id, type_id, image_url, display_order, is_active, created_at, updated_at
-			FROM paper_images
-			WHERE type_id = ?
-			ORDER BY display_order ASC, created_at DESC
-		`, t.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		var images []PaperImage
-		for imageRows.Next() {
-			var img PaperImage
-			if err := imageRows.Scan(&img.ID, &img.TypeID, &img.ImageURL, &img.DisplayOrder, &img.IsActive, &img.CreatedAt, &img.UpdatedAt); err != nil {
-				imageRows.Close()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-			images = append(images, img)
-		}
-		imageRows.Close()
-
-		results = append(results, PaperTypeWithImages{
-			Type:   t,
-			Images: images,
-		})
-	}
 
 	c.JSON(http.StatusOK, results)
 }
 
 // Get images by type ID
-func GetImagesByType(c *gin.Context) {
-	typeID := c.Param("type_id")
-
-	rows, err := db.Query(`
-		SELECT pi.id, pi.type_id, pt.name, pi.image_url, pi.display_order, pi.is_active, pi.created_at, pi.updated_at
-		FROM paper_images pi
-		JOIN paper_types pt ON pi.type_id = pt.id
-		WHERE pi.type_id = ? AND pi.is_active = 1 AND pt.is_active = 1
-		ORDER BY pi.display_order ASC, pi.created_at DESC
-	`, typeID)
+func (h *Handler) GetImagesByType(c *gin.Context) {
+	typeID, ok := paramID(c, "type_id")
+	if !ok {
+		return
+	}
+
+	images, err := h.repo.ListActiveImages(typeID)
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
-
-	var images []PaperImage
-	for rows.Next() {
-		var img PaperImage
-		if err := rows.Scan(&img.ID, &img.TypeID, &img.TypeName, &img.ImageURL, &img.DisplayOrder, &img.IsActive, &img.CreatedAt, &img.UpdatedAt); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		images = append(images, img)
-	}
 
 	c.JSON(http.StatusOK, images)
 }
 
 // Create paper type
-func CreateType(c *gin.Context) {
+func (h *Handler) CreateType(c *gin.Context) {
 	var input struct {
 		Name         string `json:"name" binding:"required"`
 		DisplayOrder int    `json:"display_order"`
@@ -224,18 +116,9 @@ func CreateType(c *gin.Context) {
 		return
 	}
 
-	result, err := db.Exec(`
-		INSERT INTO paper_types (name, display_order, is_active, created_at, updated_at)
-		VALUES (?, ?, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-	`, input.Name, input.DisplayOrder)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	id, err := result.LastInsertId()
+	id, err := h.repo.CreateType(input.Name, input.DisplayOrder)
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -244,8 +127,11 @@ func CreateType(c *gin.Context) {
 }
 
 // Update paper type
-func UpdateType(c *gin.Context) {
-	id := c.Param("id")
+func (h *Handler) UpdateType(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
 	var input struct {
 		Name         string `json:"name"`
 		DisplayOrder int    `json:"display_order"`
@@ -257,13 +143,14 @@ func UpdateType(c *gin.Context) {
 		return
 	}
 
-	_, err := db.Exec(`
-		UPDATE paper_types
-		SET name = ?, display_order = ?, is_active = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE id = ?
-	`, input.Name, input.DisplayOrder, input.IsActive, id)
-
+	err := h.repo.UpdateType(PaperType{
+		ID:           id,
+		Name:         input.Name,
+		DisplayOrder: input.DisplayOrder,
+		IsActive:     input.IsActive,
+	})
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -272,11 +159,14 @@ func UpdateType(c *gin.Context) {
 }
 
 // Delete paper type
-func DeleteType(c *gin.Context) {
-	id := c.Param("id")
+func (h *Handler) DeleteType(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
 
-	_, err := db.Exec("DELETE FROM paper_types WHERE id = ?", id)
-	if err != nil {
+	if err := h.repo.DeleteType(id); err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -285,11 +175,11 @@ func DeleteType(c *gin.Context) {
 }
 
 // Create paper image
-func CreateImage(c *gin.Context) {
+func (h *Handler) CreateImage(c *gin.Context) {
 	var input struct {
-		TypeID       int    `json:"type_id" binding:"required"`
-		ImageURL     string `json:"image_url" binding:"required"`
-		DisplayOrder int    `json:"display_order"`
+		TypeID       int        `json:"type_id" binding:"required"`
+		ImageURL     media.Link `json:"image_url" binding:"required"`
+		DisplayOrder int        `json:"display_order"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -297,33 +187,32 @@ func CreateImage(c *gin.Context) {
 		return
 	}
 
-	result, err := db.Exec(`
-		INSERT INTO paper_images (type_id, image_url, display_order, is_active, created_at, updated_at)
-		VALUES (?, ?, ?, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-	`, input.TypeID, input.ImageURL, input.DisplayOrder)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	id, err := result.LastInsertId()
+	id, err := h.repo.CreateImage(PaperImage{
+		TypeID:       input.TypeID,
+		ImageURL:     input.ImageURL,
+		DisplayOrder: input.DisplayOrder,
+	})
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	h.announceImages(c, input.TypeID, 1)
 	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Paper image created successfully"})
 }
 
 // Update paper image
-func UpdateImage(c *gin.Context) {
-	id := c.Param("id")
+func (h *Handler) UpdateImage(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
 	var input struct {
-		TypeID       int    `json:"type_id"`
-		ImageURL     string `json:"image_url"`
-		DisplayOrder int    `json:"display_order"`
-		IsActive     bool   `json:"is_active"`
+		TypeID       int        `json:"type_id"`
+		ImageURL     media.Link `json:"image_url"`
+		DisplayOrder int        `json:"display_order"`
+		IsActive     bool       `json:"is_active"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -331,13 +220,15 @@ func UpdateImage(c *gin.Context) {
 		return
 	}
 
-	_, err := db.Exec(`
-		UPDATE paper_images
-		SET type_id = ?, image_url = ?, display_order = ?, is_active = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE id = ?
-	`, input.TypeID, input.ImageURL, input.DisplayOrder, input.IsActive, id)
-
+	err := h.repo.UpdateImage(PaperImage{
+		ID:           id,
+		TypeID:       input.TypeID,
+		ImageURL:     input.ImageURL,
+		DisplayOrder: input.DisplayOrder,
+		IsActive:     input.IsActive,
+	})
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -346,11 +237,14 @@ func UpdateImage(c *gin.Context) {
 }
 
 // Delete paper image
-func DeleteImage(c *gin.Context) {
-	id := c.Param("id")
+func (h *Handler) DeleteImage(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
 
-	_, err := db.Exec("DELETE FROM paper_images WHERE id = ?", id)
-	if err != nil {
+	if err := h.repo.DeleteImage(id); err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -359,10 +253,10 @@ func DeleteImage(c *gin.Context) {
 }
 
 // Batch create images
-func BatchCreateImages(c *gin.Context) {
+func (h *Handler) BatchCreateImages(c *gin.Context) {
 	var input struct {
-		TypeID    int      `json:"type_id" binding:"required"`
-		ImageURLs []string `json:"image_urls" binding:"required"`
+		TypeID    int          `json:"type_id" binding:"required"`
+		ImageURLs []media.Link `json:"image_urls" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -370,39 +264,14 @@ func BatchCreateImages(c *gin.Context) {
 		return
 	}
 
-	tx, err := db.Begin()
+	insertedIDs, err := h.repo.CreateImages(input.TypeID, input.ImageURLs)
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	var insertedIDs []int
-	for i, url := range input.ImageURLs {
-		result, err := tx.Exec(`
-			INSERT INTO paper_images (type_id, image_url, display_order, is_active, created_at, updated_at)
-			VALUES (?, ?, ?, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-		`, input.TypeID, url, i)
-
-		if err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		id, err := result.LastInsertId()
-		if err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		insertedIDs = append(insertedIDs, int(id))
-	}
-
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
+	h.announceImages(c, input.TypeID, len(insertedIDs))
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Images created successfully",
 		"count":   len(insertedIDs),
@@ -410,55 +279,11 @@ func BatchCreateImages(c *gin.Context) {
 	})
 }
 
-// Get type by ID
-func GetTypeByID(id string) (*PaperType, error) {
-	var t PaperType
-	err := db.QueryRow(`
-		SELECT id, name, display_order, is_active, created_at, updated_at
-		FROM paper_types
-		WHERE id = ?
-	`, id).Scan(&t.ID, &t.Name, &t.DisplayOrder, &t.IsActive, &t.CreatedAt, &t.UpdatedAt)
-
-	if err != nil {
-		return nil, err
-	}
-
-	// Get image count
-	db.QueryRow(`
-		SELECT COUNT(*) FROM paper_images WHERE type_id = ? AND is_active = 1
-	`, id).Scan(&t.ImageCount)
-
-	return &t, nil
-}
-
-// Get image by ID
-func GetImageByID(id string) (*PaperImage, error) {
-	var img PaperImage
-	err := db.QueryRow(`
-		SELECT pi.id, pi.type_id, pt.name, pi.image_url, pi.display_order, pi.is_active, pi.created_at, pi.updated_at
-		FROM paper_images pi
-		JOIN paper_types pt ON pi.type_id = pt.id
-		WHERE pi.id = ?
-	`, id).Scan(&img.ID, &img.TypeID, &img.TypeName, &img.ImageURL, &img.DisplayOrder, &img.IsActive, &img.CreatedAt, &img.UpdatedAt)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &img, nil
-}
-
-// Get next display order for type
-func GetNextDisplayOrder(typeID int) int {
-	var order int
-	err := db.QueryRow(`
-		SELECT COALESCE(MAX(display_order), 0) + 1
-		FROM paper_images
-		WHERE type_id = ?
-	`, typeID).Scan(&order)
-
-	if err != nil {
-		return 1
+// announceImages publishes a paper.updated event for new images
+func (h *Handler) announceImages(c *gin.Context, typeID, count int) {
+	added := ImagesAdded{TypeID: typeID, Count: count}
+	if t, err := h.repo.GetType(typeID); err == nil {
+		added.TypeName = t.Name
 	}
-	return order
+	events.Publish(c.Request.Context(), events.PaperUpdated, added)
 }
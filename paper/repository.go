@@ -0,0 +1,359 @@
+package paper
+
+import (
+	"database/sql"
+	"errors"
+	"thaimaster2d/media"
+)
+
+// ErrNotFound is returned when a paper type or image doesn't exist
+var ErrNotFound = errors.New("paper not found")
+
+// PaperRepository stores paper types and their images
+type PaperRepository interface {
+	// ListActiveTypes returns active types with their active image count
+	ListActiveTypes() ([]PaperType, error)
+	// ListTypesWithImages returns every type with all of its images
+	ListTypesWithImages() ([]PaperTypeWithImages, error)
+	// ListActiveImages returns the active images of an active type
+	ListActiveImages(typeID int) ([]PaperImage, error)
+	GetType(id int) (*PaperType, error)
+	GetImage(id int) (*PaperImage, error)
+	CreateType(name string, displayOrder int) (int64, error)
+	UpdateType(t PaperType) error
+	// DeleteType removes a type and its images
+	DeleteType(id int) error
+	CreateImage(img PaperImage) (int64, error)
+	// CreateImages adds several images in order, all or nothing
+	CreateImages(typeID int, urls []media.Link) ([]int, error)
+	UpdateImage(img PaperImage) error
+	DeleteImage(id int) error
+	// NextDisplayOrder returns the display order after the last image of a type
+	NextDisplayOrder(typeID int) int
+}
+
+// SQLRepository is a PaperRepository backed by the paper_types and
+// paper_images tables
+type SQLRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository creates the paper tables and sample types if needed
+func NewSQLRepository(db *sql.DB) *SQLRepository {
+	r := &SQLRepository{db: db}
+	r.createTables()
+	return r
+}
+
+func (r *SQLRepository) createTables() {
+	db := r.db
+
+	// Enable foreign keys
+	_, err := db.Exec(`PRAGMA foreign_keys = ON`)
+	if err != nil {
+		panic("Failed to enable foreign keys: " + err.Error())
+	}
+
+	// Create paper_types table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS paper_types (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			display_order INTEGER NOT NULL DEFAULT 0,
+			is_active INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		panic("Failed to create paper_types table: " + err.Error())
+	}
+
+	// Create paper_images table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS paper_images (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			type_id INTEGER NOT NULL REFERENCES paper_types(id) ON DELETE CASCADE,
+			image_url TEXT NOT NULL,
+			display_order INTEGER NOT NULL DEFAULT 0,
+			is_active INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		panic("Failed to create paper_images table: " + err.Error())
+	}
+
+	// Create indexes
+	db.Exec(`CREATE INDEX IF NOT EXISTS idx_paper_images_type_id ON paper_images(type_id)`)
+	db.Exec(`CREATE INDEX IF NOT EXISTS idx_paper_images_display_order ON paper_images(display_order)`)
+	db.Exec(`CREATE INDEX IF NOT EXISTS idx_paper_types_display_order ON paper_types(display_order)`)
+
+	// Insert sample data if table is empty
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM paper_types").Scan(&count)
+	if count == 0 {
+		db.Exec(`
+			INSERT INTO paper_types (name, display_order) VALUES
+			('Myanmar News', 1),
+			('Thailand News', 2),
+			('International', 3)
+		`)
+	}
+}
+
+// ListActiveTypes returns active paper types with image count
+func (r *SQLRepository) ListActiveTypes() ([]PaperType, error) {
+	rows, err := r.db.Query(`
+		SELECT pt.id, pt.name, pt.display_order, pt.is_active, pt.created_at, pt.updated_at,
+		       COALESCE(COUNT(pi.id), 0) as image_count
+		FROM paper_types pt
+		LEFT JOIN paper_images pi ON pt.id = pi.type_id AND pi.is_active = 1
+		WHERE pt.is_active = 1
+		GROUP BY pt.id, pt.name, pt.display_order, pt.is_active, pt.created_at, pt.updated_at
+		ORDER BY pt.display_order ASC, pt.name ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var types []PaperType
+	for rows.Next() {
+		var t PaperType
+		if err := rows.Scan(&t.ID, &t.Name, &t.DisplayOrder, &t.IsActive, &t.CreatedAt, &t.UpdatedAt, &t.ImageCount); err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+
+	return types, rows.Err()
+}
+
+// ListTypesWithImages returns all paper types with their images (for admin)
+func (r *SQLRepository) ListTypesWithImages() ([]PaperTypeWithImages, error) {
+	// Get all types
+	typeRows, err := r.db.Query(`
+		SELECT id, name, display_order, is_active, created_at, updated_at
+		FROM paper_types
+		ORDER BY display_order ASC, name ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	var types []PaperType
+	for typeRows.Next() {
+		var t PaperType
+		if err := typeRows.Scan(&t.ID, &t.Name, &t.DisplayOrder, &t.IsActive, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			typeRows.Close()
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	typeRows.Close()
+
+	var results []PaperTypeWithImages
+	for _, t := range types {
+		// Get images for this type
+		imageRows, err := r.db.Query(`
+			SELECT id, type_id, image_url, display_order, is_active, created_at, updated_at
+			FROM paper_images
+			WHERE type_id = ?
+			ORDER BY display_order ASC, created_at DESC
+		`, t.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		var images []PaperImage
+		for imageRows.Next() {
+			var img PaperImage
+			if err := imageRows.Scan(&img.ID, &img.TypeID, &img.ImageURL, &img.DisplayOrder, &img.IsActive, &img.CreatedAt, &img.UpdatedAt); err != nil {
+				imageRows.Close()
+				return nil, err
+			}
+			images = append(images, img)
+		}
+		imageRows.Close()
+
+		results = append(results, PaperTypeWithImages{
+			Type:   t,
+			Images: images,
+		})
+	}
+
+	return results, nil
+}
+
+// ListActiveImages returns the active images of an active type
+func (r *SQLRepository) ListActiveImages(typeID int) ([]PaperImage, error) {
+	rows, err := r.db.Query(`
+		SELECT pi.id, pi.type_id, pt.name, pi.image_url, pi.display_order, pi.is_active, pi.created_at, pi.updated_at
+		FROM paper_images pi
+		JOIN paper_types pt ON pi.type_id = pt.id
+		WHERE pi.type_id = ? AND pi.is_active = 1 AND pt.is_active = 1
+		ORDER BY pi.display_order ASC, pi.created_at DESC
+	`, typeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []PaperImage
+	for rows.Next() {
+		var img PaperImage
+		if err := rows.Scan(&img.ID, &img.TypeID, &img.TypeName, &img.ImageURL, &img.DisplayOrder, &img.IsActive, &img.CreatedAt, &img.UpdatedAt); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+
+	return images, rows.Err()
+}
+
+// GetType returns a paper type with its active image count
+func (r *SQLRepository) GetType(id int) (*PaperType, error) {
+	var t PaperType
+	err := r.db.QueryRow(`
+		SELECT id, name, display_order, is_active, created_at, updated_at
+		FROM paper_types
+		WHERE id = ?
+	`, id).Scan(&t.ID, &t.Name, &t.DisplayOrder, &t.IsActive, &t.CreatedAt, &t.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Get image count
+	r.db.QueryRow(`
+		SELECT COUNT(*) FROM paper_images WHERE type_id = ? AND is_active = 1
+	`, id).Scan(&t.ImageCount)
+
+	return &t, nil
+}
+
+// GetImage returns a paper image with its type name
+func (r *SQLRepository) GetImage(id int) (*PaperImage, error) {
+	var img PaperImage
+	err := r.db.QueryRow(`
+		SELECT pi.id, pi.type_id, pt.name, pi.image_url, pi.display_order, pi.is_active, pi.created_at, pi.updated_at
+		FROM paper_images pi
+		JOIN paper_types pt ON pi.type_id = pt.id
+		WHERE pi.id = ?
+	`, id).Scan(&img.ID, &img.TypeID, &img.TypeName, &img.ImageURL, &img.DisplayOrder, &img.IsActive, &img.CreatedAt, &img.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &img, nil
+}
+
+// CreateType adds an active paper type
+func (r *SQLRepository) CreateType(name string, displayOrder int) (int64, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO paper_types (name, display_order, is_active, created_at, updated_at)
+		VALUES (?, ?, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, name, displayOrder)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateType updates a paper type
+func (r *SQLRepository) UpdateType(t PaperType) error {
+	_, err := r.db.Exec(`
+		UPDATE paper_types
+		SET name = ?, display_order = ?, is_active = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, t.Name, t.DisplayOrder, t.IsActive, t.ID)
+	return err
+}
+
+// DeleteType deletes a paper type, cascading to its images
+func (r *SQLRepository) DeleteType(id int) error {
+	_, err := r.db.Exec("DELETE FROM paper_types WHERE id = ?", id)
+	return err
+}
+
+// CreateImage adds an active paper image
+func (r *SQLRepository) CreateImage(img PaperImage) (int64, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO paper_images (type_id, image_url, display_order, is_active, created_at, updated_at)
+		VALUES (?, ?, ?, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, img.TypeID, img.ImageURL, img.DisplayOrder)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// CreateImages adds images in a single transaction, ordered as given
+func (r *SQLRepository) CreateImages(typeID int, urls []media.Link) ([]int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	var insertedIDs []int
+	for i, url := range urls {
+		result, err := tx.Exec(`
+			INSERT INTO paper_images (type_id, image_url, display_order, is_active, created_at, updated_at)
+			VALUES (?, ?, ?, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		`, typeID, url, i)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		insertedIDs = append(insertedIDs, int(id))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return insertedIDs, nil
+}
+
+// UpdateImage updates a paper image
+func (r *SQLRepository) UpdateImage(img PaperImage) error {
+	_, err := r.db.Exec(`
+		UPDATE paper_images
+		SET type_id = ?, image_url = ?, display_order = ?, is_active = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, img.TypeID, img.ImageURL, img.DisplayOrder, img.IsActive, img.ID)
+	return err
+}
+
+// DeleteImage deletes a paper image
+func (r *SQLRepository) DeleteImage(id int) error {
+	_, err := r.db.Exec("DELETE FROM paper_images WHERE id = ?", id)
+	return err
+}
+
+// NextDisplayOrder returns the next display order for a type
+func (r *SQLRepository) NextDisplayOrder(typeID int) int {
+	var order int
+	err := r.db.QueryRow(`
+		SELECT COALESCE(MAX(display_order), 0) + 1
+		FROM paper_images
+		WHERE type_id = ?
+	`, typeID).Scan(&order)
+
+	if err != nil {
+		return 1
+	}
+	return order
+}
@@ -0,0 +1,57 @@
+package paper
+
+import (
+	"errors"
+	"net/http"
+	"thaimaster2d/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListTypesV2 handles GET /api/v2/paper/types with pagination
+func (h *Handler) ListTypesV2(c *gin.Context) {
+	page, ok := api.ParsePage(c)
+	if !ok {
+		return
+	}
+
+	types, err := h.repo.ListActiveTypes()
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to fetch paper types")
+		return
+	}
+
+	api.Paginate(c, types, page)
+}
+
+// ListImagesV2 handles GET /api/v2/paper/types/:type_id/images with pagination
+func (h *Handler) ListImagesV2(c *gin.Context) {
+	typeID, ok := api.ParamID(c, "type_id")
+	if !ok {
+		return
+	}
+	page, ok := api.ParsePage(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.repo.GetType(typeID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			api.Error(c, http.StatusNotFound, api.CodeNotFound, "Paper type not found")
+		} else {
+			c.Error(err)
+			api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to fetch paper type")
+		}
+		return
+	}
+
+	images, err := h.repo.ListActiveImages(typeID)
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to fetch paper images")
+		return
+	}
+
+	api.Paginate(c, images, page)
+}
@@ -0,0 +1,176 @@
+package points
+
+import (
+	"errors"
+	"net/http"
+	"thaimaster2d/api"
+	"thaimaster2d/appuser"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler serves the points and redemption API. Every route runs behind
+// appuser's RequireUser.
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a handler for service
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// earnError replies to a reward that couldn't be given
+func earnError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrAlreadyEarned):
+		api.Error(c, http.StatusConflict, api.CodeConflict, "Points already earned")
+	case errors.Is(err, ErrDisabled):
+		api.Error(c, http.StatusNotFound, api.CodeNotFound, "This reward is not available")
+	case errors.Is(err, ErrInvalidReferral):
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "Invalid referral code")
+	case errors.Is(err, ErrReferralClosed):
+		api.Error(c, http.StatusConflict, api.CodeConflict, "Referral codes can only be entered in the first days after signing up")
+	case errors.Is(err, ErrUnknownDraw):
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "draw must be morning or evening")
+	case errors.Is(err, ErrDrawClosed):
+		api.Error(c, http.StatusConflict, api.CodeConflict, "This draw can't be watched now")
+	case errors.Is(err, ErrVerificationRequired):
+		api.Error(c, http.StatusForbidden, api.CodeForbidden, "Verify your phone number first")
+	default:
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to add points")
+	}
+}
+
+// earned replies with a new ledger entry and the balance after it
+func (h *Handler) earned(c *gin.Context, entry *Entry, err error) {
+	if err != nil {
+		earnError(c, err)
+		return
+	}
+	total, err := h.service.Repository().Balance(appuser.Current(c).ID)
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to fetch balance")
+		return
+	}
+	api.OK(c, http.StatusCreated, gin.H{"entry": entry, "balance": total})
+}
+
+// GetV2 handles GET /api/v2/points
+func (h *Handler) GetV2(c *gin.Context) {
+	u := appuser.Current(c)
+	total, err := h.service.Repository().Balance(u.ID)
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to fetch balance")
+		return
+	}
+	checkedIn, err := h.service.CheckedIn(u.ID)
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to fetch balance")
+		return
+	}
+	api.OK(c, http.StatusOK, gin.H{
+		"balance":       total,
+		"referral_code": ReferralCode(u.ID),
+		"checked_in":    checkedIn,
+	})
+}
+
+// LedgerV2 handles GET /api/v2/points/ledger
+func (h *Handler) LedgerV2(c *gin.Context) {
+	page, ok := api.ParsePage(c)
+	if !ok {
+		return
+	}
+	entries, total, err := h.service.Repository().Ledger(appuser.Current(c).ID, page.PerPage, page.Offset())
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to fetch points history")
+		return
+	}
+	api.List(c, entries, page, total)
+}
+
+// CheckinV2 handles POST /api/v2/points/checkin
+func (h *Handler) CheckinV2(c *gin.Context) {
+	entry, err := h.service.Checkin(c.Request.Context(), appuser.Current(c).ID)
+	h.earned(c, entry, err)
+}
+
+// WatchV2 handles POST /api/v2/points/watch
+func (h *Handler) WatchV2(c *gin.Context) {
+	var input struct {
+		Draw string `json:"draw"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+	entry, err := h.service.Watch(c.Request.Context(), appuser.Current(c).ID, input.Draw)
+	h.earned(c, entry, err)
+}
+
+// ReferralV2 handles POST /api/v2/points/referral
+func (h *Handler) ReferralV2(c *gin.Context) {
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+	if input.Code == "" {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "code is required")
+		return
+	}
+	entry, err := h.service.Refer(c.Request.Context(), appuser.Current(c), input.Code)
+	h.earned(c, entry, err)
+}
+
+// RedeemV2 handles POST /api/v2/gifts/:id/redeem
+func (h *Handler) RedeemV2(c *gin.Context) {
+	id, ok := api.ParamID(c, "id")
+	if !ok {
+		return
+	}
+
+	redemption, err := h.service.Redeem(c.Request.Context(), appuser.Current(c), id)
+	switch {
+	case errors.Is(err, ErrVerificationRequired):
+		api.Error(c, http.StatusForbidden, api.CodeForbidden, "Verify your phone number first")
+	case errors.Is(err, ErrGiftUnavailable):
+		api.Error(c, http.StatusNotFound, api.CodeNotFound, "Gift not found")
+	case errors.Is(err, ErrOutOfStock):
+		api.Error(c, http.StatusConflict, api.CodeConflict, "Gift is out of stock")
+	case errors.Is(err, ErrAlreadyClaimed):
+		api.Error(c, http.StatusConflict, api.CodeConflict, "Gift already claimed in this period")
+	case errors.Is(err, ErrLimitReached):
+		api.Error(c, http.StatusConflict, api.CodeConflict, "Gift redemption limit reached")
+	case errors.Is(err, ErrInsufficientPoints):
+		api.Error(c, http.StatusConflict, api.CodeConflict, "Not enough points")
+	case err != nil:
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to redeem gift")
+	default:
+		api.OK(c, http.StatusCreated, redemption)
+	}
+}
+
+// RedemptionsV2 handles GET /api/v2/redemptions
+func (h *Handler) RedemptionsV2(c *gin.Context) {
+	page, ok := api.ParsePage(c)
+	if !ok {
+		return
+	}
+	redemptions, total, err := h.service.Repository().ListRedemptions(appuser.Current(c).ID, "", page.PerPage, page.Offset())
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to fetch redemptions")
+		return
+	}
+	api.List(c, redemptions, page, total)
+}
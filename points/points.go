@@ -0,0 +1,304 @@
+// Package points keeps the ledger of points app users earn from daily
+// check-ins, watching draws and referrals, and spend on gifts. Daily gifts
+// can be claimed once per day and weekly gifts once per ISO week.
+package points
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"thaimaster2d/alert"
+	"thaimaster2d/appuser"
+	"thaimaster2d/gift"
+	"thaimaster2d/metrics"
+	"time"
+)
+
+var (
+	// ErrDisabled is returned when a reward is set to 0 points
+	ErrDisabled = errors.New("this reward is turned off")
+	// ErrInvalidReferral is returned for an unknown or own referral code,
+	// or the code of a user this user referred
+	ErrInvalidReferral = errors.New("invalid referral code")
+	// ErrReferralClosed is returned when a user enters a referral code
+	// after the referral window
+	ErrReferralClosed = errors.New("referral codes can only be entered soon after signing up")
+	// ErrUnknownDraw is returned for a draw that isn't in Options.Draws
+	ErrUnknownDraw = errors.New("unknown draw")
+	// ErrDrawClosed is returned when a draw isn't held today or watching
+	// it is outside its watch window
+	ErrDrawClosed = errors.New("this draw can't be watched now")
+	// ErrVerificationRequired is returned when an anonymous user tries
+	// something that needs a verified phone number
+	ErrVerificationRequired = errors.New("verify your phone number first")
+)
+
+// Draws users can earn points for watching
+const (
+	DrawMorning = "morning"
+	DrawEvening = "evening"
+)
+
+// DefaultDraws are the times of the 2D draws as offsets from midnight
+var DefaultDraws = map[string]time.Duration{
+	DrawMorning: 12*time.Hour + time.Minute,
+	DrawEvening: 16*time.Hour + 30*time.Minute,
+}
+
+const (
+	// DefaultWatchWindow is how long before and after a draw watching it
+	// counts
+	DefaultWatchWindow = 30 * time.Minute
+	// DefaultReferralWindow is how long after signing up users can enter
+	// a referral code
+	DefaultReferralWindow = 7 * 24 * time.Hour
+)
+
+var (
+	awarded = metrics.NewCounter("points_awarded_total",
+		"Points earned by reason (checkin, watch, referral or referred)", "reason")
+	redemptions = metrics.NewCounter("gift_redemptions_total",
+		"Gift redemptions by result (redeemed, fulfilled or rejected)", "result")
+)
+
+// referralPrefix starts every referral code
+const referralPrefix = "TM"
+
+// ReferralCode returns the code a user shares to refer friends
+func ReferralCode(userID int) string {
+	return referralPrefix + strings.ToUpper(strconv.FormatInt(int64(userID), 36))
+}
+
+// parseReferralCode returns the user ID of a referral code
+func parseReferralCode(code string) (int, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !strings.HasPrefix(code, referralPrefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(code[len(referralPrefix):], 36, 32)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return int(id), true
+}
+
+// Options sets the rewards. A reward of 0 turns it off.
+type Options struct {
+	Checkin int
+	Watch   int
+	// Referral is given to both the referrer and the new user
+	Referral int
+	// ReferralWindow is how long after signing up users can enter a
+	// referral code, DefaultReferralWindow if 0
+	ReferralWindow time.Duration
+	// Draws are the times of the draws users can earn points for
+	// watching, by name, as offsets from midnight. DefaultDraws if empty.
+	Draws map[string]time.Duration
+	// DrawDays are the weekdays with draws, every day if empty
+	DrawDays []time.Weekday
+	// WatchWindow is how long before and after a draw watching it counts,
+	// DefaultWatchWindow if 0
+	WatchWindow time.Duration
+	// Location is the timezone days and weeks start in
+	Location *time.Location
+	// Alerts is told when redemptions bring a gift down to its low-stock
+	// threshold or out of stock, nil to not alert
+	Alerts alert.Sink
+}
+
+// Service awards points and redeems gifts
+type Service struct {
+	repo  Repository
+	users appuser.Repository
+	opts  Options
+	now   func() time.Time
+}
+
+// NewService returns a service storing the ledger in repo. users is used to
+// look up referrers.
+func NewService(repo Repository, users appuser.Repository, opts Options) *Service {
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if opts.ReferralWindow <= 0 {
+		opts.ReferralWindow = DefaultReferralWindow
+	}
+	if len(opts.Draws) == 0 {
+		opts.Draws = DefaultDraws
+	}
+	if opts.WatchWindow <= 0 {
+		opts.WatchWindow = DefaultWatchWindow
+	}
+	return &Service{repo: repo, users: users, opts: opts, now: time.Now}
+}
+
+// Repository returns the ledger store
+func (s *Service) Repository() Repository {
+	return s.repo
+}
+
+// today returns the current date in the configured timezone
+func (s *Service) today() string {
+	return s.now().In(s.opts.Location).Format("2006-01-02")
+}
+
+// Period returns the claim window of a category period at t: the ISO week
+// for weekly categories and the date for every other one
+func Period(period string, t time.Time) string {
+	if period == gift.PeriodWeekly {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	return t.Format("2006-01-02")
+}
+
+// award adds a single reward to the ledger
+func (s *Service) award(ctx context.Context, userID, amount int, reason, ref string) (*Entry, error) {
+	if amount <= 0 {
+		return nil, ErrDisabled
+	}
+	entry := Entry{UserID: userID, Amount: amount, Reason: reason, Ref: ref}
+	if err := s.repo.Earn(entry); err != nil {
+		return nil, err
+	}
+	awarded.Add(float64(amount), reason)
+	slog.InfoContext(ctx, "points awarded", "user_id", userID, "reason", reason, "ref", ref, "amount", amount)
+	return &entry, nil
+}
+
+// CheckedIn reports whether the user has checked in today
+func (s *Service) CheckedIn(userID int) (bool, error) {
+	return s.repo.Earned(userID, ReasonCheckin, s.today())
+}
+
+// Checkin awards the daily check-in, once per day
+func (s *Service) Checkin(ctx context.Context, userID int) (*Entry, error) {
+	return s.award(ctx, userID, s.opts.Checkin, ReasonCheckin, s.today())
+}
+
+// Watch awards watching one of today's draws, once per draw
+func (s *Service) Watch(ctx context.Context, userID int, draw string) (*Entry, error) {
+	if err := s.drawOpen(draw, s.now()); err != nil {
+		return nil, err
+	}
+	return s.award(ctx, userID, s.opts.Watch, ReasonWatch, s.today()+" "+draw)
+}
+
+// drawOpen checks that draw is held on the day of now and that now is in
+// its watch window
+func (s *Service) drawOpen(draw string, now time.Time) error {
+	at, ok := s.opts.Draws[draw]
+	if !ok {
+		return ErrUnknownDraw
+	}
+	local := now.In(s.opts.Location)
+	if len(s.opts.DrawDays) > 0 && !slices.Contains(s.opts.DrawDays, local.Weekday()) {
+		return ErrDrawClosed
+	}
+	year, month, day := local.Date()
+	drawTime := time.Date(year, month, day, 0, 0, 0, 0, s.opts.Location).Add(at)
+	if local.Before(drawTime.Add(-s.opts.WatchWindow)) || local.After(drawTime.Add(s.opts.WatchWindow)) {
+		return ErrDrawClosed
+	}
+	return nil
+}
+
+// Refer credits the owner of a referral code and the new user. Each user
+// can be referred once, only after verifying their phone number and within
+// the referral window after signing up. Users can't refer each other back.
+func (s *Service) Refer(ctx context.Context, u *appuser.User, code string) (*Entry, error) {
+	if s.opts.Referral <= 0 {
+		return nil, ErrDisabled
+	}
+	if u.Anonymous {
+		return nil, ErrVerificationRequired
+	}
+	if s.now().After(u.CreatedAt.Add(s.opts.ReferralWindow)) {
+		return nil, ErrReferralClosed
+	}
+	referrerID, ok := parseReferralCode(code)
+	if !ok || referrerID == u.ID {
+		return nil, ErrInvalidReferral
+	}
+	if _, err := s.users.Get(referrerID); err != nil {
+		if errors.Is(err, appuser.ErrNotFound) {
+			return nil, ErrInvalidReferral
+		}
+		return nil, err
+	}
+	// The referrer was referred by this user
+	referredBack, err := s.repo.Earned(u.ID, ReasonReferral, strconv.Itoa(referrerID))
+	if err != nil {
+		return nil, err
+	}
+	if referredBack {
+		return nil, ErrInvalidReferral
+	}
+
+	entry := Entry{UserID: u.ID, Amount: s.opts.Referral, Reason: ReasonReferred}
+	err = s.repo.Earn(entry, Entry{
+		UserID: referrerID,
+		Amount: s.opts.Referral,
+		Reason: ReasonReferral,
+		Ref:    strconv.Itoa(u.ID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	awarded.Add(float64(s.opts.Referral), ReasonReferred)
+	awarded.Add(float64(s.opts.Referral), ReasonReferral)
+	slog.InfoContext(ctx, "referral credited", "user_id", u.ID, "referrer_id", referrerID, "amount", s.opts.Referral)
+	return &entry, nil
+}
+
+// Redeem spends points on a gift. Gifts are delivered by hand, so only
+// users with a verified phone number can redeem them.
+func (s *Service) Redeem(ctx context.Context, u *appuser.User, giftID int) (*Redemption, error) {
+	if u.Anonymous {
+		return nil, ErrVerificationRequired
+	}
+	redemption, err := s.repo.Redeem(u.ID, giftID, s.now().In(s.opts.Location))
+	if err != nil {
+		return nil, err
+	}
+	redemptions.Inc("redeemed")
+	slog.InfoContext(ctx, "gift redeemed", "user_id", u.ID, "gift_id", giftID,
+		"redemption_id", redemption.ID, "points", redemption.Points)
+	s.checkStock(redemption)
+	return redemption, nil
+}
+
+// checkStock alerts admins when a redemption took its gift's stock past the
+// low-stock threshold or took the last one
+func (s *Service) checkStock(rd *Redemption) {
+	g := gift.Gift{ID: rd.GiftID, Name: rd.GiftName, Stock: rd.StockLeft, LowStockThreshold: rd.LowStockThreshold}
+	if a := gift.StockAlert(g, rd.StockLeft+1, s.now()); a != nil {
+		alert.Notify(s.opts.Alerts, *a)
+	}
+}
+
+// Fulfill marks a redemption delivered
+func (s *Service) Fulfill(ctx context.Context, id int, note string) (*Redemption, error) {
+	redemption, err := s.repo.Fulfill(id, note)
+	if err != nil {
+		return nil, err
+	}
+	redemptions.Inc(StatusFulfilled)
+	slog.InfoContext(ctx, "redemption fulfilled", "redemption_id", id)
+	return redemption, nil
+}
+
+// Reject cancels a redemption and refunds it
+func (s *Service) Reject(ctx context.Context, id int, note string) (*Redemption, error) {
+	redemption, err := s.repo.Reject(id, note)
+	if err != nil {
+		return nil, err
+	}
+	redemptions.Inc(StatusRejected)
+	slog.InfoContext(ctx, "redemption rejected", "redemption_id", id, "refunded", redemption.Points)
+	return redemption, nil
+}
@@ -0,0 +1,81 @@
+package points
+
+import (
+	"context"
+	"testing"
+	"thaimaster2d/appuser"
+	"time"
+)
+
+func TestPeriod(t *testing.T) {
+	for _, tc := range []struct {
+		period string
+		date   string
+		want   string
+	}{
+		{"daily", "2026-10-18", "2026-10-18"},
+		{"weekly", "2026-10-18", "2026-W42"},
+		{"weekly", "2026-10-19", "2026-W43"},
+		// The first days of January can belong to the last week of the year before
+		{"weekly", "2027-01-01", "2026-W53"},
+	} {
+		day, _ := time.Parse("2006-01-02", tc.date)
+		if got := Period(tc.period, day); got != tc.want {
+			t.Errorf("Period(%s, %s) = %s, want %s", tc.period, tc.date, got, tc.want)
+		}
+	}
+}
+
+func TestReferralCode(t *testing.T) {
+	for _, id := range []int{1, 35, 36, 123456} {
+		code := ReferralCode(id)
+		if got, ok := parseReferralCode(code); !ok || got != id {
+			t.Errorf("parseReferralCode(%q) = %d, %v; want %d", code, got, ok, id)
+		}
+	}
+	if got, ok := parseReferralCode(" tm1a "); !ok || got != 46 {
+		t.Errorf("lowercase code = %d, %v; want 46", got, ok)
+	}
+	for _, code := range []string{"", "TM", "XY12", "TM-1", "TM0"} {
+		if _, ok := parseReferralCode(code); ok {
+			t.Errorf("parseReferralCode(%q) accepted", code)
+		}
+	}
+}
+
+func TestDrawOpen(t *testing.T) {
+	yangon := time.FixedZone("Asia/Yangon", 6*3600+1800)
+	s := NewService(nil, nil, Options{Location: yangon, DrawDays: []time.Weekday{time.Monday, time.Friday}})
+	for _, tc := range []struct {
+		draw string
+		at   string
+		want error
+	}{
+		{"morning", "2026-10-19 12:01", nil},
+		{"morning", "2026-10-19 11:31", nil},
+		{"morning", "2026-10-19 12:31", nil},
+		{"morning", "2026-10-19 11:30", ErrDrawClosed},
+		{"morning", "2026-10-19 12:32", ErrDrawClosed},
+		{"evening", "2026-10-23 16:45", nil},
+		{"evening", "2026-10-23 12:01", ErrDrawClosed},
+		// No draws on Sundays
+		{"morning", "2026-10-18 12:01", ErrDrawClosed},
+		{"noon", "2026-10-19 12:01", ErrUnknownDraw},
+	} {
+		at, _ := time.ParseInLocation("2006-01-02 15:04", tc.at, yangon)
+		if err := s.drawOpen(tc.draw, at.UTC()); err != tc.want {
+			t.Errorf("drawOpen(%s, %s) = %v, want %v", tc.draw, tc.at, err, tc.want)
+		}
+	}
+}
+
+func TestReferralWindow(t *testing.T) {
+	s := NewService(nil, nil, Options{Referral: 50, ReferralWindow: 24 * time.Hour})
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	u := &appuser.User{ID: 2, CreatedAt: now.Add(-25 * time.Hour)}
+	if _, err := s.Refer(context.Background(), u, ReferralCode(1)); err != ErrReferralClosed {
+		t.Errorf("Refer after the window = %v, want ErrReferralClosed", err)
+	}
+}
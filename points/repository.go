@@ -0,0 +1,447 @@
+package points
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"thaimaster2d/gift"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a redemption doesn't exist
+	ErrNotFound = errors.New("redemption not found")
+	// ErrAlreadyEarned is returned when a reward was already given
+	ErrAlreadyEarned = errors.New("points already earned")
+	// ErrGiftUnavailable is returned when a gift doesn't exist or is inactive
+	ErrGiftUnavailable = errors.New("gift not available")
+	// ErrOutOfStock is returned when a gift has no stock left
+	ErrOutOfStock = errors.New("gift out of stock")
+	// ErrAlreadyClaimed is returned when the user already claimed the gift
+	// in the current claim window
+	ErrAlreadyClaimed = errors.New("gift already claimed")
+	// ErrLimitReached is returned when the user redeemed the gift as often
+	// as its per-user limit allows
+	ErrLimitReached = errors.New("gift redemption limit reached")
+	// ErrInsufficientPoints is returned when the balance doesn't cover a gift
+	ErrInsufficientPoints = errors.New("not enough points")
+	// ErrNotPending is returned when a redemption was already handled
+	ErrNotPending = errors.New("redemption is not pending")
+)
+
+// Ledger entry reasons
+const (
+	ReasonCheckin    = "checkin"
+	ReasonWatch      = "watch"
+	ReasonReferral   = "referral"
+	ReasonReferred   = "referred"
+	ReasonRedemption = "redemption"
+	ReasonRefund     = "refund"
+)
+
+// Redemption statuses
+const (
+	StatusPending   = "pending"
+	StatusFulfilled = "fulfilled"
+	StatusRejected  = "rejected"
+)
+
+// Statuses lists the redemption statuses in the order admins handle them
+var Statuses = []string{StatusPending, StatusFulfilled, StatusRejected}
+
+// Entry is one change to a user's balance. Ref identifies what was earned
+// or spent, e.g. the check-in date or the redemption ID, so nothing is
+// counted twice.
+type Entry struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	Amount    int       `json:"amount"`
+	Reason    string    `json:"reason"`
+	Ref       string    `json:"ref"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Redemption is a gift claimed with points
+type Redemption struct {
+	ID       int    `json:"id"`
+	UserID   int    `json:"-"`
+	GiftID   int    `json:"gift_id"`
+	GiftName string `json:"gift_name"`
+	Points   int    `json:"points"`
+	// Period is the claim window the gift was claimed in, the date for
+	// daily gifts and the ISO week for weekly ones
+	Period    string    `json:"period"`
+	Status    string    `json:"status"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// UserPhone is filled in for the admin queue
+	UserPhone string `json:"-"`
+	// StockLeft and LowStockThreshold describe the gift after the claim,
+	// filled in by Redeem for stock alerts
+	StockLeft         int `json:"-"`
+	LowStockThreshold int `json:"-"`
+}
+
+// Repository stores the points ledger and gift redemptions
+type Repository interface {
+	// Balance returns the sum of a user's ledger
+	Balance(userID int) (int, error)
+	// Earn adds entries all at once, or returns ErrAlreadyEarned and adds
+	// none if any of them was already given
+	Earn(entries ...Entry) error
+	// Earned reports whether the user has an entry for reason and ref
+	Earned(userID int, reason, ref string) (bool, error)
+	// Ledger returns up to limit entries after offset, newest first, and
+	// the total number of entries
+	Ledger(userID, limit, offset int) ([]Entry, int, error)
+	// Redeem claims a gift at now: it takes one from stock, checks the
+	// gift is on offer, the claim window of its category, the per-user
+	// limit and the balance, and spends the points, in one transaction
+	Redeem(userID, giftID int, now time.Time) (*Redemption, error)
+	// ListRedemptions returns up to limit redemptions after offset, newest
+	// first, of one user unless userID is 0 and with one status unless
+	// status is empty, and the total number
+	ListRedemptions(userID int, status string, limit, offset int) ([]Redemption, int, error)
+	// Fulfill marks a pending redemption delivered
+	Fulfill(id int, note string) (*Redemption, error)
+	// Reject cancels a pending redemption, refunding the points and
+	// returning the gift to stock
+	Reject(id int, note string) (*Redemption, error)
+}
+
+// SQLRepository is a Repository backed by the points_ledger and
+// gift_redemptions tables
+type SQLRepository struct {
+	db *sql.DB
+	// mu serializes ledger writes so concurrent claims don't fail with a
+	// locked database
+	mu sync.Mutex
+}
+
+// NewSQLRepository creates the points tables if needed
+func NewSQLRepository(db *sql.DB) *SQLRepository {
+	r := &SQLRepository{db: db}
+	r.createTables()
+	return r
+}
+
+func (r *SQLRepository) createTables() {
+	query := `
+		CREATE TABLE IF NOT EXISTS points_ledger (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			amount INTEGER NOT NULL,
+			reason TEXT NOT NULL,
+			ref TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (user_id, reason, ref)
+		);
+		CREATE TABLE IF NOT EXISTS gift_redemptions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			gift_id INTEGER NOT NULL,
+			gift_name TEXT NOT NULL,
+			points INTEGER NOT NULL,
+			period TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			note TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_gift_redemptions_user ON gift_redemptions(user_id, gift_id, period);
+		CREATE INDEX IF NOT EXISTS idx_gift_redemptions_status ON gift_redemptions(status, id);
+	`
+	if _, err := r.db.Exec(query); err != nil {
+		slog.Error("failed to create points tables", "error", err)
+	}
+}
+
+// querier is a *sql.DB or *sql.Tx
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func balance(q querier, userID int) (int, error) {
+	var total int
+	err := q.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM points_ledger WHERE user_id = $1", userID).Scan(&total)
+	return total, err
+}
+
+// Balance sums the ledger of a user
+func (r *SQLRepository) Balance(userID int) (int, error) {
+	return balance(r.db, userID)
+}
+
+// Earn inserts ledger entries in one transaction
+func (r *SQLRepository) Earn(entries ...Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, e := range entries {
+		result, err := tx.Exec(`
+			INSERT INTO points_ledger (user_id, amount, reason, ref) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, reason, ref) DO NOTHING`, e.UserID, e.Amount, e.Reason, e.Ref)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrAlreadyEarned
+		}
+	}
+	return tx.Commit()
+}
+
+// Earned looks up a ledger entry
+func (r *SQLRepository) Earned(userID int, reason, ref string) (bool, error) {
+	var n int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM points_ledger WHERE user_id = $1 AND reason = $2 AND ref = $3",
+		userID, reason, ref).Scan(&n)
+	return n > 0, err
+}
+
+// Ledger pages through the entries of a user
+func (r *SQLRepository) Ledger(userID, limit, offset int) ([]Entry, int, error) {
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM points_ledger WHERE user_id = $1", userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := r.db.Query(`
+		SELECT id, user_id, amount, reason, ref, created_at FROM points_ledger
+		WHERE user_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Amount, &e.Reason, &e.Ref, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+const redemptionColumns = `r.id, r.user_id, r.gift_id, r.gift_name, r.points, r.period, r.status, r.note,
+	r.created_at, r.updated_at, COALESCE(u.phone, '')`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRedemption(row scanner) (*Redemption, error) {
+	var rd Redemption
+	err := row.Scan(&rd.ID, &rd.UserID, &rd.GiftID, &rd.GiftName, &rd.Points, &rd.Period, &rd.Status, &rd.Note,
+		&rd.CreatedAt, &rd.UpdatedAt, &rd.UserPhone)
+	if err != nil {
+		return nil, err
+	}
+	return &rd, nil
+}
+
+func getRedemption(q querier, id int) (*Redemption, error) {
+	rd, err := scanRedemption(q.QueryRow(`SELECT `+redemptionColumns+`
+		FROM gift_redemptions r LEFT JOIN app_users u ON u.id = r.user_id
+		WHERE r.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return rd, err
+}
+
+// Redeem claims a gift in one transaction
+func (r *SQLRepository) Redeem(userID, giftID int, now time.Time) (*Redemption, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Taking the gift from stock first locks the database for the rest of
+	// the transaction
+	var g gift.Gift
+	err = tx.QueryRow(`
+		UPDATE gifts SET stock = stock - 1
+		WHERE id = $1 AND is_active = 1 AND stock > 0
+		RETURNING name, type, points, stock, starts_at, ends_at, per_user_limit, low_stock_threshold`,
+		giftID).Scan(&g.Name, &g.Type, &g.Points, &g.Stock, &g.StartsAt, &g.EndsAt, &g.PerUserLimit, &g.LowStockThreshold)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow("SELECT is_active, starts_at, ends_at FROM gifts WHERE id = $1", giftID).
+			Scan(&g.IsActive, &g.StartsAt, &g.EndsAt)
+		if err == sql.ErrNoRows || (err == nil && !g.Available(now)) {
+			return nil, ErrGiftUnavailable
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrOutOfStock
+	}
+	if err != nil {
+		return nil, err
+	}
+	g.IsActive = true
+	if !g.Available(now) {
+		return nil, ErrGiftUnavailable
+	}
+
+	period := gift.PeriodDaily
+	err = tx.QueryRow("SELECT period FROM gift_categories WHERE name = $1", g.Type).Scan(&period)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	window := Period(period, now)
+	var claimed, total int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE period = $1), COUNT(*) FROM gift_redemptions
+		WHERE user_id = $2 AND gift_id = $3 AND status != 'rejected'`,
+		window, userID, giftID).Scan(&claimed, &total)
+	if err != nil {
+		return nil, err
+	}
+	if g.PerUserLimit > 0 && total >= g.PerUserLimit {
+		return nil, ErrLimitReached
+	}
+	if claimed > 0 {
+		return nil, ErrAlreadyClaimed
+	}
+
+	have, err := balance(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if have < g.Points {
+		return nil, ErrInsufficientPoints
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO gift_redemptions (user_id, gift_id, gift_name, points, period)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`, userID, giftID, g.Name, g.Points, window).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec("INSERT INTO points_ledger (user_id, amount, reason, ref) VALUES ($1, $2, $3, $4)",
+		userID, -g.Points, ReasonRedemption, strconv.Itoa(id))
+	if err != nil {
+		return nil, err
+	}
+	redemption, err := getRedemption(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	redemption.StockLeft, redemption.LowStockThreshold = g.Stock, g.LowStockThreshold
+	return redemption, tx.Commit()
+}
+
+// ListRedemptions pages through redemptions
+func (r *SQLRepository) ListRedemptions(userID int, status string, limit, offset int) ([]Redemption, int, error) {
+	where := " WHERE ($1 = 0 OR r.user_id = $1) AND ($2 = '' OR r.status = $2)"
+	var total int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM gift_redemptions r"+where, userID, status).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Pending claims are handled oldest first, the rest are history
+	order := " ORDER BY r.id DESC"
+	if status == StatusPending {
+		order = " ORDER BY r.id"
+	}
+	rows, err := r.db.Query(`SELECT `+redemptionColumns+`
+		FROM gift_redemptions r LEFT JOIN app_users u ON u.id = r.user_id`+where+order+" LIMIT $3 OFFSET $4",
+		userID, status, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var redemptions []Redemption
+	for rows.Next() {
+		rd, err := scanRedemption(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		redemptions = append(redemptions, *rd)
+	}
+	return redemptions, total, rows.Err()
+}
+
+// setStatus moves a pending redemption to status
+func setStatus(tx *sql.Tx, id int, status, note string) error {
+	result, err := tx.Exec(`
+		UPDATE gift_redemptions SET status = $1, note = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND status = 'pending'`, status, note, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := getRedemption(tx, id); err != nil {
+			return err
+		}
+		return ErrNotPending
+	}
+	return nil
+}
+
+// Fulfill marks a redemption fulfilled
+func (r *SQLRepository) Fulfill(id int, note string) (*Redemption, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := setStatus(tx, id, StatusFulfilled, note); err != nil {
+		return nil, err
+	}
+	redemption, err := getRedemption(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	return redemption, tx.Commit()
+}
+
+// Reject marks a redemption rejected, refunds it and restocks the gift
+func (r *SQLRepository) Reject(id int, note string) (*Redemption, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := setStatus(tx, id, StatusRejected, note); err != nil {
+		return nil, err
+	}
+	redemption, err := getRedemption(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec("INSERT INTO points_ledger (user_id, amount, reason, ref) VALUES ($1, $2, $3, $4)",
+		redemption.UserID, redemption.Points, ReasonRefund, strconv.Itoa(id))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE gifts SET stock = stock + 1 WHERE id = $1", redemption.GiftID); err != nil {
+		return nil, err
+	}
+	return redemption, tx.Commit()
+}
@@ -0,0 +1,217 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultFCMURL is the FCM HTTP v1 API
+const DefaultFCMURL = "https://fcm.googleapis.com"
+
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// FCM sends through the Firebase Cloud Messaging HTTP v1 API, or a
+// compatible server, authenticating with a service account
+type FCM struct {
+	ProjectID   string
+	ClientEmail string
+	TokenURL    string
+	// BaseURL is DefaultFCMURL unless pointed at a compatible server
+	BaseURL string
+	Client  *http.Client
+
+	key *rsa.PrivateKey
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+// serviceAccount is the part of a Google service account key file FCM needs
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	PrivateKey  string `json:"private_key"`
+	ClientEmail string `json:"client_email"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// LoadFCM reads a service account key file downloaded from the Firebase
+// console
+func LoadFCM(path, baseURL string) (*FCM, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FCM credentials: %w", err)
+	}
+	return NewFCM(data, baseURL)
+}
+
+// NewFCM builds a sender from service account key JSON
+func NewFCM(credentials []byte, baseURL string) (*FCM, error) {
+	var sa serviceAccount
+	if err := json.Unmarshal(credentials, &sa); err != nil {
+		return nil, fmt.Errorf("invalid FCM credentials: %w", err)
+	}
+	if sa.ProjectID == "" || sa.ClientEmail == "" || sa.PrivateKey == "" || sa.TokenURI == "" {
+		return nil, errors.New("FCM credentials need project_id, client_email, private_key and token_uri")
+	}
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, errors.New("FCM credentials: private_key is not PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("FCM credentials: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("FCM credentials: private_key is not an RSA key")
+	}
+	if baseURL == "" {
+		baseURL = DefaultFCMURL
+	}
+	return &FCM{
+		ProjectID:   sa.ProjectID,
+		ClientEmail: sa.ClientEmail,
+		TokenURL:    sa.TokenURI,
+		BaseURL:     strings.TrimSuffix(baseURL, "/"),
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		key:         key,
+	}, nil
+}
+
+// Send implements Sender
+func (f *FCM) Send(ctx context.Context, token string, msg Message) error {
+	accessToken, err := f.token(ctx)
+	if err != nil {
+		return fmt.Errorf("FCM auth: %w", err)
+	}
+	body, _ := json.Marshal(map[string]any{
+		"message": map[string]any{
+			"token":        token,
+			"notification": map[string]string{"title": msg.Title, "body": msg.Body},
+			"data":         msg.Data,
+			"android":      map[string]string{"priority": "high"},
+		},
+	})
+	endpoint := f.BaseURL + "/v1/projects/" + url.PathEscape(f.ProjectID) + "/messages:send"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var failure struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&failure)
+	if resp.StatusCode == http.StatusUnauthorized {
+		f.mu.Lock()
+		f.accessToken = ""
+		f.mu.Unlock()
+	}
+	for _, detail := range failure.Error.Details {
+		if detail.ErrorCode == "UNREGISTERED" {
+			return ErrInvalidToken
+		}
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrInvalidToken
+	}
+	return fmt.Errorf("FCM returned %s: %s %s", resp.Status, failure.Error.Status, failure.Error.Message)
+}
+
+// token returns a cached OAuth access token, fetching a new one with a
+// signed JWT assertion when it is about to expire
+func (f *FCM) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	if f.accessToken != "" && now.Before(f.expiry.Add(-time.Minute)) {
+		return f.accessToken, nil
+	}
+
+	assertion, err := f.assertion(now)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	var grant struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&grant); err != nil || grant.AccessToken == "" {
+		return "", fmt.Errorf("invalid token response: %v", err)
+	}
+	f.accessToken = grant.AccessToken
+	f.expiry = now.Add(time.Duration(grant.ExpiresIn) * time.Second)
+	return f.accessToken, nil
+}
+
+// assertion is the RS256 JWT exchanged for an access token
+func (f *FCM) assertion(now time.Time) (string, error) {
+	encode := func(v any) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	unsigned := encode(map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + encode(map[string]any{
+		"iss":   f.ClientEmail,
+		"scope": fcmScope,
+		"aud":   f.TokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(nil, f.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,113 @@
+package push
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFCM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokenFetches atomic.Int32
+	var got struct {
+		Message struct {
+			Token        string            `json:"token"`
+			Notification map[string]string `json:"notification"`
+			Data         map[string]string `json:"data"`
+		} `json:"message"`
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		tokenFetches.Add(1)
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("grant_type = %q", r.FormValue("grant_type"))
+		}
+		// The assertion is signed with the service account key
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if len(parts) != 3 {
+			t.Fatalf("assertion = %q", r.FormValue("assertion"))
+		}
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			t.Errorf("assertion signature: %v", err)
+		}
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		if !strings.Contains(string(claims), `"iss":"sender@demo.iam.gserviceaccount.com"`) {
+			t.Errorf("claims = %s", claims)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "access-1", "expires_in": 3600})
+	})
+	mux.HandleFunc("POST /v1/projects/demo/messages:send", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-1" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		switch got.Message.Token {
+		case "gone":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":404,"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":{"code":500,"status":"INTERNAL","message":"try again"}}`))
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	credentials, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "demo",
+		"client_email": "sender@demo.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    srv.URL + "/token",
+	})
+	fcm, err := NewFCM(credentials, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	msg := Message{Title: "12:01 PM 2D Result", Body: "67", Data: map[string]string{"result": "67"}}
+	if err := fcm.Send(ctx, "device-1", msg); err != nil {
+		t.Fatal(err)
+	}
+	if got.Message.Token != "device-1" || got.Message.Notification["title"] != msg.Title || got.Message.Data["result"] != "67" {
+		t.Errorf("message = %+v", got.Message)
+	}
+
+	// The access token is reused, unregistered devices are reported
+	if err := fcm.Send(ctx, "gone", msg); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("unregistered token error = %v, want ErrInvalidToken", err)
+	}
+	if err := fcm.Send(ctx, "broken", msg); err == nil || !strings.Contains(err.Error(), "try again") {
+		t.Errorf("server error = %v", err)
+	}
+	if n := tokenFetches.Load(); n != 1 {
+		t.Errorf("token fetched %d times, want 1", n)
+	}
+
+	if _, err := NewFCM([]byte(`{"project_id":"demo"}`), ""); err == nil {
+		t.Error("incomplete credentials accepted")
+	}
+}
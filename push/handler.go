@@ -0,0 +1,84 @@
+package push
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"thaimaster2d/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Platforms devices can register from
+var Platforms = []string{"android", "ios", "web"}
+
+// Handler serves the device registration API
+type Handler struct {
+	repo Repository
+}
+
+// NewHandler creates a push handler backed by repo
+func NewHandler(repo Repository) *Handler {
+	return &Handler{repo: repo}
+}
+
+// RegisterV2 handles POST /api/v2/push/devices. Registering a known token
+// replaces its platform and topics. Without topics the device gets all of
+// them.
+func (h *Handler) RegisterV2(c *gin.Context) {
+	var input struct {
+		Token    string    `json:"token"`
+		Platform string    `json:"platform"`
+		Topics   *[]string `json:"topics"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+	if input.Token == "" || len(input.Token) > 4096 {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "token is required")
+		return
+	}
+	if !slices.Contains(Platforms, input.Platform) {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "platform must be android, ios or web")
+		return
+	}
+	topics := Topics
+	if input.Topics != nil {
+		topics = *input.Topics
+	}
+	for _, topic := range topics {
+		if !slices.Contains(Topics, topic) {
+			api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "unknown topic "+topic)
+			return
+		}
+	}
+
+	device, created, err := h.repo.Register(&Device{Token: input.Token, Platform: input.Platform, Topics: topics})
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to register device")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	api.OK(c, status, device)
+}
+
+// UnregisterV2 handles DELETE /api/v2/push/devices/:token
+func (h *Handler) UnregisterV2(c *gin.Context) {
+	err := h.repo.Unregister(c.Param("token"))
+	if errors.Is(err, ErrNotFound) {
+		api.Error(c, http.StatusNotFound, api.CodeNotFound, "Device not registered")
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to unregister device")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,239 @@
+// Package push sends result notifications to the registered app devices.
+// Devices subscribe to topics, and events from the bus are turned into
+// messages for the matching topic and handed to a Sender such as FCM.
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"thaimaster2d/events"
+	"thaimaster2d/live"
+	"thaimaster2d/metrics"
+	"thaimaster2d/paper"
+	"thaimaster2d/threed"
+)
+
+// Topics devices can subscribe to
+const (
+	TopicMorning = "2d_morning"
+	TopicEvening = "2d_evening"
+	TopicThreeD  = "3d"
+	TopicPaper   = "paper"
+)
+
+// Topics lists every topic, in the order apps show them
+var Topics = []string{TopicMorning, TopicEvening, TopicThreeD, TopicPaper}
+
+// ErrInvalidToken is returned by a Sender when the device token is no longer
+// valid, e.g. the app was uninstalled. The device is then removed.
+var ErrInvalidToken = errors.New("device token is no longer valid")
+
+var notifications = metrics.NewCounter("push_notifications_total",
+	"Push notifications by topic and result (sent, failed or invalid)", "topic", "result")
+
+// Message is a notification shown on the device. Data is passed to the app.
+type Message struct {
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// Sender delivers a message to one device
+type Sender interface {
+	Send(ctx context.Context, token string, msg Message) error
+}
+
+// Sent is a message recorded by Fake
+type Sent struct {
+	Token string
+	Message
+}
+
+// Fake is a Sender that logs and records messages instead of sending them,
+// for tests and local development
+type Fake struct {
+	mu   sync.Mutex
+	sent []Sent
+	// Invalid tokens are rejected with ErrInvalidToken
+	Invalid map[string]bool
+}
+
+// NewFake returns an empty fake sender
+func NewFake() *Fake {
+	return &Fake{Invalid: make(map[string]bool)}
+}
+
+// Send implements Sender
+func (f *Fake) Send(ctx context.Context, token string, msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Invalid[token] {
+		return ErrInvalidToken
+	}
+	f.sent = append(f.sent, Sent{Token: token, Message: msg})
+	slog.InfoContext(ctx, "push notification (fake sender)", "title", msg.Title, "body", msg.Body)
+	return nil
+}
+
+// Sent returns the messages sent so far
+func (f *Fake) Sent() []Sent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Sent(nil), f.sent...)
+}
+
+// Result counts the outcome of a broadcast
+type Result struct {
+	Sent   int
+	Failed int
+	// Removed is the number of devices dropped for an invalid token
+	Removed int
+}
+
+type job struct {
+	topic string
+	msg   Message
+}
+
+// Dispatcher turns events into notifications and broadcasts them to the
+// subscribed devices
+type Dispatcher struct {
+	repo   Repository
+	sender Sender
+	queue  chan job
+}
+
+// NewDispatcher returns a dispatcher sending through sender. With a nil
+// sender devices can still register but nothing is sent.
+func NewDispatcher(repo Repository, sender Sender) *Dispatcher {
+	return &Dispatcher{repo: repo, sender: sender, queue: make(chan job, 100)}
+}
+
+// Repository returns the device store
+func (d *Dispatcher) Repository() Repository {
+	return d.repo
+}
+
+// Enabled reports whether a sender is configured
+func (d *Dispatcher) Enabled() bool {
+	return d.sender != nil
+}
+
+// Handle is an events.Handler queuing a notification for the events apps
+// are notified of
+func (d *Dispatcher) Handle(ctx context.Context, e events.Event) {
+	if d.sender == nil {
+		return
+	}
+	topic, msg, ok := message(e)
+	if !ok {
+		return
+	}
+	select {
+	case d.queue <- job{topic: topic, msg: msg}:
+	default:
+		slog.WarnContext(ctx, "push queue full, notification dropped", "topic", topic, "event", e.Type)
+	}
+}
+
+// message returns the notification for an event, if apps are notified of it
+func message(e events.Event) (string, Message, bool) {
+	data := map[string]string{"event": e.Type}
+	switch v := e.Data.(type) {
+	case live.ResultEvent:
+		topic, title := TopicMorning, "12:01 PM 2D Result"
+		if e.Type == events.ResultEvening {
+			topic, title = TopicEvening, "4:30 PM 2D Result"
+		}
+		data["date"], data["result"] = v.Date, v.Result
+		return topic, Message{
+			Title: title,
+			Body:  fmt.Sprintf("%s · SET %s · Value %s", v.Result, v.Set, v.Value),
+			Data:  data,
+		}, true
+	case *threed.ThreeDResult:
+		if e.Type != events.ThreeDCreated {
+			return "", Message{}, false
+		}
+		data["date"], data["result"] = v.Date, v.Result
+		return TopicThreeD, Message{
+			Title: "3D Result",
+			Body:  fmt.Sprintf("The 3D result for %s is %s", v.Date, v.Result),
+			Data:  data,
+		}, true
+	case paper.ImagesAdded:
+		name := v.TypeName
+		if name == "" {
+			name = "Paper"
+		}
+		data["type_id"] = fmt.Sprint(v.TypeID)
+		return TopicPaper, Message{
+			Title: name + " updated",
+			Body:  fmt.Sprintf("%d new image(s) in %s", v.Count, name),
+			Data:  data,
+		}, true
+	}
+	return "", Message{}, false
+}
+
+// Start sends queued notifications until ctx is cancelled. The returned
+// channel is closed once it has stopped.
+func (d *Dispatcher) Start(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case j := <-d.queue:
+				if _, err := d.Broadcast(ctx, j.topic, j.msg); err != nil {
+					slog.Error("push broadcast failed", "topic", j.topic, "error", err)
+				}
+			}
+		}
+	}()
+	slog.Info("push dispatcher started", "sender", fmt.Sprintf("%T", d.sender))
+	return done
+}
+
+// Broadcast sends msg to every device subscribed to topic, or to every
+// device if topic is empty. Devices with an invalid token are removed.
+func (d *Dispatcher) Broadcast(ctx context.Context, topic string, msg Message) (Result, error) {
+	var result Result
+	if d.sender == nil {
+		return result, errors.New("push notifications are not configured")
+	}
+	devices, err := d.repo.ListDevices(topic)
+	if err != nil {
+		return result, err
+	}
+	label := topic
+	if label == "" {
+		label = "all"
+	}
+	for _, device := range devices {
+		err := d.sender.Send(ctx, device.Token, msg)
+		switch {
+		case err == nil:
+			result.Sent++
+			notifications.Inc(label, "sent")
+		case errors.Is(err, ErrInvalidToken):
+			result.Removed++
+			notifications.Inc(label, "invalid")
+			if err := d.repo.Unregister(device.Token); err != nil && !errors.Is(err, ErrNotFound) {
+				slog.ErrorContext(ctx, "failed to remove device", "device_id", device.ID, "error", err)
+			}
+		default:
+			result.Failed++
+			notifications.Inc(label, "failed")
+			slog.WarnContext(ctx, "push notification failed", "device_id", device.ID, "error", err)
+		}
+	}
+	slog.InfoContext(ctx, "push broadcast sent", "topic", label, "title", msg.Title,
+		"sent", result.Sent, "failed", result.Failed, "removed", result.Removed)
+	return result, nil
+}
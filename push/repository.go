@@ -0,0 +1,147 @@
+package push
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a device token isn't registered
+var ErrNotFound = errors.New("device not registered")
+
+// Device is an app install that can receive notifications
+type Device struct {
+	ID        int       `json:"id"`
+	Token     string    `json:"token"`
+	Platform  string    `json:"platform"`
+	Topics    []string  `json:"topics"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Repository stores the registered devices
+type Repository interface {
+	// Register adds a device or replaces the platform and topics of an
+	// existing token, reporting whether it was new
+	Register(d *Device) (*Device, bool, error)
+	// Unregister removes a device or returns ErrNotFound
+	Unregister(token string) error
+	// ListDevices returns the devices subscribed to topic, or all devices
+	// if topic is empty
+	ListDevices(topic string) ([]Device, error)
+	// CountByTopic returns the number of devices subscribed to each topic
+	CountByTopic() (map[string]int, error)
+}
+
+// SQLRepository is a Repository backed by the push_devices table
+type SQLRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository creates the push_devices table if needed
+func NewSQLRepository(db *sql.DB) *SQLRepository {
+	r := &SQLRepository{db: db}
+	r.createTable()
+	return r
+}
+
+func (r *SQLRepository) createTable() {
+	query := `
+		CREATE TABLE IF NOT EXISTS push_devices (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token TEXT NOT NULL UNIQUE,
+			platform TEXT NOT NULL,
+			topics TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`
+	if _, err := r.db.Exec(query); err != nil {
+		slog.Error("failed to create push_devices table", "error", err)
+	}
+}
+
+const selectDevice = `SELECT id, token, platform, topics, created_at, updated_at FROM push_devices`
+
+func (r *SQLRepository) queryDevices(query string, args ...any) ([]Device, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []Device
+	for rows.Next() {
+		var d Device
+		var topics string
+		if err := rows.Scan(&d.ID, &d.Token, &d.Platform, &topics, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		d.Topics = []string{}
+		if topics != "" {
+			d.Topics = strings.Split(topics, ",")
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// Register upserts a device by token
+func (r *SQLRepository) Register(d *Device) (*Device, bool, error) {
+	existing, err := r.queryDevices(selectDevice+" WHERE token = $1", d.Token)
+	if err != nil {
+		return nil, false, err
+	}
+	topics := strings.Join(d.Topics, ",")
+	if len(existing) == 0 {
+		_, err = r.db.Exec("INSERT INTO push_devices (token, platform, topics) VALUES ($1, $2, $3)", d.Token, d.Platform, topics)
+	} else {
+		_, err = r.db.Exec("UPDATE push_devices SET platform = $1, topics = $2, updated_at = CURRENT_TIMESTAMP WHERE token = $3",
+			d.Platform, topics, d.Token)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	saved, err := r.queryDevices(selectDevice+" WHERE token = $1", d.Token)
+	if err != nil {
+		return nil, false, err
+	}
+	return &saved[0], len(existing) == 0, nil
+}
+
+// Unregister deletes a device by token
+func (r *SQLRepository) Unregister(token string) error {
+	result, err := r.db.Exec("DELETE FROM push_devices WHERE token = $1", token)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListDevices returns the subscribers of a topic
+func (r *SQLRepository) ListDevices(topic string) ([]Device, error) {
+	if topic == "" {
+		return r.queryDevices(selectDevice + " ORDER BY id")
+	}
+	return r.queryDevices(selectDevice+" WHERE ',' || topics || ',' LIKE '%,' || $1 || ',%' ORDER BY id", topic)
+}
+
+// CountByTopic counts the subscribers of every topic
+func (r *SQLRepository) CountByTopic() (map[string]int, error) {
+	devices, err := r.ListDevices("")
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, d := range devices {
+		for _, topic := range d.Topics {
+			counts[topic]++
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,317 @@
+package server
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"thaimaster2d/media"
+	"time"
+)
+
+// pngBytes is a 1x1 transparent PNG
+var pngBytes = []byte{
+	0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0x00, 0x00, 0x0d, 0x49, 0x48, 0x44, 0x52,
+	0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x08, 0x06, 0x00, 0x00, 0x00, 0x1f, 0x15, 0xc4,
+	0x89, 0x00, 0x00, 0x00, 0x0d, 0x49, 0x44, 0x41, 0x54, 0x78, 0x9c, 0x63, 0x00, 0x01, 0x00, 0x00,
+	0x05, 0x00, 0x01, 0x0d, 0x0a, 0x2d, 0xb4, 0x00, 0x00, 0x00, 0x00, 0x49, 0x45, 0x4e, 0x44, 0xae,
+	0x42, 0x60, 0x82,
+}
+
+// postForm submits a URL-encoded admin form
+func (ts *testServer) postForm(path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return ts.send(req)
+}
+
+// upload posts a file to the image upload endpoint
+func (ts *testServer) upload(filename string, content []byte) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("image", filename)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	part.Write(content)
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/api/admin/upload-image", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return ts.send(req)
+}
+
+// page fetches an admin page and checks it rendered
+func (ts *testServer) page(path string, contains ...string) string {
+	ts.t.Helper()
+	w := ts.do("GET", path, nil)
+	if w.Code != http.StatusOK {
+		ts.t.Fatalf("GET %s status = %d, want 200", path, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		ts.t.Fatalf("GET %s Content-Type = %q, want text/html", path, ct)
+	}
+	html := w.Body.String()
+	for _, s := range contains {
+		if !strings.Contains(html, s) {
+			ts.t.Errorf("GET %s: page does not contain %q", path, s)
+		}
+	}
+	return html
+}
+
+func expectRedirect(t *testing.T, w *httptest.ResponseRecorder, location string) {
+	t.Helper()
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want 302; body: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Location"); got != location {
+		t.Errorf("Location = %q, want %q", got, location)
+	}
+}
+
+func TestAdminPages(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.page("/admin")
+	ts.page("/admin/gifts")
+	ts.page("/admin/gifts/create")
+	ts.page("/admin/gifts/edit/3")
+	ts.page("/admin/sliders")
+	ts.page("/admin/sliders/create")
+	ts.page("/admin/sliders/edit/3")
+	ts.page("/admin/paper")
+	ts.page("/admin/media")
+	ts.page("/admin/media?pick=1")
+	ts.page("/admin/threed/create", "Create 3D Result")
+}
+
+func TestAdminThreeDForms(t *testing.T) {
+	ts := newTestServer(t)
+
+	expectRedirect(t, ts.postForm("/admin/threed/create", url.Values{"date": {"2025-10-16"}, "result": {"696"}}),
+		"/admin/threed?message=Result created successfully")
+
+	// Invalid input re-renders the form with an error
+	for _, form := range []url.Values{
+		{"date": {"2025-10-17"}, "result": {"12"}},
+		{"date": {""}, "result": {"123"}},
+	} {
+		if w := ts.postForm("/admin/threed/create", form); w.Code != http.StatusBadRequest {
+			t.Errorf("create %v status = %d, want 400", form, w.Code)
+		}
+	}
+	if w := ts.postForm("/admin/threed/create", url.Values{"date": {"2025-10-16"}, "result": {"111"}}); w.Code != http.StatusInternalServerError {
+		t.Errorf("duplicate create status = %d, want 500", w.Code)
+	}
+
+	ts.page("/admin/threed", "Manage 3D Results", "2025-10-16", "696")
+	ts.page("/admin/threed/edit?id=1", `value="696"`)
+	expectRedirect(t, ts.do("GET", "/admin/threed/edit?id=99", nil), "/admin/threed")
+
+	expectRedirect(t, ts.postForm("/admin/threed/edit", url.Values{"id": {"1"}, "result": {"697"}}),
+		"/admin/threed?message=Result updated successfully")
+	if w := ts.postForm("/admin/threed/edit", url.Values{"id": {"1"}, "result": {"6970"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid edit status = %d, want 400", w.Code)
+	}
+	ts.golden("admin_threed_after_edit", ts.do("GET", "/api/threed", nil), http.StatusOK)
+
+	expectRedirect(t, ts.postForm("/admin/threed/delete", url.Values{"id": {"1"}}),
+		"/admin/threed?message=Result deleted successfully")
+	expectRedirect(t, ts.postForm("/admin/threed/delete", url.Values{"id": {"1"}}),
+		"/admin/threed?message=Failed to delete result")
+	ts.golden("admin_threed_after_delete", ts.do("GET", "/api/threed", nil), http.StatusOK)
+}
+
+func TestAdminAppConfigForm(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.page("/admin/appconfig", "App Configuration", `value="1.0.0"`)
+
+	form := url.Values{
+		"latest_version":      {"1.2.0"},
+		"minimum_version":     {"1.1.0"},
+		"update_url":          {"https://example.com/app"},
+		"update_message":      {"Please update"},
+		"maintenance_message": {"Back soon"},
+		"update_required":     {"true"},
+		"force_update":        {"true"},
+		"app_enabled":         {"true"},
+	}
+	expectRedirect(t, ts.postForm("/admin/appconfig/update", form),
+		"/admin/appconfig?message=Configuration updated successfully")
+
+	ts.golden("appconfig_updated", ts.do("GET", "/api/appconfig", nil), http.StatusOK)
+	ts.golden("appconfig_check_outdated", ts.do("GET", "/api/appconfig/check?version=1.0.5", nil), http.StatusOK)
+	ts.golden("appconfig_check_has_update", ts.do("GET", "/api/appconfig/check?version=1.1.0", nil), http.StatusOK)
+	ts.golden("appconfig_check_latest", ts.do("GET", "/api/appconfig/check?version=1.2.0", nil), http.StatusOK)
+
+	form.Set("maintenance_mode", "true")
+	expectRedirect(t, ts.postForm("/admin/appconfig/update", form),
+		"/admin/appconfig?message=Configuration updated successfully")
+	ts.golden("appconfig_check_maintenance", ts.do("GET", "/api/appconfig/check?version=1.2.0", nil), http.StatusOK)
+
+	form.Del("maintenance_mode")
+	form.Del("app_enabled")
+	expectRedirect(t, ts.postForm("/admin/appconfig/update", form),
+		"/admin/appconfig?message=Configuration updated successfully")
+	ts.golden("appconfig_check_disabled", ts.do("GET", "/api/appconfig/check?version=1.2.0", nil), http.StatusOK)
+}
+
+func TestAppConfigPlatforms(t *testing.T) {
+	ts := newTestServer(t)
+
+	form := url.Values{
+		"latest_version":          {"1.10.0"},
+		"minimum_version":         {"1.9.0"},
+		"update_url":              {"https://example.com/app"},
+		"app_enabled":             {"true"},
+		"force_update":            {"true"},
+		"ios_latest_version":      {"2.0.0"},
+		"ios_minimum_version":     {"2.0.0-beta.1"},
+		"ios_update_url":          {"https://apps.apple.com/app/id1"},
+		"android_minimum_version": {""},
+	}
+	expectRedirect(t, ts.postForm("/admin/appconfig/update", form),
+		"/admin/appconfig?message=Configuration updated successfully")
+
+	config := object(t, ts.expect(ts.do("GET", "/api/appconfig", nil), http.StatusOK))
+	if platforms := object(t, config["platforms"]); len(platforms) != 1 || object(t, platforms["ios"])["latest_version"] != "2.0.0" {
+		t.Errorf("platforms = %v", platforms)
+	}
+	ts.page("/admin/appconfig", `name="ios_update_url" value="https://apps.apple.com/app/id1"`)
+
+	for _, tc := range []struct {
+		query      string
+		needs, has bool
+		url        string
+	}{
+		// 1.10.0 sorts above 1.9.0 as a version, not as a string
+		{"version=1.10.0", false, false, "https://example.com/app"},
+		{"version=1.9.5&platform=android", false, true, "https://example.com/app"},
+		{"version=1.10.0&platform=ios", true, true, "https://apps.apple.com/app/id1"},
+		{"version=2.0.0-beta.2&platform=ios", false, true, "https://apps.apple.com/app/id1"},
+		{"version=2.0.0&platform=ios", false, false, "https://apps.apple.com/app/id1"},
+	} {
+		check := object(t, object(t, ts.expect(ts.do("GET", "/api/v2/appconfig/check?"+tc.query, nil), http.StatusOK))["data"])
+		if check["needs_update"] != tc.needs || check["has_update"] != tc.has || check["update_url"] != tc.url {
+			t.Errorf("check?%s = %v", tc.query, check)
+		}
+	}
+	v1 := object(t, ts.expect(ts.do("GET", "/api/appconfig/check?version=1.10.0&platform=ios", nil), http.StatusOK))
+	if v1["force_update"] != true || v1["latest_version"] != "2.0.0" {
+		t.Errorf("v1 check for ios = %v", v1)
+	}
+	ts.expect(ts.do("GET", "/api/appconfig/check?version=1.0.0&platform=windows", nil), http.StatusBadRequest)
+	ts.expect(ts.do("GET", "/api/v2/appconfig/check?version=1.0.0&platform=windows", nil), http.StatusBadRequest)
+
+	// Invalid versions are not saved
+	form.Set("android_minimum_version", "2.x")
+	expectRedirect(t, ts.postForm("/admin/appconfig/update", form),
+		`/admin/appconfig?message=Not+saved%3A+android%3A+invalid+version+%222.x%22%3A+%22x%22+is+not+a+number`)
+	form.Set("android_minimum_version", "1.11.0")
+	expectRedirect(t, ts.postForm("/admin/appconfig/update", form),
+		`/admin/appconfig?message=Not+saved%3A+android%3A+minimum+version+1.11.0+is+above+latest+version+1.10.0`)
+}
+
+func TestAppConfigHistory(t *testing.T) {
+	ts := newTestServer(t)
+
+	form := url.Values{
+		"latest_version":      {"1.1.0"},
+		"minimum_version":     {"1.0.0"},
+		"update_url":          {"https://example.com/app"},
+		"maintenance_message": {"Back soon"},
+		"app_enabled":         {"true"},
+	}
+	expectRedirect(t, ts.postForm("/admin/appconfig/update", form),
+		"/admin/appconfig?message=Configuration updated successfully")
+	form.Set("maintenance_mode", "true")
+	form.Set("maintenance_message", "Oops, wrong message")
+	expectRedirect(t, ts.postForm("/admin/appconfig/update", form),
+		"/admin/appconfig?message=Configuration updated successfully")
+
+	config := object(t, ts.expect(ts.do("GET", "/api/appconfig", nil), http.StatusOK))
+	if config["version"] != 3.0 || config["maintenance_mode"] != true {
+		t.Fatalf("config after two saves = %v", config)
+	}
+	ts.page("/admin/appconfig", "First version", "latest version: 1.0.0 → 1.1.0",
+		"maintenance mode: false → true", "maintenance message: Back soon → Oops, wrong message")
+
+	expectRedirect(t, ts.postForm("/admin/appconfig/rollback", url.Values{"version": {"2"}}),
+		"/admin/appconfig?message=Rolled+back+to+version+2")
+	check := object(t, object(t, ts.expect(ts.do("GET", "/api/v2/appconfig", nil), http.StatusOK))["data"])
+	// Maintenance mode is left to the admin and the maintenance scheduler
+	if check["version"] != 4.0 || check["restored_from"] != 2.0 || check["maintenance_mode"] != true || check["maintenance_message"] != "Back soon" {
+		t.Errorf("config after rollback = %v", check)
+	}
+	ts.page("/admin/appconfig", "Rolled back to version 2", "maintenance message: Oops, wrong message → Back soon")
+
+	expectRedirect(t, ts.postForm("/admin/appconfig/rollback", url.Values{"version": {"99"}}),
+		"/admin/appconfig?message=Version+99+doesn%27t+exist")
+	expectRedirect(t, ts.postForm("/admin/appconfig/rollback", url.Values{}),
+		"/admin/appconfig?message=Choose a version to roll back to")
+}
+
+func TestImageUpload(t *testing.T) {
+	ts := newTestServer(t)
+	media.OrphanGracePeriod = 0
+	t.Cleanup(func() { media.OrphanGracePeriod = 24 * time.Hour })
+
+	ts.expect(ts.upload("notes.txt", []byte("hello")), http.StatusBadRequest)
+	ts.expect(ts.do("POST", "/api/admin/upload-image", nil), http.StatusBadRequest)
+
+	w := ts.upload("pixel.png", pngBytes)
+	uploaded := object(t, ts.expect(w, http.StatusOK))
+	assertGolden(t, "upload", w.Body.Bytes())
+	key := uploaded["key"].(string)
+
+	// Identical content reuses the stored file
+	w = ts.upload("copy.png", pngBytes)
+	if reused := object(t, ts.expect(w, http.StatusOK)); reused["key"] != key || reused["reused"] != true {
+		t.Errorf("duplicate upload = %v, want reuse of %s", reused, key)
+	}
+
+	// Both image routes serve the stored bytes
+	for _, path := range []string{"/api/images/" + key, "/uploads/" + key} {
+		w := ts.do("GET", path, nil)
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), pngBytes) {
+			t.Errorf("GET %s = %d with %d bytes, want the uploaded image", path, w.Code, w.Body.Len())
+		}
+	}
+	ts.expect(ts.do("GET", "/api/images/missing.png", nil), http.StatusNotFound)
+
+	// Signed URLs are served, tampered ones rejected
+	signed := object(t, ts.expect(ts.do("GET", "/api/admin/images/"+key+"/signed-url?ttl=10m", nil), http.StatusOK))
+	signedURL := signed["url"].(string)
+	if w := ts.do("GET", signedURL, nil); w.Code != http.StatusOK {
+		t.Errorf("GET signed URL status = %d, want 200", w.Code)
+	}
+	ts.expect(ts.do("GET", signedURL+"0", nil), http.StatusForbidden)
+	ts.expect(ts.do("GET", "/api/admin/images/"+key+"/signed-url?ttl=soon", nil), http.StatusBadRequest)
+	ts.expect(ts.do("GET", "/api/admin/images/missing.png/signed-url", nil), http.StatusNotFound)
+
+	// A file used by a gift can't be deleted
+	ts.expect(ts.do("POST", "/api/admin/gifts", map[string]any{
+		"name": "Pixel", "image_link": uploaded["image_url"], "type": "Daily", "is_active": true,
+	}), http.StatusOK)
+	ts.golden("media_list", ts.do("GET", "/api/admin/media", nil), http.StatusOK)
+	ts.golden("media_orphans_none", ts.do("GET", "/api/admin/media/orphans", nil), http.StatusOK)
+	ts.golden("image_delete_in_use", ts.do("DELETE", "/api/admin/delete-image/"+key, nil), http.StatusConflict)
+
+	// Once unused it is an orphan and cleanup removes it
+	ts.expect(ts.do("DELETE", "/api/admin/gifts/1", nil), http.StatusOK)
+	ts.golden("media_orphans", ts.do("GET", "/api/admin/media/orphans", nil), http.StatusOK)
+	ts.golden("media_cleanup", ts.do("POST", "/api/admin/media/orphans/cleanup", nil), http.StatusOK)
+	ts.expect(ts.do("GET", "/api/images/"+key, nil), http.StatusNotFound)
+
+	// Unused uploads can be deleted directly
+	w = ts.upload("pixel.png", pngBytes)
+	key = object(t, ts.expect(w, http.StatusOK))["key"].(string)
+	ts.golden("image_delete", ts.do("DELETE", "/api/admin/delete-image/"+key, nil), http.StatusOK)
+	ts.expect(ts.do("DELETE", "/api/admin/delete-image/"+key, nil), http.StatusNotFound)
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"thaimaster2d/alert"
+	"thaimaster2d/live"
+	"time"
+)
+
+// feed posts an update as a named feeder, with the secret TestFeederConsensus
+// gives it
+func (ts *testServer) feed(feeder string, data map[string]string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	req := ts.request("POST", "/api/v2/lottery/update", data)
+	if feeder != "" {
+		req.Header.Set(live.FeederHeader, feeder)
+		req.Header.Set(live.FeederSecretHeader, feeder+"-secret")
+	}
+	return ts.send(req)
+}
+
+func TestFeederConsensus(t *testing.T) {
+	ts := newTestServer(t)
+	live.Init(live.Config{
+		Location:      time.UTC,
+		SSERetry:      5 * time.Second,
+		Feeders:       []string{"primary", "backup"},
+		FeederSecrets: map[string]string{"primary": "primary-secret", "backup": "backup-secret"},
+		FeederTimeout: 300 * time.Millisecond,
+		ResultTimeout: 50 * time.Millisecond,
+	})
+	receiver, alerts := alertReceiver(t)
+	live.SetAlertSink(&alert.Webhook{URL: receiver})
+	t.Cleanup(func() { live.SetAlertSink(nil) })
+
+	current := func() map[string]any {
+		t.Helper()
+		return object(t, object(t, ts.expect(ts.do("GET", "/api/v2/lottery/current", nil), http.StatusOK))["data"])
+	}
+
+	// Only configured feeders may post
+	ts.expect(ts.feed("", map[string]string{"live": "11"}), http.StatusForbidden)
+	ts.expect(ts.feed("intruder", map[string]string{"live": "11"}), http.StatusForbidden)
+	for _, secret := range []string{"", "backup-secret"} {
+		req := ts.request("POST", "/api/v2/lottery/update", map[string]string{"live": "11"})
+		req.Header.Set(live.FeederHeader, "primary")
+		req.Header.Set(live.FeederSecretHeader, secret)
+		ts.expect(ts.send(req), http.StatusForbidden)
+	}
+
+	// The preferred feeder is published, the backup is kept on standby
+	ts.expect(ts.feed("primary", map[string]string{"date": "2025-10-20", "live": "12"}), http.StatusOK)
+	ts.expect(ts.feed("backup", map[string]string{"date": "2025-10-20", "live": "99"}), http.StatusAccepted)
+	req := ts.request("POST", "/api/lottery/update", map[string]string{"date": "2025-10-20", "live": "99"})
+	req.Header.Set(live.FeederHeader, "backup")
+	req.Header.Set(live.FeederSecretHeader, "backup-secret")
+	if body := object(t, ts.expect(ts.send(req), http.StatusOK)); body["message"] != "Update recorded, another feeder is active" {
+		t.Errorf("v1 standby message = %v", body["message"])
+	}
+	if got := current()["live"]; got != "12" {
+		t.Errorf("live = %v, want the primary's 12", got)
+	}
+
+	// A result is only published once both feeders report it
+	noon := map[string]string{"date": "2025-10-20", "live": "67", "1200set": "1,234.56", "1200value": "12,345.67", "1200": "67"}
+	ts.expect(ts.feed("primary", noon), http.StatusOK)
+	if got := current()["1200"]; got != "---" {
+		t.Errorf("12:00 result = %v before the backup agreed", got)
+	}
+	ts.expect(ts.feed("backup", noon), http.StatusAccepted)
+	if data := current(); data["1200"] != "67" || data["1200set"] != "1,234.56" {
+		t.Errorf("12:00 result = %v/%v after both agreed", data["1200"], data["1200set"])
+	}
+
+	// Disagreement past the result timeout raises a conflict for an admin
+	evening := map[string]string{"date": "2025-10-20", "live": "45", "1200": "67", "430": "45"}
+	ts.expect(ts.feed("primary", evening), http.StatusOK)
+	evening["430"] = "46"
+	ts.expect(ts.feed("backup", evening), http.StatusAccepted)
+	time.Sleep(60 * time.Millisecond)
+	evening["430"] = "45"
+	ts.expect(ts.feed("primary", evening), http.StatusOK)
+	waitForAlert(t, alerts, alert.KindResultConflict)
+	if got := current()["430"]; got != "---" {
+		t.Errorf("4:30 result = %v while the feeders disagree", got)
+	}
+	ts.page("/admin/feeders", "primary", "backup", "Conflict", "Final (consensus): 67", "Use this result")
+
+	// The admin picks the backup's result, which also goes into the history
+	if w := ts.postForm("/admin/feeders/resolve", url.Values{"draw": {live.DrawEvening}, "feeder": {"unknown"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("resolving with an unknown feeder = %d, want 400", w.Code)
+	}
+	w := ts.postForm("/admin/feeders/resolve", url.Values{"draw": {live.DrawEvening}, "feeder": {"backup"}})
+	expectRedirect(t, w, "/admin/feeders?message="+url.QueryEscape("The 4:30 result from backup is now final"))
+	if got := current()["430"]; got != "46" {
+		t.Errorf("4:30 result = %v, want the admin's pick 46", got)
+	}
+	history := array(t, object(t, ts.expect(ts.do("GET", "/api/v2/history", nil), http.StatusOK))["data"])
+	if len(history) != 1 || object(t, history[0])["430"] != "46" || object(t, history[0])["1200"] != "67" {
+		t.Errorf("history = %v, want the resolved day", history)
+	}
+	ts.page("/admin/feeders", "Final (admin): 46")
+
+	// The feeders agreeing on another 12:00 result corrects the history
+	noon["1200"] = "68"
+	ts.expect(ts.feed("primary", noon), http.StatusOK)
+	ts.expect(ts.feed("backup", noon), http.StatusAccepted)
+	history = array(t, object(t, ts.expect(ts.do("GET", "/api/v2/history", nil), http.StatusOK))["data"])
+	if len(history) != 1 || object(t, history[0])["1200"] != "68" || object(t, history[0])["430"] != "46" {
+		t.Errorf("history after the correction = %v", history)
+	}
+
+	// The backup takes over when the primary goes quiet, and hands back
+	time.Sleep(350 * time.Millisecond)
+	ts.expect(ts.feed("backup", map[string]string{"date": "2025-10-20", "live": "88"}), http.StatusOK)
+	if data := current(); data["live"] != "88" || data["430"] != "46" {
+		t.Errorf("after failover live = %v, 4:30 = %v", data["live"], data["430"])
+	}
+	ts.expect(ts.feed("primary", map[string]string{"date": "2025-10-20", "live": "89"}), http.StatusOK)
+	ts.expect(ts.feed("backup", map[string]string{"date": "2025-10-20", "live": "90"}), http.StatusAccepted)
+
+	metrics := ts.scrape()
+	if got := metrics["lottery_feeder_failovers_total"]; got < 2 {
+		t.Errorf("lottery_feeder_failovers_total = %v, want at least 2", got)
+	}
+	if got := metrics[`lottery_feeder_submissions_total{feeder="backup",result="standby"}`]; got < 4 {
+		t.Errorf("backup standby submissions = %v, want at least 4", got)
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.page("/admin/flags", "No feature flags yet", "No changes yet")
+	ts.page("/admin/flags/create", "Add Feature Flag", `value="100"`, "android")
+
+	expectRedirect(t, ts.postForm("/admin/flags/create", url.Values{
+		"key": {"threed_ticket_checker"}, "description": {"3D ticket checker"}, "enabled": {"true"},
+		"platforms": {"android"}, "min_version": {"1.4.0"}, "segments": {"Beta, staff"}, "percentage": {"100"},
+	}), "/admin/flags?message=Flag+threed_ticket_checker+created")
+	expectRedirect(t, ts.postForm("/admin/flags/create", url.Values{
+		"key": {"new_home"}, "enabled": {"true"}, "percentage": {"0"},
+	}), "/admin/flags?message=Flag+new_home+created")
+	for _, form := range []url.Values{
+		{"key": {"new_home"}, "percentage": {"100"}},
+		{"key": {"New Home"}, "percentage": {"100"}},
+		{"key": {"dark_mode"}, "percentage": {"all"}},
+		{"key": {"dark_mode"}, "percentage": {"100"}, "min_version": {"2.0.0"}, "max_version": {"1.0.0"}},
+	} {
+		if w := ts.postForm("/admin/flags/create", form); w.Code != http.StatusBadRequest {
+			t.Errorf("create %v status = %d, want 400", form, w.Code)
+		}
+	}
+
+	// Segments come from the signed-in user, set by an admin
+	beta, vip := ts.signIn("+959111111111"), ts.signIn("+959222222222")
+	for id, segments := range map[string]string{
+		fmt.Sprint(object(t, beta["user"])["id"]): "Beta, staff, beta",
+		fmt.Sprint(object(t, vip["user"])["id"]):  "vip",
+	} {
+		expectRedirect(t, ts.postForm("/admin/users/segments", url.Values{"id": {id}, "segments": {segments}}),
+			"/admin/users?message="+url.QueryEscape("User segments saved"))
+	}
+	expectRedirect(t, ts.postForm("/admin/users/segments", url.Values{"id": {"99"}, "segments": {"beta"}}),
+		"/admin/users?message="+url.QueryEscape("Failed to set user segments"))
+	ts.page("/admin/users", `value="beta, staff"`, `value="vip"`)
+	betaToken, vipToken := beta["access_token"].(string), vip["access_token"].(string)
+
+	flags := func(query, token string) map[string]any {
+		t.Helper()
+		return object(t, object(t, ts.expect(ts.authed("GET", "/api/appconfig/flags"+query, token, nil), http.StatusOK))["flags"])
+	}
+	for _, tc := range []struct {
+		query, token string
+		checker      bool
+	}{
+		{"?platform=android&version=1.5.0", betaToken, true},
+		{"?platform=Android&version=1.10.0", betaToken, true},
+		{"?platform=android&version=1.3.0", betaToken, false},
+		{"?platform=ios&version=1.5.0", betaToken, false},
+		{"?platform=android&version=1.5.0", vipToken, false},
+		// The segments a client claims are ignored
+		{"?platform=android&version=1.5.0&segments=beta", "", false},
+		{"?platform=android&version=1.5.0&segments=beta", "not-a-token", false},
+		{"", betaToken, false},
+	} {
+		got := flags(tc.query, tc.token)
+		if len(got) != 2 || got["threed_ticket_checker"] != tc.checker || got["new_home"] != false {
+			t.Errorf("flags%s = %v", tc.query, got)
+		}
+	}
+	ts.expect(ts.do("GET", "/api/appconfig/flags?platform=windows", nil), http.StatusBadRequest)
+
+	// Roll new_home out to every device
+	ts.page("/admin/flags/edit?id=2", "Edit Feature Flag", "new_home")
+	if w := ts.do("GET", "/admin/flags/edit?id=99", nil); w.Code != http.StatusFound {
+		t.Errorf("edit unknown flag status = %d, want 302", w.Code)
+	}
+	if w := ts.postForm("/admin/flags/edit", url.Values{"id": {"2"}, "percentage": {"150"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("edit with 150%% status = %d, want 400", w.Code)
+	}
+	expectRedirect(t, ts.postForm("/admin/flags/edit", url.Values{
+		"id": {"2"}, "key": {"renamed"}, "enabled": {"true"}, "percentage": {"100"},
+	}), "/admin/flags?message=Flag+new_home+updated")
+	if got := flags("?device_id=abc", ""); got["new_home"] != true {
+		t.Errorf("flags after full rollout = %v", got)
+	}
+
+	expectRedirect(t, ts.postForm("/admin/flags/delete", url.Values{"id": {"1"}}), "/admin/flags?message=Flag deleted successfully")
+	expectRedirect(t, ts.postForm("/admin/flags/delete", url.Values{"id": {"1"}}), "/admin/flags?message=Failed to delete flag")
+	if got := flags("", ""); len(got) != 1 {
+		t.Errorf("flags after delete = %v", got)
+	}
+	ts.page("/admin/flags", "new_home", "Created", "Deleted", "percentage: 0 → 100")
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"thaimaster2d/alert"
+	"time"
+)
+
+// importGifts uploads a gift catalog file
+func (ts *testServer) importGifts(filename string, content []byte) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	part.Write(content)
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/api/admin/gifts/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return ts.send(req)
+}
+
+func TestGiftCatalog(t *testing.T) {
+	ts := newTestServer(t)
+
+	// Categories start as the old Daily and Weekly types
+	categories := array(t, ts.expect(ts.do("GET", "/api/admin/gift-categories", nil), http.StatusOK))
+	if len(categories) != 2 || object(t, categories[1])["name"] != "Weekly" || object(t, categories[1])["period"] != "weekly" {
+		t.Errorf("default categories = %v", categories)
+	}
+	ts.expect(ts.do("POST", "/api/admin/gift-categories", map[string]string{"name": "Monthly", "period": "weekly"}), http.StatusCreated)
+	ts.expect(ts.do("POST", "/api/admin/gift-categories", map[string]string{"name": "Monthly"}), http.StatusConflict)
+	ts.expect(ts.do("POST", "/api/admin/gift-categories", map[string]string{"name": "Yearly", "period": "yearly"}), http.StatusBadRequest)
+	ts.expect(ts.do("POST", "/api/admin/gift-categories", map[string]string{"name": " "}), http.StatusBadRequest)
+	empty := object(t, ts.expect(ts.do("POST", "/api/admin/gift-categories", map[string]string{"name": "Empty"}), http.StatusCreated))
+	ts.expect(ts.do("DELETE", "/api/admin/gift-categories/99", nil), http.StatusNotFound)
+	ts.expect(ts.do("DELETE", "/api/admin/gift-categories/abc", nil), http.StatusBadRequest)
+
+	// Availability windows
+	now := time.Now().UTC()
+	for _, g := range []map[string]any{
+		{"name": "Future Voucher", "type": "Monthly", "points": 1, "stock": 5, "starts_at": now.Add(time.Hour)},
+		{"name": "Expired Voucher", "type": "Daily", "points": 1, "stock": 5, "ends_at": now.Add(-time.Hour)},
+		{"name": "Phone Card", "type": "Monthly", "points": 5, "stock": 2, "per_user_limit": 1, "low_stock_threshold": 1,
+			"starts_at": now.Add(-time.Hour), "ends_at": now.Add(time.Hour)},
+	} {
+		g["image_link"], g["is_active"] = "card.jpg", true
+		ts.expect(ts.do("POST", "/api/admin/gifts", g), http.StatusOK)
+	}
+	ts.expect(ts.do("POST", "/api/admin/gifts", map[string]any{
+		"name": "Backwards", "type": "Daily", "starts_at": now, "ends_at": now.Add(-time.Minute),
+	}), http.StatusBadRequest)
+	ts.expect(ts.do("POST", "/api/admin/gifts", map[string]any{"name": "Negative", "type": "Daily", "stock": -1}), http.StatusBadRequest)
+
+	offered := array(t, object(t, ts.expect(ts.do("GET", "/api/v2/gifts", nil), http.StatusOK))["data"])
+	if len(offered) != 1 || object(t, offered[0])["name"] != "Phone Card" {
+		t.Errorf("gifts on offer = %v", offered)
+	}
+	ts.expect(ts.do("DELETE", "/api/admin/gift-categories/3", nil), http.StatusConflict)
+	ts.expect(ts.do("DELETE", "/api/admin/gift-categories/"+fmt.Sprint(empty["id"]), nil), http.StatusOK)
+
+	// Per-user limits and low-stock alerts
+	alice := ts.signIn("+959111111111")["access_token"].(string)
+	bob := ts.signIn("+959222222222")["access_token"].(string)
+	for _, token := range []string{alice, bob} {
+		ts.expect(ts.authed("POST", "/api/v2/points/checkin", token, nil), http.StatusCreated)
+	}
+	ts.expect(ts.authed("POST", "/api/v2/gifts/1/redeem", alice, nil), http.StatusNotFound)
+	ts.expect(ts.authed("POST", "/api/v2/gifts/2/redeem", alice, nil), http.StatusNotFound)
+	redemption := object(t, object(t, ts.expect(ts.authed("POST", "/api/v2/gifts/3/redeem", alice, nil), http.StatusCreated))["data"])
+	if period := redemption["period"].(string); !strings.Contains(period, "-W") {
+		t.Errorf("period of a weekly category = %q, want an ISO week", period)
+	}
+	low := waitForAlert(t, ts.alerts, alert.KindLowStock)
+	if !strings.Contains(low.Title, "Phone Card") || !strings.Contains(low.Message, "1 of Phone Card") {
+		t.Errorf("low stock alert = %+v", low)
+	}
+	ts.expect(ts.authed("POST", "/api/v2/gifts/3/redeem", alice, nil), http.StatusConflict)
+	ts.expect(ts.authed("POST", "/api/v2/gifts/3/redeem", bob, nil), http.StatusCreated)
+	if out := waitForAlert(t, ts.alerts, alert.KindLowStock); !strings.Contains(out.Title, "out of stock") {
+		t.Errorf("out of stock alert = %+v", out)
+	}
+
+	// Export and import the catalog
+	ts.expect(ts.do("GET", "/api/admin/gifts/export?format=xml", nil), http.StatusBadRequest)
+	exported := array(t, ts.expect(ts.do("GET", "/api/admin/gifts/export", nil), http.StatusOK))
+	if len(exported) != 3 {
+		t.Errorf("JSON export has %d gifts, want 3", len(exported))
+	}
+	w := ts.do("GET", "/api/admin/gifts/export?format=csv", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("CSV export status = %d", w.Code)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, ".csv") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[0][0] != "id" || records[0][1] != "name" {
+		t.Fatalf("CSV export = %v", records)
+	}
+	for _, record := range records[1:] {
+		if record[1] == "Phone Card" {
+			record[6] = "50" // stock
+		}
+	}
+	records = append(records, []string{"", "Sticker Pack", "", "Daily", "", "3", "100", "true", "", "", "0", "0"})
+	var buf bytes.Buffer
+	csv.NewWriter(&buf).WriteAll(records)
+	result := object(t, ts.expect(ts.importGifts("gifts.csv", buf.Bytes()), http.StatusOK))
+	if result["created"] != 1.0 || result["updated"] != 3.0 {
+		t.Errorf("import result = %v", result)
+	}
+	card := object(t, ts.expect(ts.do("GET", "/api/admin/gifts/3", nil), http.StatusOK))
+	if card["stock"] != 50.0 || card["per_user_limit"] != 1.0 || card["ends_at"] == nil {
+		t.Errorf("imported gift = %v", card)
+	}
+
+	// Admin edits alert like redemptions once the stock drops to the threshold
+	card["stock"] = 1
+	ts.expect(ts.do("PUT", "/api/admin/gifts/3", card), http.StatusOK)
+	if low := waitForAlert(t, ts.alerts, alert.KindLowStock); !strings.Contains(low.Message, "1 of Phone Card") {
+		t.Errorf("low stock alert after an edit = %+v", low)
+	}
+	card["stock"] = 0
+	ts.expect(ts.do("PUT", "/api/admin/gifts/3", card), http.StatusOK)
+	if out := waitForAlert(t, ts.alerts, alert.KindLowStock); !strings.Contains(out.Title, "out of stock") {
+		t.Errorf("out of stock alert after an edit = %+v", out)
+	}
+
+	ts.expect(ts.importGifts("gifts.json", []byte(`[{"name": "Ok", "type": "Daily"}, {"name": "Bad", "type": "Hourly"}]`)), http.StatusBadRequest)
+	ts.expect(ts.importGifts("gifts.csv", []byte("id,name\n1,Card,extra\n")), http.StatusBadRequest)
+	ts.expect(ts.importGifts("gifts.txt", []byte("name\n")), http.StatusBadRequest)
+	ts.expect(ts.do("POST", "/api/admin/gifts/import", nil), http.StatusBadRequest)
+	if all := array(t, ts.expect(ts.do("GET", "/api/admin/gifts", nil), http.StatusOK)); len(all) != 4 {
+		t.Errorf("%d gifts after failed imports, want 4", len(all))
+	}
+
+	ts.page("/admin/gifts", "Import", "Export", "Categories")
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readFrame reads one SSE frame and returns its data payload decoded
+func readFrame(t *testing.T, r *bufio.Reader) map[string]any {
+	t.Helper()
+	var data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading SSE stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			break
+		}
+		if rest, ok := strings.CutPrefix(line, "data: "); ok {
+			data = rest
+		}
+	}
+	var v map[string]any
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatalf("invalid SSE payload %q: %v", data, err)
+	}
+	return v
+}
+
+func TestLiveFeed(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.golden("lottery_current_default", ts.do("GET", "/api/lottery/current", nil), http.StatusOK)
+
+	srv := httptest.NewServer(ts.router)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/lottery/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+	stream := bufio.NewReader(resp.Body)
+
+	// The current data is sent as soon as the client connects
+	initial := readFrame(t, stream)
+	if initial["status"] != "Off" || initial["live"] != "--" || initial["viewCount"] != float64(1) {
+		t.Errorf("initial frame = %v, want default data seen by 1 viewer", initial)
+	}
+
+	update := map[string]string{
+		"date": "2025-10-16", "live": "22", "status": "On",
+		"1200set": "1,234.56", "1200value": "12,345.67", "1200": "67",
+		"430set": "--", "430value": "--", "430": "--",
+		"930modern": "845", "930internet": "921", "200modern": "376", "200internet": "542",
+		"updatetime": "12:01:45 16/10/2025",
+	}
+	ts.golden("lottery_update", ts.do("POST", "/api/lottery/update", update), http.StatusOK)
+
+	// Updates are broadcast to connected clients
+	frame := readFrame(t, stream)
+	for k, want := range update {
+		if frame[k] != want {
+			t.Errorf("broadcast %s = %v, want %q", k, frame[k], want)
+		}
+	}
+	if frame["viewCount"] != float64(1) {
+		t.Errorf("broadcast viewCount = %v, want 1", frame["viewCount"])
+	}
+
+	ts.golden("lottery_current_updated", ts.do("GET", "/api/lottery/current", nil), http.StatusOK)
+	ts.expect(ts.do("POST", "/api/lottery/update", "{"), http.StatusBadRequest)
+
+	// Updates outside the insert window never reach the history table
+	ts.golden("history_empty", ts.do("GET", "/api/twodhistory", nil), http.StatusOK)
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"thaimaster2d/logging"
+)
+
+// captureLogs sends slog output to a buffer for the rest of the test and
+// returns a function decoding the records written so far
+func captureLogs(t *testing.T) func() []map[string]any {
+	t.Helper()
+	var (
+		mu  sync.Mutex
+		buf bytes.Buffer
+	)
+	handler, err := logging.NewHandler(lockedWriter{&mu, &buf}, "json", slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(slog.New(handler))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return func() []map[string]any {
+		mu.Lock()
+		defer mu.Unlock()
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("log line is not JSON: %q", line)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+}
+
+type lockedWriter struct {
+	mu  *sync.Mutex
+	buf *bytes.Buffer
+}
+
+func (w lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+// recordsFor returns the records tagged with the request ID
+func recordsFor(records []map[string]any, id string) map[string]map[string]any {
+	byMsg := make(map[string]map[string]any)
+	for _, r := range records {
+		if r["request_id"] == id {
+			byMsg[r["msg"].(string)] = r
+		}
+	}
+	return byMsg
+}
+
+func TestRequestIDLogging(t *testing.T) {
+	ts := newTestServer(t)
+	logs := captureLogs(t)
+
+	// A client supplied ID is echoed and tags the handler's own log lines
+	req := ts.request("POST", "/api/v2/lottery/update", map[string]string{"live": "45", "status": "On"})
+	req.Header.Set(logging.RequestIDHeader, "feeder-42")
+	w := ts.send(req)
+	ts.expect(w, http.StatusOK)
+	if got := w.Header().Get(logging.RequestIDHeader); got != "feeder-42" {
+		t.Errorf("X-Request-ID = %q, want feeder-42", got)
+	}
+
+	byMsg := recordsFor(logs(), "feeder-42")
+	if r := byMsg["lottery data updated"]; r == nil || r["live"] != "45" {
+		t.Errorf("handler log line missing request ID: %v", byMsg)
+	}
+	access := byMsg["request"]
+	if access == nil {
+		t.Fatalf("no access log line for the request: %v", logs())
+	}
+	if access["level"] != "INFO" || access["route"] != "/api/v2/lottery/update" || access["status"] != float64(200) {
+		t.Errorf("access log = %v", access)
+	}
+
+	// Without a usable ID the server generates one
+	req = ts.request("GET", "/api/v2/gifts", nil)
+	req.Header.Set(logging.RequestIDHeader, "has spaces")
+	w = ts.send(req)
+	id := w.Header().Get(logging.RequestIDHeader)
+	if len(id) != 16 {
+		t.Errorf("generated X-Request-ID = %q, want 16 hex characters", id)
+	}
+	if recordsFor(logs(), id)["request"] == nil {
+		t.Errorf("no access log line for generated ID %s", id)
+	}
+
+	// Failed requests log at warn with the error that caused them
+	w = ts.do("POST", "/api/v2/threed", map[string]string{"date": "2025-10-16", "result": "696"})
+	ts.expect(w, http.StatusCreated)
+	w = ts.do("POST", "/api/v2/threed", map[string]string{"date": "2025-10-16", "result": "111"})
+	ts.expect(w, http.StatusConflict)
+	access = recordsFor(logs(), w.Header().Get(logging.RequestIDHeader))["request"]
+	if access == nil || access["level"] != "WARN" || !strings.Contains(access["error"].(string), "UNIQUE constraint") {
+		t.Errorf("conflict access log = %v, want WARN with the SQL error", access)
+	}
+}
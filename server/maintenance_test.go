@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.page("/admin/maintenance", "Scheduled Maintenance", "No maintenance scheduled yet")
+
+	start := time.Now().UTC().Add(2 * time.Hour).Truncate(time.Minute)
+	end := start.Add(time.Hour)
+	form := func(start, end time.Time) url.Values {
+		return url.Values{
+			"starts_at": {start.Format("2006-01-02T15:04")}, "ends_at": {end.Format("2006-01-02T15:04")},
+			"message":  {"Back soon"},
+			"messages": {"my: ခဏစောင့်ပါ\r\nTH: ปิดปรับปรุง\r\n"},
+		}
+	}
+	expectRedirect(t, ts.postForm("/admin/maintenance/create", form(start, end)), "/admin/maintenance?message="+
+		url.QueryEscape("Maintenance scheduled from "+start.Format("15:04 02/01/2006")+" to "+end.Format("15:04 02/01/2006")))
+
+	overlapping := form(start.Add(30*time.Minute), end.Add(30*time.Minute))
+	backwards := form(end, start)
+	untranslated := form(end.Add(time.Hour), end.Add(2*time.Hour))
+	untranslated.Set("messages", "ปิดปรับปรุง")
+	for _, f := range []url.Values{overlapping, backwards, untranslated, {"message": {"Back soon"}}} {
+		if w := ts.postForm("/admin/maintenance/create", f); w.Code != http.StatusBadRequest {
+			t.Errorf("create %v status = %d, want 400", f, w.Code)
+		}
+	}
+	ts.page("/admin/maintenance", "Upcoming", "ปิดปรับปรุง", "Cancel")
+
+	check := func(path string, header http.Header) map[string]any {
+		t.Helper()
+		req := ts.request("GET", path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		return object(t, ts.expect(ts.send(req), http.StatusOK))
+	}
+	upcoming := object(t, check("/api/appconfig/check?version=1.0.0&locale=th", nil)["upcoming_maintenance"])
+	if upcoming["message"] != "ปิดปรับปรุง" || upcoming["starts_at"] != start.Format(time.RFC3339) || upcoming["ends_at"] != end.Format(time.RFC3339) {
+		t.Errorf("upcoming maintenance = %v", upcoming)
+	}
+	v2 := object(t, check("/api/v2/appconfig/check?version=1.0.0", http.Header{"Accept-Language": {"my-MM,en;q=0.8"}})["data"])
+	if upcoming := object(t, v2["upcoming_maintenance"]); upcoming["message"] != "ခဏစောင့်ပါ" || v2["can_use"] != true {
+		t.Errorf("v2 check = %v", v2)
+	}
+
+	srv := httptest.NewServer(ts.router)
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/lottery/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	stream := bufio.NewReader(resp.Body)
+	readFrame(t, stream)
+	announcement := func() map[string]any {
+		t.Helper()
+		if line, err := stream.ReadString('\n'); err != nil || line != "event: maintenance\n" {
+			t.Fatalf("event line = %q, %v", line, err)
+		}
+		return readFrame(t, stream)
+	}
+
+	// The window starts
+	if err := ts.app.Maintenance.Sync(ctx, start); err != nil {
+		t.Fatal(err)
+	}
+	if frame := announcement(); frame["maintenance_mode"] != true || frame["message"] != "Back soon" ||
+		object(t, frame["messages"])["th"] != "ปิดปรับปรุง" {
+		t.Errorf("start announcement = %v", frame)
+	}
+	got := check("/api/appconfig/check?version=1.0.0&locale=th", nil)
+	if got["maintenance_mode"] != true || got["can_use"] != false || got["message"] != "ปิดปรับปรุง" ||
+		got["maintenance_ends_at"] != end.Format(time.RFC3339) {
+		t.Errorf("check during maintenance = %v", got)
+	}
+	if got := check("/api/appconfig/check?version=1.0.0", nil); got["message"] != "Back soon" {
+		t.Errorf("default message during maintenance = %v", got["message"])
+	}
+	ts.page("/admin/maintenance", "In progress", "End Now")
+
+	// Saving the app config can't switch off maintenance the window owns
+	ts.page("/admin/appconfig", "Scheduled maintenance", "is in progress until "+end.Format("15:04 02/01/2006"))
+	expectRedirect(t, ts.postForm("/admin/appconfig/update", url.Values{
+		"latest_version": {"1.0.0"}, "minimum_version": {"1.0.0"}, "maintenance_message": {"Back soon"}, "app_enabled": {"true"},
+	}), "/admin/appconfig?message="+url.QueryEscape("Configuration updated successfully. Maintenance mode stays as scheduled until "+
+		end.Format("15:04 02/01/2006")+"."))
+	if got := check("/api/appconfig/check?version=1.0.0", nil); got["maintenance_mode"] != true || got["can_use"] != false {
+		t.Errorf("check after saving the config during maintenance = %v", got)
+	}
+	expectRedirect(t, ts.postForm("/admin/maintenance/cancel", url.Values{"id": {"1"}}),
+		"/admin/maintenance?message=Only upcoming maintenance can be cancelled")
+
+	// An admin ends it early
+	expectRedirect(t, ts.postForm("/admin/maintenance/end", url.Values{"id": {"1"}}), "/admin/maintenance?message=Maintenance ended")
+	if frame := announcement(); frame["maintenance_mode"] != false {
+		t.Errorf("end announcement = %v", frame)
+	}
+	if got := check("/api/appconfig/check?version=1.0.0", nil); got["maintenance_mode"] != false || got["upcoming_maintenance"] != nil {
+		t.Errorf("check after maintenance = %v", got)
+	}
+	expectRedirect(t, ts.postForm("/admin/maintenance/end", url.Values{"id": {"1"}}),
+		"/admin/maintenance?message=Only maintenance in progress can be ended")
+
+	// A window is scheduled again and cancelled
+	expectRedirect(t, ts.postForm("/admin/maintenance/create", form(start, end)), "/admin/maintenance?message="+
+		url.QueryEscape("Maintenance scheduled from "+start.Format("15:04 02/01/2006")+" to "+end.Format("15:04 02/01/2006")))
+	expectRedirect(t, ts.postForm("/admin/maintenance/cancel", url.Values{"id": {"2"}}), "/admin/maintenance?message=Maintenance cancelled")
+	ts.page("/admin/maintenance", "Done")
+	if got := check("/api/appconfig/check?version=1.0.0", nil); got["upcoming_maintenance"] != nil {
+		t.Errorf("check after cancel = %v", got)
+	}
+	if config := object(t, ts.expect(ts.do("GET", "/api/appconfig", nil), http.StatusOK)); config["maintenance_mode"] != false {
+		t.Errorf("config after maintenance = %v", config)
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrape fetches /metrics and returns each sample keyed by its series,
+// e.g. `http_requests_total{method="GET",route="/",status="200"}`
+func (ts *testServer) scrape() map[string]float64 {
+	ts.t.Helper()
+	w := ts.do("GET", "/metrics", nil)
+	if w.Code != http.StatusOK {
+		ts.t.Fatalf("GET /metrics = %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		ts.t.Errorf("Content-Type = %q, want the Prometheus text format", got)
+	}
+
+	samples := make(map[string]float64)
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			ts.t.Fatalf("bad sample line %q", line)
+		}
+		samples[line[:i]] = value
+	}
+	return samples
+}
+
+func TestMetrics(t *testing.T) {
+	ts := newTestServer(t)
+	before := ts.scrape()
+
+	ts.expect(ts.do("GET", "/", nil), http.StatusOK)
+	if w := ts.do("GET", "/no/such/route", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("GET /no/such/route = %d, want 404", w.Code)
+	}
+	ts.expect(ts.do("POST", "/api/v2/lottery/update", map[string]string{"live": "12"}), http.StatusOK)
+	ts.expect(ts.do("POST", "/api/v2/history", map[string]string{"date": "2025-10-01"}), http.StatusCreated)
+	ts.expect(ts.do("POST", "/api/v2/history", map[string]string{"date": "2025-10-01"}), http.StatusOK)
+	ts.upload("banner.png", pngBytes)
+
+	after := ts.scrape()
+	for series, want := range map[string]float64{
+		`http_requests_total{method="GET",route="/",status="200"}`:                   1,
+		`http_requests_total{method="GET",route="unmatched",status="404"}`:           1,
+		`http_request_duration_seconds_count{method="POST",route="/api/v2/history"}`: 2,
+		`http_request_duration_seconds_bucket{method="GET",route="/",le="+Inf"}`:     1,
+		`lottery_feeder_updates_total`:                                               1,
+		`twodhistory_inserts_total{result="inserted"}`:                               1,
+		`twodhistory_inserts_total{result="exists"}`:                                 1,
+		`media_uploads_total{result="stored"}`:                                       1,
+		`media_upload_bytes_total`:                                                   float64(len(pngBytes)),
+	} {
+		if got := after[series] - before[series]; got != want {
+			t.Errorf("%s grew by %v, want %v", series, got, want)
+		}
+	}
+
+	// The history inserts ran through the instrumented driver
+	if got := after[`db_query_duration_seconds_count{op="exec"}`] - before[`db_query_duration_seconds_count{op="exec"}`]; got < 1 {
+		t.Errorf("db_query_duration_seconds_count{op=\"exec\"} grew by %v, want at least 1", got)
+	}
+
+	if after["lottery_feeder_seconds_since_update"] > 5 {
+		t.Errorf("lottery_feeder_seconds_since_update = %v just after an update", after["lottery_feeder_seconds_since_update"])
+	}
+	for _, series := range []string{"lottery_sse_clients", "lottery_sse_dropped_frames_total", "db_open_connections", "db_wait_count_total"} {
+		if _, ok := after[series]; !ok {
+			t.Errorf("%s missing from /metrics", series)
+		}
+	}
+}
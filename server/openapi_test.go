@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"thaimaster2d/apidocs"
+)
+
+type openAPISpec struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]json.RawMessage `json:"schemas"`
+	} `json:"components"`
+}
+
+var pathParamRe = regexp.MustCompile(`:([A-Za-z_]+)`)
+
+func loadSpec(t *testing.T) openAPISpec {
+	t.Helper()
+	var spec openAPISpec
+	if err := json.Unmarshal(apidocs.Spec(), &spec); err != nil {
+		t.Fatalf("apidocs/openapi.json is not valid JSON: %v", err)
+	}
+	return spec
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	ts := newTestServer(t)
+	spec := loadSpec(t)
+
+	registered := make(map[string]bool)
+	for _, route := range ts.app.Router.Routes() {
+		path := pathParamRe.ReplaceAllString(route.Path, "{$1}")
+		method := strings.ToLower(route.Method)
+		registered[method+" "+path] = true
+		if _, ok := spec.Paths[path][method]; !ok {
+			t.Errorf("%s %s is registered but missing from apidocs/openapi.json", route.Method, path)
+		}
+	}
+
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			if !registered[method+" "+path] {
+				t.Errorf("apidocs/openapi.json documents %s %s, which is not registered", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIRefsResolve(t *testing.T) {
+	spec := loadSpec(t)
+
+	refRe := regexp.MustCompile(`"\$ref":\s*"#/components/schemas/([^"]+)"`)
+	for _, m := range refRe.FindAllSubmatch(apidocs.Spec(), -1) {
+		if _, ok := spec.Components.Schemas[string(m[1])]; !ok {
+			t.Errorf("unknown schema reference %s", m[1])
+		}
+	}
+}
+
+func TestAPIDocsServed(t *testing.T) {
+	ts := newTestServer(t)
+
+	w := ts.do("GET", "/api/openapi.json", nil)
+	if spec := object(t, ts.expect(w, http.StatusOK)); spec["openapi"] != "3.0.3" {
+		t.Errorf("openapi = %v, want 3.0.3", spec["openapi"])
+	}
+
+	w = ts.do("GET", "/api/docs", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/api/openapi.json") {
+		t.Errorf("GET /api/docs = %d, want the docs page loading the spec", w.Code)
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestPoints(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signIn("+959111111111")["access_token"].(string)
+	bob := ts.signIn("+959222222222")["access_token"].(string)
+	anon := object(t, object(t, ts.expect(ts.do("POST", "/api/v2/auth/anonymous", map[string]string{"device_id": "device-1"}), http.StatusOK))["data"])["access_token"].(string)
+
+	balance := func(token string) map[string]any {
+		t.Helper()
+		return object(t, object(t, ts.expect(ts.authed("GET", "/api/v2/points", token, nil), http.StatusOK))["data"])
+	}
+	earn := func(token, path string, body any, status int) {
+		t.Helper()
+		ts.expect(ts.authed("POST", path, token, body), status)
+	}
+
+	ts.expect(ts.do("GET", "/api/v2/points", nil), http.StatusUnauthorized)
+	summary := balance(alice)
+	if summary["balance"] != 0.0 || summary["checked_in"] != false || summary["referral_code"] == "" {
+		t.Errorf("new balance = %v", summary)
+	}
+
+	// Daily check-in and watching each draw pay out once a day
+	earn(alice, "/api/v2/points/checkin", nil, http.StatusCreated)
+	earn(alice, "/api/v2/points/checkin", nil, http.StatusConflict)
+	earn(alice, "/api/v2/points/watch", map[string]string{"draw": "morning"}, http.StatusCreated)
+	earn(alice, "/api/v2/points/watch", map[string]string{"draw": "morning"}, http.StatusConflict)
+	earn(alice, "/api/v2/points/watch", map[string]string{"draw": "noon"}, http.StatusUnprocessableEntity)
+	earn(alice, "/api/v2/points/watch", "not an object", http.StatusBadRequest)
+	if summary = balance(alice); summary["balance"] != 15.0 || summary["checked_in"] != true {
+		t.Errorf("balance after check-in = %v", summary)
+	}
+
+	// Referrals credit both users, once
+	code := summary["referral_code"].(string)
+	earn(bob, "/api/v2/points/referral", map[string]string{"code": "TMZZZZZZ"}, http.StatusUnprocessableEntity)
+	earn(bob, "/api/v2/points/referral", map[string]string{}, http.StatusUnprocessableEntity)
+	earn(alice, "/api/v2/points/referral", map[string]string{"code": code}, http.StatusUnprocessableEntity)
+	earn(anon, "/api/v2/points/referral", map[string]string{"code": code}, http.StatusForbidden)
+	earn(bob, "/api/v2/points/referral", map[string]string{"code": code}, http.StatusCreated)
+	earn(bob, "/api/v2/points/referral", map[string]string{"code": code}, http.StatusConflict)
+	// Alice can't be referred back by Bob
+	bobCode := balance(bob)["referral_code"].(string)
+	earn(alice, "/api/v2/points/referral", map[string]string{"code": bobCode}, http.StatusUnprocessableEntity)
+	if got := balance(alice)["balance"]; got != 65.0 {
+		t.Errorf("referrer balance = %v, want 65", got)
+	}
+	if got := balance(bob)["balance"]; got != 50.0 {
+		t.Errorf("referred balance = %v, want 50", got)
+	}
+
+	// Gifts: 1 daily, 2 weekly and expensive, 3 out of stock, 4 inactive
+	for _, g := range []map[string]any{
+		{"name": "Daily Tip", "type": "Daily", "points": 20, "stock": 5, "is_active": true},
+		{"name": "Weekly Bundle", "type": "Weekly", "points": 100, "stock": 1, "is_active": true},
+		{"name": "Sold Out", "type": "Daily", "points": 1, "stock": 0, "is_active": true},
+		{"name": "Retired", "type": "Daily", "points": 1, "stock": 5, "is_active": false},
+	} {
+		g["image_link"] = "gift.jpg"
+		ts.expect(ts.do("POST", "/api/admin/gifts", g), http.StatusOK)
+	}
+
+	redemption := object(t, object(t, ts.expect(ts.authed("POST", "/api/v2/gifts/1/redeem", alice, nil), http.StatusCreated))["data"])
+	if redemption["gift_name"] != "Daily Tip" || redemption["points"] != 20.0 || redemption["status"] != "pending" {
+		t.Errorf("redemption = %v", redemption)
+	}
+	ts.expect(ts.authed("POST", "/api/v2/gifts/1/redeem", alice, nil), http.StatusConflict)
+	ts.expect(ts.authed("POST", "/api/v2/gifts/2/redeem", alice, nil), http.StatusConflict)
+	ts.expect(ts.authed("POST", "/api/v2/gifts/3/redeem", alice, nil), http.StatusConflict)
+	ts.expect(ts.authed("POST", "/api/v2/gifts/4/redeem", alice, nil), http.StatusNotFound)
+	ts.expect(ts.authed("POST", "/api/v2/gifts/99/redeem", alice, nil), http.StatusNotFound)
+	ts.expect(ts.authed("POST", "/api/v2/gifts/abc/redeem", alice, nil), http.StatusBadRequest)
+	ts.expect(ts.authed("POST", "/api/v2/gifts/1/redeem", anon, nil), http.StatusForbidden)
+	if got := balance(alice)["balance"]; got != 45.0 {
+		t.Errorf("balance after redeeming = %v, want 45", got)
+	}
+
+	ledger := object(t, ts.expect(ts.authed("GET", "/api/v2/points/ledger?per_page=2", alice, nil), http.StatusOK))
+	entries := array(t, ledger["data"])
+	if len(entries) != 2 || object(t, entries[0])["amount"] != -20.0 || object(t, entries[0])["reason"] != "redemption" {
+		t.Errorf("ledger = %v", entries)
+	}
+	if total := object(t, ledger["meta"])["total"]; total != 4.0 {
+		t.Errorf("ledger total = %v, want 4", total)
+	}
+	mine := array(t, object(t, ts.expect(ts.authed("GET", "/api/v2/redemptions", alice, nil), http.StatusOK))["data"])
+	if len(mine) != 1 {
+		t.Errorf("redemptions = %v", mine)
+	}
+	if others := array(t, object(t, ts.expect(ts.authed("GET", "/api/v2/redemptions", bob, nil), http.StatusOK))["data"]); len(others) != 0 {
+		t.Errorf("other user's redemptions = %v", others)
+	}
+
+	// Rejecting refunds the points and frees the claim window
+	ts.page("/admin/redemptions", "Gift Redemptions", "Daily Tip", "959111111111")
+	w := ts.postForm("/admin/redemptions/reject", url.Values{"id": {"1"}, "note": {"Wrong address"}})
+	expectRedirect(t, w, "/admin/redemptions?message="+url.QueryEscape("Redemption rejected and points refunded"))
+	if got := balance(alice)["balance"]; got != 65.0 {
+		t.Errorf("balance after refund = %v, want 65", got)
+	}
+	ts.page("/admin/redemptions?status=rejected", "Wrong address")
+
+	ts.expect(ts.authed("POST", "/api/v2/gifts/1/redeem", alice, nil), http.StatusCreated)
+	w = ts.postForm("/admin/redemptions/fulfill", url.Values{"id": {"2"}, "status": {"pending"}})
+	expectRedirect(t, w, "/admin/redemptions?message="+url.QueryEscape("Redemption fulfilled")+"&status=pending")
+	w = ts.postForm("/admin/redemptions/reject", url.Values{"id": {"2"}})
+	expectRedirect(t, w, "/admin/redemptions?message="+url.QueryEscape("Redemption was already handled"))
+	w = ts.postForm("/admin/redemptions/fulfill", url.Values{"id": {"99"}})
+	expectRedirect(t, w, "/admin/redemptions?message="+url.QueryEscape("Redemption not found"))
+	ts.page("/admin/redemptions?status=all", "Fulfilled", "Rejected")
+	if got := balance(alice)["balance"]; got != 45.0 {
+		t.Errorf("balance after fulfilling = %v, want 45", got)
+	}
+
+	metrics := ts.scrape()
+	if got := metrics[`points_awarded_total{reason="checkin"}`]; got < 10 {
+		t.Errorf("check-in points = %v, want at least 10", got)
+	}
+	if got := metrics[`gift_redemptions_total{result="redeemed"}`]; got < 2 {
+		t.Errorf("redeemed gifts = %v, want at least 2", got)
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"thaimaster2d/push"
+	"time"
+)
+
+// waitForPush waits until the fake sender has sent n messages
+func (ts *testServer) waitForPush(n int) []push.Sent {
+	ts.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sent := ts.push.Sent()
+		if len(sent) >= n {
+			return sent
+		}
+		if time.Now().After(deadline) {
+			ts.t.Fatalf("sent %d push notifications, want %d: %+v", len(sent), n, sent)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPush(t *testing.T) {
+	ts := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := ts.app.Push.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// Devices register for all topics unless they pick some
+	device := object(t, object(t, ts.expect(ts.do("POST", "/api/v2/push/devices", map[string]any{"token": "phone-a", "platform": "android"}), http.StatusCreated))["data"])
+	if topics := array(t, device["topics"]); len(topics) != len(push.Topics) {
+		t.Errorf("default topics = %v", topics)
+	}
+	device = object(t, object(t, ts.expect(ts.do("POST", "/api/v2/push/devices", map[string]any{"token": "phone-a", "platform": "android", "topics": []string{push.TopicThreeD}}), http.StatusOK))["data"])
+	if topics := array(t, device["topics"]); len(topics) != 1 || topics[0] != push.TopicThreeD {
+		t.Errorf("topics after re-registering = %v", topics)
+	}
+	ts.expect(ts.do("POST", "/api/v2/push/devices", map[string]any{"token": "phone-b", "platform": "ios", "topics": []string{push.TopicMorning, push.TopicEvening}}), http.StatusCreated)
+	ts.expect(ts.do("POST", "/api/v2/push/devices", map[string]any{"token": "phone-c", "platform": "web", "topics": []string{push.TopicPaper}}), http.StatusCreated)
+	ts.expect(ts.do("POST", "/api/v2/push/devices", "not an object"), http.StatusBadRequest)
+	ts.expect(ts.do("POST", "/api/v2/push/devices", map[string]any{"platform": "android"}), http.StatusUnprocessableEntity)
+	ts.expect(ts.do("POST", "/api/v2/push/devices", map[string]any{"token": "x", "platform": "symbian"}), http.StatusUnprocessableEntity)
+	ts.expect(ts.do("POST", "/api/v2/push/devices", map[string]any{"token": "x", "platform": "ios", "topics": []string{"lottery"}}), http.StatusUnprocessableEntity)
+
+	// Results go to their topic's subscribers only
+	ts.expect(ts.do("POST", "/api/v2/lottery/update", map[string]string{
+		"date": "2025-10-20", "live": "67", "1200set": "1,234.56", "1200value": "12,345.67", "1200": "67",
+	}), http.StatusOK)
+	sent := ts.waitForPush(1)
+	if s := sent[0]; s.Token != "phone-b" || s.Title != "12:01 PM 2D Result" || !strings.HasPrefix(s.Body, "67") || s.Data["date"] != "2025-10-20" {
+		t.Errorf("12:01 notification = %+v", s)
+	}
+	ts.expect(ts.do("POST", "/api/v2/threed", map[string]string{"date": "2025-10-16", "result": "696"}), http.StatusCreated)
+	sent = ts.waitForPush(2)
+	if s := sent[1]; s.Token != "phone-a" || s.Title != "3D Result" || s.Data["result"] != "696" {
+		t.Errorf("3D notification = %+v", s)
+	}
+	ts.expect(ts.do("POST", "/api/admin/paper/images", map[string]any{"type_id": 1, "image_url": "page1.jpg"}), http.StatusCreated)
+	sent = ts.waitForPush(3)
+	if s := sent[2]; s.Token != "phone-c" || !strings.HasSuffix(s.Title, " updated") || s.Data["type_id"] != "1" {
+		t.Errorf("paper notification = %+v", s)
+	}
+
+	// Manual broadcasts from the admin
+	ts.page("/admin/push", "Push Notifications", push.TopicMorning, "All devices")
+	if w := ts.postForm("/admin/push/send", url.Values{"topic": {"all"}, "title": {"Holiday"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("broadcast without a message = %d, want 400", w.Code)
+	}
+	if w := ts.postForm("/admin/push/send", url.Values{"topic": {"lottery"}, "title": {"Holiday"}, "body": {"No draw"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("broadcast to an unknown topic = %d, want 400", w.Code)
+	}
+	w := ts.postForm("/admin/push/send", url.Values{"topic": {"all"}, "title": {"Holiday"}, "body": {"No draw today"}})
+	expectRedirect(t, w, "/admin/push?message="+url.QueryEscape("Sent to 3 devices"))
+	if sent = ts.push.Sent(); len(sent) != 6 || sent[5].Title != "Holiday" {
+		t.Errorf("after broadcast sent = %+v", sent)
+	}
+
+	// Devices the sender rejects are dropped
+	ts.push.Invalid["phone-c"] = true
+	w = ts.postForm("/admin/push/send", url.Values{"topic": {push.TopicPaper}, "title": {"New paper"}, "body": {"Out now"}})
+	expectRedirect(t, w, "/admin/push?message="+url.QueryEscape("Sent to 0 devices, 1 unregistered devices removed"))
+	ts.expect(ts.do("DELETE", "/api/v2/push/devices/phone-c", nil), http.StatusNotFound)
+	ts.expect(ts.do("DELETE", "/api/v2/push/devices/phone-a", nil), http.StatusNoContent)
+
+	metrics := ts.scrape()
+	if got := metrics[`push_notifications_total{topic="all",result="sent"}`]; got < 3 {
+		t.Errorf("broadcast notifications = %v, want at least 3", got)
+	}
+	if got := metrics[`push_notifications_total{topic="paper",result="invalid"}`]; got < 1 {
+		t.Errorf("invalid tokens = %v, want at least 1", got)
+	}
+}
@@ -0,0 +1,403 @@
+// Package server builds the HTTP router with every API and admin route.
+// main and the end-to-end tests both start the application through New.
+package server
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strings"
+	"thaimaster2d/admin"
+	"thaimaster2d/alert"
+	"thaimaster2d/api"
+	"thaimaster2d/apidocs"
+	"thaimaster2d/appconfig"
+	"thaimaster2d/appuser"
+	"thaimaster2d/config"
+	"thaimaster2d/events"
+	"thaimaster2d/gift"
+	"thaimaster2d/live"
+	"thaimaster2d/logging"
+	"thaimaster2d/media"
+	"thaimaster2d/metrics"
+	"thaimaster2d/paper"
+	"thaimaster2d/points"
+	"thaimaster2d/push"
+	"thaimaster2d/slider"
+	"thaimaster2d/storage"
+	"thaimaster2d/threed"
+	"thaimaster2d/twodhistory"
+	"thaimaster2d/version"
+	"thaimaster2d/webhook"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultTemplates is the admin template glob relative to the working directory
+const DefaultTemplates = "admin/templates/*.html"
+
+// Options holds what the router needs from the rest of the application
+type Options struct {
+	// DB enables the data APIs and admin pages. Without it only the live
+	// feed and health check are served.
+	DB *sql.DB
+	// Storage holds uploaded images
+	Storage storage.Backend
+	// Location is the timezone used for admin form defaults and the days
+	// points rewards and gift claims reset on
+	Location *time.Location
+	CORS     config.CORSConfig
+	// Templates is the admin template glob, DefaultTemplates if empty
+	Templates string
+	// Webhooks configures outbound webhook delivery
+	Webhooks webhook.Options
+	// Push sends notifications to devices, nil to only accept registrations
+	Push push.Sender
+	// Users configures app user sign-in and tokens
+	Users appuser.Options
+	// Points sets the rewards app users earn, Location and Alerts are
+	// filled in
+	Points points.Options
+	// Alerts notifies admins of gifts running low, nil to not alert
+	Alerts alert.Sink
+}
+
+// Server is the assembled application
+type Server struct {
+	Router *gin.Engine
+	// Library is nil when no database is configured
+	Library *media.Library
+	// Webhooks delivers events to partner endpoints once started. It is nil
+	// when no database is configured.
+	Webhooks *webhook.Dispatcher
+	// Push notifies subscribed devices once started. It is nil when no
+	// database is configured.
+	Push *push.Dispatcher
+	// Maintenance switches maintenance mode for scheduled windows once
+	// started. It is nil when no database is configured.
+	Maintenance *appconfig.MaintenanceScheduler
+}
+
+// New creates the router and registers all routes. live.Init must be called
+// before the live routes are served.
+func New(opts Options) (*Server, error) {
+	r := gin.New()
+
+	// Tag each request with an ID, log it once served and recover panics
+	r.Use(logging.RequestID(), logging.AccessLog(), metrics.Middleware(), logging.Recovery())
+
+	// Apply the configured CORS policy
+	r.Use(corsMiddleware(opts.CORS))
+
+	// Live routes. The v1 JSON routes are frozen for existing app versions
+	// and point clients at their /api/v2 successors.
+	r.POST("/api/lottery/update", api.Deprecated("/api/v2/lottery/update"), live.UpdateLotteryData)
+	r.GET("/api/lottery/stream", live.StreamLotteryData)
+	r.GET("/api/lottery/current", api.Deprecated("/api/v2/lottery/current"), live.GetCurrentData)
+
+	v2 := r.Group("/api/v2")
+	v2.GET("/lottery/current", live.GetCurrentDataV2)
+	v2.POST("/lottery/update", live.UpdateLotteryDataV2)
+
+	// Health check
+	r.GET("/", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"status":  "ok",
+			"message": "ThaiMaster2D Lottery API Server",
+			"version": "1.0.0",
+		})
+	})
+
+	// Prometheus metrics
+	r.GET("/metrics", metrics.Handler)
+
+	// API documentation
+	r.GET("/api/openapi.json", apidocs.SpecHandler)
+	r.GET("/api/docs", apidocs.DocsHandler)
+
+	s := &Server{Router: r}
+	if opts.DB == nil {
+		return s, nil
+	}
+
+	db := opts.DB
+	metrics.ObserveDB(db)
+	historyRepo, err := twodhistory.NewSQLRepository(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build repositories and the handlers that use them
+	giftRepo := gift.NewSQLRepository(db)
+	sliderRepo := slider.NewSQLRepository(db)
+	threedRepo := threed.NewSQLRepository(db)
+	appConfigRepo := appconfig.NewSQLRepository(db)
+	flagRepo := appconfig.NewSQLFlagRepository(db)
+	maintenanceRepo := appconfig.NewSQLMaintenanceRepository(db)
+	s.Maintenance = appconfig.NewMaintenanceScheduler(appConfigRepo, maintenanceRepo, announceMaintenance)
+	paperRepo := paper.NewSQLRepository(db)
+	s.Library = media.NewLibrary(db, opts.Storage)
+	s.Webhooks = webhook.NewDispatcher(webhook.NewSQLRepository(db), opts.Webhooks)
+	events.Subscribe("webhooks", s.Webhooks.Handle)
+	pushRepo := push.NewSQLRepository(db)
+	s.Push = push.NewDispatcher(pushRepo, opts.Push)
+	events.Subscribe("push", s.Push.Handle)
+	users := appuser.NewService(appuser.NewSQLRepository(db), opts.Users)
+	opts.Points.Location = opts.Location
+	opts.Points.Alerts = opts.Alerts
+	rewards := points.NewService(points.NewSQLRepository(db), users.Repository(), opts.Points)
+	slog.Info("database modules initialized")
+
+	historyHandler := twodhistory.NewHandler(historyRepo)
+	giftHandler := gift.NewHandler(giftRepo, opts.Alerts)
+	sliderHandler := slider.NewHandler(sliderRepo, opts.Location)
+	threedHandler := threed.NewHandler(threedRepo)
+	appConfigHandler := appconfig.NewHandler(appConfigRepo, flagRepo, maintenanceRepo)
+	paperHandler := paper.NewHandler(paperRepo)
+	pushHandler := push.NewHandler(pushRepo)
+	userHandler := appuser.NewHandler(users)
+	pointsHandler := points.NewHandler(rewards)
+	adminHandler := admin.NewHandler(threedRepo, appConfigRepo, flagRepo, s.Maintenance, s.Library, opts.Storage, opts.Location, s.Webhooks, s.Push, users, rewards)
+
+	// Record results published during the insert window, and corrections
+	// the feeders agree on later
+	toHistory := func(data *live.LotteryData) *twodhistory.LotteryData {
+		return &twodhistory.LotteryData{
+			Date:        data.Date,
+			Live:        data.Live,
+			Status:      data.Status,
+			Set1200:     data.Set1200,
+			Value1200:   data.Value1200,
+			Result1200:  data.Result1200,
+			Set430:      data.Set430,
+			Value430:    data.Value430,
+			Result430:   data.Result430,
+			Modern930:   data.Modern930,
+			Internet930: data.Internet930,
+			Modern200:   data.Modern200,
+			Internet200: data.Internet200,
+			UpdateTime:  data.UpdateTime,
+		}
+	}
+	live.SetHistoryInserter(func(ctx context.Context, data *live.LotteryData) error {
+		return historyHandler.InsertFromLotteryData(ctx, toHistory(data))
+	})
+	live.SetHistoryCorrector(func(ctx context.Context, data *live.LotteryData) error {
+		return historyHandler.CorrectFromLotteryData(ctx, toHistory(data))
+	})
+
+	// History routes
+	r.GET("/api/twodhistory", api.Deprecated("/api/v2/history"), historyHandler.GetHistory)
+	r.POST("/api/twodhistory/check", api.Deprecated("/api/v2/history"), historyHandler.CheckAndInsert)
+
+	// Gift routes
+	r.GET("/api/gifts", api.Deprecated("/api/v2/gifts"), giftHandler.GetGifts)
+
+	// Slider routes
+	r.GET("/api/sliders", api.Deprecated("/api/v2/sliders"), sliderHandler.GetSliders)
+
+	// 3D routes
+	r.GET("/api/threed", api.Deprecated("/api/v2/threed"), threedHandler.GetAllResults)
+	r.POST("/api/threed", api.Deprecated("/api/v2/threed"), threedHandler.CreateResult)
+	r.PUT("/api/threed", api.Deprecated("/api/v2/threed/{id}"), threedHandler.UpdateResult)
+	r.DELETE("/api/threed", api.Deprecated("/api/v2/threed/{id}"), threedHandler.DeleteResult)
+
+	// Paper routes (public)
+	r.GET("/api/paper/types", api.Deprecated("/api/v2/paper/types"), paperHandler.GetAllTypes)
+	r.GET("/api/paper/types/:type_id/images", api.Deprecated("/api/v2/paper/types/{type_id}/images"), paperHandler.GetImagesByType)
+
+	// App Config routes (public)
+	r.GET("/api/appconfig", api.Deprecated("/api/v2/appconfig"), appConfigHandler.GetAppConfig)
+	r.GET("/api/appconfig/check", api.Deprecated("/api/v2/appconfig/check"), appConfigHandler.CheckVersion)
+	r.GET("/api/appconfig/flags", userHandler.OptionalUser, appConfigHandler.Flags)
+
+	// v2 routes with the standard response envelope
+	v2.GET("/history", historyHandler.ListV2)
+	v2.POST("/history", historyHandler.CreateV2)
+	v2.PUT("/history/:date", historyHandler.UpdateV2)
+	v2.GET("/gifts", giftHandler.ListV2)
+	v2.GET("/sliders", sliderHandler.ListV2)
+	v2.POST("/sliders/impressions", sliderHandler.ImpressionsV2)
+	v2.GET("/sliders/:id/click", sliderHandler.ClickV2)
+	v2.GET("/threed", threedHandler.ListV2)
+	v2.POST("/threed", threedHandler.CreateV2)
+	v2.PUT("/threed/:id", threedHandler.UpdateV2)
+	v2.DELETE("/threed/:id", threedHandler.DeleteV2)
+	v2.GET("/paper/types", paperHandler.ListTypesV2)
+	v2.GET("/paper/types/:type_id/images", paperHandler.ListImagesV2)
+	v2.GET("/appconfig", appConfigHandler.GetV2)
+	v2.GET("/appconfig/check", appConfigHandler.CheckV2)
+	v2.POST("/push/devices", pushHandler.RegisterV2)
+	v2.DELETE("/push/devices/:token", pushHandler.UnregisterV2)
+	v2.POST("/auth/otp", userHandler.SendOTPV2)
+	v2.POST("/auth/verify", userHandler.VerifyOTPV2)
+	v2.POST("/auth/anonymous", userHandler.AnonymousV2)
+	v2.POST("/auth/refresh", userHandler.RefreshV2)
+	v2.POST("/auth/logout", userHandler.LogoutV2)
+	v2.GET("/me", userHandler.RequireUser, userHandler.GetProfileV2)
+	v2.PUT("/me", userHandler.RequireUser, userHandler.UpdateProfileV2)
+	v2.GET("/points", userHandler.RequireUser, pointsHandler.GetV2)
+	v2.GET("/points/ledger", userHandler.RequireUser, pointsHandler.LedgerV2)
+	v2.POST("/points/checkin", userHandler.RequireUser, pointsHandler.CheckinV2)
+	v2.POST("/points/watch", userHandler.RequireUser, pointsHandler.WatchV2)
+	v2.POST("/points/referral", userHandler.RequireUser, pointsHandler.ReferralV2)
+	v2.POST("/gifts/:id/redeem", userHandler.RequireUser, pointsHandler.RedeemV2)
+	v2.GET("/redemptions", userHandler.RequireUser, pointsHandler.RedemptionsV2)
+	v2.GET("/version", func(c *gin.Context) {
+		api.OK(c, http.StatusOK, version.GetBuildInfo())
+	})
+
+	// Serve uploaded files (legacy /uploads URLs) from the storage backend
+	r.GET("/uploads/:filename", adminHandler.ServeImageHandler)
+
+	// Load HTML templates
+	templates := opts.Templates
+	if templates == "" {
+		templates = DefaultTemplates
+	}
+	r.LoadHTMLGlob(templates)
+
+	// Admin dashboard pages
+	r.GET("/admin", adminHandler.AdminDashboardHandler)
+	r.GET("/admin/gifts", adminHandler.ManageGiftsPageHandler)
+	r.GET("/admin/sliders", adminHandler.ManageSlidersPageHandler)
+	r.GET("/admin/threed", adminHandler.ManageThreeDPageHandler)
+	r.GET("/admin/paper", adminHandler.ManagePaperPageHandler)
+	r.GET("/admin/appconfig", adminHandler.AppConfigPageHandler)
+	r.GET("/admin/media", adminHandler.MediaLibraryPageHandler)
+	r.POST("/admin/appconfig/update", adminHandler.UpdateAppConfigHandler)
+	r.POST("/admin/appconfig/rollback", adminHandler.RollbackAppConfigHandler)
+	r.GET("/admin/flags", adminHandler.FlagsPageHandler)
+	r.GET("/admin/flags/create", adminHandler.CreateFlagPageHandler)
+	r.POST("/admin/flags/create", adminHandler.CreateFlagHandler)
+	r.GET("/admin/flags/edit", adminHandler.EditFlagPageHandler)
+	r.POST("/admin/flags/edit", adminHandler.EditFlagHandler)
+	r.POST("/admin/flags/delete", adminHandler.DeleteFlagHandler)
+	r.GET("/admin/maintenance", adminHandler.MaintenancePageHandler)
+	r.POST("/admin/maintenance/create", adminHandler.CreateMaintenanceHandler)
+	r.POST("/admin/maintenance/cancel", adminHandler.CancelMaintenanceHandler)
+	r.POST("/admin/maintenance/end", adminHandler.EndMaintenanceHandler)
+	r.GET("/admin/gifts/create", adminHandler.CreateGiftPageHandler)
+	r.GET("/admin/sliders/create", adminHandler.CreateSliderPageHandler)
+	r.GET("/admin/threed/create", adminHandler.CreateThreeDPageHandler)
+	r.POST("/admin/threed/create", adminHandler.CreateThreeDHandler)
+	r.GET("/admin/gifts/edit/:id", adminHandler.EditGiftPageHandler)
+	r.GET("/admin/sliders/edit/:id", adminHandler.EditSliderPageHandler)
+	r.GET("/admin/threed/edit", adminHandler.EditThreeDPageHandler)
+	r.POST("/admin/threed/edit", adminHandler.EditThreeDHandler)
+	r.POST("/admin/threed/delete", adminHandler.DeleteThreeDHandler)
+	r.GET("/admin/feeders", adminHandler.FeedersPageHandler)
+	r.POST("/admin/feeders/resolve", adminHandler.ResolveDrawHandler)
+	r.GET("/admin/webhooks", adminHandler.WebhooksPageHandler)
+	r.GET("/admin/webhooks/create", adminHandler.CreateWebhookPageHandler)
+	r.POST("/admin/webhooks/create", adminHandler.CreateWebhookHandler)
+	r.GET("/admin/webhooks/edit", adminHandler.EditWebhookPageHandler)
+	r.POST("/admin/webhooks/edit", adminHandler.EditWebhookHandler)
+	r.POST("/admin/webhooks/delete", adminHandler.DeleteWebhookHandler)
+	r.POST("/admin/webhooks/test", adminHandler.TestWebhookHandler)
+	r.GET("/admin/push", adminHandler.PushPageHandler)
+	r.POST("/admin/push/send", adminHandler.SendPushHandler)
+	r.GET("/admin/users", adminHandler.UsersPageHandler)
+	r.POST("/admin/users/ban", adminHandler.BanUserHandler)
+	r.POST("/admin/users/unban", adminHandler.UnbanUserHandler)
+	r.POST("/admin/users/segments", adminHandler.SetUserSegmentsHandler)
+	r.GET("/admin/redemptions", adminHandler.RedemptionsPageHandler)
+	r.POST("/admin/redemptions/fulfill", adminHandler.FulfillRedemptionHandler)
+	r.POST("/admin/redemptions/reject", adminHandler.RejectRedemptionHandler)
+
+	// Image upload routes
+	r.POST("/api/admin/upload-image", adminHandler.UploadImageHandler)
+	r.DELETE("/api/admin/delete-image/:filename", adminHandler.DeleteImageHandler)
+	r.GET("/api/admin/images/:filename/signed-url", adminHandler.SignedImageURLHandler)
+
+	// Media library routes
+	r.GET("/api/admin/media", s.Library.GetMediaHandler)
+	r.GET("/api/admin/media/orphans", s.Library.GetOrphansHandler)
+	r.POST("/api/admin/media/orphans/cleanup", s.Library.CleanupOrphansHandler)
+
+	// Image serving route (API endpoint to serve images)
+	r.GET("/api/images/:filename", adminHandler.ServeImageHandler)
+
+	// Version/Health check endpoint
+	r.GET("/api/version", api.Deprecated("/api/v2/version"), func(c *gin.Context) {
+		c.JSON(200, version.GetBuildInfo())
+	})
+
+	// Admin API routes for gifts
+	r.GET("/api/admin/gifts", giftHandler.ListAdmin)
+	r.GET("/api/admin/gifts/:id", giftHandler.GetByID)
+	r.POST("/api/admin/gifts", giftHandler.Create)
+	r.PUT("/api/admin/gifts/:id", giftHandler.Update)
+	r.DELETE("/api/admin/gifts/:id", giftHandler.Delete)
+	r.GET("/api/admin/gifts/export", giftHandler.Export)
+	r.POST("/api/admin/gifts/import", giftHandler.Import)
+	r.GET("/api/admin/gift-categories", giftHandler.ListCategories)
+	r.POST("/api/admin/gift-categories", giftHandler.CreateCategory)
+	r.DELETE("/api/admin/gift-categories/:id", giftHandler.DeleteCategory)
+
+	// Admin API routes for sliders
+	r.GET("/api/admin/sliders", sliderHandler.ListAdmin)
+	r.GET("/api/admin/sliders/stats", sliderHandler.Stats)
+	r.GET("/api/admin/sliders/:id", sliderHandler.GetByID)
+	r.POST("/api/admin/sliders", sliderHandler.Create)
+	r.PUT("/api/admin/sliders/order", sliderHandler.Reorder)
+	r.PUT("/api/admin/sliders/:id", sliderHandler.Update)
+	r.DELETE("/api/admin/sliders/:id", sliderHandler.Delete)
+
+	// Admin API routes for paper
+	r.GET("/api/admin/paper/types", paperHandler.GetAllTypesWithImages)
+	r.POST("/api/admin/paper/types", paperHandler.CreateType)
+	r.PUT("/api/admin/paper/types/:id", paperHandler.UpdateType)
+	r.DELETE("/api/admin/paper/types/:id", paperHandler.DeleteType)
+	r.POST("/api/admin/paper/images", paperHandler.CreateImage)
+	r.POST("/api/admin/paper/images/batch", paperHandler.BatchCreateImages)
+	r.PUT("/api/admin/paper/images/:id", paperHandler.UpdateImage)
+	r.DELETE("/api/admin/paper/images/:id", paperHandler.DeleteImage)
+
+	return s, nil
+}
+
+// announceMaintenance tells webhooks and connected apps that a scheduled
+// window switched maintenance mode
+func announceMaintenance(ctx context.Context, config *appconfig.AppConfig, w appconfig.MaintenanceWindow) {
+	events.Publish(ctx, events.AppConfigUpdated, config)
+	live.Announce("maintenance", gin.H{
+		"maintenance_mode": config.MaintenanceMode,
+		"starts_at":        w.StartsAt,
+		"ends_at":          w.EndsAt,
+		"message":          w.Message,
+		"messages":         w.Messages,
+	})
+}
+
+// corsMiddleware sets the CORS headers allowed by the config
+func corsMiddleware(cors config.CORSConfig) gin.HandlerFunc {
+	allowAll := false
+	allowed := make(map[string]bool)
+	for _, origin := range cors.AllowOrigins {
+		if origin == "*" {
+			allowAll = true
+		}
+		allowed[origin] = true
+	}
+	methods := strings.Join(cors.AllowMethods, ", ")
+	headers := strings.Join(cors.AllowHeaders, ", ")
+
+	return func(c *gin.Context) {
+		if allowAll {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		} else if origin := c.GetHeader("Origin"); allowed[origin] {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+		c.Writer.Header().Set("Access-Control-Allow-Methods", methods)
+		c.Writer.Header().Set("Access-Control-Allow-Headers", headers)
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,449 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"thaimaster2d/alert"
+	"thaimaster2d/appuser"
+	"thaimaster2d/config"
+	"thaimaster2d/live"
+	"thaimaster2d/media"
+	"thaimaster2d/points"
+	"thaimaster2d/push"
+	"thaimaster2d/storage"
+	"thaimaster2d/twodhistory"
+	"thaimaster2d/webhook"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// routesHit records every route pattern a test request was served by, so
+// TestMain can fail when a registered route has no test
+var (
+	routesHit   = make(map[string]bool)
+	routesMutex sync.Mutex
+	allRoutes   gin.RoutesInfo
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	media.Configure("http://api.test", "")
+
+	code := m.Run()
+	if code == 0 && flag.Lookup("test.run").Value.String() == "" {
+		code = checkRouteCoverage()
+	}
+	os.Exit(code)
+}
+
+func checkRouteCoverage() int {
+	var missing []string
+	for _, route := range allRoutes {
+		key := route.Method + " " + route.Path
+		if !routesHit[key] {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return 0
+	}
+	sort.Strings(missing)
+	fmt.Fprintf(os.Stderr, "FAIL: routes without an end-to-end test:\n  %s\n", strings.Join(missing, "\n  "))
+	return 1
+}
+
+// testServer is the full router backed by a fresh SQLite file and upload dir
+type testServer struct {
+	t      *testing.T
+	app    *Server
+	router http.Handler
+	store  *storage.Local
+	push   *push.Fake
+	sms    *appuser.FakeSMS
+	// alerts receives alerts sent through Options.Alerts
+	alerts <-chan alert.Alert
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	dir := t.TempDir()
+
+	db, err := twodhistory.OpenDB(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store := storage.NewLocal(filepath.Join(dir, "uploads"), "test-signing-key")
+	storage.SetDefault(store)
+
+	// An empty insert window keeps live updates out of the history table
+	live.Init(live.Config{Location: time.UTC, SSERetry: 5 * time.Second})
+
+	sender := push.NewFake()
+	sms := appuser.NewFakeSMS()
+	alertURL, alerts := alertReceiver(t)
+	app, err := New(Options{
+		DB:        db,
+		Storage:   store,
+		Location:  time.UTC,
+		CORS:      config.Default().CORS,
+		Templates: "../admin/templates/*.html",
+		// Quick retries so webhook tests don't wait
+		Webhooks: webhook.Options{MaxAttempts: 3, Backoff: 20 * time.Millisecond, PollInterval: 10 * time.Millisecond},
+		Push:     sender,
+		Users:    appuser.Options{Secret: "test-jwt-secret", SMS: sms},
+		// Draws can be watched at any time of day
+		Points: points.Options{Checkin: 10, Watch: 5, Referral: 50, WatchWindow: 24 * time.Hour},
+		Alerts: &alert.Webhook{URL: alertURL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allRoutes == nil {
+		allRoutes = app.Router.Routes()
+	}
+
+	ts := &testServer{t: t, app: app, store: store, push: sender, sms: sms, alerts: alerts}
+	ts.router = http.HandlerFunc(ts.serveAndRecord)
+	return ts
+}
+
+// serveAndRecord serves the request and marks the matched route as tested
+func (ts *testServer) serveAndRecord(w http.ResponseWriter, r *http.Request) {
+	if key := ts.match(r.Method, r.URL.Path); key != "" {
+		routesMutex.Lock()
+		routesHit[key] = true
+		routesMutex.Unlock()
+	}
+	ts.app.Router.ServeHTTP(w, r)
+}
+
+// match finds the registered route pattern for a request path
+func (ts *testServer) match(method, path string) string {
+	parts := strings.Split(path, "/")
+	for _, route := range ts.app.Router.Routes() {
+		if route.Method != method {
+			continue
+		}
+		pattern := strings.Split(route.Path, "/")
+		if len(pattern) != len(parts) {
+			continue
+		}
+		ok := true
+		for i, p := range pattern {
+			if !strings.HasPrefix(p, ":") && p != parts[i] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return route.Method + " " + route.Path
+		}
+	}
+	return ""
+}
+
+// do sends a request with an optional JSON body
+func (ts *testServer) do(method, path string, body any) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	return ts.send(ts.request(method, path, body))
+}
+
+// request builds a request with an optional JSON body
+func (ts *testServer) request(method, path string, body any) *http.Request {
+	ts.t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, r)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req
+}
+
+func (ts *testServer) send(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	return w
+}
+
+// expect checks the status code and returns the decoded JSON body
+func (ts *testServer) expect(w *httptest.ResponseRecorder, status int) any {
+	ts.t.Helper()
+	if w.Code != status {
+		ts.t.Fatalf("status = %d, want %d; body: %s", w.Code, status, w.Body.String())
+	}
+	var v any
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+			ts.t.Fatalf("invalid JSON response: %v; body: %s", err, w.Body.String())
+		}
+	}
+	return v
+}
+
+// golden compares the response against testdata/<name>.json
+func (ts *testServer) golden(name string, w *httptest.ResponseRecorder, status int) {
+	ts.t.Helper()
+	ts.expect(w, status)
+	assertGolden(ts.t, name, w.Body.Bytes())
+}
+
+var (
+	volatileKeys   = map[string]bool{"created_at": true, "updated_at": true, "expires_at": true, "updatetime": true, "build_time": true}
+	uploadPrefixRe = regexp.MustCompile(`\b\d{10}_`)
+)
+
+// normalize replaces timestamps and generated upload prefixes so golden
+// files only change when the API does
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			if volatileKeys[k] {
+				v[k] = "<time>"
+			} else {
+				v[k] = normalize(item)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+	case string:
+		return uploadPrefixRe.ReplaceAllString(v, "<unix>_")
+	}
+	return v
+}
+
+func assertGolden(t *testing.T, name string, body []byte) {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("invalid JSON response: %v; body: %s", err, body)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(normalize(v)); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.Bytes()
+
+	path := filepath.Join("testdata", name+".json")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("missing golden file (run go test ./server -update): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("response does not match %s\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// object returns a JSON object field of v
+func object(t *testing.T, v any) map[string]any {
+	t.Helper()
+	m, ok := v.(map[string]any)
+	if !ok {
+		t.Fatalf("expected JSON object, got %T", v)
+	}
+	return m
+}
+
+// array returns a JSON array field of v
+func array(t *testing.T, v any) []any {
+	t.Helper()
+	a, ok := v.([]any)
+	if !ok {
+		t.Fatalf("expected JSON array, got %T", v)
+	}
+	return a
+}
+
+func TestHealthAndVersion(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.golden("health", ts.do("GET", "/", nil), http.StatusOK)
+	ts.golden("version", ts.do("GET", "/api/version", nil), http.StatusOK)
+}
+
+func TestCORS(t *testing.T) {
+	ts := newTestServer(t)
+
+	w := ts.do("OPTIONS", "/api/gifts", nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight status = %d, want 204", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.golden("history_empty", ts.do("GET", "/api/twodhistory", nil), http.StatusOK)
+
+	record := map[string]string{
+		"date": "2025-10-16", "1200set": "1,234.56", "1200value": "12,345.67", "1200": "67",
+		"430set": "1,240.10", "430value": "23,456.78", "430": "08",
+		"930modern": "123", "930internet": "456", "200modern": "789", "200internet": "012",
+	}
+	ts.golden("history_check", ts.do("POST", "/api/twodhistory/check", record), http.StatusOK)
+
+	// A second check for the same date must not duplicate it
+	record["430"] = "99"
+	ts.expect(ts.do("POST", "/api/twodhistory/check", record), http.StatusOK)
+	ts.golden("history_list", ts.do("GET", "/api/twodhistory", nil), http.StatusOK)
+
+	ts.expect(ts.do("POST", "/api/twodhistory/check", "not an object"), http.StatusBadRequest)
+}
+
+func TestThreeD(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.golden("threed_create", ts.do("POST", "/api/threed", map[string]string{"date": "2025-10-16", "result": "696"}), http.StatusCreated)
+	ts.expect(ts.do("POST", "/api/threed", map[string]string{"date": "2025-10-16", "result": "111"}), http.StatusConflict)
+	ts.expect(ts.do("POST", "/api/threed", map[string]string{"date": "16/10/2025", "result": "111"}), http.StatusBadRequest)
+	ts.expect(ts.do("POST", "/api/threed", map[string]string{"date": "2025-10-17", "result": "12"}), http.StatusBadRequest)
+	ts.expect(ts.do("POST", "/api/threed", map[string]string{"date": "2025-11-01", "result": "345"}), http.StatusCreated)
+
+	ts.golden("threed_update", ts.do("PUT", "/api/threed", map[string]any{"id": 1, "result": "697"}), http.StatusOK)
+	ts.expect(ts.do("PUT", "/api/threed", map[string]any{"id": 99, "result": "697"}), http.StatusNotFound)
+	ts.golden("threed_list", ts.do("GET", "/api/threed", nil), http.StatusOK)
+
+	ts.expect(ts.do("DELETE", "/api/threed", map[string]any{"id": 1}), http.StatusNoContent)
+	ts.expect(ts.do("DELETE", "/api/threed", map[string]any{"id": 1}), http.StatusNotFound)
+}
+
+func TestGifts(t *testing.T) {
+	ts := newTestServer(t)
+
+	gift := map[string]any{
+		"name": "Daily Special Tip", "image_link": "1760704284_tip.jpg", "type": "Daily",
+		"description": "Today's tip", "points": 10, "stock": 5, "is_active": true,
+	}
+	ts.golden("gift_create", ts.do("POST", "/api/admin/gifts", gift), http.StatusOK)
+
+	gift["name"], gift["type"], gift["is_active"] = "Weekly Bundle", "Weekly", false
+	ts.expect(ts.do("POST", "/api/admin/gifts", gift), http.StatusOK)
+
+	gift["type"] = "Monthly"
+	ts.expect(ts.do("POST", "/api/admin/gifts", gift), http.StatusBadRequest)
+
+	ts.golden("gifts_public", ts.do("GET", "/api/gifts", nil), http.StatusOK)
+	ts.golden("gifts_admin", ts.do("GET", "/api/admin/gifts", nil), http.StatusOK)
+	ts.golden("gift_get", ts.do("GET", "/api/admin/gifts/1", nil), http.StatusOK)
+	ts.expect(ts.do("GET", "/api/admin/gifts/99", nil), http.StatusNotFound)
+	ts.expect(ts.do("GET", "/api/admin/gifts/abc", nil), http.StatusBadRequest)
+
+	gift["type"], gift["is_active"] = "Weekly", true
+	ts.golden("gift_update", ts.do("PUT", "/api/admin/gifts/2", gift), http.StatusOK)
+	ts.golden("gifts_public_updated", ts.do("GET", "/api/gifts", nil), http.StatusOK)
+
+	ts.golden("gift_delete", ts.do("DELETE", "/api/admin/gifts/1", nil), http.StatusOK)
+	ts.expect(ts.do("DELETE", "/api/admin/gifts/abc", nil), http.StatusBadRequest)
+	ts.expect(ts.do("GET", "/api/admin/gifts/1", nil), http.StatusNotFound)
+}
+
+func TestSliders(t *testing.T) {
+	ts := newTestServer(t)
+
+	slider := map[string]any{
+		"image_link": "https://cdn.example.com/banner.jpg", "forward_link": "https://example.com",
+		"title": "Welcome", "order": 2, "is_active": true,
+	}
+	ts.golden("slider_create", ts.do("POST", "/api/admin/sliders", slider), http.StatusOK)
+
+	slider["image_link"], slider["title"], slider["order"], slider["is_active"] = "1760704284_banner.png", "Promo", 1, false
+	ts.expect(ts.do("POST", "/api/admin/sliders", slider), http.StatusOK)
+
+	ts.golden("sliders_public", ts.do("GET", "/api/sliders", nil), http.StatusOK)
+	ts.golden("sliders_admin", ts.do("GET", "/api/admin/sliders", nil), http.StatusOK)
+	ts.golden("slider_get", ts.do("GET", "/api/admin/sliders/2", nil), http.StatusOK)
+	ts.expect(ts.do("GET", "/api/admin/sliders/99", nil), http.StatusNotFound)
+
+	slider["is_active"] = true
+	ts.golden("slider_update", ts.do("PUT", "/api/admin/sliders/2", slider), http.StatusOK)
+	ts.golden("sliders_public_updated", ts.do("GET", "/api/sliders", nil), http.StatusOK)
+
+	ts.golden("slider_delete", ts.do("DELETE", "/api/admin/sliders/1", nil), http.StatusOK)
+	ts.expect(ts.do("GET", "/api/admin/sliders/1", nil), http.StatusNotFound)
+}
+
+func TestPaper(t *testing.T) {
+	ts := newTestServer(t)
+
+	// The three default types are seeded, new types start at id 4
+	ts.golden("paper_types_default", ts.do("GET", "/api/paper/types", nil), http.StatusOK)
+	ts.golden("paper_type_create", ts.do("POST", "/api/admin/paper/types", map[string]any{"name": "Morning", "display_order": 4}), http.StatusCreated)
+	ts.expect(ts.do("POST", "/api/admin/paper/types", map[string]any{"name": "Evening", "display_order": 5}), http.StatusCreated)
+	ts.expect(ts.do("POST", "/api/admin/paper/types", map[string]any{"display_order": 6}), http.StatusBadRequest)
+
+	ts.golden("paper_image_create", ts.do("POST", "/api/admin/paper/images", map[string]any{
+		"type_id": 4, "image_url": "http://api.test/api/images/1760704284_page1.jpg", "display_order": 1,
+	}), http.StatusCreated)
+	ts.golden("paper_images_batch", ts.do("POST", "/api/admin/paper/images/batch", map[string]any{
+		"type_id": 4, "image_urls": []string{"1760704284_page2.jpg", "https://elsewhere.example.com/page3.jpg"},
+	}), http.StatusCreated)
+
+	ts.golden("paper_types", ts.do("GET", "/api/paper/types", nil), http.StatusOK)
+	ts.golden("paper_type_images", ts.do("GET", "/api/paper/types/4/images", nil), http.StatusOK)
+	ts.expect(ts.do("GET", "/api/paper/types/abc/images", nil), http.StatusBadRequest)
+
+	ts.golden("paper_image_update", ts.do("PUT", "/api/admin/paper/images/2", map[string]any{
+		"type_id": 4, "image_url": "1760704284_page2.jpg", "display_order": 5, "is_active": false,
+	}), http.StatusOK)
+	ts.golden("paper_type_update", ts.do("PUT", "/api/admin/paper/types/5", map[string]any{
+		"name": "Evening Edition", "display_order": 5, "is_active": false,
+	}), http.StatusOK)
+	ts.golden("paper_admin_types", ts.do("GET", "/api/admin/paper/types", nil), http.StatusOK)
+
+	ts.golden("paper_image_delete", ts.do("DELETE", "/api/admin/paper/images/3", nil), http.StatusOK)
+	ts.golden("paper_type_delete", ts.do("DELETE", "/api/admin/paper/types/5", nil), http.StatusOK)
+	ts.expect(ts.do("DELETE", "/api/admin/paper/types/abc", nil), http.StatusBadRequest)
+	ts.golden("paper_types_after_delete", ts.do("GET", "/api/paper/types", nil), http.StatusOK)
+}
+
+func TestAppConfig(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.golden("appconfig_default", ts.do("GET", "/api/appconfig", nil), http.StatusOK)
+	ts.expect(ts.do("GET", "/api/appconfig/check", nil), http.StatusBadRequest)
+	ts.golden("appconfig_check_current", ts.do("GET", "/api/appconfig/check?version=1.0.0", nil), http.StatusOK)
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/csv"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sliderTitles returns the titles of GET path in order
+func (ts *testServer) sliderTitles(path string) []string {
+	ts.t.Helper()
+	var titles []string
+	for _, s := range array(ts.t, ts.expect(ts.do("GET", path, nil), http.StatusOK)) {
+		titles = append(titles, object(ts.t, s)["title"].(string))
+	}
+	return titles
+}
+
+func TestSliderTargeting(t *testing.T) {
+	ts := newTestServer(t)
+
+	now := time.Now().UTC()
+	for i, s := range []map[string]any{
+		{"title": "Everyone"},
+		{"title": "Scheduled", "publish_at": now.Add(time.Hour)},
+		{"title": "Expired", "expire_at": now.Add(-time.Hour)},
+		{"title": "New App", "min_version": "1.2.0"},
+		{"title": "Old App", "max_version": "1.1.9"},
+		{"title": "iOS Burmese", "platforms": []string{" iOS "}, "locales": []string{"my"}},
+		{"title": "Live Window", "publish_at": now.Add(-time.Hour), "expire_at": now.Add(time.Hour), "platforms": []string{"android", "web"}},
+	} {
+		s["image_link"], s["is_active"], s["order"] = "banner.jpg", true, i+1
+		ts.expect(ts.do("POST", "/api/admin/sliders", s), http.StatusOK)
+	}
+	for _, s := range []map[string]any{
+		{"title": "Bad Platform", "platforms": []string{"windows"}},
+		{"title": "Backwards", "publish_at": now, "expire_at": now.Add(-time.Minute)},
+		{"title": "Bad Range", "min_version": "2.0.0", "max_version": "1.0.0"},
+	} {
+		ts.expect(ts.do("POST", "/api/admin/sliders", s), http.StatusBadRequest)
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Everyone"}},
+		{"?version=1.2.0&platform=android", []string{"Everyone", "New App", "Live Window"}},
+		{"?version=1.1.0&platform=ios&locale=my-MM", []string{"Everyone", "Old App", "iOS Burmese"}},
+		// Versions compare by number, not as strings
+		{"?version=1.10.0&platform=web", []string{"Everyone", "New App", "Live Window"}},
+		{"?version=1.1.10&platform=android", []string{"Everyone", "Live Window"}},
+		{"?platform=ios&locale=en", []string{"Everyone"}},
+	} {
+		got := ts.sliderTitles("/api/sliders" + tc.query)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("sliders%s = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+	req := ts.request("GET", "/api/sliders?platform=ios", nil)
+	req.Header.Set("Accept-Language", "my;q=0.9, en")
+	if got := array(t, ts.expect(ts.send(req), http.StatusOK)); len(got) != 2 {
+		t.Errorf("Accept-Language my sees %d sliders, want 2", len(got))
+	}
+	v2 := array(t, object(t, ts.expect(ts.do("GET", "/api/v2/sliders?version=1.5.0", nil), http.StatusOK))["data"])
+	if len(v2) != 2 {
+		t.Errorf("v2 sliders for 1.5.0 = %v", v2)
+	}
+
+	// Drag-and-drop ordering lists every slider once
+	ts.expect(ts.do("PUT", "/api/admin/sliders/order", map[string]any{"ids": []int{7, 1, 2, 3, 4, 5, 6}}), http.StatusOK)
+	if got := ts.sliderTitles("/api/admin/sliders"); got[0] != "Live Window" || got[1] != "Everyone" || len(got) != 7 {
+		t.Errorf("order after reorder = %v", got)
+	}
+	ts.expect(ts.do("PUT", "/api/admin/sliders/order", map[string]any{"ids": []int{2, 1, 3, 4, 5, 6, 99}}), http.StatusNotFound)
+	ts.expect(ts.do("PUT", "/api/admin/sliders/order", map[string]any{"ids": []int{2, 2, 1, 3, 4, 5, 6, 7}}), http.StatusBadRequest)
+	ts.expect(ts.do("PUT", "/api/admin/sliders/order", map[string]any{"ids": []int{2, 2, 1, 3, 4, 5, 6}}), http.StatusBadRequest)
+	ts.expect(ts.do("PUT", "/api/admin/sliders/order", map[string]any{"ids": []int{2, 1}}), http.StatusBadRequest)
+	ts.expect(ts.do("PUT", "/api/admin/sliders/order", map[string]any{}), http.StatusBadRequest)
+	if got := ts.sliderTitles("/api/admin/sliders"); got[0] != "Live Window" || got[2] != "Scheduled" {
+		t.Errorf("failed reorder changed the order to %v", got)
+	}
+}
+
+func TestSliderStats(t *testing.T) {
+	ts := newTestServer(t)
+
+	for _, s := range []map[string]any{
+		{"title": "Promo", "forward_link": "https://example.com/promo"},
+		{"title": "Notice"},
+		// Sliders apps no longer show don't count
+		{"title": "Hidden", "forward_link": "https://example.com/hidden", "is_active": false},
+		{"title": "Ended", "forward_link": "https://example.com/ended", "expire_at": time.Now().Add(-time.Hour)},
+	} {
+		if _, ok := s["is_active"]; !ok {
+			s["is_active"] = true
+		}
+		s["image_link"] = "banner.jpg"
+		ts.expect(ts.do("POST", "/api/admin/sliders", s), http.StatusOK)
+	}
+	for _, s := range array(t, object(t, ts.expect(ts.do("GET", "/api/v2/sliders", nil), http.StatusOK))["data"]) {
+		s := object(t, s)
+		if link, _ := s["click_link"].(string); (s["title"] == "Promo") != strings.HasSuffix(link, "/api/v2/sliders/1/click") {
+			t.Errorf("click_link of %v = %q", s["title"], link)
+		}
+	}
+
+	// Impressions and clicks
+	recorded := object(t, object(t, ts.expect(ts.do("POST", "/api/v2/sliders/impressions", map[string]any{"ids": []int{1, 2, 2, 3, 4, 99}}), http.StatusAccepted))["data"])
+	if recorded["recorded"] != 2.0 {
+		t.Errorf("recorded = %v, want 2", recorded["recorded"])
+	}
+	for range 3 {
+		ts.expect(ts.do("POST", "/api/v2/sliders/impressions", map[string]any{"ids": []int{1}}), http.StatusAccepted)
+	}
+	ts.expect(ts.do("POST", "/api/v2/sliders/impressions", map[string]any{"ids": []int{}}), http.StatusUnprocessableEntity)
+
+	w := ts.do("GET", "/api/v2/sliders/1/click", nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/promo" {
+		t.Errorf("click = %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	ts.expect(ts.do("GET", "/api/v2/sliders/2/click", nil), http.StatusNotFound)
+	ts.expect(ts.do("GET", "/api/v2/sliders/3/click", nil), http.StatusNotFound)
+	ts.expect(ts.do("GET", "/api/v2/sliders/4/click", nil), http.StatusNotFound)
+	ts.expect(ts.do("GET", "/api/v2/sliders/99/click", nil), http.StatusNotFound)
+
+	// Admin statistics
+	stats := object(t, ts.expect(ts.do("GET", "/api/admin/sliders/stats", nil), http.StatusOK))
+	totals := array(t, stats["totals"])
+	if len(totals) != 2 || len(array(t, stats["daily"])) != 2 {
+		t.Fatalf("stats = %v", stats)
+	}
+	promo := object(t, totals[0])
+	if promo["title"] != "Promo" || promo["impressions"] != 4.0 || promo["clicks"] != 1.0 || promo["ctr"] != 0.25 {
+		t.Errorf("promo totals = %v", promo)
+	}
+	if empty := object(t, ts.expect(ts.do("GET", "/api/admin/sliders/stats?from=2020-01-01&to=2020-01-31", nil), http.StatusOK)); len(array(t, empty["totals"])) != 0 {
+		t.Errorf("stats of 2020 = %v", empty)
+	}
+	ts.expect(ts.do("GET", "/api/admin/sliders/stats?from=2026-02-01&to=2026-01-01", nil), http.StatusBadRequest)
+	ts.expect(ts.do("GET", "/api/admin/sliders/stats?from=2020-01-01&to=2026-01-01", nil), http.StatusBadRequest)
+	ts.expect(ts.do("GET", "/api/admin/sliders/stats?from=yesterday", nil), http.StatusBadRequest)
+
+	w = ts.do("GET", "/api/admin/sliders/stats?format=csv", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), "slider-stats-") {
+		t.Fatalf("CSV export = %d, %q", w.Code, w.Header().Get("Content-Disposition"))
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[1][2] != "Promo" || records[1][5] != "0.2500" {
+		t.Errorf("CSV export = %v", records)
+	}
+
+	ts.page("/admin/sliders", "CTR", "Export CSV")
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var otpRe = regexp.MustCompile(`\b\d{6}\b`)
+
+// lastOTP returns the code of the last SMS sent to phone
+func (ts *testServer) lastOTP(phone string) string {
+	ts.t.Helper()
+	sent := ts.sms.Sent()
+	for i := len(sent) - 1; i >= 0; i-- {
+		if sent[i].Phone == phone {
+			return otpRe.FindString(sent[i].Text)
+		}
+	}
+	ts.t.Fatalf("no SMS sent to %s", phone)
+	return ""
+}
+
+// authed sends a request with an access token
+func (ts *testServer) authed(method, path, token string, body any) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	req := ts.request(method, path, body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return ts.send(req)
+}
+
+// signIn signs in with a phone number and returns the session
+func (ts *testServer) signIn(phone string) map[string]any {
+	ts.t.Helper()
+	ts.expect(ts.do("POST", "/api/v2/auth/otp", map[string]string{"phone": phone}), http.StatusAccepted)
+	body := ts.do("POST", "/api/v2/auth/verify", map[string]string{"phone": phone, "code": ts.lastOTP(phone)})
+	return object(ts.t, object(ts.t, ts.expect(body, http.StatusOK))["data"])
+}
+
+func TestUsers(t *testing.T) {
+	ts := newTestServer(t)
+
+	// Phone sign-in with a one-time code
+	ts.expect(ts.do("POST", "/api/v2/auth/otp", map[string]string{"phone": "09123"}), http.StatusUnprocessableEntity)
+	ts.expect(ts.do("POST", "/api/v2/auth/otp", "not an object"), http.StatusBadRequest)
+	ts.expect(ts.do("POST", "/api/v2/auth/otp", map[string]string{"phone": "+95 9 123 456 789"}), http.StatusAccepted)
+	ts.expect(ts.do("POST", "/api/v2/auth/otp", map[string]string{"phone": "+959123456789"}), http.StatusTooManyRequests)
+	code := ts.lastOTP("+959123456789")
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	ts.expect(ts.do("POST", "/api/v2/auth/verify", map[string]string{"phone": "+959123456789", "code": wrong}), http.StatusUnauthorized)
+	session := object(t, object(t, ts.expect(ts.do("POST", "/api/v2/auth/verify", map[string]string{"phone": "+959123456789", "code": code}), http.StatusOK))["data"])
+	if session["token_type"] != "Bearer" || session["access_token"] == "" || session["refresh_token"] == "" {
+		t.Errorf("session = %v", session)
+	}
+	user := object(t, session["user"])
+	if user["phone"] != "+959123456789" || user["anonymous"] != false || user["last_login_at"] == nil {
+		t.Errorf("user = %v", user)
+	}
+	// Codes work once
+	ts.expect(ts.do("POST", "/api/v2/auth/verify", map[string]string{"phone": "+959123456789", "code": code}), http.StatusUnauthorized)
+
+	// Five wrong guesses void a code
+	ts.expect(ts.do("POST", "/api/v2/auth/otp", map[string]string{"phone": "+959987654321"}), http.StatusAccepted)
+	code = ts.lastOTP("+959987654321")
+	if wrong = "000000"; code == wrong {
+		wrong = "111111"
+	}
+	for range 5 {
+		ts.expect(ts.do("POST", "/api/v2/auth/verify", map[string]string{"phone": "+959987654321", "code": wrong}), http.StatusUnauthorized)
+	}
+	ts.expect(ts.do("POST", "/api/v2/auth/verify", map[string]string{"phone": "+959987654321", "code": code}), http.StatusUnauthorized)
+
+	// Profile
+	access := session["access_token"].(string)
+	ts.expect(ts.do("GET", "/api/v2/me", nil), http.StatusUnauthorized)
+	ts.expect(ts.authed("GET", "/api/v2/me", "not-a-token", nil), http.StatusUnauthorized)
+	ts.expect(ts.authed("GET", "/api/v2/me", session["refresh_token"].(string), nil), http.StatusUnauthorized)
+	me := object(t, object(t, ts.expect(ts.authed("PUT", "/api/v2/me", access, map[string]string{"name": " Ko Aung ", "locale": "my"}), http.StatusOK))["data"])
+	if me["name"] != "Ko Aung" || me["locale"] != "my" {
+		t.Errorf("updated profile = %v", me)
+	}
+	me = object(t, object(t, ts.expect(ts.authed("GET", "/api/v2/me", access, nil), http.StatusOK))["data"])
+	if me["name"] != "Ko Aung" || me["id"] != user["id"] {
+		t.Errorf("profile = %v", me)
+	}
+	ts.expect(ts.authed("PUT", "/api/v2/me", access, map[string]string{"name": strings.Repeat("a", 51)}), http.StatusUnprocessableEntity)
+
+	// Refresh tokens rotate and work once
+	refresh := session["refresh_token"].(string)
+	renewed := object(t, object(t, ts.expect(ts.do("POST", "/api/v2/auth/refresh", map[string]string{"refresh_token": refresh}), http.StatusOK))["data"])
+	ts.expect(ts.do("POST", "/api/v2/auth/refresh", map[string]string{"refresh_token": refresh}), http.StatusUnauthorized)
+	ts.expect(ts.do("POST", "/api/v2/auth/refresh", map[string]string{}), http.StatusUnprocessableEntity)
+	ts.expect(ts.do("POST", "/api/v2/auth/logout", map[string]string{"refresh_token": renewed["refresh_token"].(string)}), http.StatusNoContent)
+	ts.expect(ts.do("POST", "/api/v2/auth/refresh", map[string]string{"refresh_token": renewed["refresh_token"].(string)}), http.StatusUnauthorized)
+
+	// Anonymous accounts are kept per device and upgraded by verifying a phone
+	ts.expect(ts.do("POST", "/api/v2/auth/anonymous", map[string]string{}), http.StatusUnprocessableEntity)
+	anon := object(t, object(t, ts.expect(ts.do("POST", "/api/v2/auth/anonymous", map[string]string{"device_id": "device-1"}), http.StatusOK))["data"])
+	anonUser := object(t, anon["user"])
+	if anonUser["anonymous"] != true || anonUser["phone"] != "" {
+		t.Errorf("anonymous user = %v", anonUser)
+	}
+	again := object(t, object(t, ts.expect(ts.do("POST", "/api/v2/auth/anonymous", map[string]string{"device_id": "device-1"}), http.StatusOK))["data"])
+	if object(t, again["user"])["id"] != anonUser["id"] {
+		t.Errorf("device signed in as %v, want %v", object(t, again["user"])["id"], anonUser["id"])
+	}
+	ts.expect(ts.do("POST", "/api/v2/auth/otp", map[string]string{"phone": "+66812345678"}), http.StatusAccepted)
+	req := ts.request("POST", "/api/v2/auth/verify", map[string]string{"phone": "+66812345678", "code": ts.lastOTP("+66812345678")})
+	req.Header.Set("Authorization", "Bearer "+anon["access_token"].(string))
+	upgraded := object(t, object(t, object(t, ts.expect(ts.send(req), http.StatusOK))["data"])["user"])
+	if upgraded["id"] != anonUser["id"] || upgraded["anonymous"] != false || upgraded["phone"] != "+66812345678" {
+		t.Errorf("upgraded user = %v", upgraded)
+	}
+
+	// Admin search, ban and unban
+	ts.page("/admin/users", "App Users", "959123456789", "66812345678")
+	ts.page("/admin/users?q=Aung", "959123456789")
+	id := fmt.Sprint(user["id"])
+	w := ts.postForm("/admin/users/ban", url.Values{"id": {id}, "reason": {"Spam"}, "q": {"Aung"}})
+	expectRedirect(t, w, "/admin/users?message="+url.QueryEscape("User banned")+"&q=Aung")
+	ts.page("/admin/users?q=Aung", "Banned", "Spam")
+	ts.expect(ts.authed("GET", "/api/v2/me", access, nil), http.StatusForbidden)
+	ts.expect(ts.do("POST", "/api/v2/auth/refresh", map[string]string{"refresh_token": refresh}), http.StatusUnauthorized)
+
+	w = ts.postForm("/admin/users/unban", url.Values{"id": {id}})
+	expectRedirect(t, w, "/admin/users?message="+url.QueryEscape("User unbanned"))
+	ts.expect(ts.authed("GET", "/api/v2/me", access, nil), http.StatusOK)
+
+	metrics := ts.scrape()
+	if got := metrics[`app_user_logins_total{method="otp"}`]; got < 2 {
+		t.Errorf("otp logins = %v, want at least 2", got)
+	}
+}
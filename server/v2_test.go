@@ -0,0 +1,101 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestV1Deprecated(t *testing.T) {
+	ts := newTestServer(t)
+
+	for path, successor := range map[string]string{
+		"/api/gifts":           "/api/v2/gifts",
+		"/api/twodhistory":     "/api/v2/history",
+		"/api/lottery/current": "/api/v2/lottery/current",
+	} {
+		w := ts.do("GET", path, nil)
+		if got := w.Header().Get("Deprecation"); got != "true" {
+			t.Errorf("GET %s Deprecation = %q, want true", path, got)
+		}
+		if got, want := w.Header().Get("Link"), "<"+successor+`>; rel="successor-version"`; got != want {
+			t.Errorf("GET %s Link = %q, want %q", path, got, want)
+		}
+	}
+
+	if w := ts.do("GET", "/api/v2/gifts", nil); w.Header().Get("Deprecation") != "" {
+		t.Error("v2 routes must not be marked deprecated")
+	}
+}
+
+func TestV2Lottery(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.golden("v2_lottery_current_default", ts.do("GET", "/api/v2/lottery/current", nil), http.StatusOK)
+	ts.golden("v2_lottery_update", ts.do("POST", "/api/v2/lottery/update", map[string]string{
+		"date": "2025-10-16", "live": "22", "status": "On", "1200": "67", "updatetime": "12:01:45 16/10/2025",
+	}), http.StatusOK)
+	ts.golden("v2_lottery_update_invalid", ts.do("POST", "/api/v2/lottery/update", "{"), http.StatusBadRequest)
+	ts.golden("v2_lottery_current", ts.do("GET", "/api/v2/lottery/current", nil), http.StatusOK)
+	ts.golden("v2_version", ts.do("GET", "/api/v2/version", nil), http.StatusOK)
+}
+
+func TestV2History(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.golden("v2_history_empty", ts.do("GET", "/api/v2/history", nil), http.StatusOK)
+	for day := 1; day <= 5; day++ {
+		record := map[string]string{"date": fmt.Sprintf("2025-10-%02d", day), "1200": "12", "430": "43"}
+		ts.expect(ts.do("POST", "/api/v2/history", record), http.StatusCreated)
+	}
+	ts.golden("v2_history_exists", ts.do("POST", "/api/v2/history", map[string]string{"date": "2025-10-01"}), http.StatusOK)
+	ts.golden("v2_history_invalid_date", ts.do("POST", "/api/v2/history", map[string]string{"date": "01/10/2025"}), http.StatusUnprocessableEntity)
+
+	ts.golden("v2_history_page2", ts.do("GET", "/api/v2/history?page=2&per_page=2", nil), http.StatusOK)
+	ts.golden("v2_history_past_end", ts.do("GET", "/api/v2/history?page=4&per_page=2", nil), http.StatusOK)
+	ts.golden("v2_history_bad_page", ts.do("GET", "/api/v2/history?page=0", nil), http.StatusBadRequest)
+	ts.golden("v2_history_bad_per_page", ts.do("GET", "/api/v2/history?per_page=500", nil), http.StatusBadRequest)
+}
+
+func TestV2ThreeD(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.golden("v2_threed_create", ts.do("POST", "/api/v2/threed", map[string]string{"date": "2025-10-16", "result": "696"}), http.StatusCreated)
+	ts.expect(ts.do("POST", "/api/v2/threed", map[string]string{"date": "2025-11-01", "result": "345"}), http.StatusCreated)
+	ts.golden("v2_threed_duplicate", ts.do("POST", "/api/v2/threed", map[string]string{"date": "2025-10-16", "result": "111"}), http.StatusConflict)
+	ts.golden("v2_threed_invalid_result", ts.do("POST", "/api/v2/threed", map[string]string{"date": "2025-10-17", "result": "12a"}), http.StatusUnprocessableEntity)
+
+	ts.golden("v2_threed_update", ts.do("PUT", "/api/v2/threed/1", map[string]string{"result": "697"}), http.StatusOK)
+	ts.golden("v2_threed_update_missing", ts.do("PUT", "/api/v2/threed/99", map[string]string{"result": "697"}), http.StatusNotFound)
+	ts.golden("v2_threed_bad_id", ts.do("PUT", "/api/v2/threed/abc", map[string]string{"result": "697"}), http.StatusBadRequest)
+	ts.golden("v2_threed_list", ts.do("GET", "/api/v2/threed?per_page=1", nil), http.StatusOK)
+
+	ts.golden("v2_threed_delete", ts.do("DELETE", "/api/v2/threed/1", nil), http.StatusOK)
+	ts.golden("v2_threed_delete_missing", ts.do("DELETE", "/api/v2/threed/1", nil), http.StatusNotFound)
+}
+
+func TestV2Content(t *testing.T) {
+	ts := newTestServer(t)
+
+	for _, gift := range []map[string]any{
+		{"name": "Daily Tip", "type": "Daily", "points": 10, "is_active": true},
+		{"name": "Weekly Bundle", "type": "Weekly", "points": 50, "is_active": true},
+		{"name": "Hidden", "type": "Daily", "is_active": false},
+	} {
+		ts.expect(ts.do("POST", "/api/admin/gifts", gift), http.StatusOK)
+	}
+	ts.golden("v2_gifts", ts.do("GET", "/api/v2/gifts", nil), http.StatusOK)
+	ts.golden("v2_gifts_weekly", ts.do("GET", "/api/v2/gifts?type=Weekly", nil), http.StatusOK)
+
+	ts.expect(ts.do("POST", "/api/admin/sliders", map[string]any{"image_link": "1760704284_banner.png", "title": "Welcome", "is_active": true}), http.StatusOK)
+	ts.golden("v2_sliders", ts.do("GET", "/api/v2/sliders", nil), http.StatusOK)
+
+	ts.expect(ts.do("POST", "/api/admin/paper/images", map[string]any{"type_id": 1, "image_url": "1760704284_page1.jpg"}), http.StatusCreated)
+	ts.golden("v2_paper_types", ts.do("GET", "/api/v2/paper/types?per_page=2", nil), http.StatusOK)
+	ts.golden("v2_paper_images", ts.do("GET", "/api/v2/paper/types/1/images", nil), http.StatusOK)
+	ts.golden("v2_paper_images_missing_type", ts.do("GET", "/api/v2/paper/types/99/images", nil), http.StatusNotFound)
+
+	ts.golden("v2_appconfig", ts.do("GET", "/api/v2/appconfig", nil), http.StatusOK)
+	ts.golden("v2_appconfig_check", ts.do("GET", "/api/v2/appconfig/check?version=1.0.0", nil), http.StatusOK)
+	ts.golden("v2_appconfig_check_missing_version", ts.do("GET", "/api/v2/appconfig/check", nil), http.StatusBadRequest)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"thaimaster2d/alert"
+	"thaimaster2d/live"
+	"time"
+)
+
+// alertReceiver is a webhook endpoint collecting alerts
+func alertReceiver(t *testing.T) (string, <-chan alert.Alert) {
+	t.Helper()
+	alerts := make(chan alert.Alert, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a alert.Alert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Errorf("webhook body: %v", err)
+		}
+		alerts <- a
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, alerts
+}
+
+func waitForAlert(t *testing.T, alerts <-chan alert.Alert, kind string) alert.Alert {
+	t.Helper()
+	select {
+	case a := <-alerts:
+		if a.Kind != kind {
+			t.Fatalf("alert kind = %q, want %q", a.Kind, kind)
+		}
+		return a
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no %s alert", kind)
+		return alert.Alert{}
+	}
+}
+
+func TestFeedWatchdog(t *testing.T) {
+	ts := newTestServer(t)
+
+	// A session spanning the whole day that expects an update every 50ms
+	live.Init(live.Config{
+		Location: time.UTC,
+		SSERetry: 5 * time.Second,
+		Sessions: []live.Session{{Start: 0, End: 24 * time.Hour, MaxGap: 50 * time.Millisecond}},
+	})
+	url, alerts := alertReceiver(t)
+	live.SetAlertSink(alert.Multi{&alert.Webhook{URL: url}})
+	interval := live.WatchdogInterval
+	live.WatchdogInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := live.StartWatchdog(ctx)
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		live.WatchdogInterval = interval
+		live.SetAlertSink(nil)
+	})
+
+	ts.expect(ts.do("POST", "/api/v2/lottery/update", map[string]string{"live": "12", "status": "On"}), http.StatusOK)
+	if html := ts.page("/admin"); !strings.Contains(html, `class="feed-banner hidden"`) {
+		t.Error("feed banner shown while the feed is up")
+	}
+
+	// The feeder goes quiet
+	down := waitForAlert(t, alerts, alert.KindFeedDown)
+	if !strings.Contains(down.Message, "expected every 50ms") {
+		t.Errorf("feed down message = %q", down.Message)
+	}
+	data := object(t, object(t, ts.expect(ts.do("GET", "/api/v2/lottery/current", nil), http.StatusOK))["data"])
+	if data["stale"] != true || data["live"] != "12" {
+		t.Errorf("current data = %v, want the last numbers marked stale", data)
+	}
+	ts.page("/admin", `class="feed-banner"`, "Live feed down", "stale since")
+	if got := ts.scrape()["lottery_feed_stale"]; got != 1 {
+		t.Errorf("lottery_feed_stale = %v, want 1", got)
+	}
+
+	// It comes back
+	cancel()
+	<-done
+	ts.expect(ts.do("POST", "/api/v2/lottery/update", map[string]string{"live": "13", "status": "On"}), http.StatusOK)
+	waitForAlert(t, alerts, alert.KindFeedRecovered)
+	data = object(t, object(t, ts.expect(ts.do("GET", "/api/v2/lottery/current", nil), http.StatusOK))["data"])
+	if _, ok := data["stale"]; ok {
+		t.Errorf("current data = %v, want stale cleared", data)
+	}
+	if live.Feed().Stale {
+		t.Error("feed still stale after an update")
+	}
+}
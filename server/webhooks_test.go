@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"thaimaster2d/events"
+	"thaimaster2d/webhook"
+	"time"
+)
+
+// webhookReceiver is a partner endpoint checking signatures against secret.
+// It answers 500 while failures is above zero, counting it down.
+func webhookReceiver(t *testing.T, secret string, failures *atomic.Int32) (string, <-chan events.Event) {
+	t.Helper()
+	received := make(chan events.Event, 20)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		if err != nil {
+			t.Errorf("timestamp header: %v", err)
+		}
+		if got, want := r.Header.Get(webhook.HeaderSignature), webhook.Sign(secret, timestamp, body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var e events.Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Errorf("webhook body: %v", err)
+		}
+		if r.Header.Get(webhook.HeaderEvent) != e.Type || r.Header.Get(webhook.HeaderID) != e.ID {
+			t.Errorf("headers %v do not match event %s %s", r.Header, e.Type, e.ID)
+		}
+		received <- e
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, received
+}
+
+func waitForWebhook(t *testing.T, received <-chan events.Event, typ string) events.Event {
+	t.Helper()
+	select {
+	case e := <-received:
+		if e.Type != typ {
+			t.Fatalf("webhook event = %q, want %q", e.Type, typ)
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no %s webhook", typ)
+		return events.Event{}
+	}
+}
+
+// waitForDelivery waits for the latest delivery to an endpoint to reach status
+func waitForDelivery(t *testing.T, repo webhook.Repository, endpointID int, status string) webhook.Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := repo.ListDeliveries(endpointID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) == 1 && deliveries[0].Status == status {
+			return deliveries[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("latest delivery = %+v, want %s", deliveries, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	ts := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := ts.app.Webhooks.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	repo := ts.app.Webhooks.Repository()
+
+	var failures atomic.Int32
+	receiver, received := webhookReceiver(t, "topsecret", &failures)
+	ts.page("/admin/webhooks", "No webhooks yet", "No deliveries yet")
+	ts.page("/admin/webhooks/create", "Add Webhook", events.ResultNoon, events.AppConfigUpdated)
+
+	// Endpoints need an http(s) URL and at least one event
+	if w := ts.postForm("/admin/webhooks/create", url.Values{"url": {"ftp://example.com"}, "events": {events.ThreeDCreated}}); w.Code != http.StatusBadRequest {
+		t.Errorf("create with an ftp URL = %d, want 400", w.Code)
+	}
+	if w := ts.postForm("/admin/webhooks/create", url.Values{"url": {receiver}}); w.Code != http.StatusBadRequest {
+		t.Errorf("create without events = %d, want 400", w.Code)
+	}
+	expectRedirect(t, ts.postForm("/admin/webhooks/create", url.Values{
+		"url": {receiver}, "description": {"Partner"}, "secret": {"topsecret"}, "active": {"true"},
+		"events": {events.ThreeDCreated, events.HistoryCorrected},
+	}), "/admin/webhooks?message=Webhook created successfully")
+	// A paused endpoint receives nothing
+	expectRedirect(t, ts.postForm("/admin/webhooks/create", url.Values{
+		"url": {receiver}, "events": {events.ThreeDUpdated},
+	}), "/admin/webhooks?message=Webhook created successfully")
+	if paused, err := repo.GetEndpoint(2); err != nil || paused.Secret == "" || paused.Active {
+		t.Fatalf("paused endpoint = %+v, %v, want a generated secret", paused, err)
+	}
+
+	// Subscribed events are delivered signed
+	created := object(t, object(t, ts.expect(ts.do("POST", "/api/v2/threed", map[string]string{"date": "2025-10-16", "result": "696"}), http.StatusCreated))["data"])
+	e := waitForWebhook(t, received, events.ThreeDCreated)
+	if data := object(t, e.Data); data["result"] != "696" || data["id"] != created["id"] {
+		t.Errorf("threed.created data = %v", e.Data)
+	}
+	ts.expect(ts.do("PUT", "/api/v2/threed/1", map[string]string{"result": "697"}), http.StatusOK)
+
+	// Failed deliveries are retried with backoff
+	ts.expect(ts.do("POST", "/api/v2/history", map[string]string{"date": "2025-10-16", "1200": "67", "430": "08"}), http.StatusCreated)
+	ts.expect(ts.do("PUT", "/api/v2/history/2025-10-16", "not an object"), http.StatusBadRequest)
+	ts.expect(ts.do("PUT", "/api/v2/history/16-10-2025", map[string]string{"430": "09"}), http.StatusUnprocessableEntity)
+	ts.expect(ts.do("PUT", "/api/v2/history/2025-10-17", map[string]string{"430": "09"}), http.StatusNotFound)
+	failures.Store(2)
+	corrected := object(t, object(t, ts.expect(ts.do("PUT", "/api/v2/history/2025-10-16", map[string]string{"1200": "67", "430": "09"}), http.StatusOK))["data"])
+	if corrected["430"] != "09" {
+		t.Errorf("corrected history = %v", corrected)
+	}
+	e = waitForWebhook(t, received, events.HistoryCorrected)
+	if data := object(t, e.Data); data["430"] != "09" {
+		t.Errorf("history.corrected data = %v", e.Data)
+	}
+	if d := waitForDelivery(t, repo, 1, webhook.StatusSucceeded); d.EventType != events.HistoryCorrected || d.Attempts != 3 || d.ResponseStatus != http.StatusOK {
+		t.Errorf("retried delivery = %+v, want succeeded on the third attempt", d)
+	}
+
+	// The test event ignores subscriptions
+	expectRedirect(t, ts.postForm("/admin/webhooks/test", url.Values{"id": {"1"}}), "/admin/webhooks?endpoint_id=1&message=Test event sent")
+	waitForWebhook(t, received, events.Test)
+	expectRedirect(t, ts.postForm("/admin/webhooks/test", url.Values{"id": {"99"}}), "/admin/webhooks?message=Failed to send test event")
+
+	// A delivery that keeps failing gives up after the last attempt
+	failures.Store(10)
+	ts.expect(ts.do("POST", "/api/v2/threed", map[string]string{"date": "2025-10-17", "result": "123"}), http.StatusCreated)
+	if d := waitForDelivery(t, repo, 1, webhook.StatusFailed); d.Attempts != 3 || d.ResponseStatus != http.StatusInternalServerError {
+		t.Errorf("failed delivery = %+v", d)
+	}
+	ts.page("/admin/webhooks?endpoint_id=1", "Partner", "Succeeded", "Failed", "HTTP 500", events.Test)
+
+	// Editing keeps the secret unless a new one is given
+	ts.page("/admin/webhooks/edit?id=1", "Edit Webhook", "topsecret", receiver)
+	if w := ts.do("GET", "/admin/webhooks/edit?id=99", nil); w.Code != http.StatusFound {
+		t.Errorf("editing a missing webhook = %d, want 302", w.Code)
+	}
+	expectRedirect(t, ts.postForm("/admin/webhooks/edit", url.Values{
+		"id": {"1"}, "url": {receiver}, "active": {"true"}, "events": {events.ResultNoon, events.AppConfigUpdated},
+	}), "/admin/webhooks?message=Webhook updated successfully")
+	if endpoint, err := repo.GetEndpoint(1); err != nil || endpoint.Secret != "topsecret" || len(endpoint.Events) != 2 {
+		t.Errorf("edited endpoint = %+v, %v", endpoint, err)
+	}
+
+	// Published results and app config changes are sent once
+	failures.Store(0)
+	noon := map[string]string{"date": "2025-10-20", "live": "67", "1200set": "1,234.56", "1200value": "12,345.67", "1200": "67"}
+	ts.expect(ts.do("POST", "/api/v2/lottery/update", noon), http.StatusOK)
+	ts.expect(ts.do("POST", "/api/v2/lottery/update", noon), http.StatusOK)
+	e = waitForWebhook(t, received, events.ResultNoon)
+	if data := object(t, e.Data); data["date"] != "2025-10-20" || data["result"] != "67" {
+		t.Errorf("result.1200 data = %v", e.Data)
+	}
+	expectRedirect(t, ts.postForm("/admin/appconfig/update", url.Values{"latest_version": {"2.0.0"}, "app_enabled": {"true"}}),
+		"/admin/appconfig?message=Configuration updated successfully")
+	e = waitForWebhook(t, received, events.AppConfigUpdated)
+	if data := object(t, e.Data); data["latest_version"] != "2.0.0" {
+		t.Errorf("appconfig.updated data = %v", e.Data)
+	}
+	if w := ts.postForm("/admin/webhooks/edit", url.Values{"id": {"1"}, "url": {"nope"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("editing with an invalid URL = %d, want 400", w.Code)
+	}
+
+	// Deleting removes the endpoint and its log
+	expectRedirect(t, ts.postForm("/admin/webhooks/delete", url.Values{"id": {"2"}}), "/admin/webhooks?message=Webhook deleted successfully")
+	expectRedirect(t, ts.postForm("/admin/webhooks/delete", url.Values{"id": {"2"}}), "/admin/webhooks?message=Failed to delete webhook")
+	if endpoints, _ := repo.ListEndpoints(); len(endpoints) != 1 {
+		t.Errorf("endpoints after delete = %d, want 1", len(endpoints))
+	}
+
+	metrics := ts.scrape()
+	if got := metrics[`webhook_deliveries_total{result="retry"}`]; got < 4 {
+		t.Errorf("webhook retries = %v, want at least 4", got)
+	}
+	if got := metrics[`webhook_deliveries_total{result="failed"}`]; got < 1 {
+		t.Errorf("failed webhooks = %v, want at least 1", got)
+	}
+}
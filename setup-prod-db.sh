@@ -85,11 +85,11 @@ echo "4. Start the server:"
 echo "   ./thaimaster2d-server"
 echo ""
 echo "   OR run in background:"
-echo "   nohup ./thaimaster2d-server > server.log 2>&1 &"
+echo "   LOG_FILE=logs/server.log nohup ./thaimaster2d-server > /dev/null 2>&1 &"
 echo ""
 echo "5. Check the logs for:"
-echo "   ✅ Database connected successfully!"
-echo "   ✅ All database modules initialized!"
+echo "   \"msg\":\"database connected\""
+echo "   \"msg\":\"database modules initialized\""
 echo ""
 echo "6. Test the endpoints:"
 echo "   curl http://213.136.80.25:4545/admin"
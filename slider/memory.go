@@ -0,0 +1,194 @@
+package slider
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryRepository is an in-memory SliderRepository for tests
+type MemoryRepository struct {
+	mu      sync.Mutex
+	sliders map[int]Slider
+	nextID  int
+	// stats holds the counters by day and slider ID
+	stats map[string]map[int]*Stat
+}
+
+// NewMemoryRepository returns an empty in-memory repository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{sliders: make(map[int]Slider), nextID: 1, stats: make(map[string]map[int]*Stat)}
+}
+
+// ListActive returns active sliders in display order
+func (r *MemoryRepository) ListActive() ([]Slider, error) {
+	var sliders []Slider
+	for _, s := range r.sorted() {
+		if s.IsActive {
+			sliders = append(sliders, s)
+		}
+	}
+	return sliders, nil
+}
+
+// List returns every slider in display order
+func (r *MemoryRepository) List() ([]Slider, error) {
+	return r.sorted(), nil
+}
+
+func (r *MemoryRepository) sorted() []Slider {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sliders := make([]Slider, 0, len(r.sliders))
+	for _, s := range r.sliders {
+		sliders = append(sliders, s)
+	}
+	sort.Slice(sliders, func(i, j int) bool {
+		if sliders[i].Order != sliders[j].Order {
+			return sliders[i].Order < sliders[j].Order
+		}
+		if !sliders[i].CreatedAt.Equal(sliders[j].CreatedAt) {
+			return sliders[i].CreatedAt.After(sliders[j].CreatedAt)
+		}
+		return sliders[i].ID > sliders[j].ID
+	})
+	return sliders
+}
+
+// Get returns a single slider or ErrNotFound
+func (r *MemoryRepository) Get(id int) (*Slider, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sliders[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+// Create adds a slider with the next ID
+func (r *MemoryRepository) Create(slider Slider) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	slider.ID = r.nextID
+	r.nextID++
+	if slider.CreatedAt.IsZero() {
+		slider.CreatedAt = time.Now()
+	}
+	r.sliders[slider.ID] = slider
+	return nil
+}
+
+// Update replaces a slider, keeping its creation time
+func (r *MemoryRepository) Update(slider Slider) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.sliders[slider.ID]
+	if !ok {
+		return nil
+	}
+	slider.CreatedAt = existing.CreatedAt
+	r.sliders[slider.ID] = slider
+	return nil
+}
+
+// Delete removes a slider
+func (r *MemoryRepository) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.sliders, id)
+	return nil
+}
+
+// Reorder numbers the sliders in the order of ids
+func (r *MemoryRepository) Reorder(ids []int) error {
+	current := r.sorted()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	currentIDs := make([]int, len(current))
+	for i, s := range current {
+		currentIDs[i] = s.ID
+	}
+	order, err := reorder(currentIDs, ids)
+	if err != nil {
+		return err
+	}
+	for i, id := range order {
+		s := r.sliders[id]
+		s.Order = i + 1
+		r.sliders[id] = s
+	}
+	return nil
+}
+
+// stat returns the counter of a slider on day, creating it if needed.
+// Callers hold mu.
+func (r *MemoryRepository) stat(id int, day string) *Stat {
+	if r.stats[day] == nil {
+		r.stats[day] = make(map[int]*Stat)
+	}
+	if r.stats[day][id] == nil {
+		r.stats[day][id] = &Stat{SliderID: id, Day: day}
+	}
+	return r.stats[day][id]
+}
+
+// RecordImpressions counts impressions of existing sliders
+func (r *MemoryRepository) RecordImpressions(ids []int, day string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counted := 0
+	for _, id := range ids {
+		if _, ok := r.sliders[id]; ok {
+			r.stat(id, day).Impressions++
+			counted++
+		}
+	}
+	return counted, nil
+}
+
+// RecordClick counts a click or returns ErrNotFound
+func (r *MemoryRepository) RecordClick(id int, day string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sliders[id]; !ok {
+		return ErrNotFound
+	}
+	r.stat(id, day).Clicks++
+	return nil
+}
+
+// DailyStats returns the counters between from and to by day and slider
+func (r *MemoryRepository) DailyStats(from, to string) ([]Stat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var stats []Stat
+	for day, bySlider := range r.stats {
+		if day < from || day > to {
+			continue
+		}
+		for id, st := range bySlider {
+			s := *st
+			s.Title = r.sliders[id].Title
+			s.CTR = ctr(s.Clicks, s.Impressions)
+			stats = append(stats, s)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Day != stats[j].Day {
+			return stats[i].Day < stats[j].Day
+		}
+		return stats[i].SliderID < stats[j].SliderID
+	})
+	return stats, nil
+}
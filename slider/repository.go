@@ -0,0 +1,394 @@
+package slider
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a slider doesn't exist
+var ErrNotFound = errors.New("slider not found")
+
+// ErrOrderMismatch is returned when a new order doesn't list every slider
+// exactly once
+var ErrOrderMismatch = errors.New("ids must list every slider exactly once")
+
+// SliderRepository stores home screen sliders
+type SliderRepository interface {
+	// ListActive returns active sliders in display order
+	ListActive() ([]Slider, error)
+	// List returns every slider in display order
+	List() ([]Slider, error)
+	// Get returns a single slider or ErrNotFound
+	Get(id int) (*Slider, error)
+	Create(slider Slider) error
+	Update(slider Slider) error
+	Delete(id int) error
+	// Reorder numbers the sliders 1, 2, 3... in the order of ids in one
+	// transaction. It changes nothing and returns ErrNotFound if an ID
+	// doesn't exist, or ErrOrderMismatch if ids repeats or leaves out a
+	// slider.
+	Reorder(ids []int) error
+
+	// RecordImpressions counts one impression on day for each existing
+	// slider in ids, returning how many were counted
+	RecordImpressions(ids []int, day string) (int, error)
+	// RecordClick counts a click on day or returns ErrNotFound
+	RecordClick(id int, day string) error
+	// DailyStats returns the counters of every slider for the days from
+	// and to (inclusive, YYYY-MM-DD), ordered by day and slider
+	DailyStats(from, to string) ([]Stat, error)
+}
+
+// SQLRepository is a SliderRepository backed by the sliders table
+type SQLRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository creates the sliders table if needed
+func NewSQLRepository(db *sql.DB) *SQLRepository {
+	r := &SQLRepository{db: db}
+	r.createTable()
+	return r
+}
+
+// Create sliders table
+func (r *SQLRepository) createTable() {
+	query := `
+	CREATE TABLE IF NOT EXISTS sliders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		image_link TEXT NOT NULL,
+		forward_link TEXT,
+		title TEXT,
+		order_num INTEGER DEFAULT 0,
+		is_active INTEGER DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_slider_active ON sliders(is_active);
+	CREATE INDEX IF NOT EXISTS idx_slider_order ON sliders(order_num);
+	CREATE TABLE IF NOT EXISTS slider_stats (
+		slider_id INTEGER NOT NULL,
+		day TEXT NOT NULL,
+		impressions INTEGER NOT NULL DEFAULT 0,
+		clicks INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (slider_id, day)
+	);
+	CREATE INDEX IF NOT EXISTS idx_slider_stats_day ON slider_stats(day);
+	`
+	_, err := r.db.Exec(query)
+	if err == nil {
+		err = r.addColumns()
+	}
+	if err != nil {
+		slog.Error("failed to create sliders table", "error", err)
+	} else {
+		slog.Info("sliders table ready")
+	}
+}
+
+// scheduleColumns were added to sliders for scheduling and targeting
+var scheduleColumns = []struct{ name, definition string }{
+	{"publish_at", "DATETIME"},
+	{"expire_at", "DATETIME"},
+	{"min_version", "TEXT NOT NULL DEFAULT ''"},
+	{"max_version", "TEXT NOT NULL DEFAULT ''"},
+	{"platforms", "TEXT NOT NULL DEFAULT ''"},
+	{"locales", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// addColumns adds the schedule and targeting columns to older tables
+func (r *SQLRepository) addColumns() error {
+	rows, err := r.db.Query("SELECT name FROM pragma_table_info('sliders')")
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, column := range scheduleColumns {
+		if existing[column.name] {
+			continue
+		}
+		if _, err := r.db.Exec("ALTER TABLE sliders ADD COLUMN " + column.name + " " + column.definition); err != nil {
+			return err
+		}
+		slog.Info("added sliders column", "column", column.name)
+	}
+	return nil
+}
+
+const selectSlider = `
+	SELECT id, image_link, forward_link, title, order_num, is_active,
+	       publish_at, expire_at, min_version, max_version, platforms, locales, created_at
+	FROM sliders
+`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanSlider reads a row selected with selectSlider
+func scanSlider(row scanner) (Slider, error) {
+	var slider Slider
+	var platforms, locales string
+	err := row.Scan(&slider.ID, &slider.ImageLink, &slider.ForwardLink, &slider.Title,
+		&slider.Order, &slider.IsActive, &slider.PublishAt, &slider.ExpireAt,
+		&slider.MinVersion, &slider.MaxVersion, &platforms, &locales, &slider.CreatedAt)
+	slider.Platforms = splitList(platforms)
+	slider.Locales = splitList(locales)
+	return slider, err
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+// utc stores optional times in UTC so they compare as text
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// ListActive retrieves all active sliders ordered by order_num
+func (r *SQLRepository) ListActive() ([]Slider, error) {
+	return r.query(selectSlider + `WHERE is_active = 1 ORDER BY order_num ASC, created_at DESC`)
+}
+
+// List retrieves all sliders (including inactive)
+func (r *SQLRepository) List() ([]Slider, error) {
+	return r.query(selectSlider + `ORDER BY order_num ASC, created_at DESC`)
+}
+
+func (r *SQLRepository) query(query string, args ...interface{}) ([]Slider, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sliders []Slider
+	for rows.Next() {
+		slider, err := scanSlider(rows)
+		if err != nil {
+			slog.Warn("skipping unreadable slider row", "error", err)
+			continue
+		}
+		sliders = append(sliders, slider)
+	}
+
+	return sliders, rows.Err()
+}
+
+// Get retrieves a single slider
+func (r *SQLRepository) Get(id int) (*Slider, error) {
+	slider, err := scanSlider(r.db.QueryRow(selectSlider+`WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &slider, nil
+}
+
+// Create adds a new slider
+func (r *SQLRepository) Create(slider Slider) error {
+	query := `
+		INSERT INTO sliders (image_link, forward_link, title, order_num, is_active,
+			publish_at, expire_at, min_version, max_version, platforms, locales)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	_, err := r.db.Exec(query, slider.ImageLink, slider.ForwardLink,
+		slider.Title, slider.Order, slider.IsActive, utc(slider.PublishAt), utc(slider.ExpireAt),
+		slider.MinVersion, slider.MaxVersion, strings.Join(slider.Platforms, ","), strings.Join(slider.Locales, ","))
+	if err != nil {
+		return err
+	}
+	slog.Debug("slider inserted", "title", slider.Title)
+	return nil
+}
+
+// Update updates an existing slider
+func (r *SQLRepository) Update(slider Slider) error {
+	query := `
+		UPDATE sliders
+		SET image_link = $1, forward_link = $2, title = $3, order_num = $4, is_active = $5,
+			publish_at = $6, expire_at = $7, min_version = $8, max_version = $9, platforms = $10, locales = $11
+		WHERE id = $12
+	`
+	_, err := r.db.Exec(query, slider.ImageLink, slider.ForwardLink,
+		slider.Title, slider.Order, slider.IsActive, utc(slider.PublishAt), utc(slider.ExpireAt),
+		slider.MinVersion, slider.MaxVersion, strings.Join(slider.Platforms, ","), strings.Join(slider.Locales, ","),
+		slider.ID)
+	if err != nil {
+		return err
+	}
+	slog.Debug("slider updated", "id", slider.ID, "title", slider.Title)
+	return nil
+}
+
+// Delete deletes a slider
+func (r *SQLRepository) Delete(id int) error {
+	query := `DELETE FROM sliders WHERE id = $1`
+	_, err := r.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+	slog.Debug("slider deleted", "id", id)
+	return nil
+}
+
+// Reorder rewrites order_num for every slider in one transaction
+func (r *SQLRepository) Reorder(ids []int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id FROM sliders ORDER BY order_num ASC, created_at DESC`)
+	if err != nil {
+		return err
+	}
+	var current []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		current = append(current, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	order, err := reorder(current, ids)
+	if err != nil {
+		return err
+	}
+	for i, id := range order {
+		if _, err := tx.Exec(`UPDATE sliders SET order_num = $1 WHERE id = $2`, i+1, id); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.Debug("sliders reordered", "ids", ids)
+	return nil
+}
+
+// reorder checks that ids is a permutation of current. It returns
+// ErrNotFound if ids names a slider that isn't in current and
+// ErrOrderMismatch if it repeats or leaves out one.
+func reorder(current, ids []int) ([]int, error) {
+	exists := make(map[int]bool, len(current))
+	for _, id := range current {
+		exists[id] = true
+	}
+	listed := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if !exists[id] {
+			return nil, fmt.Errorf("%w: %d", ErrNotFound, id)
+		}
+		if listed[id] {
+			return nil, fmt.Errorf("%w: %d is listed twice", ErrOrderMismatch, id)
+		}
+		listed[id] = true
+	}
+	for _, id := range current {
+		if !listed[id] {
+			return nil, fmt.Errorf("%w: %d is missing", ErrOrderMismatch, id)
+		}
+	}
+	return ids, nil
+}
+
+// RecordImpressions upserts the day's impression counters
+func (r *SQLRepository) RecordImpressions(ids []int, day string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	counted := 0
+	for _, id := range ids {
+		result, err := tx.Exec(`
+			INSERT INTO slider_stats (slider_id, day, impressions)
+			SELECT id, $1, 1 FROM sliders WHERE id = $2
+			ON CONFLICT (slider_id, day) DO UPDATE SET impressions = impressions + 1
+		`, day, id)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := result.RowsAffected()
+		counted += int(n)
+	}
+	return counted, tx.Commit()
+}
+
+// RecordClick upserts the day's click counter
+func (r *SQLRepository) RecordClick(id int, day string) error {
+	result, err := r.db.Exec(`
+		INSERT INTO slider_stats (slider_id, day, clicks)
+		SELECT id, $1, 1 FROM sliders WHERE id = $2
+		ON CONFLICT (slider_id, day) DO UPDATE SET clicks = clicks + 1
+	`, day, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DailyStats reads the counters in a date range. Deleted sliders keep
+// their counters with an empty title.
+func (r *SQLRepository) DailyStats(from, to string) ([]Stat, error) {
+	rows, err := r.db.Query(`
+		SELECT st.slider_id, COALESCE(s.title, ''), st.day, st.impressions, st.clicks
+		FROM slider_stats st
+		LEFT JOIN sliders s ON s.id = st.slider_id
+		WHERE st.day BETWEEN $1 AND $2
+		ORDER BY st.day, st.slider_id
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []Stat
+	for rows.Next() {
+		var st Stat
+		if err := rows.Scan(&st.SliderID, &st.Title, &st.Day, &st.Impressions, &st.Clicks); err != nil {
+			return nil, err
+		}
+		st.CTR = ctr(st.Clicks, st.Impressions)
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
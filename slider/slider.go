@@ -1,164 +1,300 @@
 package slider
 
 import (
-	"database/sql"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"thaimaster2d/appconfig"
+	"thaimaster2d/media"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Slider struct {
-	ID          int       `json:"id"`
-	ImageLink   string    `json:"image_link"`
-	ForwardLink string    `json:"forward_link"`
-	Title       string    `json:"title"`
-	Order       int       `json:"order"`
-	IsActive    bool      `json:"is_active"`
-	CreatedAt   time.Time `json:"created_at"`
-}
-
-var db *sql.DB
-
-// InitDB initializes the database connection
-func InitDB(database *sql.DB) {
-	db = database
-	createTable()
-}
-
-// Create sliders table and uploads directory
-func createTable() {
-	query := `
-	CREATE TABLE IF NOT EXISTS sliders (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		image_link TEXT NOT NULL,
-		forward_link TEXT,
-		title TEXT,
-		order_num INTEGER DEFAULT 0,
-		is_active INTEGER DEFAULT 1,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-	CREATE INDEX IF NOT EXISTS idx_slider_active ON sliders(is_active);
-	CREATE INDEX IF NOT EXISTS idx_slider_order ON sliders(order_num);
-	`
-	_, err := db.Exec(query)
-	if err != nil {
-		log.Printf("❌ Error creating sliders table: %v", err)
-	} else {
-		log.Println("✅ Sliders table ready")
+	ID          int        `json:"id"`
+	ImageLink   media.Link `json:"image_link"`
+	ForwardLink string     `json:"forward_link"`
+	Title       string     `json:"title"`
+	Order       int        `json:"order"`
+	IsActive    bool       `json:"is_active"`
+	// PublishAt and ExpireAt limit when an active slider is shown, nil for
+	// no limit
+	PublishAt *time.Time `json:"publish_at"`
+	ExpireAt  *time.Time `json:"expire_at"`
+	// MinVersion and MaxVersion limit the app versions shown the slider,
+	// both inclusive and empty for no limit
+	MinVersion string `json:"min_version"`
+	MaxVersion string `json:"max_version"`
+	// Platforms and Locales limit the apps shown the slider, empty for all.
+	// A locale such as "en" also matches "en-US".
+	Platforms []string  `json:"platforms"`
+	Locales   []string  `json:"locales"`
+	CreatedAt time.Time `json:"created_at"`
+	// ClickLink counts a click and redirects to ForwardLink. Only v2 lists
+	// set it.
+	ClickLink string `json:"click_link,omitempty"`
+}
+
+// Client describes the app asking for sliders. Empty fields are unknown.
+type Client struct {
+	Version  string
+	Platform string
+	Locale   string
+}
+
+// ClientFrom reads the ?version=, ?platform= and ?locale= of a request,
+// falling back to Accept-Language for the locale
+func ClientFrom(c *gin.Context) Client {
+	locale := c.Query("locale")
+	if locale == "" {
+		locale, _, _ = strings.Cut(c.GetHeader("Accept-Language"), ",")
+		locale, _, _ = strings.Cut(locale, ";")
+	}
+	return Client{
+		Version:  strings.TrimSpace(c.Query("version")),
+		Platform: strings.ToLower(strings.TrimSpace(c.Query("platform"))),
+		Locale:   strings.ToLower(strings.TrimSpace(locale)),
 	}
 }
 
-// GetActiveSliders retrieves all active sliders ordered by order_num
-func GetActiveSliders() ([]Slider, error) {
-	query := `
-		SELECT id, image_link, forward_link, title, order_num, is_active, created_at
-		FROM sliders
-		WHERE is_active = 1
-		ORDER BY order_num ASC, created_at DESC
-	`
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
+// Live reports whether the slider is active and scheduled at t
+func (s Slider) Live(t time.Time) bool {
+	if !s.IsActive {
+		return false
+	}
+	if s.PublishAt != nil && t.Before(*s.PublishAt) {
+		return false
 	}
-	defer rows.Close()
+	return s.ExpireAt == nil || t.Before(*s.ExpireAt)
+}
 
-	var sliders []Slider
-	for rows.Next() {
-		var slider Slider
-		err := rows.Scan(&slider.ID, &slider.ImageLink, &slider.ForwardLink,
-			&slider.Title, &slider.Order, &slider.IsActive, &slider.CreatedAt)
-		if err != nil {
-			log.Printf("Error scanning slider: %v", err)
-			continue
+// Visible reports whether the slider is shown to client at t. A client
+// that doesn't say its version, platform or locale only sees sliders that
+// don't target it.
+func (s Slider) Visible(t time.Time, client Client) bool {
+	if !s.Live(t) {
+		return false
+	}
+	if s.MinVersion != "" && (client.Version == "" || appconfig.CompareVersions(client.Version, s.MinVersion) < 0) {
+		return false
+	}
+	if s.MaxVersion != "" && (client.Version == "" || appconfig.CompareVersions(client.Version, s.MaxVersion) > 0) {
+		return false
+	}
+	if len(s.Platforms) > 0 && !slices.Contains(s.Platforms, client.Platform) {
+		return false
+	}
+	return len(s.Locales) == 0 || slices.ContainsFunc(s.Locales, func(locale string) bool {
+		return client.Locale == locale || strings.HasPrefix(client.Locale, locale+"-")
+	})
+}
+
+// normalize trims the targeting lists and lowercases their values
+func (s *Slider) normalize() {
+	clean := func(values []string) []string {
+		out := []string{}
+		for _, v := range values {
+			if v = strings.ToLower(strings.TrimSpace(v)); v != "" && !slices.Contains(out, v) {
+				out = append(out, v)
+			}
+		}
+		return out
+	}
+	s.Platforms = clean(s.Platforms)
+	s.Locales = clean(s.Locales)
+	s.MinVersion = strings.TrimSpace(s.MinVersion)
+	s.MaxVersion = strings.TrimSpace(s.MaxVersion)
+}
+
+// Validate checks a normalized slider before it is saved
+func Validate(s Slider) error {
+	for _, platform := range s.Platforms {
+		if !slices.Contains(appconfig.Platforms, platform) {
+			return fmt.Errorf("unknown platform %q, want android, ios or web", platform)
+		}
+	}
+	if s.PublishAt != nil && s.ExpireAt != nil && !s.ExpireAt.After(*s.PublishAt) {
+		return errors.New("expire_at must be after publish_at")
+	}
+	for _, v := range []string{s.MinVersion, s.MaxVersion} {
+		if _, err := appconfig.ParseVersion(v); v != "" && err != nil {
+			return err
 		}
-		sliders = append(sliders, slider)
 	}
+	if s.MinVersion != "" && s.MaxVersion != "" && appconfig.CompareVersions(s.MinVersion, s.MaxVersion) > 0 {
+		return errors.New("min_version must not be above max_version")
+	}
+	return nil
+}
 
-	return sliders, nil
+// bind reads a slider from the request body, replying 400 if it can't be
+// saved
+func bind(c *gin.Context) (Slider, bool) {
+	var s Slider
+	if err := c.BindJSON(&s); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return s, false
+	}
+	s.normalize()
+	if err := Validate(s); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return s, false
+	}
+	return s, true
+}
+
+// Handler serves the slider API
+type Handler struct {
+	repo SliderRepository
+	// loc is the timezone impressions and clicks are counted by day in
+	loc *time.Location
 }
 
-// GetAllSlidersForAdmin retrieves all sliders (including inactive)
-func GetAllSlidersForAdmin() ([]Slider, error) {
-	query := `
-		SELECT id, image_link, forward_link, title, order_num, is_active, created_at
-		FROM sliders
-		ORDER BY order_num ASC, created_at DESC
-	`
-	rows, err := db.Query(query)
+// NewHandler creates a slider handler backed by repo, counting daily
+// statistics in loc (time.Local if nil)
+func NewHandler(repo SliderRepository, loc *time.Location) *Handler {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &Handler{repo: repo, loc: loc}
+}
+
+// visible returns the active sliders the requesting app should show now
+func (h *Handler) visible(c *gin.Context) ([]Slider, error) {
+	sliders, err := h.repo.ListActive()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	now, client := time.Now(), ClientFrom(c)
+	return slices.DeleteFunc(sliders, func(s Slider) bool { return !s.Visible(now, client) }), nil
+}
 
-	var sliders []Slider
-	for rows.Next() {
-		var slider Slider
-		err := rows.Scan(&slider.ID, &slider.ImageLink, &slider.ForwardLink,
-			&slider.Title, &slider.Order, &slider.IsActive, &slider.CreatedAt)
-		if err != nil {
-			log.Printf("Error scanning slider: %v", err)
-			continue
-		}
-		sliders = append(sliders, slider)
+// GetSliders returns the sliders scheduled now and targeting the client
+func (h *Handler) GetSliders(c *gin.Context) {
+	sliders, err := h.visible(c)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if sliders == nil {
+		sliders = []Slider{}
 	}
 
-	return sliders, nil
+	c.JSON(http.StatusOK, sliders)
 }
 
-// InsertSlider adds a new slider
-func InsertSlider(slider Slider) error {
-	query := `
-		INSERT INTO sliders (image_link, forward_link, title, order_num, is_active)
-		VALUES ($1, $2, $3, $4, $5)
-	`
-	_, err := db.Exec(query, slider.ImageLink, slider.ForwardLink,
-		slider.Title, slider.Order, slider.IsActive)
+// ListAdmin returns all sliders (including inactive)
+func (h *Handler) ListAdmin(c *gin.Context) {
+	sliders, err := h.repo.List()
 	if err != nil {
-		log.Printf("❌ Error inserting slider: %v", err)
-		return err
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	log.Printf("✅ Slider inserted: %s", slider.Title)
-	return nil
+	c.JSON(http.StatusOK, sliders)
 }
 
-// UpdateSlider updates an existing slider
-func UpdateSlider(slider Slider) error {
-	query := `
-		UPDATE sliders
-		SET image_link = $1, forward_link = $2, title = $3, order_num = $4, is_active = $5
-		WHERE id = $6
-	`
-	_, err := db.Exec(query, slider.ImageLink, slider.ForwardLink,
-		slider.Title, slider.Order, slider.IsActive, slider.ID)
+// GetByID returns a single slider by ID
+func (h *Handler) GetByID(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		log.Printf("❌ Error updating slider: %v", err)
-		return err
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
 	}
-	log.Printf("✅ Slider updated: %s", slider.Title)
-	return nil
-}
 
-// DeleteSlider deletes a slider
-func DeleteSlider(id int) error {
-	query := `DELETE FROM sliders WHERE id = $1`
-	_, err := db.Exec(query, id)
+	slider, err := h.repo.Get(id)
 	if err != nil {
-		log.Printf("❌ Error deleting slider: %v", err)
-		return err
+		if errors.Is(err, ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Slider not found"})
+		} else {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
 	}
-	log.Printf("✅ Slider deleted: ID %d", id)
-	return nil
+
+	c.JSON(http.StatusOK, slider)
+}
+
+// Create adds a new slider
+func (h *Handler) Create(c *gin.Context) {
+	newSlider, ok := bind(c)
+	if !ok {
+		return
+	}
+	if err := h.repo.Create(newSlider); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Slider created"})
+}
+
+// Update updates an existing slider
+func (h *Handler) Update(c *gin.Context) {
+	updatedSlider, ok := bind(c)
+	if !ok {
+		return
+	}
+	if updatedSlider.ID == 0 {
+		updatedSlider.ID, _ = strconv.Atoi(c.Param("id"))
+	}
+	if err := h.repo.Update(updatedSlider); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Slider updated"})
 }
 
-// GetSlidersHandler returns active sliders
-func GetSlidersHandler(c *gin.Context) {
-	sliders, err := GetActiveSliders()
+// Delete deletes a slider
+func (h *Handler) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	if err := h.repo.Delete(id); err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"message": "Slider deleted"})
+}
 
-	c.JSON(http.StatusOK, sliders)
+// Reorder sets the display order from a drag-and-drop list of every
+// slider ID
+func (h *Handler) Reorder(c *gin.Context) {
+	var input struct {
+		IDs []int `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(input.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids is required"})
+		return
+	}
+
+	err := h.repo.Reorder(input.IDs)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, ErrOrderMismatch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Slider order saved"})
 }
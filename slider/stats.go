@@ -0,0 +1,212 @@
+package slider
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"thaimaster2d/api"
+	"thaimaster2d/metrics"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImpressions limits the slider IDs reported in one request
+const maxImpressions = 50
+
+// maxStatsDays limits the date range of a statistics request
+const maxStatsDays = 366
+
+var interactions = metrics.NewCounter("slider_events_total",
+	"Slider impressions and clicks reported by apps", "event")
+
+// Stat holds the impression and click counters of a slider. Day is empty
+// for totals over a date range.
+type Stat struct {
+	SliderID    int    `json:"slider_id"`
+	Title       string `json:"title"`
+	Day         string `json:"day,omitempty"`
+	Impressions int    `json:"impressions"`
+	Clicks      int    `json:"clicks"`
+	// CTR is clicks per impression, 0 without impressions
+	CTR float64 `json:"ctr"`
+}
+
+// ctr returns the click-through rate rounded to four decimals
+func ctr(clicks, impressions int) float64 {
+	if impressions == 0 {
+		return 0
+	}
+	return math.Round(float64(clicks)/float64(impressions)*10000) / 10000
+}
+
+// Totals adds up daily counters per slider, ordered by slider ID
+func Totals(daily []Stat) []Stat {
+	bySlider := make(map[int]*Stat)
+	var ids []int
+	for _, st := range daily {
+		total, ok := bySlider[st.SliderID]
+		if !ok {
+			total = &Stat{SliderID: st.SliderID, Title: st.Title}
+			bySlider[st.SliderID] = total
+			ids = append(ids, st.SliderID)
+		}
+		total.Impressions += st.Impressions
+		total.Clicks += st.Clicks
+	}
+	slices.Sort(ids)
+
+	totals := make([]Stat, 0, len(ids))
+	for _, id := range ids {
+		total := bySlider[id]
+		total.CTR = ctr(total.Clicks, total.Impressions)
+		totals = append(totals, *total)
+	}
+	return totals
+}
+
+// WriteStatsCSV writes daily counters as CSV with a header row
+func WriteStatsCSV(w io.Writer, daily []Stat) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"day", "slider_id", "title", "impressions", "clicks", "ctr"})
+	for _, st := range daily {
+		cw.Write([]string{
+			st.Day, strconv.Itoa(st.SliderID), st.Title,
+			strconv.Itoa(st.Impressions), strconv.Itoa(st.Clicks),
+			strconv.FormatFloat(st.CTR, 'f', 4, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// today returns the current day in the handler's timezone
+func (h *Handler) today() string {
+	return time.Now().In(h.loc).Format("2006-01-02")
+}
+
+// ImpressionsV2 handles POST /api/v2/sliders/impressions. Apps report the
+// sliders they showed; unknown IDs and sliders that aren't live are
+// ignored.
+func (h *Handler) ImpressionsV2(c *gin.Context) {
+	var input struct {
+		IDs []int `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+	if len(input.IDs) == 0 || len(input.IDs) > maxImpressions {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "ids must list 1 to 50 sliders")
+		return
+	}
+	active, err := h.repo.ListActive()
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to record impressions")
+		return
+	}
+	now := time.Now()
+	var ids []int
+	for _, s := range active {
+		if s.Live(now) && slices.Contains(input.IDs, s.ID) {
+			ids = append(ids, s.ID)
+		}
+	}
+
+	counted, err := h.repo.RecordImpressions(ids, h.today())
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to record impressions")
+		return
+	}
+	interactions.Add(float64(counted), "impression")
+	api.OK(c, http.StatusAccepted, gin.H{"recorded": counted})
+}
+
+// ClickV2 handles GET /api/v2/sliders/:id/click by counting the click and
+// redirecting to the slider's forward link. Like impressions, clicks only
+// count on live sliders.
+func (h *Handler) ClickV2(c *gin.Context) {
+	id, ok := api.ParamID(c, "id")
+	if !ok {
+		return
+	}
+	s, err := h.repo.Get(id)
+	if err == nil && (s.ForwardLink == "" || !s.Live(time.Now())) {
+		err = ErrNotFound
+	}
+	if err == nil {
+		err = h.repo.RecordClick(id, h.today())
+	}
+	switch {
+	case errors.Is(err, ErrNotFound):
+		api.Error(c, http.StatusNotFound, api.CodeNotFound, "Slider not found or has no link")
+	case err != nil:
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to record click")
+	default:
+		interactions.Inc("click")
+		c.Redirect(http.StatusFound, s.ForwardLink)
+	}
+}
+
+// Stats returns per-slider totals and daily counters for ?from= to ?to=
+// (YYYY-MM-DD, the last 30 days by default) as JSON, or the daily counters
+// as a CSV download with ?format=csv
+func (h *Handler) Stats(c *gin.Context) {
+	today, _ := time.Parse("2006-01-02", h.today())
+	from, err := time.Parse("2006-01-02", c.DefaultQuery("from", today.AddDate(0, 0, -29).Format("2006-01-02")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date such as 2026-01-02"})
+		return
+	}
+	to, err := time.Parse("2006-01-02", c.DefaultQuery("to", today.Format("2006-01-02")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date such as 2026-01-02"})
+		return
+	}
+	if to.Before(from) || to.Sub(from) >= maxStatsDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from and the range can be at most 366 days"})
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+
+	fromDay, toDay := from.Format("2006-01-02"), to.Format("2006-01-02")
+	daily, err := h.repo.DailyStats(fromDay, toDay)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if daily == nil {
+		daily = []Stat{}
+	}
+
+	if format == "csv" {
+		var buf bytes.Buffer
+		if err := WriteStatsCSV(&buf, daily); err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="slider-stats-`+fromDay+`-to-`+toDay+`.csv"`)
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":   fromDay,
+		"to":     toDay,
+		"totals": Totals(daily),
+		"daily":  daily,
+	})
+}
@@ -0,0 +1,33 @@
+package slider
+
+import (
+	"fmt"
+	"net/http"
+	"thaimaster2d/api"
+	"thaimaster2d/media"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListV2 handles GET /api/v2/sliders with pagination, showing only the
+// sliders scheduled now and targeting the client
+func (h *Handler) ListV2(c *gin.Context) {
+	page, ok := api.ParsePage(c)
+	if !ok {
+		return
+	}
+
+	sliders, err := h.visible(c)
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to fetch sliders")
+		return
+	}
+
+	for i := range sliders {
+		if sliders[i].ForwardLink != "" {
+			sliders[i].ClickLink = media.PublicURL(fmt.Sprintf("/api/v2/sliders/%d/click", sliders[i].ID))
+		}
+	}
+	api.Paginate(c, sliders, page)
+}
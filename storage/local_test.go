@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocal(filepath.Join(t.TempDir(), "uploads"), "test-key")
+
+	if objects, err := l.List(ctx); err != nil || len(objects) != 0 {
+		t.Fatalf("List before the first upload = %v, %v", objects, err)
+	}
+	for _, key := range []string{"a.png", "b.jpg"} {
+		if err := l.Put(ctx, key, strings.NewReader("image "+key), -1, "image/png"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A failed upload leaves no temporary file behind
+	if err := l.Put(ctx, "c.png", failingReader{}, -1, "image/png"); err == nil {
+		t.Error("Put with a failing reader succeeded")
+	}
+
+	r, obj, err := l.Get(ctx, "a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(r)
+	r.Close()
+	if string(content) != "image a.png" || obj.Size != 11 || obj.ContentType != "image/png" {
+		t.Errorf("Get = %q, %+v", content, obj)
+	}
+	if obj, err := l.Stat(ctx, "b.jpg"); err != nil || obj.Size != 11 || obj.ContentType != "image/jpeg" {
+		t.Errorf("Stat = %+v, %v", obj, err)
+	}
+
+	objects, err := l.List(ctx)
+	if err != nil || len(objects) != 2 || objects[0].Key != "a.png" || objects[1].Key != "b.jpg" {
+		t.Errorf("List = %+v, %v", objects, err)
+	}
+	entries, _ := os.ReadDir(l.Dir())
+	if len(entries) != 2 {
+		t.Errorf("uploads directory holds %d files, want 2", len(entries))
+	}
+
+	if err := l.Delete(ctx, "a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := l.Get(ctx, "a.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get deleted = %v, want ErrNotFound", err)
+	}
+	if _, err := l.Stat(ctx, "a.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat deleted = %v, want ErrNotFound", err)
+	}
+	if err := l.Delete(ctx, "a.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete deleted = %v, want ErrNotFound", err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../secret.png", `a\b.png`} {
+		if err := l.Put(ctx, key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put(%q) accepted", key)
+		}
+		if _, err := l.SignedURL(key, time.Minute); err == nil {
+			t.Errorf("SignedURL(%q) accepted", key)
+		}
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+func TestLocalSignedURL(t *testing.T) {
+	l := NewLocal(t.TempDir(), "test-key")
+
+	signed, err := l.SignedURL("a.png", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil || u.Path != "/api/images/a.png" {
+		t.Fatalf("SignedURL = %q, %v", signed, err)
+	}
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+	if !l.VerifySignature("a.png", expires, signature) {
+		t.Fatal("valid signature rejected")
+	}
+
+	later := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	for name, tc := range map[string]struct{ key, expires, signature string }{
+		"other key":     {"b.png", expires, signature},
+		"later expiry":  {"a.png", later, signature},
+		"bad expiry":    {"a.png", "soon", signature},
+		"bad signature": {"a.png", expires, strings.Repeat("0", len(signature))},
+		"no signature":  {"a.png", expires, ""},
+	} {
+		if l.VerifySignature(tc.key, tc.expires, tc.signature) {
+			t.Errorf("%s: signature accepted", name)
+		}
+	}
+	if NewLocal(t.TempDir(), "other-key").VerifySignature("a.png", expires, signature) {
+		t.Error("signature accepted with another signing key")
+	}
+
+	expired, _ := l.SignedURL("a.png", -time.Second)
+	u, _ = url.Parse(expired)
+	if l.VerifySignature("a.png", u.Query().Get("expires"), u.Query().Get("signature")) {
+		t.Error("expired signature accepted")
+	}
+}
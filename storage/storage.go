@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when an object doesn't exist in the backend
+var ErrNotFound = errors.New("storage: object not found")
+
+// Object describes a stored file
+type Object struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+// Backend is where uploaded files are stored
+type Backend interface {
+	// Put stores the content of r under key. size may be -1 if unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens an object for reading. The caller must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	// Stat returns object metadata without reading its content
+	Stat(ctx context.Context, key string) (*Object, error)
+	// Delete removes an object
+	Delete(ctx context.Context, key string) error
+	// List returns every stored object
+	List(ctx context.Context) ([]Object, error)
+	// URL returns the URL clients should use to fetch an object
+	URL(key string) string
+	// SignedURL returns a URL granting temporary read access to an object
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+var defaultBackend Backend
+
+// SetDefault sets the backend used by the upload handlers
+func SetDefault(b Backend) {
+	defaultBackend = b
+}
+
+// Default returns the backend used by the upload handlers.
+// It falls back to the local uploads directory if none was configured.
+func Default() Backend {
+	if defaultBackend == nil {
+		defaultBackend = NewLocal("uploads", "")
+	}
+	return defaultBackend
+}
+
+// validKey rejects keys that could escape the storage root
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "..") || strings.Contains(key, "\\") {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	return nil
+}
+
+// randomKey generates a signing key for when none is configured
+func randomKey() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic("storage: failed to generate signing key: " + err.Error())
+	}
+	slog.Warn("no storage signing key configured, signed URLs will expire on restart")
+	return hex.EncodeToString(buf)
+}
@@ -26,16 +26,16 @@ curl -X POST http://localhost:8080/api/lottery/update \
   -d '{
     "live": "22",
     "status": "On",
-    "set1200": "15",
-    "value1200": "89",
-    "result1200": "589",
-    "set430": "67",
-    "value430": "34",
-    "result430": "134",
-    "modern930": "845",
-    "internet930": "921",
-    "modern200": "376",
-    "internet200": "542",
+    "1200set": "15",
+    "1200value": "89",
+    "1200": "589",
+    "430set": "67",
+    "430value": "34",
+    "430": "134",
+    "930modern": "845",
+    "930internet": "921",
+    "200modern": "376",
+    "200internet": "542",
     "updatetime": "12:01:45 16/10/2025"
   }' | jq .
 echo ""
@@ -0,0 +1,89 @@
+package threed
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryRepository is an in-memory ThreeDRepository for tests
+type MemoryRepository struct {
+	mu      sync.Mutex
+	results map[int]ThreeDResult
+	nextID  int
+}
+
+// NewMemoryRepository returns an empty in-memory repository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{results: make(map[int]ThreeDResult), nextID: 1}
+}
+
+// List returns every result, newest date first
+func (r *MemoryRepository) List() ([]ThreeDResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var results []ThreeDResult
+	for _, result := range r.results {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Date > results[j].Date })
+	return results, nil
+}
+
+// Get returns a single result or ErrNotFound
+func (r *MemoryRepository) Get(id int) (*ThreeDResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result, ok := r.results[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &result, nil
+}
+
+// Create stores a result, rejecting duplicate dates
+func (r *MemoryRepository) Create(date, result string) (*ThreeDResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.results {
+		if existing.Date == date {
+			return nil, ErrDuplicate
+		}
+	}
+
+	now := time.Now()
+	created := ThreeDResult{ID: r.nextID, Date: date, Result: result, CreatedAt: now, UpdatedAt: now}
+	r.results[created.ID] = created
+	r.nextID++
+	return &created, nil
+}
+
+// Update changes the result of an existing entry
+func (r *MemoryRepository) Update(id int, result string) (*ThreeDResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.results[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	existing.Result = result
+	existing.UpdatedAt = time.Now()
+	r.results[id] = existing
+	return &existing, nil
+}
+
+// Delete removes a result
+func (r *MemoryRepository) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.results[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.results, id)
+	return nil
+}
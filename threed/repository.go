@@ -0,0 +1,147 @@
+package threed
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a result doesn't exist
+	ErrNotFound = errors.New("3D result not found")
+	// ErrDuplicate is returned when a result for the date already exists
+	ErrDuplicate = errors.New("3D result for this date already exists")
+)
+
+// ThreeDRepository stores 3D results
+type ThreeDRepository interface {
+	// List returns every result, newest date first
+	List() ([]ThreeDResult, error)
+	// Get returns a single result or ErrNotFound
+	Get(id int) (*ThreeDResult, error)
+	// Create stores a result for a YYYY-MM-DD date
+	Create(date, result string) (*ThreeDResult, error)
+	// Update changes the result of an existing entry
+	Update(id int, result string) (*ThreeDResult, error)
+	Delete(id int) error
+}
+
+// SQLRepository is a ThreeDRepository backed by the threed table
+type SQLRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository creates the threed table if needed
+func NewSQLRepository(db *sql.DB) *SQLRepository {
+	r := &SQLRepository{db: db}
+	r.createTable()
+	return r
+}
+
+// createTable creates the threed table if it doesn't exist
+func (r *SQLRepository) createTable() {
+	query := `
+		CREATE TABLE IF NOT EXISTS threed (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			date DATE NOT NULL UNIQUE,
+			result TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_threed_date ON threed(date DESC);
+	`
+	_, err := r.db.Exec(query)
+	if err != nil {
+		slog.Error("failed to create threed table", "error", err)
+	}
+}
+
+// scanResult reads a row and formats the date as YYYY-MM-DD
+func scanResult(row interface{ Scan(...interface{}) error }) (*ThreeDResult, error) {
+	var result ThreeDResult
+	var date time.Time
+	if err := row.Scan(&result.ID, &date, &result.Result, &result.CreatedAt, &result.UpdatedAt); err != nil {
+		return nil, err
+	}
+	result.Date = date.Format("2006-01-02")
+	return &result, nil
+}
+
+// List fetches all 3D results ordered by date DESC
+func (r *SQLRepository) List() ([]ThreeDResult, error) {
+	rows, err := r.db.Query(`
+		SELECT id, date, result, created_at, updated_at 
+		FROM threed 
+		ORDER BY date DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []ThreeDResult
+	for rows.Next() {
+		result, err := scanResult(rows)
+		if err != nil {
+			slog.Warn("skipping unreadable threed row", "error", err)
+			continue
+		}
+		results = append(results, *result)
+	}
+
+	return results, rows.Err()
+}
+
+// Get fetches a single 3D result
+func (r *SQLRepository) Get(id int) (*ThreeDResult, error) {
+	result, err := scanResult(r.db.QueryRow("SELECT id, date, result, created_at, updated_at FROM threed WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return result, err
+}
+
+// Create inserts a new 3D result
+func (r *SQLRepository) Create(date, result string) (*ThreeDResult, error) {
+	query := `
+		INSERT INTO threed (date, result, created_at, updated_at) 
+		VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING id, date, result, created_at, updated_at
+	`
+	created, err := scanResult(r.db.QueryRow(query, date, result))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDuplicate, err)
+	}
+	return created, nil
+}
+
+// Update changes the result of an existing 3D entry
+func (r *SQLRepository) Update(id int, result string) (*ThreeDResult, error) {
+	query := `
+		UPDATE threed 
+		SET result = $1, updated_at = CURRENT_TIMESTAMP 
+		WHERE id = $2
+		RETURNING id, date, result, created_at, updated_at
+	`
+	updated, err := scanResult(r.db.QueryRow(query, result, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return updated, err
+}
+
+// Delete removes a 3D result
+func (r *SQLRepository) Delete(id int) error {
+	result, err := r.db.Exec("DELETE FROM threed WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
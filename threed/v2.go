@@ -0,0 +1,128 @@
+package threed
+
+import (
+	"errors"
+	"net/http"
+	"thaimaster2d/api"
+	"thaimaster2d/events"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListV2 handles GET /api/v2/threed with pagination
+func (h *Handler) ListV2(c *gin.Context) {
+	page, ok := api.ParsePage(c)
+	if !ok {
+		return
+	}
+
+	results, err := h.repo.List()
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to fetch results")
+		return
+	}
+
+	api.Paginate(c, results, page)
+}
+
+// validResult reports whether result is a three digit number
+func validResult(result string) bool {
+	if len(result) != 3 {
+		return false
+	}
+	for _, r := range result {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateV2 handles POST /api/v2/threed
+func (h *Handler) CreateV2(c *gin.Context) {
+	var input struct {
+		Date   string `json:"date"`
+		Result string `json:"result"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+	if _, err := time.Parse("2006-01-02", input.Date); err != nil {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "date must be YYYY-MM-DD")
+		return
+	}
+	if !validResult(input.Result) {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "result must be 3 digits")
+		return
+	}
+
+	result, err := h.repo.Create(input.Date, input.Result)
+	if err != nil {
+		c.Error(err)
+		if errors.Is(err, ErrDuplicate) {
+			api.Error(c, http.StatusConflict, api.CodeConflict, "A result for this date already exists")
+		} else {
+			api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to create result")
+		}
+		return
+	}
+
+	events.Publish(c.Request.Context(), events.ThreeDCreated, result)
+	api.OK(c, http.StatusCreated, result)
+}
+
+// UpdateV2 handles PUT /api/v2/threed/:id
+func (h *Handler) UpdateV2(c *gin.Context) {
+	id, ok := api.ParamID(c, "id")
+	if !ok {
+		return
+	}
+	var input struct {
+		Result string `json:"result"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+	if !validResult(input.Result) {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "result must be 3 digits")
+		return
+	}
+
+	result, err := h.repo.Update(id, input.Result)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			api.Error(c, http.StatusNotFound, api.CodeNotFound, "Result not found")
+		} else {
+			c.Error(err)
+			api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to update result")
+		}
+		return
+	}
+
+	events.Publish(c.Request.Context(), events.ThreeDUpdated, result)
+	api.OK(c, http.StatusOK, result)
+}
+
+// DeleteV2 handles DELETE /api/v2/threed/:id
+func (h *Handler) DeleteV2(c *gin.Context) {
+	id, ok := api.ParamID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.repo.Delete(id); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			api.Error(c, http.StatusNotFound, api.CodeNotFound, "Result not found")
+		} else {
+			c.Error(err)
+			api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to delete result")
+		}
+		return
+	}
+
+	api.OK(c, http.StatusOK, gin.H{"id": id, "deleted": true})
+}
@@ -1,15 +1,29 @@
 package twodhistory
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"thaimaster2d/events"
+	"thaimaster2d/metrics"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
+// driverName is go-sqlite3 instrumented with query latency metrics
+const driverName = "sqlite3_instrumented"
+
+var historyInserts = metrics.NewCounter("twodhistory_inserts_total",
+	"History insert attempts, by result (inserted, exists or error)", "result")
+
+func init() {
+	sql.Register(driverName, metrics.InstrumentDriver(&sqlite3.SQLiteDriver{}))
+}
+
 // TwoDHistory represents a single lottery history record
 type TwoDHistory struct {
 	ID          int       `json:"id,omitempty" db:"id"`
@@ -27,8 +41,6 @@ type TwoDHistory struct {
 	CreatedAt   time.Time `json:"created_at,omitempty" db:"created_at"`
 }
 
-var db *sql.DB
-
 // LotteryData represents incoming lottery data (to avoid circular dependency)
 type LotteryData struct {
 	Date        string `json:"date"`
@@ -47,107 +59,86 @@ type LotteryData struct {
 	UpdateTime  string `json:"updatetime"`
 }
 
-// InitDB initializes the database connection
-func InitDB(dbPath string) error {
-	var err error
-
-	log.Printf("📂 Opening database file: %s", dbPath)
+// OpenDB opens the SQLite database, creating the file if it doesn't exist
+func OpenDB(dbPath string) (*sql.DB, error) {
+	slog.Info("opening database", "path", dbPath)
 
-	// Open SQLite database (will create file if it doesn't exist)
-	db, err = sql.Open("sqlite3", dbPath)
+	db, err := sql.Open(driverName, dbPath)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Test connection
 	if err = db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
-	}
-
-	// Create table if not exists
-	if err = createTable(); err != nil {
-		return fmt.Errorf("failed to create table: %w", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("✅ Database connected and table created successfully")
-	return nil
+	slog.Info("database connected")
+	return db, nil
 }
 
-// createTable creates the twodhistory table if it doesn't exist
-func createTable() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS twodhistory (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		date TEXT NOT NULL UNIQUE,
-		set1200 TEXT,
-		value1200 TEXT,
-		result1200 TEXT,
-		set430 TEXT,
-		value430 TEXT,
-		result430 TEXT,
-		modern930 TEXT,
-		internet930 TEXT,
-		modern200 TEXT,
-		internet200 TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-	CREATE INDEX IF NOT EXISTS idx_twodhistory_date ON twodhistory(date DESC);
-	`
+// Handler serves the history API and records new results
+type Handler struct {
+	repo HistoryRepository
+}
 
-	_, err := db.Exec(query)
-	return err
+// NewHandler creates a history handler backed by repo
+func NewHandler(repo HistoryRepository) *Handler {
+	return &Handler{repo: repo}
 }
 
-// InsertHistory inserts a new history record if the date doesn't exist
-func InsertHistory(history *TwoDHistory) error {
+// InsertHistory inserts a new history record if the date doesn't exist.
+// It reports whether a record was inserted.
+func (h *Handler) InsertHistory(ctx context.Context, history *TwoDHistory) (bool, error) {
 	// Check if date already exists
-	exists, err := DateExists(history.Date)
+	exists, err := h.repo.Exists(history.Date)
 	if err != nil {
-		return err
+		historyInserts.Inc("error")
+		return false, err
 	}
 
 	if exists {
-		log.Printf("⚠️  History for date %s already exists, skipping insert", history.Date)
-		return nil
+		historyInserts.Inc("exists")
+		slog.InfoContext(ctx, "history already exists, skipping insert", "date", history.Date)
+		return false, nil
 	}
 
-	query := `
-	INSERT INTO twodhistory (
-		date, set1200, value1200, result1200,
-		set430, value430, result430,
-		modern930, internet930, modern200, internet200
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-	`
-
-	_, err = db.Exec(query,
-		history.Date,
-		history.Set1200,
-		history.Value1200,
-		history.Result1200,
-		history.Set430,
-		history.Value430,
-		history.Result430,
-		history.Modern930,
-		history.Internet930,
-		history.Modern200,
-		history.Internet200,
-	)
-
-	if err != nil {
-		return fmt.Errorf("failed to insert history: %w", err)
+	if err := h.repo.Insert(history); err != nil {
+		historyInserts.Inc("error")
+		return false, err
 	}
 
-	log.Printf("✅ Inserted history for date: %s", history.Date)
-	return nil
+	historyInserts.Inc("inserted")
+	slog.InfoContext(ctx, "history inserted", "date", history.Date)
+	return true, nil
 }
 
 // InsertFromLotteryData inserts history from LotteryData struct
-func InsertFromLotteryData(data *LotteryData) error {
-	if db == nil {
-		return fmt.Errorf("database not initialized")
+func (h *Handler) InsertFromLotteryData(ctx context.Context, data *LotteryData) error {
+	_, err := h.InsertHistory(ctx, fromLotteryData(data))
+	return err
+}
+
+// CorrectFromLotteryData updates the saved history of data.Date with its
+// corrected results and publishes history.corrected. It does nothing if the
+// day isn't saved yet.
+func (h *Handler) CorrectFromLotteryData(ctx context.Context, data *LotteryData) error {
+	updated, err := h.repo.Update(fromLotteryData(data))
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
 	}
+	slog.InfoContext(ctx, "history corrected", "date", updated.Date)
+	events.Publish(ctx, events.HistoryCorrected, updated)
+	return nil
+}
 
-	history := &TwoDHistory{
+// fromLotteryData returns the history record of live data
+func fromLotteryData(data *LotteryData) *TwoDHistory {
+	return &TwoDHistory{
 		Date:        data.Date,
 		Set1200:     data.Set1200,
 		Value1200:   data.Value1200,
@@ -160,61 +151,13 @@ func InsertFromLotteryData(data *LotteryData) error {
 		Modern200:   data.Modern200,
 		Internet200: data.Internet200,
 	}
-
-	return InsertHistory(history)
-}
-
-// DateExists checks if a history record for the given date already exists
-func DateExists(date string) (bool, error) {
-	var count int
-	query := "SELECT COUNT(*) FROM twodhistory WHERE date = $1"
-	err := db.QueryRow(query, date).Scan(&count)
-	if err != nil {
-		return false, fmt.Errorf("failed to check date existence: %w", err)
-	}
-	return count > 0, nil
 }
 
-// GetAllHistory retrieves all history records ordered by date DESC
-func GetAllHistory() ([]TwoDHistory, error) {
-	query := `
-	SELECT id, date, set1200, value1200, result1200,
-	       set430, value430, result430,
-	       modern930, internet930, modern200, internet200,
-	       created_at
-	FROM twodhistory
-	ORDER BY date DESC
-	`
-
-	rows, err := db.Query(query)
+// GetHistory is the Gin handler for GET /api/twodhistory
+func (h *Handler) GetHistory(c *gin.Context) {
+	histories, err := h.repo.List()
 	if err != nil {
-		return nil, fmt.Errorf("failed to query history: %w", err)
-	}
-	defer rows.Close()
-
-	var histories []TwoDHistory
-	for rows.Next() {
-		var h TwoDHistory
-		err := rows.Scan(
-			&h.ID, &h.Date, &h.Set1200, &h.Value1200, &h.Result1200,
-			&h.Set430, &h.Value430, &h.Result430,
-			&h.Modern930, &h.Internet930, &h.Modern200, &h.Internet200,
-			&h.CreatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
-		}
-		histories = append(histories, h)
-	}
-
-	return histories, nil
-}
-
-// GetHistoryHandler is the Gin handler for GET /api/twodhistory
-func GetHistoryHandler(c *gin.Context) {
-	histories, err := GetAllHistory()
-	if err != nil {
-		log.Printf("❌ Error fetching history: %v", err)
+		c.Error(err)
 		c.JSON(500, gin.H{"error": "Failed to fetch history"})
 		return
 	}
@@ -222,20 +165,19 @@ func GetHistoryHandler(c *gin.Context) {
 	c.JSON(200, histories)
 }
 
-// CheckAndInsertHandler is the Gin handler for POST /api/twodhistory/check
+// CheckAndInsert is the Gin handler for POST /api/twodhistory/check
 // It checks if the date exists and inserts if not
-func CheckAndInsertHandler(c *gin.Context) {
+func (h *Handler) CheckAndInsert(c *gin.Context) {
 	var history TwoDHistory
 
 	if err := c.BindJSON(&history); err != nil {
-		log.Printf("❌ Error binding JSON: %v", err)
 		c.JSON(400, gin.H{"error": "Invalid request body"})
 		return
 	}
 
 	// Insert history (will skip if date already exists)
-	if err := InsertHistory(&history); err != nil {
-		log.Printf("❌ Error inserting history: %v", err)
+	if _, err := h.InsertHistory(c.Request.Context(), &history); err != nil {
+		c.Error(err)
 		c.JSON(500, gin.H{"error": "Failed to insert history"})
 		return
 	}
@@ -246,16 +188,3 @@ func CheckAndInsertHandler(c *gin.Context) {
 		"date":    history.Date,
 	})
 }
-
-// CloseDB closes the database connection
-func CloseDB() {
-	if db != nil {
-		db.Close()
-		log.Println("Database connection closed")
-	}
-}
-
-// GetDB returns the database connection
-func GetDB() *sql.DB {
-	return db
-}
@@ -0,0 +1,84 @@
+package twodhistory
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryRepository is an in-memory HistoryRepository for tests
+type MemoryRepository struct {
+	mu      sync.Mutex
+	records []TwoDHistory
+}
+
+// NewMemoryRepository returns an empty in-memory repository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{}
+}
+
+// List returns every record, newest date first
+func (r *MemoryRepository) List() ([]TwoDHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	histories := append([]TwoDHistory(nil), r.records...)
+	sort.Slice(histories, func(i, j int) bool { return histories[i].Date > histories[j].Date })
+	return histories, nil
+}
+
+// ListPage returns one page of records, newest date first
+func (r *MemoryRepository) ListPage(limit, offset int) ([]TwoDHistory, int, error) {
+	histories, _ := r.List()
+	start := min(offset, len(histories))
+	end := min(start+limit, len(histories))
+	return histories[start:end], len(histories), nil
+}
+
+// Exists reports whether a record for the date exists
+func (r *MemoryRepository) Exists(date string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, h := range r.records {
+		if h.Date == date {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Insert stores a record, enforcing the unique date like the SQL table
+func (r *MemoryRepository) Insert(history *TwoDHistory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, h := range r.records {
+		if h.Date == history.Date {
+			return fmt.Errorf("failed to insert history: date %s already exists", history.Date)
+		}
+	}
+
+	record := *history
+	record.ID = len(r.records) + 1
+	record.CreatedAt = time.Now()
+	r.records = append(r.records, record)
+	return nil
+}
+
+// Update replaces the results of the record for history.Date
+func (r *MemoryRepository) Update(history *TwoDHistory) (*TwoDHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, h := range r.records {
+		if h.Date == history.Date {
+			record := *history
+			record.ID, record.CreatedAt = h.ID, h.CreatedAt
+			r.records[i] = record
+			return &record, nil
+		}
+	}
+	return nil, ErrNotFound
+}
@@ -0,0 +1,194 @@
+package twodhistory
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when no record exists for a date
+var ErrNotFound = errors.New("history record not found")
+
+// HistoryRepository stores daily 2D results
+type HistoryRepository interface {
+	// List returns every record, newest date first
+	List() ([]TwoDHistory, error)
+	// ListPage returns up to limit records after offset, newest date first,
+	// and the total number of records
+	ListPage(limit, offset int) ([]TwoDHistory, int, error)
+	// Exists reports whether a record for the date exists
+	Exists(date string) (bool, error)
+	// Insert stores a new record
+	Insert(history *TwoDHistory) error
+	// Update replaces the results of the record for history.Date, or
+	// returns ErrNotFound
+	Update(history *TwoDHistory) (*TwoDHistory, error)
+}
+
+// SQLRepository is a HistoryRepository backed by the twodhistory table
+type SQLRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository creates the twodhistory table if needed
+func NewSQLRepository(db *sql.DB) (*SQLRepository, error) {
+	r := &SQLRepository{db: db}
+	if err := r.createTable(); err != nil {
+		return nil, fmt.Errorf("failed to create table: %w", err)
+	}
+	return r, nil
+}
+
+// createTable creates the twodhistory table if it doesn't exist
+func (r *SQLRepository) createTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS twodhistory (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		date TEXT NOT NULL UNIQUE,
+		set1200 TEXT,
+		value1200 TEXT,
+		result1200 TEXT,
+		set430 TEXT,
+		value430 TEXT,
+		result430 TEXT,
+		modern930 TEXT,
+		internet930 TEXT,
+		modern200 TEXT,
+		internet200 TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_twodhistory_date ON twodhistory(date DESC);
+	`
+
+	_, err := r.db.Exec(query)
+	return err
+}
+
+// Insert inserts a new history record
+func (r *SQLRepository) Insert(history *TwoDHistory) error {
+	query := `
+	INSERT INTO twodhistory (
+		date, set1200, value1200, result1200,
+		set430, value430, result430,
+		modern930, internet930, modern200, internet200
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+
+	_, err := r.db.Exec(query,
+		history.Date,
+		history.Set1200,
+		history.Value1200,
+		history.Result1200,
+		history.Set430,
+		history.Value430,
+		history.Result430,
+		history.Modern930,
+		history.Internet930,
+		history.Modern200,
+		history.Internet200,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert history: %w", err)
+	}
+	return nil
+}
+
+// Exists checks if a history record for the given date already exists
+func (r *SQLRepository) Exists(date string) (bool, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM twodhistory WHERE date = $1"
+	err := r.db.QueryRow(query, date).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check date existence: %w", err)
+	}
+	return count > 0, nil
+}
+
+// Update corrects the results of an existing history record
+func (r *SQLRepository) Update(history *TwoDHistory) (*TwoDHistory, error) {
+	query := `
+	UPDATE twodhistory SET
+		set1200 = $1, value1200 = $2, result1200 = $3,
+		set430 = $4, value430 = $5, result430 = $6,
+		modern930 = $7, internet930 = $8, modern200 = $9, internet200 = $10
+	WHERE date = $11
+	RETURNING id, date, set1200, value1200, result1200,
+	          set430, value430, result430,
+	          modern930, internet930, modern200, internet200,
+	          created_at
+	`
+
+	updated, err := r.query(query,
+		history.Set1200,
+		history.Value1200,
+		history.Result1200,
+		history.Set430,
+		history.Value430,
+		history.Result430,
+		history.Modern930,
+		history.Internet930,
+		history.Modern200,
+		history.Internet200,
+		history.Date,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update history: %w", err)
+	}
+	if len(updated) == 0 {
+		return nil, ErrNotFound
+	}
+	return &updated[0], nil
+}
+
+const selectHistory = `
+	SELECT id, date, set1200, value1200, result1200,
+	       set430, value430, result430,
+	       modern930, internet930, modern200, internet200,
+	       created_at
+	FROM twodhistory
+	ORDER BY date DESC
+	`
+
+// List retrieves all history records ordered by date DESC
+func (r *SQLRepository) List() ([]TwoDHistory, error) {
+	return r.query(selectHistory)
+}
+
+// ListPage retrieves one page of history records ordered by date DESC
+func (r *SQLRepository) ListPage(limit, offset int) ([]TwoDHistory, int, error) {
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM twodhistory").Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count history: %w", err)
+	}
+
+	histories, err := r.query(selectHistory+"LIMIT $1 OFFSET $2", limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return histories, total, nil
+}
+
+func (r *SQLRepository) query(query string, args ...any) ([]TwoDHistory, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	var histories []TwoDHistory
+	for rows.Next() {
+		var h TwoDHistory
+		err := rows.Scan(
+			&h.ID, &h.Date, &h.Set1200, &h.Value1200, &h.Result1200,
+			&h.Set430, &h.Value430, &h.Result430,
+			&h.Modern930, &h.Internet930, &h.Modern200, &h.Internet200,
+			&h.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		histories = append(histories, h)
+	}
+
+	return histories, rows.Err()
+}
@@ -0,0 +1,85 @@
+package twodhistory
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"thaimaster2d/api"
+	"thaimaster2d/events"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListV2 handles GET /api/v2/history with pagination
+func (h *Handler) ListV2(c *gin.Context) {
+	page, ok := api.ParsePage(c)
+	if !ok {
+		return
+	}
+
+	histories, total, err := h.repo.ListPage(page.PerPage, page.Offset())
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to fetch history")
+		return
+	}
+
+	api.List(c, histories, page, total)
+}
+
+// CreateV2 handles POST /api/v2/history. Existing dates are left unchanged
+// and reported with inserted=false.
+func (h *Handler) CreateV2(c *gin.Context) {
+	var history TwoDHistory
+	if err := c.ShouldBindJSON(&history); err != nil {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if _, err := time.Parse("2006-01-02", history.Date); err != nil {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "date must be YYYY-MM-DD")
+		return
+	}
+
+	inserted, err := h.InsertHistory(c.Request.Context(), &history)
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to insert history")
+		return
+	}
+
+	status := http.StatusOK
+	if inserted {
+		status = http.StatusCreated
+	}
+	api.OK(c, status, gin.H{"date": history.Date, "inserted": inserted})
+}
+
+// UpdateV2 handles PUT /api/v2/history/:date, correcting a published day
+func (h *Handler) UpdateV2(c *gin.Context) {
+	var history TwoDHistory
+	if err := c.ShouldBindJSON(&history); err != nil {
+		api.Error(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	history.Date = c.Param("date")
+	if _, err := time.Parse("2006-01-02", history.Date); err != nil {
+		api.Error(c, http.StatusUnprocessableEntity, api.CodeValidation, "date must be YYYY-MM-DD")
+		return
+	}
+
+	updated, err := h.repo.Update(&history)
+	if errors.Is(err, ErrNotFound) {
+		api.Error(c, http.StatusNotFound, api.CodeNotFound, "No history for this date")
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		api.Error(c, http.StatusInternalServerError, api.CodeInternal, "Failed to update history")
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "history corrected", "date", updated.Date)
+	events.Publish(c.Request.Context(), events.HistoryCorrected, updated)
+	api.OK(c, http.StatusOK, updated)
+}
@@ -0,0 +1,234 @@
+package webhook
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when an endpoint doesn't exist
+var ErrNotFound = errors.New("webhook endpoint not found")
+
+// Repository stores endpoints and their deliveries
+type Repository interface {
+	ListEndpoints() ([]Endpoint, error)
+	// GetEndpoint returns an endpoint or ErrNotFound
+	GetEndpoint(id int) (*Endpoint, error)
+	CreateEndpoint(e *Endpoint) (*Endpoint, error)
+	UpdateEndpoint(e *Endpoint) (*Endpoint, error)
+	// DeleteEndpoint removes an endpoint and its delivery log
+	DeleteEndpoint(id int) error
+	CreateDelivery(d *Delivery) (*Delivery, error)
+	// DueDeliveries returns up to limit pending deliveries whose next
+	// attempt is due, oldest first
+	DueDeliveries(now time.Time, limit int) ([]Delivery, error)
+	// UpdateDelivery records the outcome of an attempt
+	UpdateDelivery(d *Delivery) error
+	// ListDeliveries returns the latest deliveries, to one endpoint if
+	// endpointID is not 0
+	ListDeliveries(endpointID, limit int) ([]Delivery, error)
+}
+
+// SQLRepository is a Repository backed by the webhook_endpoints and
+// webhook_deliveries tables
+type SQLRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository creates the webhook tables if needed
+func NewSQLRepository(db *sql.DB) *SQLRepository {
+	r := &SQLRepository{db: db}
+	r.createTables()
+	return r
+}
+
+func (r *SQLRepository) createTables() {
+	query := `
+		CREATE TABLE IF NOT EXISTS webhook_endpoints (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			url TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			secret TEXT NOT NULL,
+			events TEXT NOT NULL DEFAULT '',
+			active BOOLEAN NOT NULL DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			endpoint_id INTEGER NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+			event_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			response_status INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			next_attempt DATETIME NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint ON webhook_deliveries(endpoint_id, id DESC);
+	`
+	if _, err := r.db.Exec(query); err != nil {
+		slog.Error("failed to create webhook tables", "error", err)
+	}
+}
+
+const selectEndpoint = `SELECT id, url, description, secret, events, active, created_at, updated_at FROM webhook_endpoints`
+
+func scanEndpoint(row interface{ Scan(...any) error }) (*Endpoint, error) {
+	var e Endpoint
+	var events string
+	if err := row.Scan(&e.ID, &e.URL, &e.Description, &e.Secret, &events, &e.Active, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if events != "" {
+		e.Events = strings.Split(events, ",")
+	}
+	return &e, nil
+}
+
+// ListEndpoints returns every endpoint in creation order
+func (r *SQLRepository) ListEndpoints() ([]Endpoint, error) {
+	rows, err := r.db.Query(selectEndpoint + " ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endpoints []Endpoint
+	for rows.Next() {
+		e, err := scanEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, *e)
+	}
+	return endpoints, rows.Err()
+}
+
+// GetEndpoint fetches one endpoint
+func (r *SQLRepository) GetEndpoint(id int) (*Endpoint, error) {
+	e, err := scanEndpoint(r.db.QueryRow(selectEndpoint+" WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return e, err
+}
+
+// CreateEndpoint inserts an endpoint
+func (r *SQLRepository) CreateEndpoint(e *Endpoint) (*Endpoint, error) {
+	query := `
+		INSERT INTO webhook_endpoints (url, description, secret, events, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, url, description, secret, events, active, created_at, updated_at
+	`
+	return scanEndpoint(r.db.QueryRow(query, e.URL, e.Description, e.Secret, strings.Join(e.Events, ","), e.Active))
+}
+
+// UpdateEndpoint changes an endpoint
+func (r *SQLRepository) UpdateEndpoint(e *Endpoint) (*Endpoint, error) {
+	query := `
+		UPDATE webhook_endpoints
+		SET url = $1, description = $2, secret = $3, events = $4, active = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6
+		RETURNING id, url, description, secret, events, active, created_at, updated_at
+	`
+	updated, err := scanEndpoint(r.db.QueryRow(query, e.URL, e.Description, e.Secret, strings.Join(e.Events, ","), e.Active, e.ID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return updated, err
+}
+
+// DeleteEndpoint removes an endpoint and its deliveries
+func (r *SQLRepository) DeleteEndpoint(id int) error {
+	if _, err := r.db.Exec("DELETE FROM webhook_deliveries WHERE endpoint_id = $1", id); err != nil {
+		return err
+	}
+	result, err := r.db.Exec("DELETE FROM webhook_endpoints WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const selectDelivery = `
+	SELECT d.id, d.endpoint_id, e.url, e.secret, d.event_id, d.event_type, d.payload,
+	       d.status, d.attempts, d.response_status, d.error, d.next_attempt, d.created_at, d.updated_at
+	FROM webhook_deliveries d
+	JOIN webhook_endpoints e ON e.id = d.endpoint_id
+`
+
+func (r *SQLRepository) queryDeliveries(query string, args ...any) ([]Delivery, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	for rows.Next() {
+		var d Delivery
+		err := rows.Scan(&d.ID, &d.EndpointID, &d.EndpointURL, &d.secret, &d.EventID, &d.EventType, &d.Payload,
+			&d.Status, &d.Attempts, &d.ResponseStatus, &d.Error, &d.NextAttempt, &d.CreatedAt, &d.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// CreateDelivery queues a delivery
+func (r *SQLRepository) CreateDelivery(d *Delivery) (*Delivery, error) {
+	var id int
+	err := r.db.QueryRow(`
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload, status, next_attempt)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, d.EndpointID, d.EventID, d.EventType, d.Payload, d.Status, d.NextAttempt.UTC()).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	created, err := r.queryDeliveries(selectDelivery+" WHERE d.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	return &created[0], nil
+}
+
+// DueDeliveries returns pending deliveries whose next attempt has come
+func (r *SQLRepository) DueDeliveries(now time.Time, limit int) ([]Delivery, error) {
+	return r.queryDeliveries(selectDelivery+`
+		WHERE d.status = $1 AND d.next_attempt <= $2
+		ORDER BY d.next_attempt, d.id
+		LIMIT $3
+	`, StatusPending, now.UTC(), limit)
+}
+
+// UpdateDelivery stores the outcome of an attempt
+func (r *SQLRepository) UpdateDelivery(d *Delivery) error {
+	_, err := r.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, response_status = $3, error = $4, next_attempt = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6
+	`, d.Status, d.Attempts, d.ResponseStatus, d.Error, d.NextAttempt.UTC(), d.ID)
+	return err
+}
+
+// ListDeliveries returns the newest deliveries first
+func (r *SQLRepository) ListDeliveries(endpointID, limit int) ([]Delivery, error) {
+	if endpointID != 0 {
+		return r.queryDeliveries(selectDelivery+" WHERE d.endpoint_id = $1 ORDER BY d.id DESC LIMIT $2", endpointID, limit)
+	}
+	return r.queryDeliveries(selectDelivery+" ORDER BY d.id DESC LIMIT $1", limit)
+}
@@ -0,0 +1,307 @@
+// Package webhook delivers events to partner endpoints as signed HTTP
+// callbacks, retrying failed deliveries with exponential backoff.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"thaimaster2d/events"
+	"thaimaster2d/metrics"
+	"time"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderID        = "X-Webhook-ID"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	// HeaderSignature is "sha256=" and the hex HMAC-SHA256 of the
+	// timestamp, a dot and the body, keyed with the endpoint secret
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+var deliveries = metrics.NewCounter("webhook_deliveries_total",
+	"Webhook delivery attempts by result (succeeded, retry or failed)", "result")
+
+// Endpoint is a URL subscribed to some event types
+type Endpoint struct {
+	ID          int
+	URL         string
+	Description string
+	Secret      string
+	Events      []string
+	Active      bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Subscribed reports whether the endpoint wants events of type typ
+func (e Endpoint) Subscribed(typ string) bool {
+	return slices.Contains(e.Events, typ)
+}
+
+// Delivery is one event queued for one endpoint
+type Delivery struct {
+	ID          int
+	EndpointID  int
+	EndpointURL string
+	EventID     string
+	EventType   string
+	Payload     string
+	Status      string
+	Attempts    int
+	// ResponseStatus is the HTTP status of the last attempt, 0 if there was
+	// no response
+	ResponseStatus int
+	Error          string
+	NextAttempt    time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+
+	secret string
+}
+
+// Options configures the dispatcher
+type Options struct {
+	// MaxAttempts is how many times a delivery is tried before it fails
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled for each one after
+	Backoff time.Duration
+	// Timeout bounds each attempt
+	Timeout time.Duration
+	// PollInterval is how often due retries are looked for
+	PollInterval time.Duration
+}
+
+// Dispatcher queues events for the subscribed endpoints and delivers them
+type Dispatcher struct {
+	repo   Repository
+	opts   Options
+	client *http.Client
+	wake   chan struct{}
+}
+
+// NewDispatcher returns a dispatcher storing deliveries in repo
+func NewDispatcher(repo Repository, opts Options) *Dispatcher {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 8
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 30 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 5 * time.Second
+	}
+	return &Dispatcher{
+		repo:   repo,
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Repository returns the store of endpoints and deliveries
+func (d *Dispatcher) Repository() Repository {
+	return d.repo
+}
+
+// NewSecret returns a random signing secret
+func NewSecret() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// Sign returns the signature header value for a body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Handle is an events.Handler queuing the event for every active endpoint
+// subscribed to its type
+func (d *Dispatcher) Handle(ctx context.Context, e events.Event) {
+	endpoints, err := d.repo.ListEndpoints()
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list webhook endpoints", "error", err)
+		return
+	}
+	queued := false
+	for _, endpoint := range endpoints {
+		if !endpoint.Active || !endpoint.Subscribed(e.Type) {
+			continue
+		}
+		if _, err := d.enqueue(endpoint.ID, e); err != nil {
+			slog.ErrorContext(ctx, "failed to queue webhook delivery", "endpoint_id", endpoint.ID, "event", e.Type, "error", err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		d.notify()
+	}
+}
+
+// SendTest queues a test event for an endpoint, whatever its subscriptions
+func (d *Dispatcher) SendTest(ctx context.Context, endpointID int) (*Delivery, error) {
+	if _, err := d.repo.GetEndpoint(endpointID); err != nil {
+		return nil, err
+	}
+	delivery, err := d.enqueue(endpointID, events.New(events.Test, map[string]string{
+		"message": "This is a test event from ThaiMaster2D",
+	}))
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "webhook test event queued", "endpoint_id", endpointID, "delivery_id", delivery.ID)
+	d.notify()
+	return delivery, nil
+}
+
+func (d *Dispatcher) enqueue(endpointID int, e events.Event) (*Delivery, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return d.repo.CreateDelivery(&Delivery{
+		EndpointID:  endpointID,
+		EventID:     e.ID,
+		EventType:   e.Type,
+		Payload:     string(payload),
+		Status:      StatusPending,
+		NextAttempt: time.Now(),
+	})
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start delivers queued events until ctx is cancelled. The returned channel
+// is closed once it has stopped.
+func (d *Dispatcher) Start(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(d.opts.PollInterval)
+		defer ticker.Stop()
+		for {
+			d.deliverDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+	slog.Info("webhook dispatcher started", "max_attempts", d.opts.MaxAttempts, "backoff", d.opts.Backoff.String())
+	return done
+}
+
+// deliverDue attempts every delivery whose time has come. It stops at the
+// first outcome it can't record, as the same deliveries would come back due
+// again, and leaves them to the next poll.
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		due, err := d.repo.DueDeliveries(time.Now(), 20)
+		if err != nil {
+			slog.Error("failed to load due webhook deliveries", "error", err)
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+		for i := range due {
+			if err := d.attempt(ctx, &due[i]); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// attempt POSTs a delivery and records the outcome, scheduling a retry
+// after a failure until MaxAttempts is reached. It returns the error of
+// recording the outcome.
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery) error {
+	delivery.Attempts++
+	delivery.ResponseStatus, delivery.Error = 0, ""
+	status, err := d.post(ctx, delivery)
+	delivery.ResponseStatus = status
+	logger := slog.With("delivery_id", delivery.ID, "endpoint_id", delivery.EndpointID,
+		"event", delivery.EventType, "attempt", delivery.Attempts)
+
+	switch {
+	case err == nil:
+		delivery.Status = StatusSucceeded
+		deliveries.Inc("succeeded")
+		logger.Info("webhook delivered", "status", status)
+	case delivery.Attempts >= d.opts.MaxAttempts:
+		delivery.Status, delivery.Error = StatusFailed, err.Error()
+		deliveries.Inc("failed")
+		logger.Error("webhook delivery failed, giving up", "error", err)
+	default:
+		delivery.Error = err.Error()
+		delivery.NextAttempt = time.Now().Add(d.opts.Backoff << (delivery.Attempts - 1))
+		deliveries.Inc("retry")
+		logger.Warn("webhook delivery failed, will retry", "error", err, "next_attempt", delivery.NextAttempt)
+	}
+	if err := d.repo.UpdateDelivery(delivery); err != nil {
+		logger.Error("failed to record webhook delivery", "error", err)
+		return err
+	}
+	return nil
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery *Delivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.EndpointURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ThaiMaster2D-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderID, delivery.EventID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,162 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"thaimaster2d/events"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDispatcher returns a dispatcher with one endpoint for an
+// httptest.Server replying with handler
+func newTestDispatcher(t *testing.T, opts Options, handler http.HandlerFunc) (*Dispatcher, *SQLRepository, *sql.DB, *Endpoint) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	repo := NewSQLRepository(db)
+	endpoint, err := repo.CreateEndpoint(&Endpoint{URL: srv.URL, Secret: "whsec_test", Events: []string{events.ThreeDCreated}, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDispatcher(repo, opts), repo, db, endpoint
+}
+
+// delivery returns the only delivery
+func delivery(t *testing.T, repo Repository) Delivery {
+	t.Helper()
+	list, err := repo.ListDeliveries(0, 10)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("ListDeliveries = %v, %v; want one delivery", list, err)
+	}
+	return list[0]
+}
+
+func TestDeliverySigned(t *testing.T) {
+	var header http.Header
+	var body []byte
+	d, repo, _, _ := newTestDispatcher(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	})
+	ctx := context.Background()
+
+	d.Handle(ctx, events.New(events.ThreeDCreated, map[string]string{"result": "123"}))
+	// Events the endpoint isn't subscribed to are not queued
+	d.Handle(ctx, events.New(events.PaperUpdated, nil))
+	d.deliverDue(ctx)
+
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte(header.Get(HeaderTimestamp) + "." + string(body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); header.Get(HeaderSignature) != want {
+		t.Errorf("signature = %q, want %q", header.Get(HeaderSignature), want)
+	}
+	if header.Get(HeaderEvent) != events.ThreeDCreated || !strings.Contains(string(body), `"result":"123"`) {
+		t.Errorf("delivered %s with body %s", header.Get(HeaderEvent), body)
+	}
+	if got := delivery(t, repo); got.Status != StatusSucceeded || got.Attempts != 1 || got.ResponseStatus != http.StatusOK {
+		t.Errorf("delivery = %+v, want succeeded on the first attempt", got)
+	}
+}
+
+func TestDeliveryBackoffAndGivingUp(t *testing.T) {
+	var calls atomic.Int32
+	d, repo, db, _ := newTestDispatcher(t, Options{MaxAttempts: 3, Backoff: time.Hour}, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	ctx := context.Background()
+	d.Handle(ctx, events.New(events.ThreeDCreated, nil))
+
+	// Each retry waits twice as long as the one before
+	for attempt, wait := range []time.Duration{time.Hour, 2 * time.Hour} {
+		start := time.Now()
+		d.deliverDue(ctx)
+		got := delivery(t, repo)
+		if got.Status != StatusPending || got.Attempts != attempt+1 || got.ResponseStatus != http.StatusServiceUnavailable {
+			t.Fatalf("after attempt %d delivery = %+v", attempt+1, got)
+		}
+		if next := got.NextAttempt.Sub(start); next < wait || next > wait+time.Minute {
+			t.Errorf("attempt %d retries in %s, want %s", attempt+1, next, wait)
+		}
+		d.deliverDue(ctx)
+		if n := calls.Load(); n != int32(attempt+1) {
+			t.Fatalf("endpoint called %d times before the retry was due", n)
+		}
+		if _, err := db.Exec("UPDATE webhook_deliveries SET next_attempt = $1", time.Now().Add(-time.Second).UTC()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d.deliverDue(ctx)
+	got := delivery(t, repo)
+	if got.Status != StatusFailed || got.Attempts != 3 || !strings.Contains(got.Error, "503") {
+		t.Errorf("delivery after MaxAttempts = %+v, want failed", got)
+	}
+	d.deliverDue(ctx)
+	if n := calls.Load(); n != 3 {
+		t.Errorf("endpoint called %d times, want 3", n)
+	}
+}
+
+// failingRepo fails to record delivery outcomes
+type failingRepo struct {
+	Repository
+	polls atomic.Int32
+}
+
+func (r *failingRepo) DueDeliveries(now time.Time, limit int) ([]Delivery, error) {
+	r.polls.Add(1)
+	return r.Repository.DueDeliveries(now, limit)
+}
+
+func (r *failingRepo) UpdateDelivery(d *Delivery) error {
+	return errors.New("database is locked")
+}
+
+func TestDeliverDueStopsWhenUpdateFails(t *testing.T) {
+	var calls atomic.Int32
+	_, repo, _, endpoint := newTestDispatcher(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	})
+	failing := &failingRepo{Repository: repo}
+	d := NewDispatcher(failing, Options{})
+	ctx := context.Background()
+	for range 2 {
+		if _, err := d.SendTest(ctx, endpoint.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.deliverDue(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deliverDue keeps retrying deliveries it can't record")
+	}
+	if polls, n := failing.polls.Load(), calls.Load(); polls != 1 || n != 1 {
+		t.Errorf("after a failed update: %d polls and %d attempts, want 1 and 1", polls, n)
+	}
+}